@@ -15,6 +15,7 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"regexp"
@@ -26,6 +27,10 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/download"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
 )
 
 var _ = Describe("E2E - Build the airgap archive", Label("prepare-archive"), func() {
@@ -48,27 +53,17 @@ var _ = Describe("E2E - Build the airgap archive", Label("prepare-archive"), fun
 var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap-rancher"), func() {
 	It("Create the rancher-manager machine", func() {
 		By("Updating the default network configuration", func() {
-			// Don't check return code, as the default network could be already removed
-			for _, c := range []string{"net-destroy", "net-undefine"} {
-				_ = exec.Command("sudo", "virsh", c, "default").Run()
-			}
-
-			// Wait a bit between virsh commands
-			time.Sleep(30 * time.Second)
-			err := exec.Command("sudo", "virsh", "net-create", netDefaultFileName).Run()
-			Expect(err).To(Not(HaveOccurred()))
+			StartDefaultNetwork()
 		})
 
 		By("Creating the Rancher Manager VM", func() {
-			err := exec.Command("sudo", "virt-install",
-				"--name", "rancher-manager",
-				"--memory", "16384",
-				"--vcpus", "4",
-				"--disk", "path="+os.Getenv("HOME")+"/rancher-image.qcow2,bus=sata",
-				"--import",
-				"--os-variant", "opensuse-unknown",
-				"--network=default,mac=52:54:00:00:00:10",
-				"--noautoconsole").Run()
+			err := hv.Define(hypervisor.Domain{
+				Name:      "rancher-manager",
+				MAC:       "52:54:00:00:00:10",
+				Disk:      os.Getenv("HOME") + "/rancher-image.qcow2",
+				MemoryMiB: 16384,
+				VCPUs:     4,
+			})
 			Expect(err).To(Not(HaveOccurred()))
 		})
 	})
@@ -84,9 +79,12 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 		repoServer := rancherManager + ":5000"
 		userName := "root"
 
-		// For ssh access
-		client := &tools.Client{
-			Host:     "192.168.122.102:22",
+		// For ssh access, the kubeconfig is copied through SCP
+		pool := sshpool.New(userName, password)
+		defer pool.Close()
+		client := pool.Client(rancherManager, "192.168.122.102:22")
+		scpClient := &tools.Client{
+			Host:     client.Host,
 			Username: userName,
 			Password: password,
 		}
@@ -110,9 +108,15 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			_, err := client.RunSSH("mkdir -p " + optRancher)
 			Expect(err).To(Not(HaveOccurred()))
 
-			// Send the airgap archive
-			err = client.SendFile(os.Getenv("HOME")+"/"+archiveFile, destFile, "0644")
-			Expect(err).To(Not(HaveOccurred()))
+			// Send the airgap archive, each attempt resumes where the previous one stopped
+			EventuallyWith(retry.Download.WithTimeout(30*time.Minute), "transfer of "+archiveFile, func() error {
+				stats, err := download.Send(context.Background(), client, os.Getenv("HOME")+"/"+archiveFile, destFile, download.SHA256)
+				if err != nil {
+					return err
+				}
+				GinkgoWriter.Printf("Sent %s: %s\n", archiveFile, stats)
+				return nil
+			}).Should(Succeed())
 
 			// Extract the airgap archive
 			_, err = client.RunSSH("tar -I pzstd -vxf " + destFile + " -C " + optRancher)
@@ -153,7 +157,7 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			err := os.Mkdir(os.Getenv("HOME")+"/.kube", 0755)
 			Expect(err).To(Not(HaveOccurred()))
 
-			err = client.GetFile(localKubeconfig, "/etc/rancher/k3s/k3s.yaml", 0644)
+			err = scpClient.GetFile(localKubeconfig, "/etc/rancher/k3s/k3s.yaml", 0644)
 			Expect(err).To(Not(HaveOccurred()))
 
 			// NOTE: not sure that this is need because we have the config file in ~/.kube/
@@ -26,6 +26,7 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 var _ = Describe("E2E - Install a simple application", Label("install-app"), func() {
@@ -55,9 +56,9 @@ var _ = Describe("E2E - Install a simple application", Label("install-app"), fun
 				checkList := [][]string{
 					{localPathNS, "app=local-path-provisioner"},
 				}
-				Eventually(func() error {
+				EventuallyWith(retry.WorkloadReady, "local-path-provisioner pods", func() error {
 					return rancher.CheckPod(k, checkList)
-				}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 			})
 
 			By("Installing MetalLB", func() {
@@ -81,9 +82,9 @@ var _ = Describe("E2E - Install a simple application", Label("install-app"), fun
 					{metallbNS, "app.kubernetes.io/instance=metallb"},
 					{metallbNS, "app.kubernetes.io/name=metallb"},
 				}
-				Eventually(func() error {
+				EventuallyWith(retry.WorkloadReady, "MetalLB pods", func() error {
 					return rancher.CheckPod(k, checkList)
-				}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 
 				err := kubectl.Apply(metallbNS, metallbRscYaml)
 				Expect(err).NotTo(HaveOccurred())
@@ -116,19 +117,19 @@ var _ = Describe("E2E - Install a simple application", Label("install-app"), fun
 				checkList := [][]string{
 					{traefikNS, "app.kubernetes.io/name=traefik"},
 				}
-				Eventually(func() error {
+				EventuallyWith(retry.WorkloadReady, "Traefik pods", func() error {
 					return rancher.CheckPod(k, checkList)
-				}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 			})
 
 			By("Checking LoadBalancer IP", func() {
 				traefikNS := "traefik-system"
 
 				// Ensure that Traefik LB is not in Pending state anymore, could take time
-				Eventually(func() string {
+				EventuallyWith(retry.WorkloadReady.WithInterval(4*time.Second), "Traefik LoadBalancer", func() string {
 					out, _ := kubectl.RunWithoutErr("get", "svc", "--namespace", traefikNS, "traefik")
 					return out
-				}, tools.SetTimeout(4*time.Minute), 4*time.Second).Should(Not(ContainSubstring("<pending>")))
+				}).Should(Not(ContainSubstring("<pending>")))
 
 				// Check that an IP address for LB is configured
 				lbIP, err := kubectl.Run("get", "svc", "--namespace", traefikNS, "traefik", "-o", "jsonpath={.status.loadBalancer.ingress[0].ip}")
@@ -156,7 +157,7 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 		appName := "hello-world"
 
 		// We need to be sure that the cluster is accessible (mainly in upgrade tests)
-		Eventually(func() error {
+		EventuallyWith(retry.ClusterConverge.WithInterval(30*time.Second), "access to cluster "+clusterName, func() error {
 			k, err := rancher.SetClientKubeConfig(clusterNS, clusterName)
 			if err != nil {
 				return err
@@ -171,7 +172,7 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 			os.Unsetenv("KUBECONFIG")
 			os.Remove(k)
 			return err
-		}, tools.SetTimeout(5*time.Minute), 30*time.Second).ShouldNot(HaveOccurred())
+		}).ShouldNot(HaveOccurred())
 
 		// File where to host client cluster kubeconfig
 		kubeConfig, err := rancher.SetClientKubeConfig(clusterNS, clusterName)
@@ -185,10 +186,10 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 
 		By("Scaling the deployment to the number of nodes", func() {
 			var nodeList string
-			Eventually(func() string {
+			EventuallyWith(retry.APIRead, "nodes of cluster "+clusterName, func() string {
 				nodeList, _ = kubectl.RunWithoutErr("get", "nodes", "-o", "jsonpath={.items[*].metadata.name}")
 				return nodeList
-			}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(Not(BeEmpty()))
+			}).Should(Not(BeEmpty()))
 
 			nodeNumber := len(strings.Fields(nodeList))
 			Expect(nodeNumber).To(Not(BeZero()))
@@ -201,18 +202,18 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 		By("Waiting for deployment to be rollout", func() {
 			// Wait for application to be started
 			// NOTE: 1st or 2nd rollout command can sporadically fail, so better to use Eventually here
-			Eventually(func() string {
+			EventuallyWith(retry.WorkloadReady, "rollout of "+appName, func() string {
 				status, _ := kubectl.RunWithoutErr("rollout", "status", "deployment/"+appName)
 				return status
-			}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(ContainSubstring("successfully rolled out"))
+			}).Should(ContainSubstring("successfully rolled out"))
 		})
 
 		By("Checking application", func() {
 			// Ensure that LB is not in Pending state anymore, could take time
-			Eventually(func() string {
+			EventuallyWith(retry.WorkloadReady.WithInterval(4*time.Second), appName+" LoadBalancer", func() string {
 				out, _ := kubectl.RunWithoutErr("get", "svc", appName+"-loadbalancer")
 				return out
-			}, tools.SetTimeout(4*time.Minute), 4*time.Second).Should(Not(ContainSubstring("<pending>")))
+			}).Should(Not(ContainSubstring("<pending>")))
 
 			// Wait until at least an IP address is returned
 			cmd := []string{
@@ -221,10 +222,10 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 				"-o", "jsonpath={.status.loadBalancer.ingress[*].ip}",
 			}
 
-			Eventually(func() bool {
+			EventuallyWith(retry.APIRead, appName+" LoadBalancer IP", func() bool {
 				ip, _ := kubectl.RunWithoutErr(cmd...)
 				return tools.IsIPv4(strings.Fields(ip)[0])
-			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(BeTrue())
+			}).Should(BeTrue())
 
 			// Get load balancer IPs
 			appIPs, err := kubectl.RunWithoutErr(cmd...)
@@ -238,10 +239,10 @@ var _ = Describe("E2E - Checking a simple application", Label("check-app"), func
 
 					// Retry if needed, could take some times if a pod is restarted for example
 					var htmlPage []byte
-					Eventually(func() error {
+					EventuallyWith(retry.Download, appName+" page on "+ip, func() error {
 						htmlPage, err = exec.Command("curl", "http://"+ip+":8080").CombinedOutput()
 						return err
-					}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+					}).Should(Not(HaveOccurred()))
 
 					// Check HTML page content
 					Expect(string(htmlPage)).To(And(
@@ -24,6 +24,8 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 const (
@@ -67,7 +69,7 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		// testCaseID = 65
 
 		By("Adding a backup resource", func() {
-			err := kubectl.Apply(clusterNS, backupYaml)
+			err := render.Apply(clusterNS, RenderBackup())
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
@@ -160,25 +162,24 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 
 		By("Adding a restore resource", func() {
 			// Set the backup file in the restore resource
-			err := tools.Sed("%BACKUP_FILE%", backupFile, restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
-
-			// "prune" option should be set to true here
-			err = tools.Sed("%PRUNE%", "false", restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
+			// NOTE: "prune" option should be set to true here
+			restoreFile := RenderManifest(restoreYaml, "restore", render.Values{
+				"BACKUP_FILE": backupFile,
+				"PRUNE":       "false",
+			})
 
 			// And apply
-			err = kubectl.Apply(clusterNS, restoreYaml)
+			err := render.Apply(clusterNS, restoreFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Checking that the restore has been done", func() {
 			// Wait until resources are available again
-			Eventually(func() string {
+			EventuallyWith(retry.BackupRestore, "restore "+restoreResourceName, func() string {
 				out, _ := kubectl.RunWithoutErr("get", "restore", restoreResourceName,
 					"-o", "jsonpath={.metadata.name}")
 				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring(restoreResourceName))
+			}).Should(ContainSubstring(restoreResourceName))
 
 			// Wait for restore to be done
 			CheckBackupRestore("Done restoring")
@@ -209,7 +210,7 @@ var _ = Describe("E2E - Test simple Backup/Restore", Label("test-simple-backup-r
 		testCaseID = 65
 
 		By("Adding a backup resource", func() {
-			err := kubectl.Apply(clusterNS, backupYaml)
+			err := render.Apply(clusterNS, RenderBackup())
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
@@ -250,25 +251,24 @@ var _ = Describe("E2E - Test simple Backup/Restore", Label("test-simple-backup-r
 			Expect(err).To(Not(HaveOccurred()))
 
 			// Set the backup file in the restore resource
-			err = tools.Sed("%BACKUP_FILE%", backupFile, restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
-
-			// "prune" option should be set to true here
-			err = tools.Sed("%PRUNE%", "true", restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
+			// NOTE: "prune" option should be set to true here
+			restoreFile := RenderManifest(restoreYaml, "restore", render.Values{
+				"BACKUP_FILE": backupFile,
+				"PRUNE":       "true",
+			})
 
 			// And apply
-			err = kubectl.Apply(clusterNS, restoreYaml)
+			err = render.Apply(clusterNS, restoreFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Checking that the restore has been done", func() {
 			// Wait until resources are available again
-			Eventually(func() string {
+			EventuallyWith(retry.BackupRestore, "restore "+restoreResourceName, func() string {
 				out, _ := kubectl.RunWithoutErr("get", "restore", restoreResourceName,
 					"-o", "jsonpath={.metadata.name}")
 				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring(restoreResourceName))
+			}).Should(ContainSubstring(restoreResourceName))
 
 			// Wait for restore to be done
 			CheckBackupRestore("Done restoring")
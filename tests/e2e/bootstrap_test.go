@@ -15,35 +15,40 @@ limitations under the License.
 package e2e_test
 
 import (
-	"os/exec"
+	"context"
+	"path/filepath"
+	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
-	"github.com/rancher/elemental/tests/e2e/helpers/misc"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootentry"
+	"github.com/rancher/elemental/tests/e2e/helpers/cluster"
+	"github.com/rancher/elemental/tests/e2e/helpers/disklayout"
+	"github.com/rancher/elemental/tests/e2e/helpers/fleet"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
 	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+	"github.com/rancher/elemental/tests/e2e/helpers/timeline"
 )
 
-func checkClusterAgent(client *tools.Client) {
+// Message logged at the end of the installation
+var installCompleted = regexp.MustCompile(`(?i)elemental install.* completed`)
+
+func checkClusterAgent(client *sshpool.Client) {
 	// cluster-agent is the pod that communicates to Rancher, wait for it before continuing
-	Eventually(func() string {
+	EventuallyWith(retry.ClusterConverge.For(usedNodes), "cluster agent on "+client.Host, func() string {
 		out, _ := client.RunSSH("kubectl get pod -n cattle-system -l app=cattle-cluster-agent")
 		return out
-	}, tools.SetTimeout(5*time.Duration(usedNodes)*time.Minute), 10*time.Second).Should(ContainSubstring("Running"))
+	}).Should(ContainSubstring("Running"))
 }
 
 var _ = Describe("E2E - Bootstrapping node", Label("bootstrap"), func() {
-	var (
-		bootstrappedNodes int
-		wg                sync.WaitGroup
-	)
-
 	It("Provision the node", func() {
 		// Report to Qase
 		testCaseID = 9
@@ -52,97 +57,101 @@ var _ = Describe("E2E - Bootstrapping node", Label("bootstrap"), func() {
 			By("Downloading MachineRegistration file", func() {
 				// Download the new YAML installation config file
 				machineRegName := "machine-registration-" + poolType + "-" + clusterName
-				tokenURL, err := kubectl.RunWithoutErr("get", "MachineRegistration",
-					"--namespace", clusterNS, machineRegName,
-					"-o", "jsonpath={.status.registrationURL}")
+				registration, err := Elemental().MachineRegistrations(clusterNS).Get(machineRegName)
 				Expect(err).To(Not(HaveOccurred()))
+				tokenURL := registration.Status.RegistrationURL
 
-				Eventually(func() error {
+				EventuallyWith(retry.Download, "download of "+machineRegName, func() error {
 					return tools.GetFileFromURL(tokenURL, installConfigYaml, false)
-				}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
-			})
-
-			By("Configuring iPXE boot script for network installation", func() {
-				numberOfFile, err := network.ConfigureiPXE(httpSrv)
-				Expect(err).To(Not(HaveOccurred()))
-				Expect(numberOfFile).To(BeNumerically(">=", 1))
+				}).ShouldNot(HaveOccurred())
 			})
 		}
-
 		// Loop on node provisionning
 		// NOTE: if numberOfVMs == vmIndex then only one node will be provisionned
-		bootstrappedNodes = 0
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
+		nodes := GetFleet()
+		for _, n := range nodes.Nodes {
 			// Add node in network configuration
-			err := rancher.AddNode(netDefaultFileName, hostName, index)
-			Expect(err).To(Not(HaveOccurred()))
+			AddNode(n.Hostname, n.Index)
+		}
 
-			// Get generated MAC address
-			_, macAdrs := GetNodeInfo(hostName)
-			Expect(macAdrs).To(Not(BeEmpty()))
+		var ipxe network.IPXEConfig
+		if !isoBoot && !rawBoot {
+			By("Configuring iPXE boot scripts for network installation", func() {
+				ipxe = ConfigureiPXE(nodes)
+			})
+		}
 
-			wg.Add(1)
-			go func(s, h, m string, i int) {
-				defer wg.Done()
-				defer GinkgoRecover()
+		// Raw images are already installed on the first disk
+		if !rawBoot {
+			By("Checking the disk layouts against the device-selector", func() {
+				machineRegName := "machine-registration-" + poolType + "-" + clusterName
+				registration, err := Elemental().MachineRegistrations(clusterNS).Get(machineRegName)
+				Expect(err).To(Not(HaveOccurred()))
+				rules, err := disklayout.Rules(registration.Spec.Config)
+				Expect(err).To(Not(HaveOccurred()))
 
-				By("Installing node "+h, func() {
-					// Wait a little bit to avoid starting all VMs at the same time
-					misc.RandomSleep(sequential, i)
+				for _, n := range nodes.Nodes {
+					layout := NodeLayout(n.Index)
+					device, err := layout.Select(rules)
+					Expect(err).To(Not(HaveOccurred()), "layout "+layout.Name+" of "+n.Hostname)
+					Expect(device).To(Equal(layout.Device), "layout "+layout.Name+" of "+n.Hostname)
+				}
+			})
+		}
 
-					// Execute node deployment in parallel
-					err := exec.Command(s, h, m).Run()
-					Expect(err).To(Not(HaveOccurred()))
-				})
-			}(installVMScript, hostName, macAdrs, index)
+		BootNodes(nodes, func(n fleet.Node) {
+			By("Installing node "+n.Hostname, func() {
+				// Execute node deployment in parallel
+				err := hv.Define(hypervisor.Domain{Name: n.Hostname, MAC: n.MAC, Disks: NodeLayout(n.Index).Disks, Networks: IsolatedNetworkNames()})
+				Expect(err).To(Not(HaveOccurred()))
+			})
+		})
 
-			// Wait a bit before starting more nodes to reduce CPU and I/O load
-			bootstrappedNodes = misc.WaitNodesBoot(index, vmIndex, bootstrappedNodes, numberOfNodesMax)
+		// Network installations are done once the nodes are defined
+		if !isoBoot && !rawBoot {
+			nodes.ForEach(0, func(n fleet.Node) {
+				By("Checking the files downloaded by "+n.Hostname, func() {
+					Expect(bootServer.Fetched(n.Hostname, ipxe.Artifacts.Rootfs)).To(BeTrue(), "rootfs not downloaded")
+					Expect(bootServer.Count(n.Hostname, filepath.Base(installConfigYaml))).To(Equal(1), "install config not downloaded once")
+				})
+			})
 		}
 
-		// Wait for all parallel jobs
-		wg.Wait()
-
 		// Loop on nodes to check that SeedImage cloud-config is correctly applied
 		// Only for master pool
 		if poolType == "master" && isoBoot {
-			for index := vmIndex; index <= numberOfVMs; index++ {
-				hostName := elemental.SetHostname(vmNameRoot, index)
-				Expect(hostName).To(Not(BeEmpty()))
-
-				client, _ := GetNodeInfo(hostName)
-				Expect(client).To(Not(BeNil()))
-
-				wg.Add(1)
-				go func(h string, cl *tools.Client) {
-					defer wg.Done()
-					defer GinkgoRecover()
-
-					By("Checking SeedImage cloud-config on "+h, func() {
-						// Wait for SSH to be available
-						// NOTE: this also checks that the root password was correctly set by cloud-config
-						CheckSSH(cl)
-
-						// Check that the cloud-config is correctly applied by checking the presence of a file
-						_ = RunSSHWithRetry(cl, "ls /etc/elemental-test")
-
-						// Check that the installation is completed before halting the VM
-						Eventually(func() error {
-							// A little bit dirty but this is temporary to keep compatibility with older Stable versions
-							_, err := cl.RunSSH("(journalctl --no-pager -u elemental-register.service ; journalctl --no-pager -u elemental-register-install.service) | grep -Eiq 'elemental install.* completed'")
-							return err
-						}, tools.SetTimeout(8*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
-
-						// Halt the VM
-						_ = RunSSHWithRetry(cl, "setsid -f init 0")
-					})
-				}(hostName, client)
-			}
-			wg.Wait()
+			nodes.ForEach(0, func(n fleet.Node) {
+				By("Checking SeedImage cloud-config on "+n.Hostname, func() {
+					// Wait for SSH to be available
+					// NOTE: this also checks that the root password was correctly set by cloud-config
+					CheckSSH(n.Client)
+
+					// Check that the cloud-config is correctly applied by checking the presence of a file
+					_ = RunSSHWithRetry(n.Client, "ls /etc/elemental-test")
+
+					// Check that the installation is completed before halting the VM
+					EventuallyWith(retry.NodeBoot, "installation of "+n.Hostname, func() (bool, error) {
+						ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+						defer cancel()
+
+						// Older Stable versions install from elemental-register.service
+						for _, unit := range []string{"elemental-register.service", "elemental-register-install.service"} {
+							if found, err := n.Client.JournalContains(ctx, unit, installCompleted, time.Time{}); err != nil || found {
+								return found, err
+							}
+						}
+						return false, nil
+					}).Should(BeTrue())
+					MarkPhase(n.Hostname, timeline.PhaseInstalled, timeline.SourceSSH, "journal of elemental-register")
+
+					// Halt the VM
+					_ = RunSSHWithRetry(n.Client, "setsid -f init 0")
+
+					// The installed system has its own host key, the one of the live ISO is not kept
+					err := sshPool.Forget(n.Hostname)
+					Expect(err).To(Not(HaveOccurred()))
+				})
+			})
 		}
 	})
 
@@ -150,28 +159,15 @@ var _ = Describe("E2E - Bootstrapping node", Label("bootstrap"), func() {
 		// Report to Qase
 		testCaseID = 67
 
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
-			// Execute node deployment in parallel
-			wg.Add(1)
-			go func(c, h string, i int) {
-				defer wg.Done()
-				defer GinkgoRecover()
-
-				By("Checking that node "+h+" is available in Rancher", func() {
-					Eventually(func() string {
-						id, _ := elemental.GetServerID(c, i)
-						return id
-					}, tools.SetTimeout(1*time.Minute), 5*time.Second).Should(Not(BeEmpty()))
-				})
-			}(clusterNS, hostName, index)
-		}
-
-		// Wait for all parallel jobs
-		wg.Wait()
+		nodes := GetFleet()
+		nodes.ForEach(0, func(n fleet.Node) {
+			By("Checking that node "+n.Hostname+" is available in Rancher", func() {
+				EventuallyWith(retry.APIRead, "server ID of "+n.Hostname, func() string {
+					id, _ := Elemental().GetServerID(n.Namespace, n.Index)
+					return id
+				}).Should(Not(BeEmpty()))
+			})
+		})
 
 		if vmIndex > 1 {
 			By("Checking cluster state", func() {
@@ -187,204 +183,137 @@ var _ = Describe("E2E - Bootstrapping node", Label("bootstrap"), func() {
 			Expect(value).To(BeNumerically(">=", 1))
 
 			// Check that the selector has been correctly created
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "MachineInventorySelector",
-					"--namespace", clusterNS,
-					"-o", "jsonpath={.items[*].metadata.name}")
-				return out
-			}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(ContainSubstring(poolType + "-" + clusterName))
+			EventuallyWith(retry.APIRead, "selector of pool "+poolType, func() []string {
+				names, _ := Elemental().MachineInventorySelectors(clusterNS).Names("")
+				return names
+			}).Should(ContainElement(ContainSubstring(poolType + "-" + clusterName)))
 		})
 
 		By("Waiting for known cluster state before adding the node(s)", func() {
 			msg := `(configuring .* node\(s\)|waiting for viable init node)`
-			Eventually(func() string {
-				clusterMsg, _ := elemental.GetClusterState(clusterNS, clusterName,
-					"{.status.conditions[?(@.type==\"Updated\")].message}")
+			EventuallyWith(retry.ClusterConverge.For(usedNodes), "cluster "+clusterName+" waiting for nodes", func() string {
+				c, err := cluster.Get(context.Background(), Kube(), clusterNS, clusterName)
+				if err != nil {
+					return ""
+				}
 
 				// Sometimes we can have a different status/condition
-				if clusterMsg == "" {
-					out, _ := elemental.GetClusterState(clusterNS, clusterName,
-						"{.status.conditions[?(@.type==\"Provisioned\")].message}")
-
-					return out
+				for _, t := range []string{"Updated", "Provisioned"} {
+					if cond := c.Condition(t); cond != nil && cond.Message != "" {
+						return cond.Message
+					}
 				}
 
-				return clusterMsg
-			}, tools.SetTimeout(5*time.Duration(usedNodes)*time.Minute), 10*time.Second).Should(MatchRegexp(msg))
+				return ""
+			}).Should(MatchRegexp(msg))
 		})
 
-		bootstrappedNodes = 0
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
-			// Get node information
-			client, _ := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
-
-			// Execute in parallel
-			wg.Add(1)
-			go func(c, h string, i int, t bool, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
-
-				// Restart the node(s)
-				By("Restarting "+h+" to add it in the cluster", func() {
-					// Wait a little bit to avoid starting all VMs at the same time
-					misc.RandomSleep(sequential, i)
+		BootNodes(nodes, func(n fleet.Node) {
+			// Restart the node(s)
+			By("Restarting "+n.Hostname+" to add it in the cluster", func() {
+				// The console may not show the power-off, the hypervisor does
+				if state, err := hv.State(n.Hostname); err == nil && state == hypervisor.StateShutOff {
+					MarkPhase(n.Hostname, timeline.PhasePoweredOff, timeline.SourceHypervisor, string(state))
+				}
 
-					err := exec.Command("sudo", "virsh", "start", h).Run()
-					Expect(err).To(Not(HaveOccurred()))
-				})
+				err := hv.Start(n.Hostname)
+				Expect(err).To(Not(HaveOccurred()))
+			})
 
-				By("Checking "+h+" SSH connection", func() {
-					CheckSSH(cl)
-				})
+			By("Checking "+n.Hostname+" SSH connection", func() {
+				CheckSSH(n.Client)
+			})
 
-				By("Checking that TPM is correctly configured on "+h, func() {
-					testValue := "-c"
-					if t == true {
-						testValue = "! -e"
-					}
-					_ = RunSSHWithRetry(cl, "[[ "+testValue+" /dev/tpm0 ]]")
-				})
+			state := ProbeNode(n.Client)
 
-				By("Checking OS version on "+h, func() {
-					out := RunSSHWithRetry(cl, "cat /etc/os-release")
-					GinkgoWriter.Printf("OS Version on %s:\n%s\n", h, out)
-				})
-			}(clusterNS, hostName, index, emulateTPM, client)
+			By("Checking that TPM is correctly configured on "+n.Hostname, func() {
+				// There is no TPM device if the TPM is emulated
+				Expect(state.TPM).To(Equal(!emulateTPM))
+			})
 
-			// Wait a bit before starting more nodes to reduce CPU and I/O load
-			bootstrappedNodes = misc.WaitNodesBoot(index, vmIndex, bootstrappedNodes, numberOfNodesMax)
-		}
+			layout := NodeLayout(n.Index)
+			By("Checking that "+n.Hostname+" is installed on "+layout.Device, func() {
+				out := RunSSHWithRetry(n.Client, disklayout.Command)
+				Expect(disklayout.Check(layout, out)).To(Succeed())
+			})
 
-		// Wait for all parallel jobs
-		wg.Wait()
+			By("Checking OS version on "+n.Hostname, func() {
+				GinkgoWriter.Printf("OS state on %s:\n%s\n", n.Hostname, state)
+				Expect(state.BootMode).To(Equal(probe.BootActive))
+			})
+		})
 
 		if poolType != "worker" {
-			for index := vmIndex; index <= numberOfVMs; index++ {
-				// Set node hostname
-				hostName := elemental.SetHostname(vmNameRoot, index)
-				Expect(hostName).To(Not(BeEmpty()))
-
-				// Get node information
-				client, _ := GetNodeInfo(hostName)
-				Expect(client).To(Not(BeNil()))
-
-				// Execute in parallel
-				wg.Add(1)
-				go func(h string, cl *tools.Client) {
-					defer wg.Done()
-					defer GinkgoRecover()
-
-					if strings.Contains(k8sDownstreamVersion, "rke2") {
-						By("Configuring kubectl command on node "+h, func() {
-							dir := "/var/lib/rancher/rke2/bin"
-							kubeCfg := "export KUBECONFIG=/etc/rancher/rke2/rke2.yaml"
-
-							// Wait a little to be sure that RKE2 installation has started
-							// Otherwise the directory is not available!
-							_ = RunSSHWithRetry(cl, "[[ -d "+dir+" ]]")
-
-							// Configure kubectl
-							_ = RunSSHWithRetry(cl, "I="+dir+"/kubectl; if [[ -x ${I} ]]; then ln -s ${I} bin/; echo "+kubeCfg+" >> .bashrc; fi")
-						})
-					}
-
-					By("Checking kubectl command on "+h, func() {
-						// Check if kubectl works
-						Eventually(func() string {
-							out, _ := cl.RunSSH("kubectl version 2>/dev/null | grep 'Server Version:'")
-							return out
-						}, tools.SetTimeout(5*time.Minute), 5*time.Second).Should(ContainSubstring(k8sDownstreamVersion))
+			nodes.ForEach(0, func(n fleet.Node) {
+				if strings.Contains(k8sDownstreamVersion, "rke2") {
+					By("Configuring kubectl command on node "+n.Hostname, func() {
+						dir := "/var/lib/rancher/rke2/bin"
+						kubeCfg := "export KUBECONFIG=/etc/rancher/rke2/rke2.yaml"
+
+						// Wait a little to be sure that RKE2 installation has started
+						// Otherwise the directory is not available!
+						_ = RunSSHWithRetry(n.Client, "[[ -d "+dir+" ]]")
+
+						// Configure kubectl
+						_ = RunSSHWithRetry(n.Client, "I="+dir+"/kubectl; if [[ -x ${I} ]]; then ln -s ${I} bin/; echo "+kubeCfg+" >> .bashrc; fi")
 					})
+				}
 
-					By("Checking cluster agent on "+h, func() {
-						checkClusterAgent(cl)
-					})
-				}(hostName, client)
-			}
+				By("Checking kubectl command on "+n.Hostname, func() {
+					// Check if kubectl works
+					EventuallyWith(retry.NodeBoot, "kubectl on "+n.Hostname, func() string {
+						out, _ := n.Client.RunSSH("kubectl version 2>/dev/null | grep 'Server Version:'")
+						return out
+					}).Should(ContainSubstring(k8sDownstreamVersion))
+				})
 
-			// Wait for all parallel jobs
-			wg.Wait()
+				By("Checking cluster agent on "+n.Hostname, func() {
+					checkClusterAgent(n.Client)
+				})
+			})
 		}
 
 		By("Checking cluster state", func() {
 			WaitCluster(clusterNS, clusterName)
 		})
 
-		if poolType != "worker" {
-			for index := vmIndex; index <= numberOfVMs; index++ {
-				// Set node hostname
-				hostName := elemental.SetHostname(vmNameRoot, index)
-				Expect(hostName).To(Not(BeEmpty()))
-
-				// Get node information
-				client, _ := GetNodeInfo(hostName)
-				Expect(client).To(Not(BeNil()))
-
-				// Execute in parallel
-				wg.Add(1)
-				go func(h string, cl *tools.Client) {
-					defer wg.Done()
-					defer GinkgoRecover()
-
-					By("Checking cluster version on "+h, func() {
-						Eventually(func() error {
-							k8sVer, err := cl.RunSSH("kubectl version 2>/dev/null")
-							if strings.Contains(k8sVer, "Server Version:") {
-								// Show cluster version, could be useful for debugging purposes
-								GinkgoWriter.Printf("K8s version on %s:\n%s\n", h, k8sVer)
-							}
-							return err
-						}, tools.SetTimeout(1*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
-					})
-				}(hostName, client)
-			}
-
-			// Wait for all parallel jobs
-			wg.Wait()
-		}
+		By("Checking boot timeline of the nodes", func() {
+			nodes.ForEach(0, func(n fleet.Node) {
+				MarkPhase(n.Hostname, timeline.PhaseJoined, timeline.SourceCluster, clusterName)
 
-		bootstrappedNodes = 0
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
-			// Get node information
-			client, _ := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
-
-			// Execute in parallel
-			wg.Add(1)
-			go func(h, p string, i int, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
-
-				By("Rebooting "+h, func() {
-					// Wait a little bit to avoid starting all VMs at the same time
-					misc.RandomSleep(sequential, i)
+				tl := timelines.Timeline(n.Hostname)
+				GinkgoWriter.Printf("Boot timeline of %s\n", tl)
+				Expect(tl.CheckOrder(timeline.PhasePoweredOff, timeline.PhaseActiveBoot, timeline.PhaseJoined)).To(Succeed())
+			})
+		})
 
-					// Execute 'reboot' in background, to avoid SSH locking
-					_ = RunSSHWithRetry(cl, "setsid -f reboot")
+		if poolType != "worker" {
+			nodes.ForEach(0, func(n fleet.Node) {
+				By("Checking cluster version on "+n.Hostname, func() {
+					EventuallyWith(retry.SSHCommand, "cluster version on "+n.Hostname, func() error {
+						k8sVer, err := n.Client.RunSSH("kubectl version 2>/dev/null")
+						if strings.Contains(k8sVer, "Server Version:") {
+							// Show cluster version, could be useful for debugging purposes
+							GinkgoWriter.Printf("K8s version on %s:\n%s\n", n.Hostname, k8sVer)
+						}
+						return err
+					}).Should(Not(HaveOccurred()))
 				})
-
-				if p != "worker" {
-					By("Checking cluster agent on "+h, func() {
-						checkClusterAgent(cl)
-					})
-				}
-			}(hostName, poolType, index, client)
-
-			// Wait a bit before starting more nodes to reduce CPU and I/O load
-			bootstrappedNodes = misc.WaitNodesBoot(index, vmIndex, bootstrappedNodes, numberOfNodesMax)
+			})
 		}
 
-		// Wait for all parallel jobs
-		wg.Wait()
+		BootNodes(nodes, func(n fleet.Node) {
+			By("Rebooting "+n.Hostname, func() {
+				active := ProbeNode(n.Client)
+				BootEntry(n.Client, bootentry.Active, active)
+			})
+
+			if n.Pool != "worker" {
+				By("Checking cluster agent on "+n.Hostname, func() {
+					checkClusterAgent(n.Client)
+				})
+			}
+		})
 
 		By("Checking cluster state after reboot", func() {
 			WaitCluster(clusterNS, clusterName)
@@ -19,13 +19,12 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
-	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
 	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 	"golang.org/x/mod/semver"
 )
 
@@ -34,20 +33,11 @@ var _ = Describe("E2E - Configure test", Label("configure"), func() {
 		// Report to Qase
 		testCaseID = 30
 
-		// Patterns to replace
-		basePatterns := []YamlPattern{
-			{
-				key:   "%CLUSTER_NAME%",
-				value: clusterName,
-			},
-			{
-				key:   "%K8S_VERSION%",
-				value: k8sDownstreamVersion,
-			},
-			{
-				key:   "%SELINUX%",
-				value: strconv.FormatBool(selinux),
-			},
+		// Values used in all templates
+		baseValues := render.Values{
+			"CLUSTER_NAME": clusterName,
+			"K8S_VERSION":  k8sDownstreamVersion,
+			"SELINUX":      strconv.FormatBool(selinux),
 		}
 
 		By("Configuring SSH client", func() {
@@ -68,48 +58,25 @@ var _ = Describe("E2E - Configure test", Label("configure"), func() {
 
 		By("Creating a cluster", func() {
 			// Create Yaml file
-			for _, p := range basePatterns {
-				err := tools.Sed(p.key, p.value, clusterYaml)
-				Expect(err).To(Not(HaveOccurred()))
-			}
+			clusterFile := RenderCluster(clusterName)
 
 			// Apply to k8s
-			Eventually(func() error {
-				return kubectl.Apply(clusterNS, clusterYaml)
-			}, tools.SetTimeout(1*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+			EventuallyWith(retry.APIRead, "creation of cluster "+clusterName, func() error {
+				return render.Apply(clusterNS, clusterFile)
+			}).Should(Not(HaveOccurred()))
 
 			// Check that the cluster is correctly created
 			CheckCreatedCluster(clusterNS, clusterName)
 		})
 
 		By("Creating cluster selectors", func() {
-			// Set temporary file
-			selectorTmp, err := tools.CreateTemp("selector")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(selectorTmp)
-
 			for _, pool := range []string{"master", "worker"} {
-				// Patterns to replace
-				addPatterns := []YamlPattern{
-					{
-						key:   "%POOL_TYPE%",
-						value: pool,
-					},
-				}
-				patterns := append(basePatterns, addPatterns...)
-
-				// Save original file as it will have to be modified twice
-				err := tools.CopyFile(selectorYaml, selectorTmp)
-				Expect(err).To(Not(HaveOccurred()))
-
 				// Create Yaml file
-				for _, p := range patterns {
-					err := tools.Sed(p.key, p.value, selectorTmp)
-					Expect(err).To(Not(HaveOccurred()))
-				}
+				values := baseValues.With(render.Values{"POOL_TYPE": pool})
+				selectorFile := RenderManifest(selectorYaml, "selector-"+pool+"-"+clusterName, values)
 
 				// Apply to k8s
-				err = kubectl.Apply(clusterNS, selectorTmp)
+				err := render.Apply(clusterNS, selectorFile)
 				Expect(err).To(Not(HaveOccurred()))
 
 				// Check that the selector template is correctly created
@@ -118,62 +85,33 @@ var _ = Describe("E2E - Configure test", Label("configure"), func() {
 		})
 
 		By("Adding MachineRegistration", func() {
-			// Set temporary file
-			registrationTmp, err := tools.CreateTemp("machineRegistration")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(registrationTmp)
+			// Same SSH key for all the nodes of the run
+			authorizedKey := NewRunKey()
+
+			// Stable version of Elemental Operator does not support snapshotter option
+			// NOTE: the snapshotter is not rendered if its type is empty
+			registrationSnapType := snapType
+			operatorVersion, _ := elemental.GetOperatorVersion()
+			if semver.Compare("v"+operatorVersion, "v1.6.0") == -1 {
+				GinkgoWriter.Printf("Found operator Stable version %s, snapshotter not set.\n", operatorVersion)
+				registrationSnapType = ""
+			}
 
 			for _, pool := range []string{"master", "worker"} {
-				// Patterns to replace
-				addPatterns := []YamlPattern{
-					{
-						key:   "%PASSWORD%",
-						value: userPassword,
-					},
-					{
-						key:   "%POOL_TYPE%",
-						value: pool,
-					},
-					{
-						key:   "%SNAP_TYPE%",
-						value: snapType,
-					},
-					{
-						key:   "%SSHD_CONFIG_FILE%",
-						value: sshdConfigFile,
-					},
-					{
-						key:   "%USER%",
-						value: userName,
-					},
-					{
-						key:   "%VM_NAME%",
-						value: vmNameRoot,
-					},
-				}
-				patterns := append(basePatterns, addPatterns...)
-
-				// Save original file as it will have to be modified twice
-				err := tools.CopyFile(registrationYaml, registrationTmp)
-				Expect(err).To(Not(HaveOccurred()))
-
 				// Create Yaml file
-				for _, p := range patterns {
-					err := tools.Sed(p.key, p.value, registrationTmp)
-					Expect(err).To(Not(HaveOccurred()))
-				}
-
-				// Stable version of Elemental Operator does not support snapshotter option
-				// NOTE: a bit dirty, but this is a workaround until Dev become the new Stable
-				operatorVersion, err := elemental.GetOperatorVersion()
-				if semver.Compare("v"+operatorVersion, "v1.6.0") == -1 {
-					GinkgoWriter.Printf("Found operator Stable version, apply workaround for pool %s.\n", pool)
-					err = exec.Command("sed", "-i", "/snapshotter:/,/type:/d", registrationTmp).Run()
-					Expect(err).To(Not(HaveOccurred()))
-				}
+				values := baseValues.With(render.Values{
+					"PASSWORD":           userPassword,
+					"POOL_TYPE":          pool,
+					"SNAP_TYPE":          registrationSnapType,
+					"SSH_AUTHORIZED_KEY": authorizedKey,
+					"SSHD_CONFIG_FILE":   sshdConfigFile,
+					"USER":               userName,
+					"VM_NAME":            vmNameRoot,
+				})
+				registrationFile := RenderManifest(registrationYaml, "machine-registration-"+pool+"-"+clusterName, values)
 
 				// Apply to k8s
-				err = kubectl.Apply(clusterNS, registrationTmp)
+				err := render.Apply(clusterNS, registrationFile)
 				Expect(err).To(Not(HaveOccurred()))
 
 				// Check that the machine registration is correctly created
@@ -188,15 +126,11 @@ var _ = Describe("E2E - Configure test", Label("configure"), func() {
 			testCaseID = 68
 
 			By("Starting default network", func() {
-				// Don't check return code, as the default network could be already removed
-				for _, c := range []string{"net-destroy", "net-undefine"} {
-					_ = exec.Command("sudo", "virsh", c, "default").Run()
-				}
-
-				// Wait a bit between virsh commands
-				time.Sleep(30 * time.Second)
-				err := exec.Command("sudo", "virsh", "net-create", netDefaultFileName).Run()
-				Expect(err).To(Not(HaveOccurred()))
+				StartDefaultNetwork()
+			})
+
+			By("Starting isolated networks", func() {
+				StartIsolatedNetworks()
 			})
 		}
 	})
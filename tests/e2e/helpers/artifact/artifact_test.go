@@ -0,0 +1,418 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"unicode/utf16"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+const registrationURL = "https://rancher/elemental/registration/token"
+
+// Cloud-config as built in a SeedImage artifact
+const liveConfig = `elemental:
+  registration:
+    url: ` + registrationURL + `
+write_files:
+  - path: /etc/elemental-test
+    append: true
+    content: |
+      SeedImage cloud-config-test
+`
+
+// Root image, only the magic number matters
+var squashfs = append([]byte(squashfsMagic), make([]byte, minRootImageSize)...)
+
+/*
+Build a FAT12 filesystem with 512 bytes clusters
+  - @remarks Each directory fits in one cluster
+  - @param label Label of the volume
+  - @param files Content by path, names are uppercase 8.3 ones unless they use a long name
+  - @returns The filesystem
+*/
+func buildFAT(t *testing.T, label string, files map[string][]byte) []byte {
+	t.Helper()
+
+	const sectors = 128
+	img := make([]byte, sectors*512)
+	boot := img[:512]
+	binary.LittleEndian.PutUint16(boot[11:], 512)
+	boot[13] = 1
+	binary.LittleEndian.PutUint16(boot[14:], 1)
+	boot[16] = 1
+	binary.LittleEndian.PutUint16(boot[17:], 16)
+	binary.LittleEndian.PutUint16(boot[19:], sectors)
+	binary.LittleEndian.PutUint16(boot[22:], 1)
+	copy(boot[43:54], []byte(label+strings.Repeat(" ", 11-len(label))))
+	copy(boot[54:], "FAT12   ")
+	boot[510], boot[511] = 0x55, 0xaa
+
+	// FAT in sector 1, root directory in sector 2, clusters from sector 3
+	setFAT := func(cluster, value int) {
+		off := 512 + cluster + cluster/2
+		v := binary.LittleEndian.Uint16(img[off:])
+		if cluster%2 == 1 {
+			v = v&0x000f | uint16(value)<<4
+		} else {
+			v = v&0xf000 | uint16(value)
+		}
+		binary.LittleEndian.PutUint16(img[off:], v)
+	}
+	next := 2
+	alloc := func(size int) int {
+		first := next
+		count := max(1, (size+511)/512)
+		for i := range count {
+			value := 0xfff
+			if i < count-1 {
+				value = next + 1
+			}
+			setFAT(next, value)
+			next++
+		}
+		return first
+	}
+	clusterData := func(c int) []byte {
+		return img[(3+c-2)*512:]
+	}
+
+	dirs := map[string][]byte{".": img[2*512 : 3*512]}
+	used := map[string]int{}
+	add := func(dir, name string, attr byte, cluster, size int) {
+		e := dirs[dir][used[dir]*fatEntrySize:]
+		short := strings.ToUpper(name)
+		if base, ext, _ := strings.Cut(short, "."); len(base) > 8 || len(ext) > 3 || short != name {
+			// Long name entries, last part first, before a generated short one
+			u := append(utf16.Encode([]rune(name)), 0)
+			for len(u)%13 != 0 {
+				u = append(u, 0xffff)
+			}
+			for seq := len(u) / 13; seq > 0; seq-- {
+				e[0] = byte(seq)
+				if seq == len(u)/13 {
+					e[0] |= 0x40
+				}
+				e[11] = 0x0f
+				for i, c := range u[(seq-1)*13 : seq*13] {
+					off := []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30}[i]
+					binary.LittleEndian.PutUint16(e[off:], c)
+				}
+				used[dir]++
+				e = dirs[dir][used[dir]*fatEntrySize:]
+			}
+			short = "LONG~1"
+		}
+		base, ext, _ := strings.Cut(short, ".")
+		copy(e[:11], base+strings.Repeat(" ", 8-len(base))+ext+strings.Repeat(" ", 3-len(ext)))
+		e[11] = attr
+		binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+		binary.LittleEndian.PutUint32(e[28:], uint32(size))
+		used[dir]++
+	}
+
+	for p, data := range files {
+		dir := "."
+		parts := strings.Split(p, "/")
+		for _, d := range parts[:len(parts)-1] {
+			sub := joinPath(dir, d)
+			if _, found := dirs[sub]; !found {
+				c := alloc(512)
+				dirs[sub] = clusterData(c)[:512]
+				add(dir, d, 0x10, c, 0)
+			}
+			dir = sub
+		}
+		c := alloc(len(data))
+		copy(clusterData(c), data)
+		add(dir, parts[len(parts)-1], 0x20, c, len(data))
+	}
+
+	return img
+}
+
+func joinPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+/*
+Build an ISO9660 filesystem with Rock Ridge names and an El Torito EFI image
+  - @param efi EFI boot image
+  - @returns The filesystem
+*/
+func buildISO(t *testing.T, efi []byte) []byte {
+	t.Helper()
+
+	const (
+		rootSector    = 20
+		bootSector    = 21
+		catalogSector = 22
+		configSector  = 23
+		efiSector     = 24
+	)
+	rootfsSector := efiSector + (len(efi)+isoSectorSize-1)/isoSectorSize
+	img := make([]byte, (rootfsSector+(len(squashfs)+isoSectorSize-1)/isoSectorSize)*isoSectorSize)
+	sector := func(n int) []byte {
+		return img[n*isoSectorSize : (n+1)*isoSectorSize]
+	}
+
+	record := func(name string, lba, size int, dir bool, su []byte) []byte {
+		id := []byte(name)
+		if name == "." || name == ".." {
+			id = []byte{byte(len(name) - 1)}
+		}
+		l := 33 + len(id)
+		if l%2 != 0 {
+			l++
+		}
+		r := make([]byte, l+len(su))
+		r[0] = byte(len(r))
+		binary.LittleEndian.PutUint32(r[2:], uint32(lba))
+		binary.LittleEndian.PutUint32(r[10:], uint32(size))
+		r[18], r[19], r[20] = 126, 1, 2
+		if dir {
+			r[25] = 0x02
+		}
+		r[32] = byte(len(id))
+		copy(r[33:], id)
+		copy(r[l:], su)
+		return r
+	}
+	nm := func(name string) []byte {
+		return append([]byte{'N', 'M', byte(5 + len(name)), 1, 0}, name...)
+	}
+
+	// Volume descriptors: primary, El Torito and terminator
+	pvd := sector(16)
+	pvd[0] = 1
+	copy(pvd[1:], isoIdentifier)
+	copy(pvd[156:], record(".", rootSector, isoSectorSize, true, nil))
+	br := sector(17)
+	copy(br[1:], isoIdentifier)
+	copy(br[7:], "EL TORITO SPECIFICATION")
+	binary.LittleEndian.PutUint32(br[71:], catalogSector)
+	end := sector(18)
+	end[0] = 255
+	copy(end[1:], isoIdentifier)
+
+	// EFI only catalog
+	catalog := sector(catalogSector)
+	catalog[0], catalog[1], catalog[30], catalog[31] = 0x01, 0xef, 0x55, 0xaa
+	catalog[32] = 0x88
+	binary.LittleEndian.PutUint32(catalog[40:], efiSector)
+
+	sp := []byte{'S', 'P', 7, 1, 0xbe, 0xef, 0}
+	var root []byte
+	for _, r := range [][]byte{
+		record(".", rootSector, isoSectorSize, true, sp),
+		record("..", rootSector, isoSectorSize, true, nil),
+		record("BOOT", bootSector, isoSectorSize, true, nm("boot")),
+		record("LIVECD_C.YAM;1", configSector, len(liveConfig), false, nm("livecd-cloud-config.yaml")),
+		record("ROOTFS.SQU;1", rootfsSector, len(squashfs), false, nm("rootfs.squashfs")),
+	} {
+		root = append(root, r...)
+	}
+	copy(sector(rootSector), root)
+
+	var boot []byte
+	for _, r := range [][]byte{
+		record(".", bootSector, isoSectorSize, true, nil),
+		record("..", rootSector, isoSectorSize, true, nil),
+		record("GRUB.CFG;1", configSector, len(liveConfig), false, nm("grub.cfg")),
+	} {
+		boot = append(boot, r...)
+	}
+	copy(sector(bootSector), boot)
+
+	copy(sector(configSector), liveConfig)
+	copy(img[efiSector*isoSectorSize:], efi)
+	copy(img[rootfsSector*isoSectorSize:], squashfs)
+
+	return img
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "image")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestFAT(t *testing.T) {
+	img := buildFAT(t, "COS_GRUB", map[string][]byte{
+		"EFI/BOOT/BOOTX64.EFI":     bytes.Repeat([]byte("efi"), 400),
+		"EFI/BOOT/grub.cfg":        []byte("configfile /boot/grub2/grub.cfg\n"),
+		"livecd-cloud-config.yaml": []byte(liveConfig),
+	})
+
+	f, err := openFAT(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.bits != 12 || f.label != "COS_GRUB" {
+		t.Fatalf("unexpected FAT%d %q", f.bits, f.label)
+	}
+
+	fsys := &imageFS{r: bytes.NewReader(img), tree: f, fold: true}
+	if err := fstest.TestFS(fsys, "EFI/BOOT/BOOTX64.EFI", "EFI/BOOT/grub.cfg", "livecd-cloud-config.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "efi/boot/bootx64.efi")
+	if err != nil || len(data) != 1200 {
+		t.Fatalf("unexpected content of %d bytes, error %v", len(data), err)
+	}
+}
+
+func TestISO(t *testing.T) {
+	efi := buildFAT(t, "", map[string][]byte{"EFI/BOOT/BOOTX64.EFI": []byte("efi")})
+	file := writeFile(t, buildISO(t, efi))
+
+	report, err := Inspect(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Format != FormatISO {
+		t.Fatalf("unexpected format %s", report.Format)
+	}
+	if len(report.EFILoaders) != 1 || report.EFILoaders[0] != "eltorito:/EFI/BOOT/BOOTX64.EFI" {
+		t.Fatalf("unexpected EFI loaders %v", report.EFILoaders)
+	}
+	if len(report.RootImages) != 1 || report.RootImages[0] != "iso:/rootfs.squashfs (squashfs)" {
+		t.Fatalf("unexpected root images %v", report.RootImages)
+	}
+
+	seed := &elemental.SeedImage{Spec: elemental.SeedImageSpec{CloudConfig: map[string]interface{}{
+		"write_files": []interface{}{map[string]interface{}{"path": "/etc/elemental-test", "content": "SeedImage cloud-config-test\n"}},
+	}}}
+	reg := &elemental.MachineRegistration{Status: elemental.MachineRegistrationStatus{RegistrationURL: registrationURL}}
+	expect, err := ExpectFrom(reg, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Check(expect); err != nil {
+		t.Fatalf("%v\n%s", err, report)
+	}
+
+	expect.RegistrationURL = "https://other/registration"
+	expect.WriteFiles["/etc/other"] = "other"
+	err = report.Check(expect)
+	if err == nil || !strings.Contains(err.Error(), "registration URL https://other/registration not found") || !strings.Contains(err.Error(), "/etc/other") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Files are also readable directly
+	data, _ := os.ReadFile(file)
+	fsys, err := OpenISO(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootfs, err := fs.ReadFile(fsys, "rootfs.squashfs"); err != nil || !bytes.Equal(rootfs, squashfs) {
+		t.Fatalf("unexpected rootfs, %v", err)
+	}
+	if _, err := OpenISO(bytes.NewReader(efi)); err == nil {
+		t.Fatal("FAT image opened as ISO")
+	}
+
+	// Broken image
+	if _, err := Inspect(writeFile(t, data[:isoSectorSize*19])); err == nil {
+		t.Fatal("truncated ISO accepted")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	mke2fs, err := exec.LookPath("mke2fs")
+	if err != nil {
+		t.Skip("mke2fs is needed to build an ext4 filesystem")
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "cOS"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cOS", "recovery.img"), squashfs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "90_registration.yaml"), []byte(liveConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ext := filepath.Join(t.TempDir(), "ext4")
+	if out, err := exec.Command(mke2fs, "-q", "-F", "-t", "ext4", "-L", "COS_RECOVERY", "-d", dir, ext, "8M").CombinedOutput(); err != nil {
+		t.Skipf("cannot build an ext4 filesystem: %v: %s", err, out)
+	}
+	recovery, err := os.ReadFile(ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	efi := buildFAT(t, "COS_GRUB", map[string][]byte{
+		"EFI/BOOT/BOOTX64.EFI": []byte("efi"),
+		"EFI/BOOT/grub.cfg":    []byte("configfile /boot/grub2/grub.cfg\n"),
+	})
+
+	// GPT header in sector 1, entries in sectors 2 to 33
+	const first = 34
+	img := make([]byte, first*rawSectorSize)
+	copy(img[rawSectorSize:], gptSignature)
+	binary.LittleEndian.PutUint64(img[rawSectorSize+72:], 2)
+	binary.LittleEndian.PutUint32(img[rawSectorSize+80:], 128)
+	binary.LittleEndian.PutUint32(img[rawSectorSize+84:], 128)
+	for i, p := range []struct {
+		name string
+		data []byte
+	}{{"efi", efi}, {"recovery", recovery}} {
+		e := img[2*rawSectorSize+i*128:]
+		if i == 0 {
+			copy(e, efiPartitionType)
+		} else {
+			copy(e, "linux data type!")
+		}
+		start := len(img) / rawSectorSize
+		binary.LittleEndian.PutUint64(e[32:], uint64(start))
+		binary.LittleEndian.PutUint64(e[40:], uint64(start+len(p.data)/rawSectorSize-1))
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(e[56+2*j:], c)
+		}
+		img = append(img, p.data...)
+	}
+
+	report, err := Inspect(writeFile(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Format != FormatRaw || len(report.Partitions) != 2 || !report.Partitions[0].EFI {
+		t.Fatalf("unexpected image:\n%s", report)
+	}
+	if err := report.Check(Expect{RegistrationURL: registrationURL, WriteFiles: map[string]string{"/etc/elemental-test": "SeedImage cloud-config-test"}}); err != nil {
+		t.Fatalf("%v\n%s", err, report)
+	}
+	if report.RootImages[0] != "recovery:/cOS/recovery.img (squashfs)" {
+		t.Fatalf("unexpected root images %v", report.RootImages)
+	}
+}
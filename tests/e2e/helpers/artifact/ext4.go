@@ -0,0 +1,341 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// Offset of the ext2/3/4 superblock
+	extSuperblock = 1024
+
+	// Magic number of the superblock
+	extMagic = 0xef53
+
+	// Inode of the root directory
+	extRootInode = 2
+
+	// Incompatible features
+	extFeatureMetaBG = 0x0010
+	extFeature64Bit  = 0x0080
+
+	// Inode flags
+	extExtentsFlag    = 0x80000
+	extInlineDataFlag = 0x10000000
+
+	// Magic number of an extent tree node
+	extExtentMagic = 0xf30a
+)
+
+// ext2, ext3 or ext4 filesystem
+// NOTE: only what is needed to read files is supported, e.g. journal is ignored
+type ext4 struct {
+	r io.ReaderAt
+
+	blockSize      int64
+	inodeSize      int64
+	inodesPerGroup uint32
+	descSize       int64
+	descStart      int64
+	is64Bit        bool
+
+	// Label of the volume, set in the superblock
+	label string
+}
+
+/*
+Check if an image is an ext2/3/4 filesystem
+  - @param r Content of the image
+  - @returns True if it is
+*/
+func isExt4(r io.ReaderAt) bool {
+	b := make([]byte, 2)
+	_, err := r.ReadAt(b, extSuperblock+56)
+
+	return err == nil && binary.LittleEndian.Uint16(b) == extMagic
+}
+
+/*
+Open an ext2/3/4 filesystem
+  - @param r Content of the image
+  - @returns The filesystem or an error
+*/
+func openExt4(r io.ReaderAt) (*ext4, error) {
+	sb := make([]byte, 1024)
+	if _, err := r.ReadAt(sb, extSuperblock); err != nil {
+		return nil, fmt.Errorf("cannot read superblock: %w", err)
+	}
+	if binary.LittleEndian.Uint16(sb[56:]) != extMagic {
+		return nil, errors.New("invalid superblock")
+	}
+
+	e := &ext4{
+		r:              r,
+		blockSize:      1024 << binary.LittleEndian.Uint32(sb[24:]),
+		inodeSize:      128,
+		inodesPerGroup: binary.LittleEndian.Uint32(sb[40:]),
+		descSize:       32,
+		label:          strings.TrimRight(string(sb[120:136]), "\x00"),
+	}
+
+	// Dynamic revision sets the size of the inodes
+	if binary.LittleEndian.Uint32(sb[76:]) >= 1 {
+		e.inodeSize = int64(binary.LittleEndian.Uint16(sb[88:]))
+	}
+
+	incompat := binary.LittleEndian.Uint32(sb[96:])
+	if incompat&extFeatureMetaBG != 0 {
+		return nil, errors.New("meta_bg feature is not supported")
+	}
+	if incompat&extFeature64Bit != 0 {
+		e.is64Bit = true
+		if size := int64(binary.LittleEndian.Uint16(sb[254:])); size != 0 {
+			e.descSize = size
+		}
+	}
+	if e.inodesPerGroup == 0 || e.inodeSize == 0 {
+		return nil, errors.New("invalid superblock")
+	}
+
+	// Group descriptors follow the block of the superblock
+	e.descStart = (int64(binary.LittleEndian.Uint32(sb[20:])) + 1) * e.blockSize
+
+	return e, nil
+}
+
+/*
+Read an inode
+  - @param ino Number of the inode
+  - @param name Name of the file, set in the returned node
+  - @returns The file or directory, or an error
+*/
+func (e *ext4) inode(ino uint32, name string) (*node, error) {
+	group := int64((ino - 1) / e.inodesPerGroup)
+	index := int64((ino - 1) % e.inodesPerGroup)
+
+	desc := make([]byte, e.descSize)
+	if _, err := e.r.ReadAt(desc, e.descStart+group*e.descSize); err != nil {
+		return nil, fmt.Errorf("cannot read group descriptor %d: %w", group, err)
+	}
+	table := int64(binary.LittleEndian.Uint32(desc[8:]))
+	if e.is64Bit && e.descSize >= 64 {
+		table |= int64(binary.LittleEndian.Uint32(desc[0x28:])) << 32
+	}
+
+	raw := make([]byte, min(e.inodeSize, 256))
+	if _, err := e.r.ReadAt(raw, table*e.blockSize+index*e.inodeSize); err != nil {
+		return nil, fmt.Errorf("cannot read inode %d: %w", ino, err)
+	}
+
+	mode := binary.LittleEndian.Uint16(raw)
+	n := &node{
+		name:    name,
+		dir:     mode&0xf000 == 0x4000,
+		size:    int64(binary.LittleEndian.Uint32(raw[4:])) | int64(binary.LittleEndian.Uint32(raw[108:]))<<32,
+		modTime: time.Unix(int64(binary.LittleEndian.Uint32(raw[16:])), 0),
+		id:      uint64(ino),
+	}
+
+	flags := binary.LittleEndian.Uint32(raw[32:])
+	block := raw[40:100]
+
+	var err error
+	switch {
+	case n.size == 0:
+	case flags&extInlineDataFlag != 0:
+		// The beginning of the data is in the inode itself, the rest in an extended attribute
+		if n.size > int64(len(block)) {
+			return nil, fmt.Errorf("inode %d: inline data of %d bytes is not supported", ino, n.size)
+		}
+		pos := table*e.blockSize + index*e.inodeSize + 40
+		n.extents = []extent{{pos: pos, len: n.size}}
+	case flags&extExtentsFlag != 0:
+		n.extents, err = e.extentTree(block, 0)
+	default:
+		n.extents, err = e.blockMap(block, n.size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inode %d: %w", ino, err)
+	}
+
+	return n, nil
+}
+
+/*
+Get the extents of a node of an extent tree
+  - @param data Content of the node
+  - @param depth Depth of the node, to stop on corrupted trees
+  - @returns The extents or an error
+*/
+func (e *ext4) extentTree(data []byte, depth int) ([]extent, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint16(data) != extExtentMagic {
+		return nil, errors.New("invalid extent header")
+	}
+	count := int(binary.LittleEndian.Uint16(data[2:]))
+	level := binary.LittleEndian.Uint16(data[6:])
+	if depth > 5 || 12+count*12 > len(data) {
+		return nil, errors.New("invalid extent tree")
+	}
+
+	var extents []extent
+	for i := range count {
+		entry := data[12+i*12 : 24+i*12]
+
+		// Leaves give the blocks, indexes the next node of the tree
+		if level == 0 {
+			length := int64(binary.LittleEndian.Uint16(entry[4:]))
+			pos := int64(binary.LittleEndian.Uint16(entry[6:]))<<32 | int64(binary.LittleEndian.Uint32(entry[8:]))
+			pos *= e.blockSize
+			// Uninitialized extents are read as zeros
+			if length > 32768 {
+				length -= 32768
+				pos = -1
+			}
+			extents = append(extents, extent{
+				off: int64(binary.LittleEndian.Uint32(entry)) * e.blockSize,
+				pos: pos,
+				len: length * e.blockSize,
+			})
+			continue
+		}
+
+		leaf := int64(binary.LittleEndian.Uint16(entry[8:]))<<32 | int64(binary.LittleEndian.Uint32(entry[4:]))
+		child := make([]byte, e.blockSize)
+		if _, err := e.r.ReadAt(child, leaf*e.blockSize); err != nil {
+			return nil, fmt.Errorf("cannot read extent block %d: %w", leaf, err)
+		}
+		sub, err := e.extentTree(child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, sub...)
+	}
+
+	return extents, nil
+}
+
+/*
+Get the extents of a file using direct and indirect blocks (ext2/3)
+  - @param block Block map of the inode
+  - @param size Size of the file
+  - @returns The extents or an error
+*/
+func (e *ext4) blockMap(block []byte, size int64) ([]extent, error) {
+	var extents []extent
+	var off int64
+
+	// Walk an indirect block, level 0 being a data block
+	var walk func(b uint32, level int) error
+	walk = func(b uint32, level int) error {
+		if off >= size {
+			return nil
+		}
+
+		// Holes are not part of the extents
+		if b == 0 {
+			span := e.blockSize
+			for range level {
+				span *= e.blockSize / 4
+			}
+			off += span
+			return nil
+		}
+
+		if level == 0 {
+			// Contiguous blocks are merged
+			pos := int64(b) * e.blockSize
+			if last := len(extents) - 1; last >= 0 && extents[last].off+extents[last].len == off &&
+				extents[last].pos+extents[last].len == pos {
+				extents[last].len += e.blockSize
+			} else {
+				extents = append(extents, extent{off: off, pos: pos, len: e.blockSize})
+			}
+			off += e.blockSize
+			return nil
+		}
+
+		data := make([]byte, e.blockSize)
+		if _, err := e.r.ReadAt(data, int64(b)*e.blockSize); err != nil {
+			return fmt.Errorf("cannot read indirect block %d: %w", b, err)
+		}
+		for i := int64(0); i < e.blockSize; i += 4 {
+			if err := walk(binary.LittleEndian.Uint32(data[i:]), level-1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for i := range 15 {
+		// 12 direct blocks, then single, double and triple indirect ones
+		if err := walk(binary.LittleEndian.Uint32(block[i*4:]), max(0, i-11)); err != nil {
+			return nil, err
+		}
+	}
+
+	return extents, nil
+}
+
+func (e *ext4) root() *node {
+	// Read when the directory is listed
+	return &node{name: ".", dir: true, id: extRootInode}
+}
+
+func (e *ext4) readDir(dir *node) ([]*node, error) {
+	inode, err := e.inode(uint32(dir.id), dir.name)
+	if err != nil {
+		return nil, err
+	}
+	if !inode.dir {
+		return nil, fmt.Errorf("%s is not a directory", dir.name)
+	}
+
+	data := make([]byte, inode.size)
+	if _, err := (&extentReader{r: e.r, extents: inode.extents, size: inode.size}).ReadAt(data, 0); err != nil {
+		return nil, fmt.Errorf("cannot read directory %s: %w", dir.name, err)
+	}
+
+	// Hashed directories can be read linearly, the index is hidden in empty entries
+	var entries []*node
+	for off := 0; off+8 <= len(data); {
+		ino := binary.LittleEndian.Uint32(data[off:])
+		recLen := int(binary.LittleEndian.Uint16(data[off+4:]))
+		nameLen := int(data[off+6])
+		if recLen < 8 || off+recLen > len(data) || 8+nameLen > recLen {
+			return nil, fmt.Errorf("invalid entry in directory %s at %d", dir.name, off)
+		}
+		name := string(data[off+8 : off+8+nameLen])
+		off += recLen
+
+		if ino == 0 || name == "." || name == ".." {
+			continue
+		}
+
+		n, err := e.inode(ino, name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, n)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,327 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Size of a FAT directory entry
+const fatEntrySize = 32
+
+// FAT12, FAT16 or FAT32 filesystem
+type fat struct {
+	r io.ReaderAt
+
+	bits        int
+	clusterSize int64
+	clusters    uint32
+	fatStart    int64
+	dataStart   int64
+	rootDir     *node
+
+	// Label of the volume, set in the boot sector
+	label string
+}
+
+/*
+Check if an image is a FAT filesystem
+  - @param r Content of the image
+  - @returns True if it is
+*/
+func isFAT(r io.ReaderAt) bool {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return false
+	}
+
+	return boot[510] == 0x55 && boot[511] == 0xaa &&
+		(string(boot[54:57]) == "FAT" || string(boot[82:87]) == "FAT32")
+}
+
+/*
+Open a FAT filesystem
+  - @param r Content of the image
+  - @returns The filesystem or an error
+*/
+func openFAT(r io.ReaderAt) (*fat, error) {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("cannot read boot sector: %w", err)
+	}
+
+	sectorSize := int64(binary.LittleEndian.Uint16(boot[11:]))
+	perCluster := int64(boot[13])
+	reserved := int64(binary.LittleEndian.Uint16(boot[14:]))
+	fats := int64(boot[16])
+	rootEntries := int64(binary.LittleEndian.Uint16(boot[17:]))
+	total := int64(binary.LittleEndian.Uint16(boot[19:]))
+	if total == 0 {
+		total = int64(binary.LittleEndian.Uint32(boot[32:]))
+	}
+	fatSize := int64(binary.LittleEndian.Uint16(boot[22:]))
+	if fatSize == 0 {
+		fatSize = int64(binary.LittleEndian.Uint32(boot[36:]))
+	}
+	if sectorSize == 0 || perCluster == 0 || fats == 0 || fatSize == 0 {
+		return nil, errors.New("invalid FAT boot sector")
+	}
+
+	rootSectors := (rootEntries*fatEntrySize + sectorSize - 1) / sectorSize
+	dataSector := reserved + fats*fatSize + rootSectors
+	if total <= dataSector {
+		return nil, errors.New("invalid FAT size")
+	}
+
+	f := &fat{
+		r:           r,
+		clusterSize: sectorSize * perCluster,
+		clusters:    uint32((total - dataSector) / perCluster),
+		fatStart:    reserved * sectorSize,
+		dataStart:   dataSector * sectorSize,
+		rootDir:     &node{name: ".", dir: true},
+	}
+
+	// The type only depends on the number of clusters
+	switch {
+	case f.clusters < 4085:
+		f.bits = 12
+	case f.clusters < 65525:
+		f.bits = 16
+	default:
+		f.bits = 32
+	}
+
+	if f.bits == 32 {
+		f.label = string(boot[71:82])
+		f.rootDir.id = uint64(binary.LittleEndian.Uint32(boot[44:]))
+	} else {
+		f.label = string(boot[43:54])
+		size := rootEntries * fatEntrySize
+		f.rootDir.size = size
+		f.rootDir.extents = []extent{{pos: (reserved + fats*fatSize) * sectorSize, len: size}}
+	}
+	f.label = strings.TrimSpace(f.label)
+	if f.label == "NO NAME" {
+		f.label = ""
+	}
+
+	return f, nil
+}
+
+/*
+Get the next cluster of a chain
+  - @param cluster Current cluster
+  - @returns The next cluster, 0 at the end of the chain, or an error
+*/
+func (f *fat) next(cluster uint32) (uint32, error) {
+	var next, end uint32
+	b := make([]byte, 4)
+
+	switch f.bits {
+	case 12:
+		if _, err := f.r.ReadAt(b[:2], f.fatStart+int64(cluster+cluster/2)); err != nil {
+			return 0, err
+		}
+		next = uint32(binary.LittleEndian.Uint16(b))
+		if cluster%2 == 1 {
+			next >>= 4
+		}
+		next &= 0xfff
+		end = 0xff8
+	case 16:
+		if _, err := f.r.ReadAt(b[:2], f.fatStart+int64(cluster)*2); err != nil {
+			return 0, err
+		}
+		next = uint32(binary.LittleEndian.Uint16(b))
+		end = 0xfff8
+	default:
+		if _, err := f.r.ReadAt(b, f.fatStart+int64(cluster)*4); err != nil {
+			return 0, err
+		}
+		next = binary.LittleEndian.Uint32(b) & 0x0fffffff
+		end = 0x0ffffff8
+	}
+
+	switch {
+	case next >= end:
+		return 0, nil
+	case next < 2 || next >= f.clusters+2:
+		return 0, fmt.Errorf("invalid cluster %d after %d", next, cluster)
+	}
+
+	return next, nil
+}
+
+/*
+Get the extents of a cluster chain
+  - @param first First cluster of the chain
+  - @param size Size of the content, the whole chain is used if negative
+  - @returns The extents and the size of the content, or an error
+*/
+func (f *fat) chain(first uint32, size int64) ([]extent, int64, error) {
+	var extents []extent
+	var off int64
+
+	for cluster, count := first, uint32(0); cluster != 0; count++ {
+		if count > f.clusters {
+			return nil, 0, fmt.Errorf("loop in cluster chain from %d", first)
+		}
+
+		pos := f.dataStart + int64(cluster-2)*f.clusterSize
+		// Contiguous clusters are merged
+		if last := len(extents) - 1; last >= 0 && extents[last].pos+extents[last].len == pos {
+			extents[last].len += f.clusterSize
+		} else {
+			extents = append(extents, extent{off: off, pos: pos, len: f.clusterSize})
+		}
+		off += f.clusterSize
+
+		var err error
+		if cluster, err = f.next(cluster); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if size < 0 {
+		size = off
+	}
+	if size > off {
+		return nil, 0, fmt.Errorf("cluster chain from %d is shorter than %d bytes", first, size)
+	}
+
+	return extents, size, nil
+}
+
+func (f *fat) root() *node {
+	return f.rootDir
+}
+
+func (f *fat) readDir(dir *node) ([]*node, error) {
+	// Directories other than the FAT12/16 root one are cluster chains without size
+	if dir.extents == nil {
+		extents, size, err := f.chain(uint32(dir.id), -1)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read directory %s: %w", dir.name, err)
+		}
+		dir.extents, dir.size = extents, size
+	}
+
+	data := make([]byte, dir.size)
+	if _, err := (&extentReader{r: f.r, extents: dir.extents, size: dir.size}).ReadAt(data, 0); err != nil {
+		return nil, fmt.Errorf("cannot read directory %s: %w", dir.name, err)
+	}
+
+	var entries []*node
+	var long []uint16
+	for off := 0; off+fatEntrySize <= len(data); off += fatEntrySize {
+		e := data[off : off+fatEntrySize]
+		attr := e[11]
+
+		switch {
+		case e[0] == 0x00:
+			return entries, nil
+		case e[0] == 0xe5:
+			long = nil
+			continue
+		case attr&0x3f == 0x0f:
+			// Long name parts are stored backward, before the short entry
+			part := make([]uint16, 0, 13)
+			for _, r := range [][2]int{{1, 11}, {14, 26}, {28, 32}} {
+				for i := r[0]; i < r[1]; i += 2 {
+					part = append(part, binary.LittleEndian.Uint16(e[i:]))
+				}
+			}
+			if e[0]&0x40 != 0 {
+				long = nil
+			}
+			long = append(part, long...)
+			continue
+		case attr&0x08 != 0:
+			// Volume label
+			long = nil
+			continue
+		}
+
+		n := &node{
+			dir:  attr&0x10 != 0,
+			size: int64(binary.LittleEndian.Uint32(e[28:])),
+			id:   uint64(binary.LittleEndian.Uint16(e[20:]))<<16 | uint64(binary.LittleEndian.Uint16(e[26:])),
+		}
+		n.name = fatShortName(e)
+		if long != nil {
+			// Long names end with a NUL, then are padded with 0xffff
+			for i, c := range long {
+				if c == 0 {
+					long = long[:i]
+					break
+				}
+			}
+			n.name = string(utf16.Decode(long))
+			long = nil
+		}
+		if n.name == "." || n.name == ".." {
+			continue
+		}
+
+		date, t := binary.LittleEndian.Uint16(e[24:]), binary.LittleEndian.Uint16(e[22:])
+		n.modTime = time.Date(1980+int(date>>9), time.Month(date>>5&0x0f), int(date&0x1f),
+			int(t>>11), int(t>>5&0x3f), int(t&0x1f)*2, 0, time.UTC)
+
+		if n.dir {
+			n.size = 0
+		} else if n.size > 0 {
+			extents, _, err := f.chain(uint32(n.id), n.size)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %s: %w", n.name, err)
+			}
+			n.extents = extents
+		}
+		entries = append(entries, n)
+	}
+
+	return entries, nil
+}
+
+/*
+Get the 8.3 name of a directory entry
+  - @param e Directory entry
+  - @returns The name, lowercase parts are set by flags
+*/
+func fatShortName(e []byte) string {
+	base := strings.TrimRight(string(e[:8]), " ")
+	ext := strings.TrimRight(string(e[8:11]), " ")
+	if e[0] == 0x05 {
+		base = "\xe5" + base[1:]
+	}
+	if e[12]&0x08 != 0 {
+		base = strings.ToLower(base)
+	}
+	if e[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+
+	if ext == "" {
+		return base
+	}
+
+	return base + "." + ext
+}
@@ -0,0 +1,217 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Part of a file stored contiguously in an image
+type extent struct {
+	// Offset in the file
+	off int64
+	// Offset in the image, or -1 for a hole
+	pos int64
+	len int64
+}
+
+// Content of a file, stored in extents
+type extentReader struct {
+	r       io.ReaderAt
+	extents []extent
+	size    int64
+}
+
+func (e *extentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= e.size {
+		return 0, io.EOF
+	}
+
+	var n int
+	for n < len(p) && off < e.size {
+		// Default to a hole until the next extent
+		chunk := min(int64(len(p)-n), e.size-off)
+		pos := int64(-1)
+		for _, x := range e.extents {
+			if off >= x.off && off < x.off+x.len {
+				chunk = min(chunk, x.off+x.len-off)
+				if x.pos >= 0 {
+					pos = x.pos + off - x.off
+				}
+				break
+			}
+			if x.off > off {
+				chunk = min(chunk, x.off-off)
+			}
+		}
+
+		if pos < 0 {
+			clear(p[n : n+int(chunk)])
+		} else if _, err := e.r.ReadAt(p[n:n+int(chunk)], pos); err != nil {
+			return n, err
+		}
+		n += int(chunk)
+		off += chunk
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// File or directory of an image
+type node struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+	extents []extent
+
+	// Specific to the filesystem, e.g. an inode number
+	id uint64
+}
+
+func (n *node) Name() string               { return n.name }
+func (n *node) Size() int64                { return n.size }
+func (n *node) ModTime() time.Time         { return n.modTime }
+func (n *node) IsDir() bool                { return n.dir }
+func (n *node) Sys() any                   { return nil }
+func (n *node) Type() fs.FileMode          { return n.Mode().Type() }
+func (n *node) Info() (fs.FileInfo, error) { return n, nil }
+
+func (n *node) Mode() fs.FileMode {
+	if n.dir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+// Filesystem format, read from an image
+type tree interface {
+	// Root directory
+	root() *node
+	// Entries of a directory, without . and ..
+	readDir(dir *node) ([]*node, error)
+}
+
+// Read-only filesystem of an image
+type imageFS struct {
+	r    io.ReaderAt
+	tree tree
+
+	// Names are compared without case, e.g. on FAT
+	fold bool
+}
+
+func (f *imageFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	n := f.tree.root()
+	if name != "." {
+		for part := range strings.SplitSeq(name, "/") {
+			next, err := f.lookup(n, part)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			n = next
+		}
+	}
+
+	return &file{fs: f, node: n, content: io.NewSectionReader(&extentReader{r: f.r, extents: n.extents, size: n.size}, 0, n.size)}, nil
+}
+
+/*
+Find an entry of a directory
+  - @param dir Directory to look into
+  - @param name Name of the entry
+  - @returns The entry or an error
+*/
+func (f *imageFS) lookup(dir *node, name string) (*node, error) {
+	if !dir.dir {
+		return nil, fs.ErrNotExist
+	}
+
+	entries, err := f.tree.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.name == name || (f.fold && strings.EqualFold(e.name, name)) {
+			return e, nil
+		}
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+// Opened file or directory of an image
+type file struct {
+	fs      *imageFS
+	node    *node
+	content *io.SectionReader
+
+	// Directory entries not read yet, nil until the first call to ReadDir
+	entries []*node
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.node, nil }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.node.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.node.name, Err: errors.New("is a directory")}
+	}
+
+	return f.content.Read(p)
+}
+
+func (f *file) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !f.node.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.node.name, Err: errors.New("not a directory")}
+	}
+
+	if f.entries == nil {
+		entries, err := f.fs.tree.readDir(f.node)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = append(make([]*node, 0, len(entries)), entries...)
+	}
+
+	n := len(f.entries)
+	if count > 0 {
+		if n == 0 {
+			return nil, io.EOF
+		}
+		n = min(n, count)
+	}
+
+	list := make([]fs.DirEntry, n)
+	for i, e := range f.entries[:n] {
+		list[i] = e
+	}
+	f.entries = f.entries[n:]
+
+	return list, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// Size of a sector of a raw image
+	rawSectorSize = 512
+
+	// Signature of the GPT header, in the second sector
+	gptSignature = "EFI PART"
+)
+
+// Type of the EFI system partition, as stored on disk
+var efiPartitionType = []byte{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}
+
+// Partition of a raw image
+type Partition struct {
+	Number int
+	Name   string
+	EFI    bool
+
+	// Offset and size in bytes
+	Start int64
+	Size  int64
+}
+
+/*
+Check if an image is a raw disk with a GPT
+  - @param r Content of the image
+  - @returns True if it is
+*/
+func isGPT(r io.ReaderAt) bool {
+	sig := make([]byte, len(gptSignature))
+	_, err := r.ReadAt(sig, rawSectorSize)
+
+	return err == nil && string(sig) == gptSignature
+}
+
+/*
+Read the partitions of a raw image
+  - @param r Content of the image
+  - @returns The partitions or an error
+*/
+func readGPT(r io.ReaderAt) ([]Partition, error) {
+	header := make([]byte, 92)
+	if _, err := r.ReadAt(header, rawSectorSize); err != nil {
+		return nil, fmt.Errorf("cannot read GPT header: %w", err)
+	}
+	if string(header[:8]) != gptSignature {
+		return nil, errors.New("no GPT header")
+	}
+
+	start := int64(binary.LittleEndian.Uint64(header[72:])) * rawSectorSize
+	count := binary.LittleEndian.Uint32(header[80:])
+	size := binary.LittleEndian.Uint32(header[84:])
+	if size < 128 || count > 1024 {
+		return nil, fmt.Errorf("invalid GPT header: %d entries of %d bytes", count, size)
+	}
+
+	entries := make([]byte, int64(count)*int64(size))
+	if _, err := r.ReadAt(entries, start); err != nil {
+		return nil, fmt.Errorf("cannot read GPT entries: %w", err)
+	}
+
+	var parts []Partition
+	unused := make([]byte, 16)
+	for i := range int(count) {
+		e := entries[i*int(size) : (i+1)*int(size)]
+		if bytes.Equal(e[:16], unused) {
+			continue
+		}
+
+		first := int64(binary.LittleEndian.Uint64(e[32:]))
+		last := int64(binary.LittleEndian.Uint64(e[40:]))
+
+		name := make([]uint16, 36)
+		for j := range name {
+			name[j] = binary.LittleEndian.Uint16(e[56+2*j:])
+		}
+
+		parts = append(parts, Partition{
+			Number: i + 1,
+			Name:   strings.TrimRight(string(utf16.Decode(name)), "\x00"),
+			EFI:    bytes.Equal(e[:16], efiPartitionType),
+			Start:  first * rawSectorSize,
+			Size:   (last - first + 1) * rawSectorSize,
+		})
+	}
+
+	return parts, nil
+}
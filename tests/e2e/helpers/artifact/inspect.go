@@ -0,0 +1,398 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"gopkg.in/yaml.v3"
+)
+
+// Format of a SeedImage artifact
+type Format string
+
+const (
+	FormatISO Format = "iso"
+	FormatRaw Format = "raw"
+)
+
+const (
+	// Files bigger than this are not parsed as cloud-config
+	maxConfigSize = 1 << 20
+
+	// Files smaller than this are not checked as root images
+	minRootImageSize = 1 << 20
+
+	// Magic number of a squashfs image
+	squashfsMagic = "hsqs"
+)
+
+// Filesystem found in an artifact
+type Filesystem struct {
+	// Where the filesystem is: iso, eltorito or the name of a partition
+	Name  string
+	Label string
+	fs.FS
+}
+
+// Cloud-config embedded in an artifact
+type Config struct {
+	// Filesystem and path of the file
+	Path string
+
+	RegistrationURL string
+	// Content of the written files, by path
+	WriteFiles map[string]string
+}
+
+// Content of a SeedImage artifact
+type Report struct {
+	File       string
+	Format     Format
+	Partitions []Partition
+
+	// Files found, prefixed by their filesystem
+	EFILoaders  []string
+	GrubConfigs []string
+	RootImages  []string
+	Configs     []Config
+}
+
+// Content expected in a SeedImage artifact
+type Expect struct {
+	RegistrationURL string
+	// Content of the files written by the cloud-config of the SeedImage, by path
+	WriteFiles map[string]string
+}
+
+// Part of a cloud-config used by the checks
+type cloudConfig struct {
+	Elemental struct {
+		Registration struct {
+			URL string `yaml:"url" json:"url"`
+		} `yaml:"registration" json:"registration"`
+	} `yaml:"elemental" json:"elemental"`
+	WriteFiles []struct {
+		Path    string `yaml:"path" json:"path"`
+		Content string `yaml:"content" json:"content"`
+	} `yaml:"write_files" json:"write_files"`
+}
+
+/*
+Get the content of the written files
+  - @remarks Files written several times are appended
+  - @returns The content by path
+*/
+func (c *cloudConfig) writeFiles() map[string]string {
+	files := map[string]string{}
+	for _, f := range c.WriteFiles {
+		files[f.Path] += f.Content
+	}
+
+	return files
+}
+
+/*
+Get what a SeedImage artifact must contain
+  - @param reg MachineRegistration used by the SeedImage
+  - @param seed SeedImage which built the artifact
+  - @returns What is expected or an error
+*/
+func ExpectFrom(reg *elemental.MachineRegistration, seed *elemental.SeedImage) (Expect, error) {
+	var c cloudConfig
+	if seed.Spec.CloudConfig != nil {
+		data, err := json.Marshal(seed.Spec.CloudConfig)
+		if err != nil {
+			return Expect{}, err
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return Expect{}, fmt.Errorf("invalid cloud-config in SeedImage %s: %w", seed.Name, err)
+		}
+	}
+
+	return Expect{RegistrationURL: reg.Status.RegistrationURL, WriteFiles: c.writeFiles()}, nil
+}
+
+/*
+Inspect a SeedImage artifact without booting it
+  - @param file ISO or raw image
+  - @returns What the artifact contains or an error if it cannot be read
+*/
+func Inspect(file string) (*Report, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{File: file}
+	filesystems, err := report.open(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	for _, fsys := range filesystems {
+		if err := report.walk(fsys); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", file, fsys.Name, err)
+		}
+	}
+
+	return report, nil
+}
+
+/*
+Get the filesystems of an artifact
+  - @remarks Hybrid ISO also have a partition table, so ISO is checked first
+  - @param img Content of the artifact
+  - @param size Size of the artifact
+  - @returns The filesystems or an error
+*/
+func (r *Report) open(img io.ReaderAt, size int64) ([]Filesystem, error) {
+	switch {
+	case isISO9660(img):
+		r.Format = FormatISO
+
+		iso, err := openISO9660(img)
+		if err != nil {
+			return nil, err
+		}
+		filesystems := []Filesystem{{Name: "iso", FS: &imageFS{r: img, tree: iso}}}
+
+		off, err := iso.efiImage()
+		if err != nil {
+			return nil, err
+		}
+		if off > 0 {
+			efi := io.NewSectionReader(img, off, size-off)
+			if !isFAT(efi) {
+				return nil, errors.New("EFI boot image is not a FAT filesystem")
+			}
+			f, err := openFAT(efi)
+			if err != nil {
+				return nil, fmt.Errorf("EFI boot image: %w", err)
+			}
+			filesystems = append(filesystems, Filesystem{Name: "eltorito", Label: f.label, FS: &imageFS{r: efi, tree: f, fold: true}})
+		}
+
+		return filesystems, nil
+
+	case isGPT(img):
+		r.Format = FormatRaw
+
+		parts, err := readGPT(img)
+		if err != nil {
+			return nil, err
+		}
+		r.Partitions = parts
+
+		var filesystems []Filesystem
+		for _, p := range parts {
+			name := p.Name
+			if name == "" {
+				name = fmt.Sprintf("part%d", p.Number)
+			}
+
+			// Other partitions, e.g. swap or empty ones, are not inspected
+			sr := io.NewSectionReader(img, p.Start, p.Size)
+			switch {
+			case isFAT(sr):
+				f, err := openFAT(sr)
+				if err != nil {
+					return nil, fmt.Errorf("partition %s: %w", name, err)
+				}
+				filesystems = append(filesystems, Filesystem{Name: name, Label: f.label, FS: &imageFS{r: sr, tree: f, fold: true}})
+			case isExt4(sr):
+				e, err := openExt4(sr)
+				if err != nil {
+					return nil, fmt.Errorf("partition %s: %w", name, err)
+				}
+				filesystems = append(filesystems, Filesystem{Name: name, Label: e.label, FS: &imageFS{r: sr, tree: e}})
+			}
+		}
+
+		return filesystems, nil
+	}
+
+	return nil, errors.New("neither an ISO9660 image nor a raw image with a GPT")
+}
+
+/*
+Look for the boot files and the configurations in a filesystem
+  - @param fsys Filesystem to walk
+  - @returns Nothing or an error if the filesystem is corrupted
+*/
+func (r *Report) walk(fsys Filesystem) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name := fsys.Name + ":/" + p
+		lower := strings.ToLower(p)
+		switch {
+		case path.Dir(lower) == "efi/boot" && strings.HasPrefix(path.Base(lower), "boot") && path.Ext(lower) == ".efi":
+			r.EFILoaders = append(r.EFILoaders, name)
+		case path.Base(lower) == "grub.cfg" && info.Size() > 0:
+			r.GrubConfigs = append(r.GrubConfigs, name)
+		case info.Size() >= minRootImageSize:
+			kind, err := rootImage(fsys, p)
+			if err != nil {
+				return err
+			}
+			if kind != "" {
+				r.RootImages = append(r.RootImages, name+" ("+kind+")")
+			}
+		case (path.Ext(lower) == ".yaml" || path.Ext(lower) == ".yml") && info.Size() <= maxConfigSize:
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			// Other YAML files are not cloud-config, they are ignored
+			var c cloudConfig
+			if yaml.Unmarshal(data, &c) == nil && (c.Elemental.Registration.URL != "" || len(c.WriteFiles) > 0) {
+				r.Configs = append(r.Configs, Config{Path: name, RegistrationURL: c.Elemental.Registration.URL, WriteFiles: c.writeFiles()})
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+Get the kind of a root image
+  - @param fsys Filesystem of the file
+  - @param p Path of the file
+  - @returns squashfs, ext or empty if it is not a root image, or an error
+*/
+func rootImage(fsys fs.FS, p string) (string, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Enough to get the ext magic number, in the superblock
+	head := make([]byte, extSuperblock+58)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", p, err)
+	}
+
+	switch {
+	case string(head[:4]) == squashfsMagic:
+		return "squashfs", nil
+	case binary.LittleEndian.Uint16(head[extSuperblock+56:]) == extMagic:
+		return "ext", nil
+	}
+
+	return "", nil
+}
+
+/*
+Check that the artifact can boot and register
+  - @param e What the artifact must contain
+  - @returns Nothing or an error listing all the issues found
+*/
+func (r *Report) Check(e Expect) error {
+	var errs []error
+
+	if len(r.EFILoaders) == 0 {
+		errs = append(errs, errors.New("no EFI boot loader"))
+	}
+	if len(r.GrubConfigs) == 0 {
+		errs = append(errs, errors.New("no grub configuration"))
+	}
+	if len(r.RootImages) == 0 {
+		errs = append(errs, errors.New("no root image"))
+	}
+
+	var urls []string
+	for _, c := range r.Configs {
+		if c.RegistrationURL != "" {
+			urls = append(urls, c.RegistrationURL)
+		}
+	}
+	switch {
+	case len(urls) == 0:
+		errs = append(errs, errors.New("no registration configuration"))
+	case e.RegistrationURL != "" && !slices.Contains(urls, e.RegistrationURL):
+		errs = append(errs, fmt.Errorf("registration URL %s not found, got %s", e.RegistrationURL, strings.Join(urls, ", ")))
+	}
+
+	for file, content := range e.WriteFiles {
+		found := slices.ContainsFunc(r.Configs, func(c Config) bool {
+			written, ok := c.WriteFiles[file]
+			return ok && strings.TrimSpace(written) == strings.TrimSpace(content)
+		})
+		if !found {
+			errs = append(errs, fmt.Errorf("cloud-config does not write %s with %q", file, content))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", r.File, err)
+	}
+
+	return nil
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s (%s)\n", r.File, r.Format)
+	for _, p := range r.Partitions {
+		fmt.Fprintf(&b, "  partition %d %q: %d bytes at %d, EFI: %t\n", p.Number, p.Name, p.Size, p.Start, p.EFI)
+	}
+	for _, list := range []struct {
+		title string
+		files []string
+	}{
+		{"EFI loader", r.EFILoaders},
+		{"grub configuration", r.GrubConfigs},
+		{"root image", r.RootImages},
+	} {
+		for _, f := range list.files {
+			fmt.Fprintf(&b, "  %s: %s\n", list.title, f)
+		}
+	}
+	for _, c := range r.Configs {
+		files := make([]string, 0, len(c.WriteFiles))
+		for f := range c.WriteFiles {
+			files = append(files, f)
+		}
+		slices.Sort(files)
+		fmt.Fprintf(&b, "  cloud-config: %s, registration URL %q, writes %s\n", c.Path, c.RegistrationURL, strings.Join(files, ", "))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,320 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// Size of an ISO9660 sector
+	isoSectorSize = 2048
+
+	// First sector of the volume descriptors
+	isoDescriptorSector = 16
+
+	// Identifier of the ISO9660 volume descriptors
+	isoIdentifier = "CD001"
+)
+
+// ISO9660 filesystem
+// NOTE: Rock Ridge names are used if present, then Joliet ones, relocated directories are not followed
+type iso9660 struct {
+	r       io.ReaderAt
+	rootDir *node
+
+	joliet    bool
+	rockRidge bool
+
+	// Sector of the El Torito boot catalog, 0 if the ISO cannot boot
+	bootCatalog uint32
+}
+
+/*
+Check if an image is an ISO9660 one
+  - @param r Content of the image
+  - @returns True if it is
+*/
+func isISO9660(r io.ReaderAt) bool {
+	id := make([]byte, len(isoIdentifier))
+	_, err := r.ReadAt(id, isoDescriptorSector*isoSectorSize+1)
+
+	return err == nil && string(id) == isoIdentifier
+}
+
+/*
+Open an ISO9660 filesystem
+  - @param r Content of the image
+  - @returns The filesystem or an error
+*/
+func openISO9660(r io.ReaderAt) (*iso9660, error) {
+	iso := &iso9660{r: r}
+
+	var primary, joliet *node
+	sector := make([]byte, isoSectorSize)
+	for i := int64(isoDescriptorSector); ; i++ {
+		if _, err := r.ReadAt(sector, i*isoSectorSize); err != nil {
+			return nil, fmt.Errorf("cannot read volume descriptor %d: %w", i, err)
+		}
+		if string(sector[1:6]) != isoIdentifier {
+			return nil, fmt.Errorf("invalid volume descriptor %d", i)
+		}
+
+		switch sector[0] {
+		case 0:
+			if strings.HasPrefix(string(sector[7:39]), "EL TORITO SPECIFICATION") {
+				iso.bootCatalog = binary.LittleEndian.Uint32(sector[71:])
+			}
+		case 1:
+			primary = isoRecord(sector[156:190], false)
+		case 2:
+			// Joliet is a supplementary descriptor with UCS-2 escape sequences
+			if esc := string(sector[88:91]); esc == "%/@" || esc == "%/C" || esc == "%/E" {
+				joliet = isoRecord(sector[156:190], true)
+			}
+		}
+
+		if sector[0] == 255 {
+			break
+		}
+	}
+	if primary == nil {
+		return nil, errors.New("no primary volume descriptor")
+	}
+
+	// Rock Ridge is announced by a SUSP entry in the first record of the root directory
+	first := make([]byte, 255)
+	if _, err := r.ReadAt(first, primary.extents[0].pos); err != nil {
+		return nil, fmt.Errorf("cannot read root directory: %w", err)
+	}
+	if su := isoSystemUse(first); len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef {
+		iso.rockRidge = true
+	}
+
+	iso.rootDir = primary
+	if !iso.rockRidge && joliet != nil {
+		iso.rootDir, iso.joliet = joliet, true
+	}
+	iso.rootDir.name = "."
+
+	return iso, nil
+}
+
+/*
+Open the filesystem of an ISO
+  - @remarks Files are read on demand, the content must stay available while the filesystem is used
+  - @param r Content of the ISO
+  - @returns The filesystem or an error
+*/
+func OpenISO(r io.ReaderAt) (fs.FS, error) {
+	if !isISO9660(r) {
+		return nil, errors.New("not an ISO9660 image")
+	}
+	iso, err := openISO9660(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageFS{r: r, tree: iso}, nil
+}
+
+/*
+Parse a directory record
+  - @param rec Record
+  - @param joliet True if the name is UCS-2 encoded
+  - @returns The file or directory
+*/
+func isoRecord(rec []byte, joliet bool) *node {
+	n := &node{
+		dir:  rec[25]&0x02 != 0,
+		size: int64(binary.LittleEndian.Uint32(rec[10:])),
+	}
+	n.extents = []extent{{pos: int64(binary.LittleEndian.Uint32(rec[2:])) * isoSectorSize, len: n.size}}
+
+	// Time offset is given in 15 minutes intervals
+	t := rec[18:25]
+	n.modTime = time.Date(1900+int(t[0]), time.Month(t[1]), int(t[2]), int(t[3]), int(t[4]), int(t[5]), 0,
+		time.FixedZone("", int(int8(t[6]))*15*60))
+
+	name := rec[33 : 33+int(rec[32])]
+	if joliet {
+		u := make([]uint16, len(name)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(name[2*i:])
+		}
+		n.name = string(utf16.Decode(u))
+	} else {
+		n.name = string(name)
+	}
+
+	// Version and empty extension are not part of the name
+	if !n.dir {
+		n.name, _, _ = strings.Cut(n.name, ";")
+		n.name = strings.TrimSuffix(n.name, ".")
+	}
+
+	return n
+}
+
+/*
+Get the System Use area of a directory record, where Rock Ridge entries are stored
+  - @param rec Record
+  - @returns The area, can be empty
+*/
+func isoSystemUse(rec []byte) []byte {
+	start := 33 + int(rec[32])
+	// Name is padded to an even length
+	if start%2 != 0 {
+		start++
+	}
+	if start > int(rec[0]) {
+		return nil
+	}
+
+	return rec[start:rec[0]]
+}
+
+/*
+Get the Rock Ridge name of a directory record
+  - @param su System Use area of the record
+  - @returns The name, true if set and false if the entry must be hidden (relocated directory)
+*/
+func rockRidgeName(su []byte) (string, bool, bool) {
+	var name []byte
+	var found bool
+
+	for len(su) >= 4 && su[2] >= 4 && int(su[2]) <= len(su) {
+		entry := su[:su[2]]
+		su = su[su[2]:]
+
+		switch string(entry[:2]) {
+		case "NM":
+			if len(entry) > 5 && entry[4]&0x06 == 0 {
+				name = append(name, entry[5:]...)
+				found = true
+			}
+		case "RE":
+			return "", false, false
+		case "ST":
+			return string(name), found, true
+		}
+	}
+
+	return string(name), found, true
+}
+
+func (iso *iso9660) root() *node {
+	return iso.rootDir
+}
+
+func (iso *iso9660) readDir(dir *node) ([]*node, error) {
+	data := make([]byte, dir.size)
+	if _, err := iso.r.ReadAt(data, dir.extents[0].pos); err != nil {
+		return nil, fmt.Errorf("cannot read directory %s: %w", dir.name, err)
+	}
+
+	var entries []*node
+	var multiExtent bool
+	for off := 0; off < len(data); {
+		size := int(data[off])
+		// Records do not cross sectors, the end of a sector is filled with zeros
+		if size == 0 {
+			off = (off/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if size < 34 || off+size > len(data) || 33+int(data[off+32]) > size {
+			return nil, fmt.Errorf("invalid record in directory %s at %d", dir.name, off)
+		}
+		rec := data[off : off+size]
+		off += size
+
+		// Current and parent directories
+		if rec[32] == 1 && (rec[33] == 0 || rec[33] == 1) {
+			continue
+		}
+
+		n := isoRecord(rec, iso.joliet)
+		if iso.rockRidge {
+			name, found, visible := rockRidgeName(isoSystemUse(rec))
+			if !visible {
+				continue
+			}
+			if found {
+				n.name = name
+			}
+		}
+
+		// Big files are stored in several records with the same name
+		if multiExtent && len(entries) > 0 && entries[len(entries)-1].name == n.name {
+			last := entries[len(entries)-1]
+			n.extents[0].off = last.size
+			last.extents = append(last.extents, n.extents[0])
+			last.size += n.size
+		} else {
+			entries = append(entries, n)
+		}
+		multiExtent = rec[25]&0x80 != 0
+	}
+
+	return entries, nil
+}
+
+/*
+Get the EFI boot image of the ISO
+  - @remarks The image is a FAT filesystem, referenced by the El Torito boot catalog
+  - @returns Offset of the image in the ISO, 0 if there is none, or an error
+*/
+func (iso *iso9660) efiImage() (int64, error) {
+	if iso.bootCatalog == 0 {
+		return 0, nil
+	}
+
+	catalog := make([]byte, isoSectorSize)
+	if _, err := iso.r.ReadAt(catalog, int64(iso.bootCatalog)*isoSectorSize); err != nil {
+		return 0, fmt.Errorf("cannot read boot catalog: %w", err)
+	}
+	if catalog[0] != 0x01 || catalog[30] != 0x55 || catalog[31] != 0xaa {
+		return 0, errors.New("invalid boot catalog")
+	}
+
+	// Validation entry gives the platform of the default entry, section headers the one of their entries
+	const efiPlatform = 0xef
+	platform := catalog[1]
+	for off := 32; off+32 <= len(catalog); off += 32 {
+		entry := catalog[off : off+32]
+		switch entry[0] {
+		case 0x88:
+			if platform == efiPlatform {
+				return int64(binary.LittleEndian.Uint32(entry[8:])) * isoSectorSize, nil
+			}
+		case 0x90, 0x91:
+			platform = entry[1]
+		case 0x00:
+			if bytes.Equal(entry, make([]byte, 32)) {
+				return 0, nil
+			}
+		}
+	}
+
+	return 0, nil
+}
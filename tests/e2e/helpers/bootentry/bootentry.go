@@ -0,0 +1,94 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootentry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+)
+
+// Grub entry of an Elemental system
+type Entry string
+
+const (
+	Active Entry = "active"
+	// Fallback, only available once the system has been upgraded
+	Passive  Entry = "passive"
+	Recovery Entry = "recovery"
+)
+
+// Grub environment file read by the Elemental boot loader
+const GrubEnvFile = "/oem/grubenv"
+
+/*
+Get the mode of a node booted with this entry
+  - @returns The boot mode
+*/
+func (e Entry) Mode() probe.BootMode {
+	return probe.BootMode(e)
+}
+
+/*
+Select the entry used at the next boot
+  - @remarks Grub resets the selection once used, the default entry is booted after
+  - @param ctx Context used to stop the command
+  - @param r Runner of the node
+  - @param e Entry to boot
+  - @returns Nothing or an error
+*/
+func SetNext(ctx context.Context, r probe.Runner, e Entry) error {
+	res, err := r.Run(ctx, "grub2-editenv "+GrubEnvFile+" set next_entry="+string(e))
+	if err != nil {
+		return err
+	}
+
+	return res.Err()
+}
+
+/*
+Check that a node booted with the expected entry
+  - @param e Entry expected
+  - @param active State of the node booted with the active entry, used as reference
+  - @param s State of the node after the boot
+  - @returns Nothing or an error listing all the differences
+*/
+func Verify(e Entry, active, s *probe.State) error {
+	var errs []error
+
+	if s.BootMode != e.Mode() {
+		errs = append(errs, fmt.Errorf("booted in %q mode instead of %q", s.BootMode, e.Mode()))
+	}
+	if next := s.GrubEnv["next_entry"]; next != "" {
+		errs = append(errs, fmt.Errorf("next_entry=%s is still set after the boot", next))
+	}
+
+	switch {
+	case s.RootImage == "":
+		errs = append(errs, errors.New("mounted image is unknown"))
+	case e == Active && s.RootImage != active.RootImage:
+		errs = append(errs, fmt.Errorf("mounted image is %s instead of %s", s.RootImage, active.RootImage))
+	case e != Active && s.RootImage == active.RootImage:
+		errs = append(errs, fmt.Errorf("mounted image is %s, the one of the active system", s.RootImage))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s boot: %w", e, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootentry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+// Runner recording the commands
+type fakeRunner struct {
+	commands []string
+}
+
+func (f *fakeRunner) Run(_ context.Context, cmd string) (*sshpool.Result, error) {
+	f.commands = append(f.commands, cmd)
+	return &sshpool.Result{Command: cmd}, nil
+}
+
+func TestSetNext(t *testing.T) {
+	r := &fakeRunner{}
+	if err := SetNext(context.Background(), r, Recovery); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.commands) != 1 || r.commands[0] != "grub2-editenv /oem/grubenv set next_entry=recovery" {
+		t.Errorf("commands = %q", r.commands)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	active := &probe.State{BootMode: probe.BootActive, RootImage: "/dev/vda3[/@/.snapshots/2/snapshot]"}
+	passive := &probe.State{BootMode: probe.BootPassive, RootImage: "/dev/vda3[/@/.snapshots/1/snapshot]"}
+
+	if err := Verify(Active, active, active); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(Passive, active, passive); err != nil {
+		t.Error(err)
+	}
+
+	// Entry selected but not used
+	stuck := &probe.State{BootMode: probe.BootActive, RootImage: active.RootImage, GrubEnv: map[string]string{"next_entry": "recovery"}}
+	if err := Verify(Recovery, active, stuck); err == nil {
+		t.Error("wrong boot not detected")
+	}
+}
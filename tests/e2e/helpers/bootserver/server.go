@@ -0,0 +1,350 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+// Name of the log of the requests, in the artifacts directory
+const LogName = "http-boot.log"
+
+// File served, from the disk or from memory
+type entry struct {
+	file    string
+	data    []byte
+	modTime time.Time
+}
+
+// Request received by the server
+type Request struct {
+	Time   time.Time
+	IP     string
+	MAC    string
+	Node   string
+	Method string
+	Name   string
+	Range  string
+	Status int
+	Bytes  int64
+}
+
+// Successful download, partial or not
+func (r Request) Fetched() bool {
+	return r.Method == http.MethodGet && r.Status >= 200 && r.Status < 300
+}
+
+func (r Request) String() string {
+	node := r.Node
+	if node == "" {
+		node = "-"
+	}
+	mac := r.MAC
+	if mac == "" {
+		mac = "-"
+	}
+	str := fmt.Sprintf("%s %s %s %s %s /%s %d %d", r.Time.Format(time.RFC3339), r.IP, mac, node, r.Method, r.Name, r.Status, r.Bytes)
+	if r.Range != "" {
+		str += " " + r.Range
+	}
+
+	return str
+}
+
+// HTTP server of the network boot, only serving the registered files
+type Server struct {
+	// Function giving the DHCP host of an IP address
+	Resolve func(ip string) (network.Host, bool)
+
+	// Log of the requests, nil to disable
+	Log io.Writer
+
+	mu       sync.Mutex
+	files    map[string]entry
+	hosts    map[string]network.Host
+	requests []Request
+}
+
+/*
+Create a server
+  - @param resolve Function giving the DHCP host of an IP address, nil if unknown
+  - @returns Pointer to the server, without any file
+*/
+func New(resolve func(ip string) (network.Host, bool)) *Server {
+	return &Server{
+		Resolve: resolve,
+		files:   map[string]entry{},
+		hosts:   map[string]network.Host{},
+	}
+}
+
+/*
+Get the name of a file in the URLs
+  - @param name Path of the file in the URLs, with or without leading '/'
+  - @returns The cleaned name
+*/
+func clean(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+/*
+Serve a file of the disk
+  - @remarks The file is opened on each request, it may be created or replaced later
+  - @param name Path of the file in the URLs
+  - @param file Path of the file on the disk
+  - @returns Nothing
+*/
+func (s *Server) Register(name, file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[clean(name)] = entry{file: file}
+}
+
+/*
+Serve a file from memory
+  - @param name Path of the file in the URLs
+  - @param data Content of the file
+  - @returns Nothing
+*/
+func (s *Server) RegisterData(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[clean(name)] = entry{data: slices.Clone(data), modTime: time.Now()}
+}
+
+/*
+Stop serving a file
+  - @param name Path of the file in the URLs
+  - @returns Nothing
+*/
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.files, clean(name))
+}
+
+// Sorted names of the registered files
+func (s *Server) Registered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+/*
+Get the DHCP host of a client
+  - @remarks Known hosts are cached, their address does not change during a run
+  - @param ip IP address of the client
+  - @returns The host, only with the IP if unknown
+*/
+func (s *Server) host(ip string) network.Host {
+	s.mu.Lock()
+	h, found := s.hosts[ip]
+	s.mu.Unlock()
+	if found {
+		return h
+	}
+
+	if s.Resolve != nil {
+		if h, found = s.Resolve(ip); found {
+			s.mu.Lock()
+			s.hosts[ip] = h
+			s.mu.Unlock()
+			return h
+		}
+	}
+
+	return network.Host{IP: ip}
+}
+
+// Response writer recording the status and the size of the response
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+
+	return n, err
+}
+
+// Serve a registered file, range requests included
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	h := s.host(ip)
+	req := Request{
+		Time:   time.Now(),
+		IP:     ip,
+		MAC:    h.MAC,
+		Node:   h.Name,
+		Method: r.Method,
+		Name:   clean(r.URL.Path),
+		Range:  r.Header.Get("Range"),
+	}
+
+	rec := &recorder{ResponseWriter: w}
+	s.serve(rec, r, req.Name)
+	req.Status = rec.status
+	req.Bytes = rec.bytes
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if s.Log != nil {
+		fmt.Fprintln(s.Log, req)
+	}
+	s.mu.Unlock()
+}
+
+/*
+Send a registered file
+  - @param w Writer of the response
+  - @param r Request to answer
+  - @param name Name of the requested file
+  - @returns Nothing
+*/
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	e, found := s.files[name]
+	s.mu.Unlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	if e.file == "" {
+		http.ServeContent(w, r, name, e.modTime, bytes.NewReader(e.data))
+		return
+	}
+
+	f, err := os.Open(e.file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+/*
+Get the requests of a node
+  - @param node Name of the node, empty for all the requests
+  - @returns The requests, oldest first
+*/
+func (s *Server) Requests(node string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Request
+	for _, r := range s.requests {
+		if node == "" || r.Node == node {
+			list = append(list, r)
+		}
+	}
+
+	return list
+}
+
+/*
+Count the downloads of a file by a node
+  - @remarks Each range request is counted, as a new download
+  - @param node Name of the node
+  - @param name Name of the file in the URLs
+  - @returns Number of successful downloads
+*/
+func (s *Server) Count(node, name string) int {
+	name = clean(name)
+
+	count := 0
+	for _, r := range s.Requests(node) {
+		if r.Name == name && r.Fetched() {
+			count++
+		}
+	}
+
+	return count
+}
+
+/*
+Check if a node downloaded a file
+  - @param node Name of the node
+  - @param name Name of the file in the URLs
+  - @returns True if the file was downloaded at least once
+*/
+func (s *Server) Fetched(node, name string) bool {
+	return s.Count(node, name) > 0
+}
+
+/*
+Forget the requests of a node
+  - @remarks Used before reprovisioning a node
+  - @param node Name of the node
+  - @returns Nothing
+*/
+func (s *Server) Reset(node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = slices.DeleteFunc(s.requests, func(r Request) bool {
+		return r.Node == node
+	})
+}
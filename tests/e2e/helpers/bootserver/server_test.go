@@ -0,0 +1,93 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+func get(t *testing.T, s *Server, ip, name, rng string) *http.Response {
+	r := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+	r.RemoteAddr = ip + ":4242"
+	if rng != "" {
+		r.Header.Set("Range", rng)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	return w.Result()
+}
+
+func TestServer(t *testing.T) {
+	rootfs := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.WriteFile(rootfs, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	s := New(func(ip string) (network.Host, bool) {
+		if ip == "192.168.122.3" {
+			return network.Host{Name: "node-002", MAC: "52:54:00:00:00:02", IP: ip}, true
+		}
+		return network.Host{}, false
+	})
+	s.Log = &log
+	s.Register("elemental-squashfs", rootfs)
+	s.RegisterData("/install-config.yaml", []byte("elemental: {}\n"))
+
+	resp := get(t, s, "192.168.122.3", "elemental-squashfs", "bytes=4-")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "456789" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+	if resp := get(t, s, "192.168.122.3", "install-config.yaml", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	// Only registered files are served
+	for _, name := range []string{"suite_test.go", "../etc/passwd", "elemental-squashfs/.."} {
+		if resp := get(t, s, "192.168.122.4", name, ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("%s served with %d", name, resp.StatusCode)
+		}
+	}
+
+	if !s.Fetched("node-002", "elemental-squashfs") || s.Count("node-002", "/install-config.yaml") != 1 {
+		t.Fatalf("unexpected requests %v", s.Requests("node-002"))
+	}
+	if s.Fetched("node-003", "elemental-squashfs") || len(s.Requests("")) != 5 {
+		t.Fatalf("unexpected requests %v", s.Requests(""))
+	}
+	if !strings.Contains(log.String(), "192.168.122.3 52:54:00:00:00:02 node-002 GET /elemental-squashfs 206 6 bytes=4-\n") {
+		t.Fatalf("unexpected log:\n%s", log.String())
+	}
+
+	s.Reset("node-002")
+	if s.Fetched("node-002", "elemental-squashfs") {
+		t.Fatal("requests not reset")
+	}
+	s.Unregister("install-config.yaml")
+	if names := s.Registered(); len(names) != 1 || names[0] != "elemental-squashfs" {
+		t.Fatalf("unexpected files %v", names)
+	}
+}
@@ -0,0 +1,366 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// Default interval between two calls of the resync hook
+const DefaultResync = 30 * time.Second
+
+// Default delay before restarting a watch ending without any event, doubled each time up to the resync interval
+const DefaultBackoff = time.Second
+
+// Rancher Manager provisioning cluster resource
+var Resource = schema.GroupVersionResource{
+	Group:    "provisioning.cattle.io",
+	Version:  "v1",
+	Resource: "clusters",
+}
+
+// Condition of a provisioning cluster
+type Condition struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason,omitempty"`
+	Message        string `json:"message,omitempty"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
+
+// Provisioning cluster, only the status is needed here
+type Cluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            ClusterStatus `json:"status,omitempty"`
+}
+
+type ClusterStatus struct {
+	Ready      bool        `json:"ready,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Expected status of a condition
+type Expectation struct {
+	Type   string
+	Status string
+}
+
+// Conditions expected on a stable cluster
+var DefaultExpectations = []Expectation{
+	{Type: "Connected", Status: "True"},
+	{Type: "Created", Status: "True"},
+	{Type: "NoDiskPressure", Status: "True"},
+	{Type: "NoMemoryPressure", Status: "True"},
+	{Type: "Provisioned", Status: "True"},
+	{Type: "Ready", Status: "True"},
+	{Type: "Reconciling", Status: "False"},
+	{Type: "Stalled", Status: "False"},
+	{Type: "Updated", Status: "True"},
+	{Type: "Waiting", Status: "True"},
+}
+
+// Waiter watches a cluster until all the expected conditions are met
+type Waiter struct {
+	Client    dynamic.Interface
+	Namespace string
+	Name      string
+	Expected  []Expectation
+	Timeout   time.Duration
+
+	// Hook called periodically with the last known state while waiting, can be nil
+	// NOTE: it runs in its own goroutine, so a slow hook does not delay the events
+	OnResync func(c *Cluster, unmet []Expectation)
+	Resync   time.Duration
+
+	Backoff time.Duration
+}
+
+/*
+Get a condition
+  - @param t Type of the condition
+  - @returns Pointer to the condition or nil if not found
+*/
+func (c *Cluster) Condition(t string) *Condition {
+	for i := range c.Status.Conditions {
+		if c.Status.Conditions[i].Type == t {
+			return &c.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+/*
+Get the expectations not met by the cluster
+  - @param expected Expected conditions
+  - @returns List of the unmet expectations
+*/
+func (c *Cluster) Unmet(expected []Expectation) []Expectation {
+	var unmet []Expectation
+	for _, e := range expected {
+		if cond := c.Condition(e.Type); cond == nil || cond.Status != e.Status {
+			unmet = append(unmet, e)
+		}
+	}
+
+	return unmet
+}
+
+/*
+Check if the cluster is in the expected state
+  - @param expected Expected conditions
+  - @returns true if the cluster is ready and all expectations are met
+*/
+func (c *Cluster) Meets(expected []Expectation) bool {
+	return c.Status.Ready && len(c.Unmet(expected)) == 0
+}
+
+/*
+Convert an unstructured object to a cluster
+  - @param obj Object to convert
+  - @returns Pointer to the cluster or an error
+*/
+func decode(obj runtime.Object) (*Cluster, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+
+	c := &Cluster{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+/*
+Get a provisioning cluster
+  - @param ctx Context of the request
+  - @param client Dynamic Kubernetes client
+  - @param ns Namespace of the cluster
+  - @param name Name of the cluster
+  - @returns Pointer to the cluster or an error
+*/
+func Get(ctx context.Context, client dynamic.Interface, ns, name string) (*Cluster, error) {
+	u, err := client.Resource(Resource).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(u)
+}
+
+/*
+Wait for the cluster to meet all expectations
+  - @remarks The watch is restarted if closed by the API server before the end
+  - @param ctx Context used to stop waiting
+  - @returns The timeline of the transitions seen and nothing or an error
+*/
+func (w *Waiter) Wait(ctx context.Context) (*Timeline, error) {
+	timeline := NewTimeline()
+
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	resync := w.Resync
+	if resync <= 0 {
+		resync = DefaultResync
+	}
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	delay := backoff
+
+	// The hook is only called again once the previous call is done, the last call is waited for
+	resyncs := make(chan *Cluster, 1)
+	var wg sync.WaitGroup
+	if w.OnResync != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range resyncs {
+				w.OnResync(c, c.Unmet(w.Expected))
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(resyncs)
+
+	client := w.Client.Resource(Resource).Namespace(w.Namespace)
+	var last *Cluster
+
+	for {
+		// Get the current state before (re)starting the watch, so nothing is missed
+		u, err := client.Get(ctx, w.Name, metav1.GetOptions{})
+		if err == nil {
+			if last, err = decode(u); err == nil {
+				timeline.Record(last)
+				if last.Meets(w.Expected) {
+					return timeline, nil
+				}
+			}
+		}
+
+		var (
+			events  <-chan watch.Event
+			watcher watch.Interface
+		)
+		if err == nil {
+			watcher, err = client.Watch(ctx, metav1.ListOptions{
+				FieldSelector:   "metadata.name=" + w.Name,
+				ResourceVersion: u.GetResourceVersion(),
+			})
+			if err == nil {
+				events = watcher.ResultChan()
+			}
+		}
+
+		// Without events (cluster not created yet or watch error), retry on next tick
+		done, seen, err := w.process(ctx, events, ticker.C, resyncs, timeline, &last)
+		if watcher != nil {
+			watcher.Stop()
+		}
+		if done || err != nil {
+			return timeline, err
+		}
+
+		// A watch closed at once by the API server would be restarted in a loop
+		if seen {
+			delay = backoff
+			continue
+		}
+		if !sleep(ctx, delay) {
+			return timeline, w.timeoutError(ctx, last)
+		}
+		delay = min(2*delay, resync)
+	}
+}
+
+/*
+Sleep or stop earlier if the context is done
+  - @param ctx Context to check
+  - @param d Time to sleep
+  - @returns false if the context is done
+*/
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+/*
+Process the watch events until the watch ends
+  - @remarks The last known state is sent to resyncs on each tick, unless the hook is still busy
+  - @returns true if the cluster meets the expectations, true if the cluster was received, or an error
+*/
+func (w *Waiter) process(ctx context.Context, events <-chan watch.Event, tick <-chan time.Time, resyncs chan<- *Cluster, timeline *Timeline, last **Cluster) (bool, bool, error) {
+	seen := false
+	for {
+		select {
+		case <-ctx.Done():
+			return false, seen, w.timeoutError(ctx, *last)
+		case <-tick:
+			if w.OnResync != nil && *last != nil {
+				select {
+				case resyncs <- *last:
+				default:
+				}
+			}
+			if events == nil {
+				return false, seen, nil
+			}
+		case e, ok := <-events:
+			if !ok {
+				return false, seen, nil
+			}
+
+			switch e.Type {
+			case watch.Added, watch.Modified:
+				c, err := decode(e.Object)
+				if err != nil {
+					continue
+				}
+				seen = true
+				*last = c
+				timeline.Record(c)
+				if c.Meets(w.Expected) {
+					return true, seen, nil
+				}
+			case watch.Deleted:
+				return false, seen, fmt.Errorf("cluster %s/%s has been deleted", w.Namespace, w.Name)
+			case watch.Error:
+				// Probably an expired resource version, restart the watch
+				return false, seen, nil
+			}
+		}
+	}
+}
+
+/*
+Build the error returned when the cluster is not in the expected state in time
+  - @param ctx Expired context
+  - @param c Last known state of the cluster, can be nil
+  - @returns The error, listing all unmet expectations
+*/
+func (w *Waiter) timeoutError(ctx context.Context, c *Cluster) error {
+	if c == nil {
+		return fmt.Errorf("cluster %s/%s not found: %w", w.Namespace, w.Name, ctx.Err())
+	}
+
+	var msgs []string
+	if !c.Status.Ready {
+		msgs = append(msgs, "status.ready is false")
+	}
+	for _, e := range c.Unmet(w.Expected) {
+		status := "missing"
+		if cond := c.Condition(e.Type); cond != nil {
+			status = cond.Status
+			if cond.Message != "" {
+				status += " (" + cond.Message + ")"
+			}
+		}
+		msgs = append(msgs, fmt.Sprintf("%s is %s instead of %s", e.Type, status, e.Status))
+	}
+
+	return errors.Join(fmt.Errorf("cluster %s/%s not in expected state: %w", w.Namespace, w.Name, ctx.Err()),
+		errors.New(strings.Join(msgs, "; ")))
+}
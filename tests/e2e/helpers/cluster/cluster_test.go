@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNS = "fleet-default"
+
+func newCluster(ready bool) *unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"ready":      ready,
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": status}},
+		},
+	}}
+	u.SetAPIVersion("provisioning.cattle.io/v1")
+	u.SetKind("Cluster")
+	u.SetNamespace(testNS)
+	u.SetName("cluster")
+
+	return u
+}
+
+func newFakeClient(objs ...runtime.Object) *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Resource: "ClusterList"}, objs...)
+}
+
+func newWaiter(client *fake.FakeDynamicClient) *Waiter {
+	return &Waiter{
+		Client:    client,
+		Namespace: testNS,
+		Name:      "cluster",
+		Expected:  []Expectation{{Type: "Ready", Status: "True"}},
+		Timeout:   5 * time.Second,
+		Resync:    10 * time.Millisecond,
+		Backoff:   10 * time.Millisecond,
+	}
+}
+
+func TestWaitSlowResync(t *testing.T) {
+	client := newFakeClient(newCluster(false))
+	w := newWaiter(client)
+
+	// The hook blocks until the cluster is ready, as a node restarted over SSH
+	called := make(chan struct{})
+	var calls int32
+	w.OnResync = func(c *Cluster, unmet []Expectation) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return
+		}
+		if len(unmet) != 1 || unmet[0].Type != "Ready" {
+			t.Errorf("unexpected unmet expectations %v", unmet)
+		}
+		close(called)
+
+		_, err := client.Resource(Resource).Namespace(testNS).Update(context.Background(), newCluster(true), metav1.UpdateOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	timeline, err := w.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+	default:
+		t.Fatal("resync hook not called")
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("hook called %d times while busy", calls)
+	}
+	if timeline.String() == "" {
+		t.Error("empty timeline")
+	}
+}
+
+func TestWaitBackoff(t *testing.T) {
+	client := newFakeClient(newCluster(false))
+
+	// The API server closes each watch at once
+	var watches int32
+	client.PrependWatchReactor("*", func(k8stesting.Action) (bool, watch.Interface, error) {
+		atomic.AddInt32(&watches, 1)
+		w := watch.NewFake()
+		w.Stop()
+		return true, w, nil
+	})
+
+	w := newWaiter(client)
+	w.Timeout = 300 * time.Millisecond
+	w.Resync = 100 * time.Millisecond
+
+	// 10, 20, 40, 80, 100ms... at most 6 watches in 300ms
+	if _, err := w.Wait(context.Background()); err == nil {
+		t.Fatal("cluster not ready, but no error")
+	}
+	if n := atomic.LoadInt32(&watches); n < 2 || n > 6 {
+		t.Errorf("%d watches started in 300ms", n)
+	}
+}
+
+func TestWaitDeleted(t *testing.T) {
+	client := newFakeClient(newCluster(false))
+	w := newWaiter(client)
+	w.Resync = time.Hour
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = client.Resource(Resource).Namespace(testNS).Delete(context.Background(), "cluster", metav1.DeleteOptions{})
+	}()
+
+	if _, err := w.Wait(context.Background()); err == nil {
+		t.Error("deletion not reported")
+	}
+}
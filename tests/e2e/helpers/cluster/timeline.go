@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name used in the timeline for the .status.ready field
+const ReadyField = "status.ready"
+
+// Transition of a condition seen while waiting
+type Transition struct {
+	Time    time.Time
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// Timestamped list of the transitions seen on a cluster
+type Timeline struct {
+	Start       time.Time
+	Transitions []Transition
+
+	mu   sync.Mutex
+	last map[string]Transition
+}
+
+/*
+Create an empty timeline starting now
+  - @returns Pointer to the timeline
+*/
+func NewTimeline() *Timeline {
+	return &Timeline{
+		Start: time.Now(),
+		last:  map[string]Transition{},
+	}
+}
+
+/*
+Record the changes compared to the previous state
+  - @remarks A transition is added only when the status, reason or message changes
+  - @param c Current state of the cluster
+  - @returns Nothing
+*/
+func (t *Timeline) Record(c *Cluster) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.add(Transition{Time: now, Type: ReadyField, Status: strconv.FormatBool(c.Status.Ready)})
+	for _, cond := range c.Status.Conditions {
+		t.add(Transition{
+			Time:    now,
+			Type:    cond.Type,
+			Status:  cond.Status,
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+}
+
+func (t *Timeline) add(tr Transition) {
+	if prev, ok := t.last[tr.Type]; ok &&
+		prev.Status == tr.Status && prev.Reason == tr.Reason && prev.Message == tr.Message {
+		return
+	}
+
+	t.last[tr.Type] = tr
+	t.Transitions = append(t.Transitions, tr)
+}
+
+/*
+Format the timeline, one transition per line
+  - @returns The timeline with times relative to its start
+*/
+func (t *Timeline) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	for _, tr := range t.Transitions {
+		fmt.Fprintf(&b, "+%-8s %s=%s", tr.Time.Sub(t.Start).Round(time.Second), tr.Type, tr.Status)
+		if tr.Reason != "" {
+			fmt.Fprintf(&b, " [%s]", tr.Reason)
+		}
+		if tr.Message != "" {
+			fmt.Fprintf(&b, " %s", tr.Message)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+/*
+Write the timeline into a file
+  - @param dir Directory where to write the file
+  - @param name Name of the file
+  - @returns Path of the written file or an error
+*/
+func (t *Timeline) WriteFile(dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(t.String()), 0644); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
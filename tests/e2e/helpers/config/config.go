@@ -0,0 +1,448 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/disklayout"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Environment variable used to load a YAML profile file
+	ProfileEnv = "E2E_PROFILE"
+
+	// Default directory where the run artifacts are stored
+	// NOTE: this is relative to the e2e directory and uploaded by the CI
+	DefaultArtifactsDir = "logs/artifacts"
+
+	// Name of the file where the effective configuration is dumped
+	DumpFileName = "suite-config.yaml"
+
+	// Default limits used to start the nodes, CPU and IO wait are in percent
+	DefaultBootMaxCPU    = 90
+	DefaultBootMaxIOWait = 30
+	DefaultBootSlots     = 30
+
+	// Isolated networks use the subnets from 192.168.131.0/24 to 192.168.230.0/24, after the default one
+	MaxIsolatedNetworks = 100
+
+	// Memory of a VM, as set by the install-vm script
+	DefaultBootMinFreeHugeMiB = 4096
+
+	// Default directory of the SSH key and known host keys of the run
+	// NOTE: kept out of the artifacts directory as it contains a private key
+	DefaultSSHDir = "logs/ssh"
+)
+
+// Rancher Manager release, as channel/version/head-version
+type RancherRelease struct {
+	Channel     string
+	Version     string
+	HeadVersion string
+}
+
+// List of values, comma-separated in the environment
+type List []string
+
+// Configuration of the E2E test suite
+type SuiteConfig struct {
+	ArtifactsDir         string         `yaml:"artifactsDir" env:"ARTIFACTS_DIR"`
+	BackupRestoreVersion string         `yaml:"backupRestoreVersion" env:"BACKUP_RESTORE_VERSION"`
+	BootEntryNodes       int            `yaml:"bootEntryNodes" env:"BOOT_ENTRY_NODES"`
+	BootMaxCPU           int            `yaml:"bootMaxCPU" env:"BOOT_MAX_CPU"`
+	BootMaxIOWait        int            `yaml:"bootMaxIOWait" env:"BOOT_MAX_IOWAIT"`
+	BootMinFreeHugeMiB   int            `yaml:"bootMinFreeHugeMiB" env:"BOOT_MIN_FREE_HUGE_MIB"`
+	BootSeed             int            `yaml:"bootSeed" env:"BOOT_SEED"`
+	BootSlots            int            `yaml:"bootSlots" env:"BOOT_SLOTS"`
+	BootType             string         `yaml:"bootType" env:"BOOT_TYPE"`
+	CAType               string         `yaml:"caType" env:"CA_TYPE"`
+	CertManagerVersion   string         `yaml:"certManagerVersion" env:"CERT_MANAGER_VERSION"`
+	ClusterName          string         `yaml:"clusterName" env:"CLUSTER_NAME"`
+	ClusterNS            string         `yaml:"clusterNS" env:"CLUSTER_NS"`
+	ClusterType          string         `yaml:"clusterType" env:"CLUSTER_TYPE"`
+	DiskLayouts          List           `yaml:"diskLayouts" env:"DISK_LAYOUTS"`
+	ElementalSupport     string         `yaml:"elementalSupport" env:"ELEMENTAL_SUPPORT"`
+	EmulateTPM           bool           `yaml:"emulateTPM" env:"EMULATE_TPM"`
+	ForceDowngrade       bool           `yaml:"forceDowngrade" env:"FORCE_DOWNGRADE"`
+	HDDSize              int            `yaml:"hddSize" env:"HDD_SIZE"`
+	IsolatedNetworks     int            `yaml:"isolatedNetworks" env:"ISOLATED_NETWORKS"`
+	K8sDownstreamVersion string         `yaml:"k8sDownstreamVersion" env:"K8S_DOWNSTREAM_VERSION"`
+	K8sUpstreamVersion   string         `yaml:"k8sUpstreamVersion" env:"K8S_UPSTREAM_VERSION"`
+	NumberOfClusters     int            `yaml:"numberOfClusters" env:"CLUSTER_NUMBER"`
+	NumberOfVMs          int            `yaml:"numberOfVMs" env:"VM_NUMBERS"`
+	OperatorInstallType  string         `yaml:"operatorInstallType" env:"OPERATOR_INSTALL_TYPE"`
+	OperatorRepo         string         `yaml:"operatorRepo" env:"OPERATOR_REPO"`
+	OperatorUpgrade      string         `yaml:"operatorUpgrade" env:"OPERATOR_UPGRADE"`
+	OSToTest             string         `yaml:"osToTest" env:"OS_TO_TEST"`
+	PoolType             string         `yaml:"poolType" env:"POOL"`
+	Proxy                string         `yaml:"proxy" env:"PROXY"`
+	Rancher              RancherRelease `yaml:"rancher" env:"RANCHER_VERSION"`
+	RancherHostname      string         `yaml:"rancherHostname" env:"PUBLIC_FQDN"`
+	RancherLogCollector  string         `yaml:"rancherLogCollector" env:"RANCHER_LOG_COLLECTOR"`
+	RancherUpgrade       RancherRelease `yaml:"rancherUpgrade" env:"RANCHER_UPGRADE"`
+	SELinux              bool           `yaml:"selinux" env:"SELINUX"`
+	Sequential           bool           `yaml:"sequential" env:"SEQUENTIAL"`
+	SnapMax              int            `yaml:"snapMax" env:"SNAP_MAX"`
+	SnapType             string         `yaml:"snapType" env:"SNAP_TYPE"`
+	SSHDir               string         `yaml:"sshDir" env:"SSH_DIR"`
+	TestType             string         `yaml:"testType" env:"TEST_TYPE"`
+	UpgradeImage         string         `yaml:"upgradeImage" env:"UPGRADE_IMAGE"`
+	UpgradeOSChannel     string         `yaml:"upgradeOSChannel" env:"UPGRADE_OS_CHANNEL"`
+	UpgradeType          string         `yaml:"upgradeType" env:"UPGRADE_TYPE"`
+	VMIndex              *int           `yaml:"vmIndex,omitempty" env:"VM_INDEX"`
+}
+
+/*
+Parse a Rancher Manager release
+  - @param text Release in channel/version/head-version format
+  - @returns Nothing or an error
+*/
+func (r *RancherRelease) UnmarshalText(text []byte) error {
+	*r = RancherRelease{}
+
+	s := strings.Split(string(text), "/")
+	if len(s) > 3 {
+		return fmt.Errorf("invalid Rancher release %q, expected channel/version/head-version", text)
+	}
+
+	r.Channel = s[0]
+	if len(s) > 1 {
+		r.Version = s[1]
+	}
+	if len(s) > 2 {
+		r.HeadVersion = s[2]
+	}
+
+	return nil
+}
+
+/*
+Format a Rancher Manager release
+  - @returns The release in channel/version/head-version format
+*/
+func (r RancherRelease) MarshalText() ([]byte, error) {
+	return []byte(strings.TrimRight(r.Channel+"/"+r.Version+"/"+r.HeadVersion, "/")), nil
+}
+
+/*
+Load configuration from a YAML profile file
+  - @param file Path of the profile file
+  - @returns The configuration or an error
+*/
+func LoadFile(file string) (*SuiteConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &SuiteConfig{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("cannot parse profile %s: %w", file, err)
+	}
+
+	return c, nil
+}
+
+/*
+Load configuration from the profile file (if any) and the environment
+  - @remarks Environment variables override values from the profile file
+  - @returns The validated configuration or an error
+*/
+func Load() (*SuiteConfig, error) {
+	c := &SuiteConfig{}
+
+	if file := os.Getenv(ProfileEnv); file != "" {
+		var err error
+		if c, err = LoadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	c.setDefaults()
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+/*
+Override configuration values with the ones set in the environment
+  - @returns Nothing or an error
+*/
+func (c *SuiteConfig) loadEnv() error {
+	var errs []error
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		value, set := os.LookupEnv(name)
+		if !set || value == "" {
+			continue
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Parse a list
+  - @param text Comma-separated values
+  - @returns Nothing or an error
+*/
+func (l *List) UnmarshalText(text []byte) error {
+	*l = nil
+	for v := range strings.SplitSeq(string(text), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+/*
+Format a list
+  - @returns The comma-separated values
+*/
+func (l List) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(l, ",")), nil
+}
+
+/*
+Set a configuration field from its string representation
+  - @param f Field to set
+  - @param value Value to convert
+  - @returns Nothing or an error
+*/
+func setField(f reflect.Value, value string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch f.Kind() {
+	case reflect.Pointer:
+		// Used when an explicit zero value differs from an unset one
+		p := reflect.New(f.Type().Elem())
+		if err := setField(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		// As always done by the suite, only "true" enables an option
+		f.SetBool(value == "true")
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		f.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Kind())
+	}
+
+	return nil
+}
+
+/*
+Set default values for unset fields
+  - @returns Nothing
+*/
+func (c *SuiteConfig) setDefaults() {
+	if c.ArtifactsDir == "" {
+		c.ArtifactsDir = DefaultArtifactsDir
+	}
+
+	if c.SSHDir == "" {
+		c.SSHDir = DefaultSSHDir
+	}
+
+	if c.BootMaxCPU == 0 {
+		c.BootMaxCPU = DefaultBootMaxCPU
+	}
+	if c.BootMaxIOWait == 0 {
+		c.BootMaxIOWait = DefaultBootMaxIOWait
+	}
+	if c.BootMinFreeHugeMiB == 0 {
+		c.BootMinFreeHugeMiB = DefaultBootMinFreeHugeMiB
+	}
+	if c.BootSlots == 0 {
+		c.BootSlots = DefaultBootSlots
+	}
+
+	if c.HDDSize == 0 {
+		c.HDDSize = disklayout.DefaultSizeGiB
+	}
+
+	// A random seed is used if not set, it is dumped with the configuration to reproduce the run
+	if c.BootSeed == 0 {
+		c.BootSeed = int(time.Now().UnixNano() % 1000000)
+	}
+
+	// By default only one node is used
+	if c.NumberOfVMs == 0 {
+		c.NumberOfVMs = c.Index()
+	}
+}
+
+/*
+Validate the configuration
+  - @returns Nothing or an error listing all the issues found
+*/
+func (c *SuiteConfig) Validate() error {
+	var errs []error
+
+	if c.ClusterNS == "" {
+		errs = append(errs, errors.New("CLUSTER_NS must be set"))
+	}
+
+	switch c.BootType {
+	case "", "iso", "pxe", "raw":
+	default:
+		errs = append(errs, fmt.Errorf("unknown BOOT_TYPE %q, expected iso, pxe or raw", c.BootType))
+	}
+
+	switch c.SnapType {
+	case "", "btrfs", "loopdevice":
+	default:
+		errs = append(errs, fmt.Errorf("unknown SNAP_TYPE %q, expected btrfs or loopdevice", c.SnapType))
+	}
+
+	switch c.UpgradeType {
+	case "":
+	case "osImage":
+		if c.UpgradeImage == "" {
+			errs = append(errs, errors.New("UPGRADE_TYPE osImage needs UPGRADE_IMAGE to be set"))
+		}
+	case "managedOSVersionName":
+		if c.UpgradeOSChannel == "" {
+			errs = append(errs, errors.New("UPGRADE_TYPE managedOSVersionName needs UPGRADE_OS_CHANNEL to be set"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown UPGRADE_TYPE %q, expected osImage or managedOSVersionName", c.UpgradeType))
+	}
+
+	for _, name := range c.DiskLayouts {
+		l, found := disklayout.Get(name)
+		if !found {
+			errs = append(errs, fmt.Errorf("unknown disk layout %q in DISK_LAYOUTS, expected one of %s", name, strings.Join(disklayout.Names(), ", ")))
+			continue
+		}
+		if err := l.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// The raw image is copied on the first disk, with its default size
+	if len(c.DiskLayouts) > 0 && c.BootType == "raw" {
+		errs = append(errs, errors.New("DISK_LAYOUTS cannot be used with BOOT_TYPE raw"))
+	}
+
+	if c.SnapMax < 0 {
+		errs = append(errs, fmt.Errorf("SNAP_MAX %d cannot be negative", c.SnapMax))
+	}
+
+	if c.Index() < 0 {
+		errs = append(errs, fmt.Errorf("VM_INDEX %d cannot be negative", c.Index()))
+	}
+
+	if c.NumberOfVMs < c.Index() {
+		errs = append(errs, fmt.Errorf("VM_NUMBERS %d cannot be lower than VM_INDEX %d", c.NumberOfVMs, c.Index()))
+	}
+
+	if c.BootSlots < 0 {
+		errs = append(errs, fmt.Errorf("BOOT_SLOTS %d cannot be negative", c.BootSlots))
+	}
+
+	if c.HDDSize < 0 {
+		errs = append(errs, fmt.Errorf("HDD_SIZE %d cannot be negative", c.HDDSize))
+	}
+
+	// Boot entries are tested on all the nodes if not set
+	if c.BootEntryNodes < 0 {
+		errs = append(errs, fmt.Errorf("BOOT_ENTRY_NODES %d cannot be negative", c.BootEntryNodes))
+	}
+
+	if c.IsolatedNetworks < 0 || c.IsolatedNetworks > MaxIsolatedNetworks {
+		errs = append(errs, fmt.Errorf("ISOLATED_NETWORKS %d must be between 0 and %d", c.IsolatedNetworks, MaxIsolatedNetworks))
+	}
+
+	if c.BootMaxCPU < 0 || c.BootMaxCPU > 100 || c.BootMaxIOWait < 0 || c.BootMaxIOWait > 100 {
+		errs = append(errs, fmt.Errorf("BOOT_MAX_CPU %d and BOOT_MAX_IOWAIT %d must be between 0 and 100", c.BootMaxCPU, c.BootMaxIOWait))
+	}
+
+	if c.NumberOfClusters < 0 {
+		errs = append(errs, fmt.Errorf("CLUSTER_NUMBER %d cannot be negative", c.NumberOfClusters))
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Get the index of the first node
+  - @returns VM_INDEX, 0 if not set
+*/
+func (c *SuiteConfig) Index() int {
+	if c.VMIndex == nil {
+		return 0
+	}
+
+	return *c.VMIndex
+}
+
+/*
+Dump the effective configuration as a YAML profile file
+  - @remarks The file can be reused with E2E_PROFILE to reproduce a run
+  - @param dir Directory where to write the file
+  - @returns Path of the written file or an error
+*/
+func (c *SuiteConfig) Dump(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, DumpFileName)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Unset all the variables read by the configuration, empty values are ignored
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	ty := reflect.TypeOf(SuiteConfig{})
+	for i := 0; i < ty.NumField(); i++ {
+		t.Setenv(ty.Field(i).Tag.Get("env"), "")
+	}
+	t.Setenv(ProfileEnv, "")
+}
+
+func TestLoadEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		env   map[string]string
+		check func(c *SuiteConfig) bool
+	}{
+		{"true enables", map[string]string{"EMULATE_TPM": "true"}, func(c *SuiteConfig) bool { return c.EmulateTPM }},
+		{"yes does not enable", map[string]string{"SELINUX": "yes"}, func(c *SuiteConfig) bool { return !c.SELinux }},
+		{"1 does not enable", map[string]string{"SEQUENTIAL": "1"}, func(c *SuiteConfig) bool { return !c.Sequential }},
+		{"TRUE does not enable", map[string]string{"FORCE_DOWNGRADE": "TRUE"}, func(c *SuiteConfig) bool { return !c.ForceDowngrade }},
+		{"VM_INDEX unset", nil, func(c *SuiteConfig) bool { return c.VMIndex == nil && c.Index() == 0 }},
+		{"VM_INDEX 0 is set", map[string]string{"VM_INDEX": "0"}, func(c *SuiteConfig) bool { return c.VMIndex != nil && c.Index() == 0 }},
+		{"VM_NUMBERS defaults to VM_INDEX", map[string]string{"VM_INDEX": "3"}, func(c *SuiteConfig) bool { return c.Index() == 3 && c.NumberOfVMs == 3 }},
+		{"Rancher release", map[string]string{"RANCHER_VERSION": "prime/2.11.1/2.11-head"}, func(c *SuiteConfig) bool {
+			return c.Rancher == RancherRelease{Channel: "prime", Version: "2.11.1", HeadVersion: "2.11-head"}
+		}},
+		{"Rancher channel only", map[string]string{"RANCHER_UPGRADE": "latest"}, func(c *SuiteConfig) bool {
+			return c.RancherUpgrade == RancherRelease{Channel: "latest"}
+		}},
+		{"list", map[string]string{"DISK_LAYOUTS": "nvme, virtio,"}, func(c *SuiteConfig) bool {
+			return reflect.DeepEqual(c.DiskLayouts, List{"nvme", "virtio"})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("CLUSTER_NS", "fleet-default")
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			c, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.check(c) {
+				t.Errorf("unexpected configuration %+v", c)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"CLUSTER_NS": ""}, "CLUSTER_NS must be set"},
+		{map[string]string{"BOOT_TYPE": "usb"}, `unknown BOOT_TYPE "usb"`},
+		{map[string]string{"UPGRADE_TYPE": "osImage"}, "needs UPGRADE_IMAGE"},
+		{map[string]string{"VM_INDEX": "3", "VM_NUMBERS": "2"}, "VM_NUMBERS 2 cannot be lower than VM_INDEX 3"},
+		{map[string]string{"VM_INDEX": "one"}, `VM_INDEX: invalid integer "one"`},
+		{map[string]string{"DISK_LAYOUTS": "floppy"}, `unknown disk layout "floppy"`},
+		{map[string]string{"ISOLATED_NETWORKS": "101"}, "ISOLATED_NETWORKS 101 must be between 0 and 100"},
+	} {
+		clearEnv(t)
+		t.Setenv("CLUSTER_NS", "fleet-default")
+		for k, v := range tc.env {
+			t.Setenv(k, v)
+		}
+
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Load() with %v = %v, want %q", tc.env, err, tc.want)
+		}
+	}
+}
+
+func TestDumpAndLoadFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CLUSTER_NS", "fleet-default")
+	t.Setenv("VM_INDEX", "0")
+	t.Setenv("RANCHER_VERSION", "stable/latest")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := c.Dump(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dumped profile gives the same configuration, environment variables still take precedence
+	clearEnv(t)
+	t.Setenv(ProfileEnv, file)
+	t.Setenv("BOOT_TYPE", "raw")
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.VMIndex == nil || reloaded.Rancher != c.Rancher || reloaded.BootSeed != c.BootSeed || reloaded.BootType != "raw" {
+		t.Errorf("reloaded configuration %+v, want %+v", reloaded, c)
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("LoadFile() = %v for a missing file", err)
+	}
+}
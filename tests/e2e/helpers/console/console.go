@@ -0,0 +1,191 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package console
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Default number of lines kept before a fatal line
+	DefaultBefore = 20
+
+	// Default number of lines added after a fatal line, like a kernel call trace
+	DefaultAfter = 15
+)
+
+// Signature of a boot failure on the console
+type Signature struct {
+	Name    string
+	Pattern *regexp.Regexp
+
+	// Number of matching lines needed within Window, 1 if zero
+	Count  int
+	Window time.Duration
+}
+
+// Fatal signatures watched by default
+var DefaultSignatures = []Signature{
+	{Name: "kernel panic", Pattern: regexp.MustCompile(`Kernel panic - not syncing`)},
+	{Name: "dracut emergency shell", Pattern: regexp.MustCompile(`Entering emergency mode|Starting dracut-emergency|dracut:/#`)},
+	{Name: "grub rescue", Pattern: regexp.MustCompile(`grub rescue>`)},
+	// A node may reboot a few times when installed, upgraded or reset, but not that quickly
+	{Name: "boot loop", Pattern: regexp.MustCompile(`Linux version \d`), Count: 5, Window: 10 * time.Minute},
+}
+
+// Terminal control sequences, useless in an excerpt
+var escapes = regexp.MustCompile(`\x1b(\[[0-9;?]*[A-Za-z]|[()][0-9A-Za-z]|[=>c])`)
+
+// Failure detected on the console of a node
+type Failure struct {
+	Node      string
+	Signature string
+	Time      time.Time
+
+	// Matching line, with the lines around it
+	Line    string
+	Excerpt []string
+}
+
+/*
+Remove the terminal control sequences and the line ending of a console line
+  - @param line Line of the console
+  - @returns The readable line
+*/
+func Clean(line string) string {
+	return strings.TrimRight(escapes.ReplaceAllString(line, ""), "\r\n")
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%s detected on the console of %s at %s:\n%s",
+		f.Signature, f.Node, f.Time.Format(time.RFC3339), strings.Join(f.Excerpt, "\n"))
+}
+
+// Matcher checks the console lines of a node against the fatal signatures
+type Matcher struct {
+	Node       string
+	Signatures []Signature
+	Before     int
+	After      int
+
+	lines   []string
+	hits    map[string][]time.Time
+	failure *Failure
+	after   int
+}
+
+/*
+Create a matcher
+  - @param node Name of the node
+  - @param sigs Signatures to look for, DefaultSignatures if nil
+  - @returns Pointer to the matcher
+*/
+func NewMatcher(node string, sigs []Signature) *Matcher {
+	if sigs == nil {
+		sigs = DefaultSignatures
+	}
+
+	return &Matcher{
+		Node:       node,
+		Signatures: sigs,
+		Before:     DefaultBefore,
+		After:      DefaultAfter,
+		hits:       map[string][]time.Time{},
+	}
+}
+
+/*
+Check if a line completes a signature
+  - @param s Signature to check
+  - @param line Line of the console
+  - @param at Time the line was seen
+  - @returns True if the signature is complete
+*/
+func (m *Matcher) match(s Signature, line string, at time.Time) bool {
+	if !s.Pattern.MatchString(line) {
+		return false
+	}
+	if s.Count <= 1 {
+		return true
+	}
+
+	// Only keep the matches within the window
+	hits := append(m.hits[s.Name], at)
+	for len(hits) > 0 && s.Window > 0 && at.Sub(hits[0]) > s.Window {
+		hits = hits[1:]
+	}
+	m.hits[s.Name] = hits
+
+	return len(hits) >= s.Count
+}
+
+/*
+Check a line of the console
+  - @remarks Only the first failure is kept, the next lines only complete its excerpt
+  - @param line Line of the console
+  - @param at Time the line was seen
+  - @returns The failure if this line reveals it, nil otherwise
+*/
+func (m *Matcher) Feed(line string, at time.Time) *Failure {
+	line = Clean(line)
+
+	if m.failure != nil {
+		if m.after > 0 {
+			m.failure.Excerpt = append(m.failure.Excerpt, line)
+			m.after--
+		}
+		return nil
+	}
+
+	m.lines = append(m.lines, line)
+	if len(m.lines) > m.Before+1 {
+		m.lines = m.lines[len(m.lines)-m.Before-1:]
+	}
+
+	for _, s := range m.Signatures {
+		if m.match(s, line, at) {
+			m.failure = &Failure{
+				Node:      m.Node,
+				Signature: s.Name,
+				Time:      at,
+				Line:      line,
+				Excerpt:   append([]string(nil), m.lines...),
+			}
+			m.after = m.After
+			m.lines = nil
+			return m.failure
+		}
+	}
+
+	return nil
+}
+
+/*
+Get the detected failure
+  - @returns A copy of the failure, nil if none
+*/
+func (m *Matcher) Failure() *Failure {
+	if m.failure == nil {
+		return nil
+	}
+
+	f := *m.failure
+	f.Excerpt = append([]string(nil), m.failure.Excerpt...)
+
+	return &f
+}
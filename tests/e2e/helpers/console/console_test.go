@@ -0,0 +1,104 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher("node-1", nil)
+	m.Before, m.After = 1, 1
+	start := time.Now()
+
+	// Legitimate reboots, far enough from each other
+	for i := range 8 {
+		if f := m.Feed("[    0.000000] Linux version 6.4.0", start.Add(time.Duration(i)*5*time.Minute)); f != nil {
+			t.Fatalf("boot %d: unexpected failure: %v", i, f)
+		}
+	}
+
+	m.Feed("\x1b[0mVFS: Unable to mount root fs\r\n", start)
+	f := m.Feed("Kernel panic - not syncing: VFS: Unable to mount root fs", start)
+	if f == nil || f.Signature != "kernel panic" {
+		t.Fatalf("failure = %v", f)
+	}
+	m.Feed("Call Trace:", start)
+	m.Feed("Kernel Offset: disabled", start)
+
+	got := m.Failure()
+	if want := []string{"VFS: Unable to mount root fs", f.Line, "Call Trace:"}; strings.Join(got.Excerpt, "|") != strings.Join(want, "|") {
+		t.Errorf("Excerpt = %q, want %q", got.Excerpt, want)
+	}
+}
+
+func TestBootLoop(t *testing.T) {
+	m := NewMatcher("node-1", nil)
+	start := time.Now()
+
+	var f *Failure
+	for i := range 5 {
+		f = m.Feed("Linux version 6.4.0", start.Add(time.Duration(i)*time.Minute))
+	}
+	if f == nil || f.Signature != "boot loop" {
+		t.Errorf("failure = %v", f)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "console.log")
+	// Previous boots are ignored
+	if err := os.WriteFile(file, []byte("Kernel panic - not syncing: old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMonitor()
+	m.Interval = time.Millisecond
+	m.Watch("node-1", file)
+	defer m.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+	if f := m.Failure("node-1"); f != nil {
+		t.Fatalf("failure from a previous boot: %v", f)
+	}
+
+	out, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A prompt does not end with a new line
+	_, _ = out.WriteString("error: disk `hd0,gpt2' not found.\r\ngrub rescue> ")
+	out.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Failure("node-1") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("grub rescue not detected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if f := m.Failure("node-1"); f.Signature != "grub rescue" || !strings.Contains(f.Error(), "hd0,gpt2") {
+		t.Errorf("failure = %v", f)
+	}
+
+	m.Forget("node-1")
+	if f := m.Failure("node-1"); f != nil || len(m.Watching()) != 0 {
+		t.Errorf("node still watched after Forget: %v", f)
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package console
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Default time between two reads of a console log
+	DefaultInterval = time.Second
+
+	// Longest line kept, as a console can print anything
+	maxLine = 64 * 1024
+)
+
+// Console log of a node being watched
+type watcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	matcher *Matcher
+	observe func(line string, at time.Time)
+}
+
+/*
+Check a complete line
+  - @param line Line of the console
+  - @param at Time the line was read
+  - @returns Nothing
+*/
+func (w *watcher) line(line string, at time.Time) {
+	line = Clean(line)
+	w.matcher.Feed(line, at)
+	if w.observe != nil {
+		w.observe(line, at)
+	}
+}
+
+/*
+Check the complete lines of the data read
+  - @param data Data read, starting with the incomplete line of the previous read
+  - @param at Time the data was read
+  - @returns Incomplete line at the end of the data
+*/
+func (w *watcher) feed(data []byte, at time.Time) []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(data[:i]), at)
+		data = data[i+1:]
+	}
+
+	if len(data) > maxLine {
+		w.line(string(data), at)
+		return nil
+	}
+
+	return data
+}
+
+// Monitor watches the serial console logs of the nodes in the background
+type Monitor struct {
+	// Signatures to look for, DefaultSignatures if nil
+	Signatures []Signature
+
+	Interval time.Duration
+
+	// Called with each line of the consoles, must not block
+	Observer func(name, line string, at time.Time)
+
+	mu       sync.Mutex
+	watchers map[string]*watcher
+}
+
+/*
+Create a monitor
+  - @returns Pointer to the monitor
+*/
+func NewMonitor() *Monitor {
+	return &Monitor{
+		Interval: DefaultInterval,
+		watchers: map[string]*watcher{},
+	}
+}
+
+/*
+Sleep or stop earlier if the context is done
+  - @param ctx Context to check
+  - @param d Time to sleep
+  - @returns Nothing
+*/
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+/*
+Read a console log as it grows, until the context is done
+  - @remarks The file may not exist yet, and is read again from the start if truncated
+  - @param ctx Context used to stop watching
+  - @param file Console log
+  - @param offset Position to start reading from
+  - @param w Watcher of the node
+  - @returns Nothing
+*/
+func (m *Monitor) tail(ctx context.Context, file string, offset int64, w *watcher) {
+	defer close(w.done)
+
+	var (
+		f       *os.File
+		partial []byte
+	)
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for ctx.Err() == nil {
+		if f == nil {
+			if f, _ = os.Open(file); f != nil {
+				if _, err := f.Seek(offset, io.SeekStart); err != nil {
+					_ = f.Close()
+					f = nil
+				}
+			}
+		}
+
+		if f != nil {
+			if st, err := f.Stat(); err == nil && st.Size() < offset {
+				offset = 0
+				partial = nil
+				_, _ = f.Seek(0, io.SeekStart)
+			}
+
+			read := false
+			for {
+				n, err := f.Read(buf)
+				if n > 0 {
+					read = true
+					offset += int64(n)
+					partial = w.feed(append(partial, buf[:n]...), time.Now())
+				}
+				if err != nil || n == 0 {
+					break
+				}
+			}
+
+			// Nothing more printed, the console is waiting on a prompt like "grub rescue>"
+			if !read && len(partial) > 0 {
+				w.feed(append(partial, '\n'), time.Now())
+				partial = nil
+			}
+		}
+
+		sleep(ctx, m.Interval)
+	}
+}
+
+/*
+Start to watch the console log of a node
+  - @remarks Nothing is done if the node is already watched, or if the file is empty
+  - @remarks Only what is printed from now on is checked, the existing content is from previous boots
+  - @param name Name of the node
+  - @param file Console log of the node
+  - @returns Nothing
+*/
+func (m *Monitor) Watch(name, file string) {
+	if file == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.watchers[name]; found {
+		return
+	}
+
+	var offset int64
+	if st, err := os.Stat(file); err == nil {
+		offset = st.Size()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{cancel: cancel, done: make(chan struct{}), matcher: NewMatcher(name, m.Signatures)}
+	if m.Observer != nil {
+		observer := m.Observer
+		w.observe = func(line string, at time.Time) {
+			observer(name, line, at)
+		}
+	}
+	m.watchers[name] = w
+	go m.tail(ctx, file, offset, w)
+}
+
+/*
+Get the failure detected on the console of a node
+  - @param name Name of the node
+  - @returns The failure, nil if none or if the node is not watched
+*/
+func (m *Monitor) Failure(name string) *Failure {
+	m.mu.Lock()
+	w, found := m.watchers[name]
+	m.mu.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.matcher.Failure()
+}
+
+/*
+Get the watched nodes
+  - @returns Names of the nodes, sorted
+*/
+func (m *Monitor) Watching() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.watchers))
+	for name := range m.watchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+Stop watching a node
+  - @remarks The failure detected, if any, is forgotten, as for a reprovisioned node
+  - @param name Name of the node
+  - @returns Nothing
+*/
+func (m *Monitor) Forget(name string) {
+	m.mu.Lock()
+	w, found := m.watchers[name]
+	delete(m.watchers, name)
+	m.mu.Unlock()
+
+	if !found {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+/*
+Stop watching all the nodes
+  - @returns Nothing
+*/
+func (m *Monitor) Stop() {
+	for _, name := range m.Watching() {
+		m.Forget(name)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/cluster"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// Units whose journal is collected on each failing node
+var DefaultUnits = []string{
+	"rancher-system-agent.service",
+	"elemental-system-agent.service",
+}
+
+// Collector gathers a diagnostics bundle for a cluster
+type Collector struct {
+	// Base directory of the bundles, a sub-directory is created for each one
+	Dir string
+
+	// Client used to get the cluster, its Machines and MachineInventories
+	Kube dynamic.Interface
+
+	// Pool used to access the nodes through SSH
+	SSH *sshpool.Pool
+
+	// Units whose journal is collected, DefaultUnits if empty
+	Units []string
+}
+
+/*
+Write a file into the bundle
+  - @remarks Errors are written in place of the content, so a partial bundle is still useful
+  - @param dir Directory where to write the file
+  - @param name Name of the file
+  - @param content Content of the file
+  - @param err Error got while gathering the content
+  - @returns Nothing or an error
+*/
+func write(dir, name, content string, err error) error {
+	if err != nil {
+		content += "\n!! Error while collecting: " + err.Error() + "\n"
+	}
+
+	return os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+}
+
+/*
+Get a provisioning cluster as YAML
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name
+  - @returns The YAML definition or an error
+*/
+func (c *Collector) clusterYAML(ns, cn string) (string, error) {
+	u, err := c.Kube.Resource(cluster.Resource).Namespace(ns).Get(context.Background(), cn, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+/*
+Gather a diagnostics bundle for a cluster
+  - @remarks The bundle is organized per failing node, all nodes are used if none is failing
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name
+  - @param cause Error that triggered the collection, it contains the failed conditions
+  - @returns Path of the bundle directory or an error
+*/
+func (c *Collector) Collect(ns, cn string, cause error) (string, error) {
+	dir := filepath.Join(c.Dir, "diag-"+cn+"-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var errs []error
+
+	// Cluster level information
+	msg := ""
+	if cause != nil {
+		msg = cause.Error() + "\n"
+	}
+	errs = append(errs, write(dir, "failed-conditions.txt", msg, nil))
+
+	out, err := c.clusterYAML(ns, cn)
+	errs = append(errs, write(dir, "cluster.yaml", out, err))
+
+	// Node level information
+	client := elemental.NewClient(c.Kube)
+	machines, err := ListMachines(client, ns, cn)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("cannot list machines: %w", err))
+	}
+
+	// Only the events of the cluster and of its nodes
+	objects := []string{cn}
+	for _, m := range machines {
+		objects = append(objects, m.Name)
+		if m.NodeName != "" {
+			objects = append(objects, m.NodeName)
+		}
+	}
+	out, err = kubectl.RunWithoutErr("get", "events",
+		"--namespace", ns, "--sort-by=.lastTimestamp", "-o", "json")
+	if err == nil {
+		out, err = FilterEvents(out, objects)
+	}
+	errs = append(errs, write(dir, "events.txt", out, err))
+
+	var failing []Machine
+	for _, m := range machines {
+		if len(m.Failed()) > 0 {
+			failing = append(failing, m)
+		}
+	}
+	if len(failing) == 0 {
+		failing = machines
+	}
+
+	for _, m := range failing {
+		errs = append(errs, c.collectNode(client, dir, ns, m))
+	}
+
+	return dir, errors.Join(errs...)
+}
+
+/*
+Gather the diagnostics of one node
+  - @param client Client of the Elemental and Cluster API resources
+  - @param dir Directory of the bundle
+  - @param ns Namespace where the cluster is deployed
+  - @param m Machine of the node
+  - @returns Nothing or an error
+*/
+func (c *Collector) collectNode(client *elemental.Client, dir, ns string, m Machine) error {
+	name := m.Hostname
+	if name == "" {
+		name = m.Name
+	}
+
+	nodeDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		return err
+	}
+
+	var errs []error
+
+	var conds strings.Builder
+	for _, f := range m.Failed() {
+		fmt.Fprintf(&conds, "%s=%s [%s] %s\n", f.Type, f.Status, f.Reason, f.Message)
+	}
+	errs = append(errs, write(nodeDir, "failed-conditions.txt", conds.String(), nil))
+
+	out, err := client.Machines(ns).YAML(m.Name)
+	errs = append(errs, write(nodeDir, "machine.yaml", out, err))
+
+	if m.NodeName != "" {
+		out, err = client.MachineInventories(ns).YAML(m.NodeName)
+	} else {
+		out, err = "", errors.New("no node linked to the machine yet")
+	}
+	errs = append(errs, write(nodeDir, "machineinventory.yaml", out, err))
+
+	out, err = kubectl.RunWithoutErr("get", "secret",
+		"--namespace", ns,
+		"-l", "rke.cattle.io/machine-name="+m.Name,
+		"-o", "yaml")
+	errs = append(errs, write(nodeDir, "plan-secrets.yaml", out, err))
+
+	// Journals are only available if the node can be reached
+	if !tools.IsIPv4(m.InternalIP) {
+		return errors.Join(append(errs, write(nodeDir, "journals.txt", "", fmt.Errorf("no IP for machine %s", m.Name)))...)
+	}
+
+	cl := c.SSH.Client("", m.InternalIP+":22")
+
+	units := c.Units
+	if len(units) == 0 {
+		units = DefaultUnits
+	}
+	for _, unit := range units {
+		out, err := cl.RunSSH("journalctl --no-pager --unit " + unit)
+		errs = append(errs, write(nodeDir, strings.TrimSuffix(unit, ".service")+".log", out, err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diag
+
+import (
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newMachine(name, cn string, status map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	u.SetAPIVersion(elemental.MachineGroupVersion.String())
+	u.SetKind("Machine")
+	u.SetNamespace("fleet-default")
+	u.SetName(name)
+	u.SetLabels(map[string]string{ClusterNameLabel: cn})
+
+	return u
+}
+
+func TestFilterEvents(t *testing.T) {
+	data := `{"items": [
+		{"type": "Normal", "reason": "Created", "message": "created", "lastTimestamp": "2026-01-01T00:00:00Z",
+		 "involvedObject": {"kind": "Machine", "name": "cluster-a-m1"}},
+		{"type": "Warning", "reason": "Failed", "message": "failed\n", "lastTimestamp": "2026-01-01T00:00:01Z", "count": 3,
+		 "involvedObject": {"kind": "Machine", "name": "cluster-b-m1"}},
+		{"type": "Normal", "reason": "Ready", "message": "ready", "lastTimestamp": "2026-01-01T00:00:02Z",
+		 "involvedObject": {"kind": "Cluster", "name": "cluster-a"}}
+	]}`
+
+	out, err := FilterEvents(data, []string{"cluster-a", "cluster-a-m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-01-01T00:00:00Z Normal Created Machine/cluster-a-m1 (x1): created\n" +
+		"2026-01-01T00:00:02Z Normal Ready Cluster/cluster-a (x1): ready\n"
+	if out != want {
+		t.Fatalf("FilterEvents() =\n%s\nwant\n%s", out, want)
+	}
+
+	if _, err := FilterEvents("not json", nil); err == nil {
+		t.Fatal("invalid events accepted")
+	}
+}
+
+func TestListMachines(t *testing.T) {
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), elemental.ListKinds,
+		newMachine("cluster-a-m1", "cluster-a", map[string]interface{}{
+			"nodeRef": map[string]interface{}{"kind": "Node", "name": "m-1"},
+			"addresses": []interface{}{
+				map[string]interface{}{"type": "Hostname", "address": "node-001"},
+				map[string]interface{}{"type": "InternalIP", "address": "192.168.122.2"},
+			},
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "PlanApplied", "status": "False", "message": PlanErrorMessage},
+			},
+		}),
+		newMachine("cluster-a-m2", "cluster-a", map[string]interface{}{}),
+		newMachine("cluster-b-m1", "cluster-b", map[string]interface{}{}),
+	)
+
+	machines, err := ListMachines(elemental.NewClient(dyn), "fleet-default", "cluster-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 2 {
+		t.Fatalf("ListMachines() = %+v, want the 2 machines of cluster-a", machines)
+	}
+
+	m := machines[0]
+	if m.Name != "cluster-a-m1" || m.Hostname != "node-001" || m.InternalIP != "192.168.122.2" || m.NodeName != "m-1" {
+		t.Errorf("unexpected machine %+v", m)
+	}
+	if failed := m.Failed(); len(failed) != 1 || failed[0].Type != "PlanApplied" || !m.HasMessage(PlanErrorMessage) {
+		t.Errorf("Failed() = %+v", failed)
+	}
+	if m := machines[1]; m.NodeName != "" || len(m.Failed()) != 0 {
+		t.Errorf("unexpected machine %+v", m)
+	}
+}
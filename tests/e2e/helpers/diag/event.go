@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type eventList struct {
+	Items []struct {
+		Type           string `json:"type"`
+		Reason         string `json:"reason"`
+		Message        string `json:"message"`
+		LastTimestamp  string `json:"lastTimestamp"`
+		Count          int    `json:"count"`
+		InvolvedObject struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"involvedObject"`
+	} `json:"items"`
+}
+
+/*
+Keep the events of some objects
+  - @param data Events as given by 'kubectl get events -o json', in the order to keep
+  - @param objects Names of the objects whose events are kept
+  - @returns One line per event, or an error
+*/
+func FilterEvents(data string, objects []string) (string, error) {
+	var list eventList
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, e := range list.Items {
+		if !slices.Contains(objects, e.InvolvedObject.Name) {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s %s %s/%s (x%d): %s\n", e.LastTimestamp, e.Type, e.Reason,
+			e.InvolvedObject.Kind, e.InvolvedObject.Name, max(e.Count, 1), strings.TrimSpace(e.Message))
+	}
+
+	return b.String(), nil
+}
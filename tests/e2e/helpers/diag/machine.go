@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diag
+
+import (
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+// Label set by CAPI on the Machines of a cluster
+const ClusterNameLabel = "cluster.x-k8s.io/cluster-name"
+
+// Message set on a Machine when rancher-system-agent failed to apply the plan
+const PlanErrorMessage = "error applying plan -- check rancher-system-agent.service logs on node for more information"
+
+// CAPI Machine, only with the fields needed to find the node
+type Machine struct {
+	Name       string
+	Hostname   string
+	InternalIP string
+
+	// Name of the node, same as the MachineInventory name
+	NodeName   string
+	Conditions []elemental.MachineCondition
+}
+
+/*
+List the Machines of a cluster
+  - @remarks Other clusters can be deployed in the same namespace, their Machines are ignored
+  - @param client Client of the Elemental and Cluster API resources
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name
+  - @returns List of the Machines or an error
+*/
+func ListMachines(client *elemental.Client, ns, cn string) ([]Machine, error) {
+	list, err := client.Machines(ns).List(ClusterNameLabel + "=" + cn)
+	if err != nil {
+		return nil, err
+	}
+
+	machines := make([]Machine, 0, len(list))
+	for _, item := range list {
+		m := Machine{
+			Name:       item.Name,
+			Hostname:   item.Address("Hostname"),
+			InternalIP: item.Address("InternalIP"),
+			Conditions: item.Status.Conditions,
+		}
+		if item.Status.NodeRef != nil {
+			m.NodeName = item.Status.NodeRef.Name
+		}
+		machines = append(machines, m)
+	}
+
+	return machines, nil
+}
+
+/*
+Get the failed conditions of a Machine
+  - @returns List of the conditions not in True state
+*/
+func (m *Machine) Failed() []elemental.MachineCondition {
+	var failed []elemental.MachineCondition
+	for _, c := range m.Conditions {
+		if c.Status != "True" {
+			failed = append(failed, c)
+		}
+	}
+
+	return failed
+}
+
+/*
+Check if one of the Machine conditions has a message
+  - @param msg Message to look for
+  - @returns true if found
+*/
+func (m *Machine) HasMessage(msg string) bool {
+	for _, c := range m.Conditions {
+		if c.Message == msg {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklayout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Command listing the block devices of a node, as parsed by Check
+const Command = "lsblk -J -b -o NAME,PATH,SIZE,TYPE,LABEL"
+
+// Labels of the partitions created by the installation
+var COSLabels = []string{"COS_GRUB", "COS_OEM", "COS_RECOVERY", "COS_STATE", "COS_PERSISTENT"}
+
+// Size in bytes, lsblk gives a string or a number depending on its version
+type size int64
+
+func (s *size) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %s: %w", data, err)
+	}
+	*s = size(n)
+
+	return nil
+}
+
+// Block device, as listed by lsblk
+type blockDevice struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Size     size          `json:"size"`
+	Type     string        `json:"type"`
+	Label    string        `json:"label"`
+	Children []blockDevice `json:"children"`
+}
+
+/*
+Get the labels of a device and its children
+  - @returns The labels set
+*/
+func (b blockDevice) labels() []string {
+	var labels []string
+	if b.Label != "" {
+		labels = append(labels, b.Label)
+	}
+	for _, c := range b.Children {
+		labels = append(labels, c.labels()...)
+	}
+
+	return labels
+}
+
+/*
+Check that the installation used the expected disk
+  - @remarks The other disks must not have any partition or filesystem
+  - @param l Layout of the node
+  - @param out Output of Command on the node
+  - @returns Nothing or an error listing all the issues found
+*/
+func Check(l Layout, out string) error {
+	var lsblk struct {
+		BlockDevices []blockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(out), &lsblk); err != nil {
+		return fmt.Errorf("cannot parse lsblk output: %w", err)
+	}
+
+	var errs []error
+	var disks []string
+	for _, b := range lsblk.BlockDevices {
+		// CD-ROM and loop devices are not part of the layout
+		if b.Type != "disk" {
+			continue
+		}
+		disks = append(disks, b.Path)
+
+		d, found := l.Disk(b.Path)
+		if !found {
+			errs = append(errs, fmt.Errorf("unexpected disk %s", b.Path))
+			continue
+		}
+		if int64(b.Size) != int64(d.SizeGiB)<<30 {
+			errs = append(errs, fmt.Errorf("%s has %d bytes, expected %dGiB", b.Path, b.Size, d.SizeGiB))
+		}
+
+		labels := b.labels()
+		if b.Path != l.Device {
+			if len(b.Children) > 0 || len(labels) > 0 {
+				errs = append(errs, fmt.Errorf("%s has been modified, labels found: %s", b.Path, strings.Join(labels, ", ")))
+			}
+			continue
+		}
+		for _, label := range COSLabels {
+			if !slices.Contains(labels, label) {
+				errs = append(errs, fmt.Errorf("%s has no %s partition", b.Path, label))
+			}
+		}
+	}
+
+	for _, device := range l.Devices() {
+		if !slices.Contains(disks, device) {
+			errs = append(errs, fmt.Errorf("disk %s not found", device))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("layout %s: %w", l.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklayout
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+)
+
+// Disks of a node and the device the installation must choose
+type Layout struct {
+	Name  string
+	Disks []hypervisor.Disk
+
+	// Device expected to be selected by the MachineRegistration, as named by the node
+	Device string
+}
+
+// Size of the disks created by the install-vm script when HDD_SIZE is not set
+const DefaultSizeGiB = 30
+
+// Layout created by the install-vm script when no disk is set
+var Default = Layout{
+	Name:   "default",
+	Disks:  []hypervisor.Disk{{SizeGiB: DefaultSizeGiB, Bus: hypervisor.BusSCSI}, {SizeGiB: DefaultSizeGiB, Bus: hypervisor.BusSCSI}},
+	Device: "/dev/sda",
+}
+
+// Known layouts, each one exercises a rule of the device-selector
+var Layouts = []Layout{
+	Default,
+	{
+		// Only the first virtio disk matches the names
+		Name:   "virtio",
+		Disks:  []hypervisor.Disk{{SizeGiB: 30, Bus: hypervisor.BusVirtio}, {SizeGiB: 30, Bus: hypervisor.BusVirtio}},
+		Device: "/dev/vda",
+	},
+	{
+		// The first disk is too small
+		Name:   "sata-too-small",
+		Disks:  []hypervisor.Disk{{SizeGiB: 20, Bus: hypervisor.BusSATA}, {SizeGiB: 30, Bus: hypervisor.BusVirtio}},
+		Device: "/dev/vda",
+	},
+	{
+		// The first disk is too big
+		Name:   "sata-too-big",
+		Disks:  []hypervisor.Disk{{SizeGiB: 40, Bus: hypervisor.BusSATA}, {SizeGiB: 30, Bus: hypervisor.BusVirtio}},
+		Device: "/dev/vda",
+	},
+	{
+		// Both disks match, the smallest one is chosen
+		Name:   "smallest-match",
+		Disks:  []hypervisor.Disk{{SizeGiB: 32, Bus: hypervisor.BusVirtio}, {SizeGiB: 28, Bus: hypervisor.BusSATA}},
+		Device: "/dev/sda",
+	},
+	{
+		// The NVMe disk is named nvme0n1, so it does not match /dev/nvme0
+		Name:   "nvme",
+		Disks:  []hypervisor.Disk{{SizeGiB: 30, Bus: hypervisor.BusNVMe}, {SizeGiB: 30, Bus: hypervisor.BusSATA}},
+		Device: "/dev/sda",
+	},
+}
+
+/*
+Get a known layout
+  - @param name Name of the layout
+  - @returns The layout and true if found
+*/
+func Get(name string) (Layout, bool) {
+	i := slices.IndexFunc(Layouts, func(l Layout) bool {
+		return l.Name == name
+	})
+	if i < 0 {
+		return Layout{}, false
+	}
+
+	return Layouts[i], true
+}
+
+/*
+Get the names of the known layouts
+  - @returns The names, in declaration order
+*/
+func Names() []string {
+	names := make([]string, len(Layouts))
+	for i, l := range Layouts {
+		names[i] = l.Name
+	}
+
+	return names
+}
+
+/*
+Get a copy of the layout with disks of another size
+  - @remarks Used to follow HDD_SIZE with the default layout
+  - @param sizeGiB Size of all the disks
+  - @returns The new layout
+*/
+func (l Layout) WithSize(sizeGiB int) Layout {
+	disks := make([]hypervisor.Disk, len(l.Disks))
+	for i, d := range l.Disks {
+		d.SizeGiB = sizeGiB
+		disks[i] = d
+	}
+	l.Disks = disks
+
+	return l
+}
+
+/*
+Get the devices of the disks, as named by the node
+  - @remarks SATA and SCSI disks share the same names, so their order is only known if the buses are not mixed
+  - @returns The device of each disk, in the order of the disks
+*/
+func (l Layout) Devices() []string {
+	devices := make([]string, len(l.Disks))
+
+	var sd, vd, nvme int
+	for i, d := range l.Disks {
+		switch d.Bus {
+		case hypervisor.BusSATA, hypervisor.BusSCSI:
+			devices[i] = "/dev/sd" + string(rune('a'+sd))
+			sd++
+		case hypervisor.BusVirtio:
+			devices[i] = "/dev/vd" + string(rune('a'+vd))
+			vd++
+		case hypervisor.BusNVMe:
+			devices[i] = fmt.Sprintf("/dev/nvme%dn1", nvme)
+			nvme++
+		}
+	}
+
+	return devices
+}
+
+/*
+Get the disk of a device
+  - @param device Device, as named by the node
+  - @returns The disk and true if found
+*/
+func (l Layout) Disk(device string) (hypervisor.Disk, bool) {
+	i := slices.Index(l.Devices(), device)
+	if i < 0 {
+		return hypervisor.Disk{}, false
+	}
+
+	return l.Disks[i], true
+}
+
+/*
+Check that the layout can be used
+  - @returns Nothing or an error listing all the issues found
+*/
+func (l Layout) Validate() error {
+	var errs []error
+
+	if len(l.Disks) == 0 {
+		errs = append(errs, errors.New("no disk"))
+	}
+
+	var buses []hypervisor.Bus
+	for _, d := range l.Disks {
+		switch d.Bus {
+		case hypervisor.BusSATA, hypervisor.BusSCSI, hypervisor.BusVirtio, hypervisor.BusNVMe:
+		default:
+			errs = append(errs, fmt.Errorf("unknown bus %q", d.Bus))
+		}
+		if d.SizeGiB <= 0 {
+			errs = append(errs, fmt.Errorf("invalid size %dGiB", d.SizeGiB))
+		}
+		buses = append(buses, d.Bus)
+	}
+	if slices.Contains(buses, hypervisor.BusSATA) && slices.Contains(buses, hypervisor.BusSCSI) {
+		errs = append(errs, errors.New("SATA and SCSI disks cannot be mixed, their names are not predictable"))
+	}
+
+	if _, found := l.Disk(l.Device); !found {
+		errs = append(errs, fmt.Errorf("expected device %s is not a disk of the layout", l.Device))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("layout %s: %w", l.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklayout
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"sigs.k8s.io/yaml"
+)
+
+// Rules of the MachineRegistration used by the tests
+func registrationRules(t *testing.T) []Rule {
+	t.Helper()
+
+	data, err := os.ReadFile("../../../assets/machineRegistration.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := render.Bytes("machineRegistration", data, render.Values{
+		"CLUSTER_NAME":       "cluster",
+		"PASSWORD":           "password",
+		"POOL_TYPE":          "master",
+		"SNAP_TYPE":          "btrfs",
+		"SSH_AUTHORIZED_KEY": "key",
+		"SSHD_CONFIG_FILE":   "/etc/ssh/sshd_config",
+		"USER":               "root",
+		"VM_NAME":            "node",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reg elemental.MachineRegistration
+	if err := yaml.Unmarshal(out, &reg); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Rules(reg.Spec.Config)
+	if err != nil || len(rules) == 0 {
+		t.Fatalf("no device-selector found: %v", err)
+	}
+
+	return rules
+}
+
+func TestLayouts(t *testing.T) {
+	rules := registrationRules(t)
+
+	for _, l := range Layouts {
+		if err := l.Validate(); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		// The expected device must be the one chosen by the MachineRegistration
+		device, err := l.Select(rules)
+		if err != nil {
+			t.Errorf("layout %s: %v", l.Name, err)
+		} else if device != l.Device {
+			t.Errorf("layout %s: %s selected, %s expected", l.Name, device, l.Device)
+		}
+	}
+
+	if _, found := Get("nvme"); !found {
+		t.Error("nvme layout not found")
+	}
+	if len(Names()) != len(Layouts) {
+		t.Errorf("unexpected names %v", Names())
+	}
+}
+
+func TestDevices(t *testing.T) {
+	l, _ := Get("nvme")
+	if got := strings.Join(l.Devices(), ","); got != "/dev/nvme0n1,/dev/sda" {
+		t.Errorf("unexpected devices %s", got)
+	}
+
+	mixed := Layout{Name: "mixed", Disks: []hypervisor.Disk{{SizeGiB: 30, Bus: "sata"}, {SizeGiB: 30, Bus: "scsi"}}, Device: "/dev/sda"}
+	if err := mixed.Validate(); err == nil {
+		t.Error("mixed SATA and SCSI disks accepted")
+	}
+
+	tie := Layout{Name: "tie", Disks: []hypervisor.Disk{{SizeGiB: 30, Bus: "virtio"}, {SizeGiB: 30, Bus: "sata"}}}
+	if _, err := tie.Select([]Rule{{Key: "Size", Operator: "Gt", Values: []string{"25Gi"}}}); err == nil {
+		t.Error("devices of the same size not reported")
+	}
+}
+
+func TestWithSize(t *testing.T) {
+	l := Default.WithSize(50)
+	if l.Disks[0].SizeGiB != 50 || l.Disks[1].SizeGiB != 50 || l.Disks[1].Bus != hypervisor.BusSCSI {
+		t.Errorf("unexpected disks %v", l.Disks)
+	}
+	if Default.Disks[0].SizeGiB != DefaultSizeGiB {
+		t.Errorf("default layout modified: %v", Default.Disks)
+	}
+}
+
+const lsblk = `{
+   "blockdevices": [
+      {"name":"sr0", "path":"/dev/sr0", "size":1073741824, "type":"rom", "label":"COS_LIVE"},
+      {"name":"loop0", "path":"/dev/loop0", "size":"3221225472", "type":"loop", "label":"COS_ACTIVE"},
+      {"name":"sda", "path":"/dev/sda", "size":"32212254720", "type":"disk", "label":null},
+      {"name":"vda", "path":"/dev/vda", "size":32212254720, "type":"disk", "label":null,
+         "children": [
+            {"name":"vda1", "path":"/dev/vda1", "size":67108864, "type":"part", "label":"COS_GRUB"},
+            {"name":"vda2", "path":"/dev/vda2", "size":67108864, "type":"part", "label":"COS_OEM"},
+            {"name":"vda3", "path":"/dev/vda3", "size":67108864, "type":"part", "label":"COS_RECOVERY"},
+            {"name":"vda4", "path":"/dev/vda4", "size":67108864, "type":"part", "label":"COS_STATE"},
+            {"name":"vda5", "path":"/dev/vda5", "size":67108864, "type":"part", "label":"COS_PERSISTENT"}
+         ]
+      }
+   ]
+}`
+
+func TestCheck(t *testing.T) {
+	l := Layout{Name: "test", Disks: []hypervisor.Disk{{SizeGiB: 30, Bus: "sata"}, {SizeGiB: 30, Bus: "virtio"}}, Device: "/dev/vda"}
+	if err := Check(l, lsblk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installed on the wrong disk
+	l.Device = "/dev/sda"
+	err := Check(l, lsblk)
+	if err == nil || !strings.Contains(err.Error(), "/dev/vda has been modified") || !strings.Contains(err.Error(), "/dev/sda has no COS_STATE") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Missing disk
+	l = Layout{Name: "test", Disks: []hypervisor.Disk{{SizeGiB: 30, Bus: "sata"}, {SizeGiB: 30, Bus: "sata"}, {SizeGiB: 30, Bus: "virtio"}}, Device: "/dev/vda"}
+	if err := Check(l, lsblk); err == nil || !strings.Contains(err.Error(), "/dev/sdb not found") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklayout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Rule of the device-selector of a MachineRegistration
+type Rule struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+/*
+Get the device-selector of a MachineRegistration
+  - @param config Config of the MachineRegistration
+  - @returns The rules, empty if there is no device-selector, or an error
+*/
+func Rules(config map[string]interface{}) ([]Rule, error) {
+	var c struct {
+		Elemental struct {
+			Install struct {
+				DeviceSelector []Rule `json:"device-selector"`
+			} `json:"install"`
+		} `json:"elemental"`
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid device-selector: %w", err)
+	}
+
+	return c.Elemental.Install.DeviceSelector, nil
+}
+
+/*
+Check if a disk matches a rule
+  - @param device Device of the disk
+  - @param d Disk to check
+  - @returns True if the disk matches or an error if the rule is not supported
+*/
+func (r Rule) Match(device string, d hypervisor.Disk) (bool, error) {
+	switch r.Key {
+	case "Name":
+		switch r.Operator {
+		case "In":
+			return slices.Contains(r.Values, device), nil
+		case "NotIn":
+			return !slices.Contains(r.Values, device), nil
+		}
+	case "Size":
+		if len(r.Values) != 1 {
+			return false, fmt.Errorf("size rule needs one value, got %d", len(r.Values))
+		}
+		q, err := resource.ParseQuantity(r.Values[0])
+		if err != nil {
+			return false, fmt.Errorf("invalid size %q: %w", r.Values[0], err)
+		}
+		size := int64(d.SizeGiB) << 30
+
+		switch r.Operator {
+		case "Gt":
+			return size > q.Value(), nil
+		case "Lt":
+			return size < q.Value(), nil
+		}
+	}
+
+	return false, fmt.Errorf("unsupported rule %s %s", r.Key, r.Operator)
+}
+
+func (r Rule) String() string {
+	return r.Key + " " + r.Operator + " " + strings.Join(r.Values, "|")
+}
+
+/*
+Get the device a device-selector chooses in a layout
+  - @remarks Like the operator, the smallest disk matching all the rules is chosen
+  - @param rules Rules of the device-selector
+  - @returns The device or an error if none or several can be chosen
+*/
+func (l Layout) Select(rules []Rule) (string, error) {
+	var chosen []string
+	var smallest int
+
+	for i, device := range l.Devices() {
+		d := l.Disks[i]
+
+		match := true
+		for _, r := range rules {
+			ok, err := r.Match(device, d)
+			if err != nil {
+				return "", err
+			}
+			match = match && ok
+		}
+
+		switch {
+		case !match:
+		case len(chosen) == 0 || d.SizeGiB < smallest:
+			chosen, smallest = []string{device}, d.SizeGiB
+		case d.SizeGiB == smallest:
+			chosen = append(chosen, device)
+		}
+	}
+
+	switch len(chosen) {
+	case 0:
+		return "", errors.New("no device matches the device-selector")
+	case 1:
+		return chosen[0], nil
+	default:
+		return "", fmt.Errorf("devices %s match the device-selector with the same size", strings.Join(chosen, ", "))
+	}
+}
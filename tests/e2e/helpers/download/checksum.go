@@ -0,0 +1,144 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package download
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+)
+
+// Hash algorithm of a checksum
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+)
+
+/*
+Create a hash of the algorithm
+  - @returns The hash, or an error if the algorithm is not supported
+*/
+func (a Algorithm) New() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", a)
+}
+
+/*
+Guess the algorithm of a checksum
+  - @remarks Checksum files do not name the algorithm, only its length tells it
+  - @param sum Checksum in hexadecimal
+  - @returns The algorithm, or an error if the length is not supported
+*/
+func AlgorithmOf(sum string) (Algorithm, error) {
+	switch len(sum) {
+	case hex.EncodedLen(sha256.Size):
+		return SHA256, nil
+	case hex.EncodedLen(sha512.Size):
+		return SHA512, nil
+	}
+
+	return "", fmt.Errorf("checksum of unsupported length %d", len(sum))
+}
+
+// Expected checksum of a file
+type Checksum struct {
+	Algorithm Algorithm
+	Sum       string
+}
+
+func (c Checksum) String() string {
+	return string(c.Algorithm) + ":" + c.Sum
+}
+
+/*
+Compare a computed sum with the expected one
+  - @param sum Computed sum
+  - @returns Nothing, or an error if the sums differ
+*/
+func (c Checksum) Verify(sum []byte) error {
+	if got := hex.EncodeToString(sum); got != c.Sum {
+		return fmt.Errorf("%s checksum mismatch: got %s, expected %s", c.Algorithm, got, c.Sum)
+	}
+
+	return nil
+}
+
+/*
+Parse a checksum file
+  - @remarks Format of sha256sum and sha512sum, a bare sum is also accepted
+  - @param data Content of the file
+  - @param name Name of the checked file, only used if the file has several entries
+  - @returns The checksum, or an error if none matches
+*/
+func ParseChecksum(data, name string) (Checksum, error) {
+	var sums []Checksum
+	var names []string
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		sum := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(sum); err != nil {
+			return Checksum{}, fmt.Errorf("invalid checksum %q", fields[0])
+		}
+		alg, err := AlgorithmOf(sum)
+		if err != nil {
+			return Checksum{}, err
+		}
+
+		file := ""
+		if len(fields) > 1 {
+			// Binary mode is marked with a '*' before the name
+			file = path.Base(strings.TrimPrefix(fields[1], "*"))
+		}
+		sums = append(sums, Checksum{Algorithm: alg, Sum: sum})
+		names = append(names, file)
+	}
+	if err := scanner.Err(); err != nil {
+		return Checksum{}, err
+	}
+
+	switch len(sums) {
+	case 0:
+		return Checksum{}, fmt.Errorf("no checksum found")
+	case 1:
+		// The operator names the file after the SeedImage, not after the local copy
+		return sums[0], nil
+	}
+	for i, file := range names {
+		if file == path.Base(name) {
+			return sums[i], nil
+		}
+	}
+
+	return Checksum{}, fmt.Errorf("no checksum found for %s", path.Base(name))
+}
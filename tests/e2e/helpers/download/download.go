@@ -0,0 +1,260 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffix of the file being downloaded, renamed once verified
+const PartSuffix = ".part"
+
+// HTTP client of the downloads, Rancher uses a self-signed certificate
+var Client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// Download of a file over HTTP, resumed by each new attempt
+type Download struct {
+	URL      string
+	File     string
+	Checksum *Checksum
+
+	started   bool
+	validator string
+}
+
+/*
+Create a download
+  - @param url URL of the file
+  - @param file Local path of the file
+  - @param sum Expected checksum, nil to only check the size
+  - @returns Pointer to the download
+*/
+func New(url, file string, sum *Checksum) *Download {
+	return &Download{URL: url, File: file, Checksum: sum}
+}
+
+/*
+Get the checksum published for a file
+  - @param ctx Context used to stop the request
+  - @param url URL of the checksum file
+  - @param name Name of the checked file
+  - @returns The checksum, or an error
+*/
+func FetchChecksum(ctx context.Context, url, name string) (*Checksum, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := ParseChecksum(string(data), name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+
+	return &sum, nil
+}
+
+/*
+Download the file, or the part missing since the previous attempt
+  - @remarks Data is hashed while written, the file is only renamed to its final name once verified
+  - @param ctx Context used to stop the transfer
+  - @returns Statistics of the attempt, or an error, the partial file is kept unless its content is wrong
+*/
+func (d *Download) Run(ctx context.Context) (*Stats, error) {
+	part := d.File + PartSuffix
+
+	// A partial file is only trusted if this download created it
+	var offset int64
+	if d.started {
+		if info, err := os.Stat(part); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if d.validator != "" {
+			// The whole file is sent again if it changed in between
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	start := time.Now()
+	resp, err := Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	size := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+	case http.StatusPartialContent:
+		var first int64
+		if first, size, err = contentRange(resp.Header.Get("Content-Range")); err != nil {
+			return nil, err
+		}
+		if first != offset {
+			return nil, fmt.Errorf("%s: resumed at %d instead of %d", d.URL, first, offset)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing left to download, or the file shrunk: start again
+		_ = os.Remove(part)
+		d.started = false
+		return nil, fmt.Errorf("%s: %s", d.URL, resp.Status)
+	default:
+		return nil, fmt.Errorf("%s: %s", d.URL, resp.Status)
+	}
+	d.started = true
+	d.validator = resp.Header.Get("ETag")
+	if d.validator == "" {
+		d.validator = resp.Header.Get("Last-Modified")
+	}
+
+	alg := SHA256
+	if d.Checksum != nil {
+		alg = d.Checksum.Algorithm
+	}
+	h, err := alg.New()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := d.open(part, offset, h)
+	if err != nil {
+		return nil, err
+	}
+	n, copyErr := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return nil, fmt.Errorf("%s: interrupted after %d bytes: %w", d.URL, offset+n, copyErr)
+	}
+
+	stats := &Stats{
+		Size:        offset + n,
+		Resumed:     offset,
+		Transferred: n,
+		Duration:    time.Since(start),
+		Checksum:    Checksum{Algorithm: alg},
+	}
+	if size >= 0 && stats.Size != size {
+		return nil, fmt.Errorf("%s: got %d bytes, expected %d: %w", d.URL, stats.Size, size, io.ErrUnexpectedEOF)
+	}
+
+	sum := h.Sum(nil)
+	stats.Checksum.Sum = fmt.Sprintf("%x", sum)
+	if d.Checksum != nil {
+		if err := d.Checksum.Verify(sum); err != nil {
+			// Resuming a corrupted file is pointless
+			_ = os.Remove(part)
+			d.started = false
+			return nil, fmt.Errorf("%s: %w", d.URL, err)
+		}
+	}
+
+	return stats, os.Rename(part, d.File)
+}
+
+/*
+Open the partial file to continue it
+  - @param part Path of the partial file
+  - @param offset Size already downloaded, 0 to start again
+  - @param h Hash fed with the content already downloaded
+  - @returns The file opened at the offset, or an error
+*/
+func (d *Download) open(part string, offset int64, h hash.Hash) (*os.File, error) {
+	if offset == 0 {
+		return os.Create(part)
+	}
+
+	f, err := os.OpenFile(part, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+/*
+Parse the Content-Range header of a partial response
+  - @param value Value of the header, "bytes first-last/size"
+  - @returns First byte sent and size of the whole file, -1 if unknown, or an error
+*/
+func contentRange(value string) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	rng, total, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	if total == "*" {
+		return start, -1, nil
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	return start, size, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+var content = bytes.Repeat([]byte("elemental"), 100000)
+
+/*
+Serve the content, the first request is interrupted in the middle
+  - @param t Test
+  - @returns Server and the Range headers received
+*/
+func server(t *testing.T) (*httptest.Server, *[]string) {
+	var ranges []string
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if calls.Add(1) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+		http.ServeContent(w, r, "image.iso", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &ranges
+}
+
+func TestResume(t *testing.T) {
+	srv, ranges := server(t)
+	file := filepath.Join(t.TempDir(), "image.iso")
+	sum := &Checksum{Algorithm: SHA512, Sum: fmt.Sprintf("%x", sha512.Sum512(content))}
+
+	d := New(srv.URL, file, sum)
+	if _, err := d.Run(context.Background()); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	stats, err := d.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Resumed != int64(len(content)/2) || stats.Size != int64(len(content)) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if (*ranges)[1] != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Fatalf("unexpected ranges %q", *ranges)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("wrong content, %v", err)
+	}
+	if _, err := os.Stat(file + PartSuffix); !os.IsNotExist(err) {
+		t.Fatal("partial file kept")
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	srv, _ := server(t)
+	file := filepath.Join(t.TempDir(), "image.iso")
+	sum := &Checksum{Algorithm: SHA256, Sum: strings.Repeat("0", 64)}
+
+	d := New(srv.URL, file, sum)
+	_, _ = d.Run(context.Background())
+	if _, err := d.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := os.Stat(file + PartSuffix); !os.IsNotExist(err) {
+		t.Fatal("corrupted partial file kept")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("corrupted file renamed")
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("b", 128)
+
+	sum, err := ParseChecksum(a+"  elemental-cluster.iso\n", "../../elemental-local.iso")
+	if err != nil || sum.Algorithm != SHA256 || sum.Sum != a {
+		t.Fatalf("unexpected checksum %v, %v", sum, err)
+	}
+	sum, err = ParseChecksum(a+"  one.raw\n"+b+" *two.raw\n", "/tmp/two.raw")
+	if err != nil || sum.Algorithm != SHA512 || sum.Sum != b {
+		t.Fatalf("unexpected checksum %v, %v", sum, err)
+	}
+	if _, err := ParseChecksum("abcd  x.iso\n", "x.iso"); err == nil {
+		t.Fatal("short checksum accepted")
+	}
+}
+
+// Node keeping the files in memory
+type memRemote map[string][]byte
+
+func (m memRemote) Run(_ context.Context, cmd string) (*sshpool.Result, error) {
+	name, data := "", []byte(nil)
+	for path, d := range m {
+		if strings.HasSuffix(cmd, sshpool.Quote(path)) {
+			name, data = path, d
+		}
+	}
+
+	r := &sshpool.Result{Command: cmd}
+	switch {
+	case name == "":
+		r.ExitCode = 1
+	case strings.HasPrefix(cmd, "stat "):
+		r.Stdout = fmt.Sprintf("%d\n", len(data))
+	case strings.HasPrefix(cmd, "sha256sum "):
+		r.Stdout = fmt.Sprintf("%x  %s\n", sha256.Sum256(data), name)
+	case strings.HasPrefix(cmd, "rm "):
+		delete(m, name)
+	}
+
+	return r, nil
+}
+
+func (m memRemote) Write(_ context.Context, cmd string, stdin io.Reader) error {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	path := strings.Trim(cmd[strings.LastIndex(cmd, " ")+1:], "'")
+	if strings.HasPrefix(cmd, "cat >> ") {
+		data = append(m[path], data...)
+	}
+	m[path] = data
+
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "airgap.zst")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A previous attempt sent the first half
+	remote := memRemote{"/opt/rancher/airgap.zst": bytes.Clone(content[:len(content)/2])}
+	stats, err := Send(context.Background(), remote, src, "/opt/rancher/airgap.zst", SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Resumed != int64(len(content)/2) || !bytes.Equal(remote["/opt/rancher/airgap.zst"], content) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Garbage is detected and removed
+	remote["/opt/rancher/airgap.zst"] = []byte("garbage")
+	if _, err := Send(context.Background(), remote, src, "/opt/rancher/airgap.zst", SHA256); err == nil {
+		t.Fatal("corrupted file accepted")
+	}
+	if _, found := remote["/opt/rancher/airgap.zst"]; found {
+		t.Fatal("corrupted file kept")
+	}
+}
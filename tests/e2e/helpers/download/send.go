@@ -0,0 +1,143 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+// Node receiving a file, implemented by *sshpool.Client
+type Remote interface {
+	Run(ctx context.Context, cmd string) (*sshpool.Result, error)
+	Write(ctx context.Context, cmd string, stdin io.Reader) error
+}
+
+/*
+Send a local file to a node, or the part missing since the previous attempt
+  - @remarks The content is verified with a checksum computed on the node
+  - @param ctx Context used to stop the transfer
+  - @param r Node receiving the file
+  - @param src Path of the local file
+  - @param dst Path of the file on the node
+  - @param alg Algorithm of the checksum, its "<alg>sum" command must be available on the node
+  - @returns Statistics of the attempt, or an error, the remote file is kept unless its content is wrong
+*/
+func Send(ctx context.Context, r Remote, src, dst string, alg Algorithm) (*Stats, error) {
+	h, err := alg.New()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := remoteSize(ctx, r, dst)
+	if err != nil {
+		return nil, err
+	}
+	// Bigger than the source, it cannot be the beginning of it
+	if offset > info.Size() {
+		offset = 0
+	}
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		return nil, err
+	}
+
+	cmd := "cat > " + sshpool.Quote(dst)
+	if offset > 0 {
+		cmd = "cat >> " + sshpool.Quote(dst)
+	}
+
+	start := time.Now()
+	counter := &counter{r: io.TeeReader(f, h)}
+	if err := r.Write(ctx, cmd, counter); err != nil {
+		return nil, fmt.Errorf("%s: interrupted after %d bytes: %w", dst, offset+counter.n, err)
+	}
+
+	stats := &Stats{
+		Size:        offset + counter.n,
+		Resumed:     offset,
+		Transferred: counter.n,
+		Duration:    time.Since(start),
+		Checksum:    Checksum{Algorithm: alg, Sum: fmt.Sprintf("%x", h.Sum(nil))},
+	}
+
+	res, err := r.Run(ctx, string(alg)+"sum "+sshpool.Quote(dst))
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(res.Stdout)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s: no checksum computed on the node", dst)
+	}
+	if fields[0] != stats.Checksum.Sum {
+		// Resuming a corrupted file is pointless
+		_, _ = r.Run(ctx, "rm -f "+sshpool.Quote(dst))
+		return nil, fmt.Errorf("%s: %s checksum mismatch: got %s on the node, expected %s", dst, alg, fields[0], stats.Checksum.Sum)
+	}
+
+	return stats, nil
+}
+
+/*
+Get the size of a file on a node
+  - @param ctx Context used to stop the command
+  - @param r Node to check
+  - @param path Path of the file
+  - @returns The size, 0 if the file does not exist, or an error
+*/
+func remoteSize(ctx context.Context, r Remote, path string) (int64, error) {
+	res, err := r.Run(ctx, "stat -c %s "+sshpool.Quote(path))
+	if err != nil {
+		return 0, err
+	}
+	if !res.Success() {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(res.Stdout), 10, 64)
+}
+
+// Reader counting the bytes read
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package download
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statistics of a completed transfer
+type Stats struct {
+	Size        int64
+	Resumed     int64
+	Transferred int64
+	Duration    time.Duration
+	Checksum    Checksum
+}
+
+/*
+Get the throughput of the transfer
+  - @remarks Only the data transferred by the last attempt is accounted
+  - @returns Bytes per second, 0 if nothing was transferred
+*/
+func (s *Stats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+
+	return float64(s.Transferred) / s.Duration.Seconds()
+}
+
+func (s *Stats) String() string {
+	str := fmt.Sprintf("%s in %s (%s/s)", humanSize(s.Transferred), s.Duration.Round(time.Millisecond), humanSize(int64(s.Throughput())))
+	if s.Resumed > 0 {
+		str += fmt.Sprintf(", resumed at %s of %s", humanSize(s.Resumed), humanSize(s.Size))
+	}
+
+	return str + ", " + s.Checksum.String()
+}
+
+/*
+Format a size for humans
+  - @param n Size in bytes
+  - @returns The size with a binary unit
+*/
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,350 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// Resource names of the Elemental kinds
+var (
+	MachineRegistrationResource              = GroupVersion.WithResource("machineregistrations")
+	MachineInventoryResource                 = GroupVersion.WithResource("machineinventories")
+	MachineInventorySelectorResource         = GroupVersion.WithResource("machineinventoryselectors")
+	MachineInventorySelectorTemplateResource = GroupVersion.WithResource("machineinventoryselectortemplates")
+	SeedImageResource                        = GroupVersion.WithResource("seedimages")
+	ManagedOSImageResource                   = GroupVersion.WithResource("managedosimages")
+	ManagedOSVersionResource                 = GroupVersion.WithResource("managedosversions")
+	ManagedOSVersionChannelResource          = GroupVersion.WithResource("managedosversionchannels")
+	MachineResource                          = MachineGroupVersion.WithResource("machines")
+)
+
+// List kinds of the Elemental resources, needed by the fake dynamic client
+var ListKinds = map[schema.GroupVersionResource]string{
+	MachineRegistrationResource:              "MachineRegistrationList",
+	MachineInventoryResource:                 "MachineInventoryList",
+	MachineInventorySelectorResource:         "MachineInventorySelectorList",
+	MachineInventorySelectorTemplateResource: "MachineInventorySelectorTemplateList",
+	SeedImageResource:                        "SeedImageList",
+	ManagedOSImageResource:                   "ManagedOSImageList",
+	ManagedOSVersionResource:                 "ManagedOSVersionList",
+	ManagedOSVersionChannelResource:          "ManagedOSVersionChannelList",
+	MachineResource:                          "MachineList",
+}
+
+// Client for the Elemental resources
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// Typed access to one kind of Elemental resource in a namespace
+type Resource[T any] struct {
+	client dynamic.ResourceInterface
+}
+
+// Event received when watching a resource
+type Event[T any] struct {
+	Type   watch.EventType
+	Object *T
+
+	// Error sent by the API server or met while decoding, Object is nil then
+	Err error
+}
+
+/*
+Create a client from an existing Kubernetes client
+  - @param dyn Dynamic Kubernetes client, can be a fake one
+  - @returns Pointer to the client
+*/
+func NewClient(dyn dynamic.Interface) *Client {
+	return &Client{dynamic: dyn}
+}
+
+/*
+Create a client from the kubeconfig file
+  - @remarks Same loading rules as kubectl (KUBECONFIG variable or ~/.kube/config)
+  - @returns Pointer to the client or an error
+*/
+func NewClientFromKubeconfig() (*Client, error) {
+	dyn, err := kube.NewDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(dyn), nil
+}
+
+func newResource[T any](c *Client, gvr schema.GroupVersionResource, ns string) *Resource[T] {
+	return &Resource[T]{client: c.dynamic.Resource(gvr).Namespace(ns)}
+}
+
+// MachineRegistrations in a namespace
+func (c *Client) MachineRegistrations(ns string) *Resource[MachineRegistration] {
+	return newResource[MachineRegistration](c, MachineRegistrationResource, ns)
+}
+
+// MachineInventories in a namespace
+func (c *Client) MachineInventories(ns string) *Resource[MachineInventory] {
+	return newResource[MachineInventory](c, MachineInventoryResource, ns)
+}
+
+// MachineInventorySelectors in a namespace
+func (c *Client) MachineInventorySelectors(ns string) *Resource[MachineInventorySelector] {
+	return newResource[MachineInventorySelector](c, MachineInventorySelectorResource, ns)
+}
+
+// MachineInventorySelectorTemplates in a namespace
+func (c *Client) MachineInventorySelectorTemplates(ns string) *Resource[MachineInventorySelectorTemplate] {
+	return newResource[MachineInventorySelectorTemplate](c, MachineInventorySelectorTemplateResource, ns)
+}
+
+// SeedImages in a namespace
+func (c *Client) SeedImages(ns string) *Resource[SeedImage] {
+	return newResource[SeedImage](c, SeedImageResource, ns)
+}
+
+// ManagedOSImages in a namespace
+func (c *Client) ManagedOSImages(ns string) *Resource[ManagedOSImage] {
+	return newResource[ManagedOSImage](c, ManagedOSImageResource, ns)
+}
+
+// ManagedOSVersions in a namespace
+func (c *Client) ManagedOSVersions(ns string) *Resource[ManagedOSVersion] {
+	return newResource[ManagedOSVersion](c, ManagedOSVersionResource, ns)
+}
+
+// ManagedOSVersionChannels in a namespace
+func (c *Client) ManagedOSVersionChannels(ns string) *Resource[ManagedOSVersionChannel] {
+	return newResource[ManagedOSVersionChannel](c, ManagedOSVersionChannelResource, ns)
+}
+
+// Cluster API Machines in a namespace
+func (c *Client) Machines(ns string) *Resource[Machine] {
+	return newResource[Machine](c, MachineResource, ns)
+}
+
+/*
+Convert an unstructured object to its typed version
+  - @param u Object to convert
+  - @returns Pointer to the typed object or an error
+*/
+func decode[T any](u *unstructured.Unstructured) (*T, error) {
+	obj := new(T)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj); err != nil {
+		return nil, fmt.Errorf("cannot decode %s %s: %w", u.GetKind(), u.GetName(), err)
+	}
+
+	return obj, nil
+}
+
+/*
+Get a resource
+  - @param name Name of the resource
+  - @returns Pointer to the resource or an error
+*/
+func (r *Resource[T]) Get(name string) (*T, error) {
+	u, err := r.client.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return decode[T](u)
+}
+
+/*
+List resources
+  - @param selector Label selector to filter on, empty for all resources
+  - @returns List of the resources or an error
+*/
+func (r *Resource[T]) List(selector string) ([]T, error) {
+	list, err := r.client.List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]T, 0, len(list.Items))
+	for i := range list.Items {
+		obj, err := decode[T](&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, *obj)
+	}
+
+	return objs, nil
+}
+
+/*
+Get the names of the resources
+  - @param selector Label selector to filter on, empty for all resources
+  - @returns List of the names or an error
+*/
+func (r *Resource[T]) Names(selector string) ([]string, error) {
+	list, err := r.client.List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+
+	return names, nil
+}
+
+/*
+Watch resources
+  - @remarks The channel is closed when the context is cancelled or the watch ends, errors are sent as events
+  - @param ctx Context used to stop the watch
+  - @param name Name of the resource to watch, empty for all resources
+  - @returns Channel of typed events or an error
+*/
+func (r *Resource[T]) Watch(ctx context.Context, name string) (<-chan Event[T], error) {
+	opts := metav1.ListOptions{}
+	if name != "" {
+		opts.FieldSelector = "metadata.name=" + name
+	}
+
+	w, err := r.client.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event[T])
+	go func() {
+		defer close(events)
+		defer w.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+
+				event := Event[T]{Type: e.Type}
+				if u, isObj := e.Object.(*unstructured.Unstructured); isObj && e.Type != watch.Error {
+					event.Object, event.Err = decode[T](u)
+				} else {
+					event.Err = apierrors.FromObject(e.Object)
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+/*
+Get a resource as YAML
+  - @remarks All the fields are kept, not only the typed ones
+  - @param name Name of the resource
+  - @returns The YAML definition or an error
+*/
+func (r *Resource[T]) YAML(name string) (string, error) {
+	u, err := r.client.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+/*
+Patch a resource
+  - @param name Name of the resource
+  - @param patch JSON merge patch to apply
+  - @returns Pointer to the patched resource or an error
+*/
+func (r *Resource[T]) Patch(name string, patch []byte) (*T, error) {
+	u, err := r.client.Patch(context.Background(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return decode[T](u)
+}
+
+/*
+Patch a resource with a value
+  - @param name Name of the resource
+  - @param patch Value to marshal as a JSON merge patch
+  - @returns Pointer to the patched resource or an error
+*/
+func (r *Resource[T]) PatchValue(name string, patch interface{}) (*T, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Patch(name, data)
+}
+
+/*
+Patch a resource with a file
+  - @param name Name of the resource
+  - @param file YAML or JSON merge patch file
+  - @returns Pointer to the patched resource or an error
+*/
+func (r *Resource[T]) PatchFile(name, file string) (*T, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %s to JSON: %w", file, err)
+	}
+
+	return r.Patch(name, patch)
+}
+
+/*
+Delete a resource
+  - @param name Name of the resource
+  - @returns Nothing or an error
+*/
+func (r *Resource[T]) Delete(name string) error {
+	return r.client.Delete(context.Background(), name, metav1.DeleteOptions{})
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNS = "fleet-default"
+
+func newObject(kind, name string, content map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(GroupVersion.String())
+	u.SetKind(kind)
+	u.SetNamespace(testNS)
+	u.SetName(name)
+
+	return u
+}
+
+func newFakeClient(objs ...runtime.Object) *Client {
+	return NewClient(fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds, objs...))
+}
+
+func TestGetDecodesStatus(t *testing.T) {
+	c := newFakeClient(newObject("SeedImage", "seed", map[string]interface{}{
+		"spec":   map[string]interface{}{"baseImage": "registry/os:latest", "cleanupAfterMinutes": int64(0)},
+		"status": map[string]interface{}{"downloadURL": "http://host/seed.iso", "checksumURL": "http://host/seed.iso.sha256"},
+	}))
+
+	seed, err := c.SeedImages(testNS).Get("seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed.Spec.BaseImage != "registry/os:latest" || seed.Status.DownloadURL != "http://host/seed.iso" {
+		t.Errorf("unexpected SeedImage: %+v", seed)
+	}
+
+	if _, err := c.SeedImages(testNS).Get("missing"); err == nil {
+		t.Error("expected an error for a missing SeedImage")
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	c := newFakeClient(
+		newObject("MachineInventory", "m-1", map[string]interface{}{}),
+		newObject("MachineInventory", "m-2", map[string]interface{}{}),
+		newObject("ManagedOSVersion", "v1.0", map[string]interface{}{
+			"spec": map[string]interface{}{"metadata": map[string]interface{}{"uri": "registry/os:v1.0"}},
+		}),
+	)
+
+	id, err := c.GetServerID(testNS, 2)
+	if err != nil || id != "m-2" {
+		t.Errorf("GetServerID() = %q, %v", id, err)
+	}
+	if _, err := c.GetServerID(testNS, 3); err == nil {
+		t.Error("expected an error for an out of range index")
+	}
+
+	uri, err := c.GetImageURI(testNS, "v1.0\n")
+	if err != nil || uri != "registry/os:v1.0" {
+		t.Errorf("GetImageURI() = %q, %v", uri, err)
+	}
+
+	// Fake client supports merge patches, so labels can be checked
+	if err := c.SetMachineInventoryLabel(testNS, "m-1", "clusterName", "cluster-1"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.MachineInventories(testNS).Get("m-1")
+	if err != nil || m.Labels["clusterName"] != "cluster-1" {
+		t.Errorf("label not set: %+v, %v", m, err)
+	}
+
+	selected, err := c.MachineInventories(testNS).List("clusterName=cluster-1")
+	if err != nil || len(selected) != 1 || selected[0].Name != "m-1" {
+		t.Errorf("List() = %+v, %v", selected, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := newFakeClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.ManagedOSVersionChannels(testNS).Watch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.dynamic.Resource(ManagedOSVersionChannelResource).Namespace(testNS).Create(ctx,
+		newObject("ManagedOSVersionChannel", "channel", map[string]interface{}{
+			"spec": map[string]interface{}{"options": map[string]interface{}{"image": "registry/channel:latest"}},
+		}), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != watch.Added || e.Object.Spec.Options.Image != "registry/channel:latest" {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("channel should be closed when the context is cancelled")
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds)
+	w := watch.NewFake()
+	dyn.PrependWatchReactor("*", k8stesting.DefaultWatchReactor(w, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := NewClient(dyn).SeedImages(testNS).Watch(ctx, "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go w.Error(&metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonExpired, Message: "too old resource version"})
+
+	select {
+	case e := <-events:
+		if e.Type != watch.Error || e.Object != nil || !apierrors.IsResourceExpired(e.Err) {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error received")
+	}
+}
+
+func TestMachines(t *testing.T) {
+	machine := newObject("Machine", "m-abc", map[string]interface{}{
+		"status": map[string]interface{}{
+			"nodeRef": map[string]interface{}{"kind": "Node", "name": "m-1"},
+			"addresses": []interface{}{
+				map[string]interface{}{"type": "Hostname", "address": "node-001"},
+				map[string]interface{}{"type": "InternalIP", "address": "192.168.122.2"},
+			},
+		},
+	})
+	machine.SetAPIVersion(MachineGroupVersion.String())
+	c := newFakeClient(machine)
+
+	name, err := c.GetInternalMachine(testNS, "m-1")
+	if err != nil || name != "m-abc" {
+		t.Errorf("GetInternalMachine() = %q, %v", name, err)
+	}
+	if name, err := c.GetInternalMachine(testNS, "m-2"); err != nil || name != "" {
+		t.Errorf("GetInternalMachine() = %q, %v for a deleted machine", name, err)
+	}
+
+	host, err := c.GetExternalMachine(testNS, "m-abc")
+	if err != nil || host != "node-001" {
+		t.Errorf("GetExternalMachine() = %q, %v", host, err)
+	}
+	ip, err := c.GetExternalMachineIP(testNS, "m-abc")
+	if err != nil || ip != "192.168.122.2" {
+		t.Errorf("GetExternalMachineIP() = %q, %v", ip, err)
+	}
+
+	out, err := c.Machines(testNS).YAML("m-abc")
+	if err != nil || !strings.Contains(out, "address: 192.168.122.2") {
+		t.Errorf("YAML() = %q, %v", out, err)
+	}
+}
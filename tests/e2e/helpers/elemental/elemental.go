@@ -19,67 +19,21 @@ import (
 	"strings"
 
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"gopkg.in/yaml.v3"
 )
 
-/*
-Add node selector
-  - @param key key to add in YAML
-  - @param value value to set the key to
-  - @returns The YAML structure or an error
-*/
-func AddSelector(key, value string) ([]byte, error) {
-	type selectorYaml struct {
-		MatchLabels map[string]string `yaml:"matchLabels,omitempty"`
-	}
-
-	type selector struct {
-		SelectorYaml selectorYaml `yaml:"nodeSelector,omitempty"`
-	}
-
-	v := selectorYaml{map[string]string{key: value}}
-	s := selector{v}
-	out, err := yaml.Marshal(s)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add indent at the beginning
-	out = append([]byte("  "), out...)
-
-	return out, nil
-}
-
-/*
-Get state of the cluster
-  - @param ns Namespace where the cluster is deployed
-  - @param cluster Name of the cluster to check
-  - @param condition Status to search for
-  - @returns The YAML structure or an error
-*/
-func GetClusterState(ns, cluster, condition string) (string, error) {
-	out, err := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io", "--namespace", ns, cluster, "-o", "jsonpath="+condition)
-	if err != nil {
-		return "", err
-	}
-	return out, nil
-}
-
 /*
 Get nodeName from MachineInventory
   - @param ns Namespace
   - @param machine Machine name as seen by Rancher Manager
   - @returns Corresponding external machine name
 */
-func GetExternalMachine(ns, machine string) (string, error) {
-	node, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns, machine,
-		"-o", "jsonpath={.status.addresses[?(@.type==\"Hostname\")].address}")
+func (c *Client) GetExternalMachine(ns, machine string) (string, error) {
+	m, err := c.Machines(ns).Get(machine)
 	if err != nil {
 		return "", err
 	}
 
-	return node, nil
+	return m.Address("Hostname"), nil
 }
 
 /*
@@ -88,15 +42,13 @@ Get IP from MachineInventory
   - @param machine Machine name as seen by Rancher Manager
   - @returns Corresponding machine IP
 */
-func GetExternalMachineIP(ns, machine string) (string, error) {
-	node, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns, machine,
-		"-o", "jsonpath={.status.addresses[?(@.type==\"InternalIP\")].address}")
+func (c *Client) GetExternalMachineIP(ns, machine string) (string, error) {
+	m, err := c.Machines(ns).Get(machine)
 	if err != nil {
 		return "", err
 	}
 
-	return node, nil
+	return m.Address("InternalIP"), nil
 }
 
 /*
@@ -105,33 +57,35 @@ Get container URI from ManagedOSVersion
   - @param os OS version to get URI from
   - @returns URI of container image
 */
-func GetImageURI(ns, os string) (string, error) {
-	uri, err := kubectl.RunWithoutErr("get", "ManagedOSVersion",
-		"--namespace", ns, os,
-		"-o", "jsonpath={.spec.metadata.uri}")
-
+func (c *Client) GetImageURI(ns, os string) (string, error) {
+	version, err := c.ManagedOSVersions(ns).Get(strings.TrimSpace(os))
 	if err != nil {
 		return "", err
 	}
 
-	return uri, nil
+	return version.Spec.Metadata.URI, nil
 }
 
 /*
 Get Machine from MachineInventory
   - @param ns Namespace
   - @param machineInventory Machine name as seen by Elemental
-  - @returns Corresponding internal machine name
+  - @returns Corresponding internal machine name, empty if there is none, or an error
 */
-func GetInternalMachine(ns, machineInventory string) (string, error) {
-	machine, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns,
-		"-o", "jsonpath={.items[?(@.status.nodeRef.name==\""+machineInventory+"\")].metadata.name}")
+func (c *Client) GetInternalMachine(ns, machineInventory string) (string, error) {
+	machines, err := c.Machines(ns).List("")
 	if err != nil {
 		return "", err
 	}
 
-	return machine, nil
+	for _, m := range machines {
+		if m.Status.NodeRef != nil && m.Status.NodeRef.Name == machineInventory {
+			return m.Name, nil
+		}
+	}
+
+	// The Machine can already be deleted
+	return "", nil
 }
 
 /*
@@ -168,18 +122,20 @@ func GetOperatorVersion() (string, error) {
 /*
 Get MachineInventory name (aka. server id)
   - @param ns Namespace
-  - @param index URL of the repository
+  - @param index Index of the MachineInventory, starting at 1
   - @returns The name/id of the server or an error
 */
-func GetServerID(ns string, index int) (string, error) {
-	serverID, err := kubectl.RunWithoutErr("get", "MachineInventories",
-		"--namespace", ns,
-		"-o", "jsonpath={.items["+fmt.Sprint(index-1)+"].metadata.name}")
+func (c *Client) GetServerID(ns string, index int) (string, error) {
+	names, err := c.MachineInventories(ns).Names("")
 	if err != nil {
 		return "", err
 	}
 
-	return serverID, nil
+	if index < 1 || index > len(names) {
+		return "", fmt.Errorf("no MachineInventory at index %d, %d found", index, len(names))
+	}
+
+	return names[index-1], nil
 }
 
 /*
@@ -208,13 +164,33 @@ Set a label on MachineInventory
   - @param value Value to set on Label
   - @returns Nothing or an error
 */
-func SetMachineInventoryLabel(ns, node, key, value string) error {
-	_, err := kubectl.RunWithoutErr("label", "machineinventory",
-		"--namespace", ns, node,
-		"--overwrite", key+"="+value)
+func (c *Client) SetMachineInventoryLabel(ns, node, key, value string) error {
+	_, err := c.MachineInventories(ns).PatchValue(node, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{key: value},
+		},
+	})
+
+	return err
+}
+
+/*
+Get MachineInventory registered with an IP
+  - @param ns Namespace
+  - @param ip IP used by the node to register
+  - @returns The MachineInventory name or an error
+*/
+func (c *Client) GetMachineInventoryByIP(ns, ip string) (string, error) {
+	machines, err := c.MachineInventories(ns).List("")
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	for _, m := range machines {
+		if m.Annotations["elemental.cattle.io/registration-ip"] == ip {
+			return m.Name, nil
+		}
 	}
 
-	return nil
+	return "", fmt.Errorf("no MachineInventory registered with IP %s", ip)
 }
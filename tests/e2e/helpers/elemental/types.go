@@ -0,0 +1,224 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// NOTE: only the fields used by the tests are defined here, unknown fields are ignored when decoding
+
+// API group and version of the Elemental resources
+var GroupVersion = schema.GroupVersion{Group: "elemental.cattle.io", Version: "v1beta1"}
+
+// API group and version of the Cluster API resources created by Rancher Manager
+var MachineGroupVersion = schema.GroupVersion{Group: "cluster.x-k8s.io", Version: "v1beta1"}
+
+// Reference to an object in the same namespace
+type ObjectReference struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// MachineRegistration resource
+type MachineRegistration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              MachineRegistrationSpec   `json:"spec,omitempty"`
+	Status            MachineRegistrationStatus `json:"status,omitempty"`
+}
+
+type MachineRegistrationSpec struct {
+	MachineName                 string                 `json:"machineName,omitempty"`
+	MachineInventoryLabels      map[string]string      `json:"machineInventoryLabels,omitempty"`
+	MachineInventoryAnnotations map[string]string      `json:"machineInventoryAnnotations,omitempty"`
+	Config                      map[string]interface{} `json:"config,omitempty"`
+}
+
+type MachineRegistrationStatus struct {
+	Conditions        []metav1.Condition `json:"conditions,omitempty"`
+	RegistrationURL   string             `json:"registrationURL,omitempty"`
+	RegistrationToken string             `json:"registrationToken,omitempty"`
+}
+
+// MachineInventory resource
+type MachineInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              MachineInventorySpec   `json:"spec,omitempty"`
+	Status            MachineInventoryStatus `json:"status,omitempty"`
+}
+
+type MachineInventorySpec struct {
+	TPMHash     string `json:"tpmHash,omitempty"`
+	MachineHash string `json:"machineHash,omitempty"`
+}
+
+type MachineInventoryStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// MachineInventorySelectorTemplate resource
+type MachineInventorySelectorTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              MachineInventorySelectorTemplateSpec `json:"spec,omitempty"`
+}
+
+type MachineInventorySelectorTemplateSpec struct {
+	Template MachineInventorySelectorTemplateContent `json:"template,omitempty"`
+}
+
+type MachineInventorySelectorTemplateContent struct {
+	Spec MachineInventorySelectorSpec `json:"spec,omitempty"`
+}
+
+type MachineInventorySelectorSpec struct {
+	Selector metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// MachineInventorySelector resource, created from the template for each machine pool
+type MachineInventorySelector struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              MachineInventorySelectorSpec `json:"spec,omitempty"`
+}
+
+// SeedImage resource
+type SeedImage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              SeedImageSpec   `json:"spec,omitempty"`
+	Status            SeedImageStatus `json:"status,omitempty"`
+}
+
+type SeedImageSpec struct {
+	BaseImage              string                 `json:"baseImage,omitempty"`
+	BootloaderImage        string                 `json:"bootloaderImage,omitempty"`
+	CloudConfig            map[string]interface{} `json:"cloud-config,omitempty"`
+	MachineRegistrationRef *ObjectReference       `json:"registrationRef,omitempty"`
+	Type                   string                 `json:"type,omitempty"`
+	CleanupAfterMinutes    int64                  `json:"cleanupAfterMinutes,omitempty"`
+	RetriggerBuild         bool                   `json:"retriggerBuild,omitempty"`
+}
+
+type SeedImageStatus struct {
+	Conditions  []metav1.Condition `json:"conditions,omitempty"`
+	DownloadURL string             `json:"downloadURL,omitempty"`
+	ChecksumURL string             `json:"checksumURL,omitempty"`
+	State       string             `json:"state,omitempty"`
+}
+
+// ManagedOSImage resource
+type ManagedOSImage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ManagedOSImageSpec `json:"spec,omitempty"`
+}
+
+type ManagedOSImageSpec struct {
+	OSImage              string                 `json:"osImage,omitempty"`
+	ManagedOSVersionName string                 `json:"managedOSVersionName,omitempty"`
+	Clusters             []ManagedOSImageTarget `json:"clusterTargets,omitempty"`
+	NodeSelector         *metav1.LabelSelector  `json:"nodeSelector,omitempty"`
+}
+
+type ManagedOSImageTarget struct {
+	ClusterName string `json:"clusterName,omitempty"`
+}
+
+// ManagedOSVersion resource
+type ManagedOSVersion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ManagedOSVersionSpec `json:"spec,omitempty"`
+}
+
+type ManagedOSVersionSpec struct {
+	Version    string                   `json:"version,omitempty"`
+	Type       string                   `json:"type,omitempty"`
+	MinVersion string                   `json:"minVersion,omitempty"`
+	Metadata   ManagedOSVersionMetadata `json:"metadata,omitempty"`
+}
+
+type ManagedOSVersionMetadata struct {
+	DisplayName  string `json:"displayName,omitempty"`
+	URI          string `json:"uri,omitempty"`
+	UpgradeImage string `json:"upgradeImage,omitempty"`
+}
+
+// ManagedOSVersionChannel resource
+type ManagedOSVersionChannel struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ManagedOSVersionChannelSpec   `json:"spec,omitempty"`
+	Status            ManagedOSVersionChannelStatus `json:"status,omitempty"`
+}
+
+type ManagedOSVersionChannelSpec struct {
+	Type         string                         `json:"type,omitempty"`
+	SyncInterval string                         `json:"syncInterval,omitempty"`
+	Options      ManagedOSVersionChannelOptions `json:"options,omitempty"`
+}
+
+type ManagedOSVersionChannelOptions struct {
+	Image string `json:"image,omitempty"`
+}
+
+type ManagedOSVersionChannelStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Cluster API Machine, the node of a cluster as seen by Rancher Manager
+type Machine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            MachineStatus `json:"status,omitempty"`
+}
+
+type MachineStatus struct {
+	NodeRef    *ObjectReference   `json:"nodeRef,omitempty"`
+	Addresses  []MachineAddress   `json:"addresses,omitempty"`
+	Conditions []MachineCondition `json:"conditions,omitempty"`
+}
+
+type MachineCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type MachineAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+/*
+Get an address of the machine
+  - @param t Type of the address, like Hostname or InternalIP
+  - @returns The address, empty if not found
+*/
+func (m *Machine) Address(t string) string {
+	for _, a := range m.Status.Addresses {
+		if a.Type == t {
+			return a.Address
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/types"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+// Elemental node used in the tests
+type Node struct {
+	Hostname string
+	Index    int
+	MAC      string
+	IP       string
+
+	// Pool type (master, worker, ...) and cluster the node belongs to
+	Pool      string
+	Cluster   string
+	Namespace string
+
+	// Client used to access the node through SSH
+	Client *sshpool.Client
+
+	// Name of the MachineInventory, empty if the node is not registered yet
+	MachineInventory string
+}
+
+// Set of nodes handled together
+type Fleet struct {
+	Nodes []Node
+}
+
+// Error of a node returned by Run
+type NodeError struct {
+	Hostname string
+	Err      error
+}
+
+func (e *NodeError) Error() string {
+	return e.Hostname + ": " + e.Err.Error()
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Gomega failure of a node, raised to stop the node without failing the spec
+type nodeFailure struct {
+	message  string
+	location types.CodeLocation
+}
+
+/*
+Create a fleet
+  - @param nodes Nodes of the fleet
+  - @returns Pointer to the fleet
+*/
+func New(nodes ...Node) *Fleet {
+	return &Fleet{Nodes: nodes}
+}
+
+// Number of nodes in the fleet
+func (f *Fleet) Len() int {
+	return len(f.Nodes)
+}
+
+// Hostnames of the nodes, in fleet order
+func (f *Fleet) Hostnames() []string {
+	names := make([]string, 0, len(f.Nodes))
+	for _, n := range f.Nodes {
+		names = append(names, n.Hostname)
+	}
+
+	return names
+}
+
+/*
+Get a node
+  - @param hostname Hostname of the node
+  - @returns Pointer to the node and true if found
+*/
+func (f *Fleet) Node(hostname string) (*Node, bool) {
+	for i := range f.Nodes {
+		if f.Nodes[i].Hostname == hostname {
+			return &f.Nodes[i], true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+Keep only some nodes
+  - @param keep Function returning true for the nodes to keep
+  - @returns Pointer to a new fleet with the selected nodes
+*/
+func (f *Fleet) Filter(keep func(Node) bool) *Fleet {
+	var nodes []Node
+	for _, n := range f.Nodes {
+		if keep(n) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return New(nodes...)
+}
+
+/*
+Keep only the first nodes
+  - @param n Number of nodes to keep, all of them if larger than the fleet
+  - @returns Pointer to a new fleet with the selected nodes
+*/
+func (f *Fleet) First(n int) *Fleet {
+	if n > len(f.Nodes) {
+		n = len(f.Nodes)
+	}
+
+	return New(slices.Clone(f.Nodes[:n])...)
+}
+
+/*
+Execute a function on all nodes in parallel
+  - @remarks Failures are recovered per node, so one node cannot hide the others, Gomega failures are returned with their message instead of failing the spec
+  - @param parallelism Maximum number of nodes handled at the same time, no limit if <= 0
+  - @param fn Function to execute, Gomega assertions can be used
+  - @returns Nothing or the aggregated errors of the failed nodes
+*/
+func (f *Fleet) Run(parallelism int, fn func(Node)) error {
+	return errors.Join(f.run(parallelism, fn)...)
+}
+
+func (f *Fleet) run(parallelism int, fn func(Node)) []error {
+	if parallelism <= 0 || parallelism > len(f.Nodes) {
+		parallelism = len(f.Nodes)
+	}
+
+	var (
+		errs []error
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+	sem := make(chan struct{}, parallelism)
+
+	// Ginkgo only keeps the first failure of a spec, so the Gomega failures are kept per node instead,
+	// the previous fail handler is restored by InterceptGomegaFailures once all the nodes are done
+	InterceptGomegaFailures(func() {
+		RegisterFailHandler(func(message string, callerSkip ...int) {
+			skip := 0
+			if len(callerSkip) > 0 {
+				skip = callerSkip[0]
+			}
+			panic(&nodeFailure{message: message, location: types.NewCodeLocation(skip + 1)})
+		})
+
+		for _, n := range f.Nodes {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(n Node) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				// Forward the other failures to Ginkgo, so they are reported with their location
+				defer GinkgoRecover()
+				defer func() {
+					if r := recover(); r != nil {
+						mu.Lock()
+						errs = append(errs, &NodeError{Hostname: n.Hostname, Err: panicError(r)})
+						mu.Unlock()
+						if _, ok := r.(*nodeFailure); !ok {
+							panic(r)
+						}
+					}
+				}()
+
+				fn(n)
+			}(n)
+		}
+		wg.Wait()
+	})
+
+	// Keep a stable order, whatever the order of the failures
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].(*NodeError).Hostname < errs[j].(*NodeError).Hostname
+	})
+
+	return errs
+}
+
+/*
+Execute a function on all nodes in parallel, failing the spec if a node failed
+  - @param parallelism Maximum number of nodes handled at the same time, no limit if <= 0
+  - @param fn Function to execute, Gomega assertions can be used
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func (f *Fleet) ForEach(parallelism int, fn func(Node)) {
+	if errs := f.run(parallelism, fn); len(errs) > 0 {
+		err := errors.Join(errs...)
+		AddReportEntry("Failed nodes", err.Error())
+		Fail(fmt.Sprintf("%d/%d node(s) failed:\n%s", len(errs), len(f.Nodes), err), 1)
+	}
+}
+
+/*
+Convert a recovered panic into an error
+  - @remarks Ginkgo failures only carry the location, the message is in the spec report
+  - @param r Recovered value
+  - @returns The error
+*/
+func panicError(r any) error {
+	if f, ok := r.(*nodeFailure); ok {
+		return fmt.Errorf("%s\n%s", f.message, f.location)
+	}
+
+	var ginkgoErr types.GinkgoError
+	if err, ok := r.(error); ok && errors.As(err, &ginkgoErr) {
+		return errors.New("assertion failed")
+	}
+
+	if err, ok := r.(error); ok {
+		return err
+	}
+
+	return fmt.Errorf("panic: %v", r)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func newFleet(count int) *Fleet {
+	f := New()
+	for i := 1; i <= count; i++ {
+		f.Nodes = append(f.Nodes, Node{Hostname: fmt.Sprintf("node-%03d", i), Index: i})
+	}
+
+	return f
+}
+
+func TestRunParallelism(t *testing.T) {
+	var running, peak int32
+
+	err := newFleet(6).Run(2, func(n Node) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak > 2 {
+		t.Errorf("%d nodes handled at the same time, want at most 2", peak)
+	}
+}
+
+func TestRunAggregatesErrors(t *testing.T) {
+	boom := errors.New("boom")
+
+	err := newFleet(4).Run(0, func(n Node) {
+		if n.Index%2 == 0 {
+			panic(boom)
+		}
+	})
+
+	var nodeErr *NodeError
+	if !errors.As(err, &nodeErr) || !errors.Is(err, boom) {
+		t.Fatalf("Run() = %v, want NodeError wrapping %v", err, boom)
+	}
+	if want := "node-002: boom\nnode-004: boom"; err.Error() != want {
+		t.Errorf("Run() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestRunKeepsAssertionMessages(t *testing.T) {
+	var failures []string
+	RegisterFailHandler(func(message string, _ ...int) {
+		failures = append(failures, message)
+	})
+
+	err := newFleet(3).Run(0, func(n Node) {
+		Expect(n.Index).To(Equal(2), "unexpected index on "+n.Hostname)
+	})
+	if err == nil {
+		t.Fatal("Run() should fail")
+	}
+	for _, want := range []string{"node-001: unexpected index on node-001", "node-003: unexpected index on node-003"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() = %q, want %q", err.Error(), want)
+		}
+	}
+	if strings.Contains(err.Error(), "node-002") {
+		t.Errorf("Run() = %q, node-002 should not fail", err.Error())
+	}
+
+	// The previous fail handler is restored
+	Expect(false).To(BeTrue())
+	if len(failures) != 1 {
+		t.Errorf("%d failure(s) given to the previous handler, want 1", len(failures))
+	}
+}
+
+func TestFirst(t *testing.T) {
+	f := newFleet(3)
+
+	if got := f.First(2).Hostnames(); !slices.Equal(got, []string{"node-001", "node-002"}) {
+		t.Errorf("First(2) = %v", got)
+	}
+	if got := f.First(5).Len(); got != 3 {
+		t.Errorf("First(5) has %d nodes, want 3", got)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hypervisor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+// State of a domain, same values as 'virsh domstate'
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateShutOff   State = "shut off"
+	StatePaused    State = "paused"
+	StateShutdown  State = "in shutdown"
+	StateCrashed   State = "crashed"
+	StateUndefined State = "undefined"
+)
+
+const (
+	// Default interval between two state checks
+	DefaultPollInterval = 5 * time.Second
+
+	// Default time given to a network to change its state
+	DefaultNetworkTimeout = 2 * time.Minute
+
+	// Name of the serial console log, in the directory of the domain
+	ConsoleLogName = "console.log"
+)
+
+// Bus of a disk, as used by virt-install
+type Bus string
+
+const (
+	BusSATA   Bus = "sata"
+	BusSCSI   Bus = "scsi"
+	BusVirtio Bus = "virtio"
+	BusNVMe   Bus = "nvme"
+)
+
+// Disk created with a domain
+type Disk struct {
+	SizeGiB int
+	Bus     Bus
+}
+
+// Disk as set in the DISKS variable of the install-vm script, SIZE:BUS
+func (d Disk) String() string {
+	return fmt.Sprintf("%d:%s", d.SizeGiB, d.Bus)
+}
+
+// Definition of a domain (aka. VM)
+type Domain struct {
+	Name string
+	MAC  string
+
+	// Existing disk image to import, the node installation is used if empty
+	Disk string
+
+	// Disks of the node installation, in boot order, the defaults of the installation are used if empty
+	Disks []Disk
+
+	// Networks attached after the default one, with generated MAC addresses
+	Networks []string
+
+	// Resources, only used when a disk is imported
+	MemoryMiB int
+	VCPUs     int
+}
+
+// Hypervisor manages the lifecycle of the domains and their networks
+type Hypervisor interface {
+	// Define creates the domain and starts its first boot
+	Define(d Domain) error
+	// Clone copies a shut off domain and its disks into a new domain, left shut off
+	Clone(src string, d Domain) error
+	// Undefine removes a shut off domain and its disks
+	Undefine(name string) error
+	Start(name string) error
+	Shutdown(name string) error
+	Destroy(name string) error
+	State(name string) (State, error)
+	WaitState(ctx context.Context, name string, state State) error
+	// ConsoleLog returns the file where the serial console of the domain is logged, empty if not logged
+	ConsoleLog(name string) string
+
+	// CreateNetwork creates a transient network and waits for it to be active
+	CreateNetwork(n *network.Network) error
+	// DestroyNetwork removes a network and waits for it to be gone
+	DestroyNetwork(name string) error
+	// AddNetworkHost adds a static DHCP host in a running network
+	AddNetworkHost(name string, h network.Host) error
+	// RemoveNetworkHost removes a static DHCP host from a running network
+	RemoveNetworkHost(name, host string) error
+	// Network returns the current definition of a network
+	Network(name string) (*network.Network, error)
+}
+
+/*
+Wait for a condition to be true
+  - @param timeout Maximum time to wait
+  - @param interval Interval between two checks
+  - @param check Function returning nil when the condition is true
+  - @returns Nothing or the last error returned by check
+*/
+func poll(timeout, interval time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+/*
+Wait for a domain to reach a state
+  - @param ctx Context used to stop waiting
+  - @param h Hypervisor to use
+  - @param name Name of the domain
+  - @param state Expected state
+  - @param interval Interval between two checks
+  - @returns Nothing or an error
+*/
+func waitState(ctx context.Context, h Hypervisor, name string, state State, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		current, err := h.State(name)
+		if err == nil && current == state {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("domain %s is %q instead of %q: %w", name, current, state, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,465 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+// Output of 'virsh net-info' for an active or a persistent network
+var (
+	netActive     = regexp.MustCompile(`(?m)^Active:\s+yes`)
+	netPersistent = regexp.MustCompile(`(?m)^Persistent:\s+yes`)
+)
+
+// Error printed by virsh for an unknown network
+const netNotFound = "Network not found"
+
+// Libvirt hypervisor, driven with virsh and virt-install
+type Libvirt struct {
+	// Script used to install a node, called with the domain name and MAC address
+	InstallScript string
+
+	// Interval between two state checks
+	PollInterval time.Duration
+
+	// Time given to a network to change its state
+	NetworkTimeout time.Duration
+
+	// Base directory of the serial console logs, a sub-directory is used for each domain
+	// The console is not logged if empty
+	ConsoleDir string
+}
+
+/*
+Create a libvirt hypervisor
+  - @param installScript Script used to install a node
+  - @returns Pointer to the hypervisor
+*/
+func NewLibvirt(installScript string) *Libvirt {
+	return &Libvirt{
+		InstallScript:  installScript,
+		PollInterval:   DefaultPollInterval,
+		NetworkTimeout: DefaultNetworkTimeout,
+	}
+}
+
+/*
+Execute a virsh command
+  - @param args Arguments to pass to virsh
+  - @returns Output of the command or an error
+*/
+func virsh(args ...string) (string, error) {
+	out, err := exec.Command("sudo", append([]string{"virsh"}, args...)...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("virsh %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return string(out), nil
+}
+
+/*
+Get the serial console log of a domain
+  - @remarks The path is absolute, as it is used by QEMU
+  - @param name Name of the domain
+  - @returns Path of the log, empty if the console is not logged
+*/
+func (l *Libvirt) ConsoleLog(name string) string {
+	if l.ConsoleDir == "" {
+		return ""
+	}
+
+	// Used by QEMU, so must not depend on the current directory
+	dir, err := filepath.Abs(l.ConsoleDir)
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, name, ConsoleLogName)
+}
+
+/*
+Create the serial console log of a domain
+  - @remarks Created in advance, so the file stays readable by the tests once QEMU writes into it
+  - @param name Name of the domain
+  - @returns Path of the log, empty if not logged, or an error
+*/
+func (l *Libvirt) createConsoleLog(name string) (string, error) {
+	file := l.ConsoleLog(name)
+	if file == "" {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return file, f.Close()
+}
+
+/*
+Define a domain and start its first boot
+  - @remarks The node is installed with InstallScript, unless an existing disk is imported
+  - @param d Definition of the domain
+  - @returns Nothing or an error including the output of the installation
+*/
+func (l *Libvirt) Define(d Domain) error {
+	console, err := l.createConsoleLog(d.Name)
+	if err != nil {
+		return fmt.Errorf("cannot create console log of %s: %w", d.Name, err)
+	}
+
+	// Node installation
+	if d.Disk == "" {
+		cmd := exec.Command(l.InstallScript, d.Name, d.MAC)
+		cmd.Env = os.Environ()
+		if console != "" {
+			cmd.Env = append(cmd.Env, "CONSOLE_LOG="+console)
+		}
+		if len(d.Disks) > 0 {
+			disks := make([]string, len(d.Disks))
+			for i, disk := range d.Disks {
+				disks[i] = disk.String()
+			}
+			cmd.Env = append(cmd.Env, "DISKS="+strings.Join(disks, ","))
+		}
+		if len(d.Networks) > 0 {
+			cmd.Env = append(cmd.Env, "NETWORKS="+strings.Join(d.Networks, ","))
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("cannot install %s: %w: %s", d.Name, err, strings.TrimSpace(string(out)))
+		}
+
+		return nil
+	}
+
+	// Import of an existing disk
+	args := []string{"virt-install",
+		"--name", d.Name,
+		"--memory", strconv.Itoa(d.MemoryMiB),
+		"--vcpus", strconv.Itoa(d.VCPUs),
+		"--disk", "path=" + d.Disk + ",bus=sata",
+		"--import",
+		"--os-variant", "opensuse-unknown",
+		"--network=default,mac=" + d.MAC,
+		"--noautoconsole"}
+	for _, n := range d.Networks {
+		args = append(args, "--network=network="+n+",model=virtio")
+	}
+	if console != "" {
+		args = append(args, "--serial", "pty,log.file="+console+",log.append=on")
+	}
+	out, err := exec.Command("sudo", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot import %s: %w: %s", d.Name, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+/*
+Clone a shut off domain and its disks
+  - @remarks The clone is left shut off, with its own console log
+  - @param src Name of the domain to copy
+  - @param d Name and MAC address of the new domain
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Clone(src string, d Domain) error {
+	out, err := exec.Command("sudo", "virt-clone",
+		"--original", src,
+		"--name", d.Name,
+		"--mac", d.MAC,
+		"--auto-clone").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot clone %s into %s: %w: %s", src, d.Name, err, strings.TrimSpace(string(out)))
+	}
+
+	// The clone must not write into the console log of the original domain
+	console, err := l.createConsoleLog(d.Name)
+	if err != nil || console == "" {
+		return err
+	}
+	out, err = exec.Command("sudo", "virt-xml", d.Name, "--edit", "--serial", "pty,log.file="+console+",log.append=on").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot set console log of %s: %w: %s", d.Name, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+/*
+Remove a shut off domain, its NVRAM, TPM and disks
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Undefine(name string) error {
+	_, err := virsh("undefine", name, "--nvram", "--tpm", "--remove-all-storage")
+	return err
+}
+
+/*
+Start a domain
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Start(name string) error {
+	_, err := virsh("start", name)
+	return err
+}
+
+/*
+Ask a domain to shut down
+  - @remarks The guest can take some time, WaitState can be used to wait for it
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Shutdown(name string) error {
+	_, err := virsh("shutdown", name)
+	return err
+}
+
+/*
+Force off a domain
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Destroy(name string) error {
+	_, err := virsh("destroy", name)
+	return err
+}
+
+/*
+Get the state of a domain
+  - @param name Name of the domain
+  - @returns The state, StateUndefined with an error if unknown
+*/
+func (l *Libvirt) State(name string) (State, error) {
+	out, err := virsh("domstate", name)
+	if err != nil {
+		return StateUndefined, err
+	}
+
+	return State(strings.TrimSpace(out)), nil
+}
+
+/*
+Wait for a domain to reach a state
+  - @param ctx Context used to stop waiting
+  - @param name Name of the domain
+  - @param state Expected state
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) WaitState(ctx context.Context, name string, state State) error {
+	return waitState(ctx, l, name, state, l.PollInterval)
+}
+
+/*
+Check if a network interface exists on the host
+  - @param name Name of the interface
+  - @returns true if the interface exists
+*/
+func linkExists(name string) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/net", name))
+	return err == nil
+}
+
+/*
+Create a transient network and wait for it to be active
+  - @param n Definition of the network
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) CreateNetwork(n *network.Network) error {
+	data, err := n.XML()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "net-"+n.Name()+"-*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(data); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if _, err := virsh("net-create", file.Name()); err != nil {
+		return err
+	}
+
+	// The network is usable only when active and when its bridge is up
+	return poll(l.NetworkTimeout, l.PollInterval, func() error {
+		out, err := virsh("net-info", n.Name())
+		if err != nil {
+			return err
+		}
+		if !netActive.MatchString(out) {
+			return fmt.Errorf("network %s is not active", n.Name())
+		}
+		if bridge := n.Bridge(); bridge != "" && !linkExists(bridge) {
+			return fmt.Errorf("bridge %s of network %s is not up", bridge, n.Name())
+		}
+
+		return nil
+	})
+}
+
+/*
+Remove a network and wait for it and its bridge to be gone
+  - @param name Name of the network, nothing is done if it does not exist
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) DestroyNetwork(name string) error {
+	info, err := virsh("net-info", name)
+	if err != nil {
+		// Nothing to do if the network does not exist
+		if strings.Contains(info, netNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	n, err := l.Network(name)
+	if err != nil {
+		return err
+	}
+
+	if netActive.MatchString(info) {
+		if _, err := virsh("net-destroy", name); err != nil {
+			return err
+		}
+	}
+
+	// Only needed for persistent networks
+	if netPersistent.MatchString(info) {
+		if _, err := virsh("net-undefine", name); err != nil {
+			return err
+		}
+	}
+
+	// Wait for the network and its bridge to be really removed
+	return poll(l.NetworkTimeout, l.PollInterval, func() error {
+		if _, err := virsh("net-info", name); err == nil {
+			return fmt.Errorf("network %s still exists", name)
+		}
+		if bridge := n.Bridge(); bridge != "" && linkExists(bridge) {
+			return fmt.Errorf("bridge %s of network %s still exists", bridge, name)
+		}
+
+		return nil
+	})
+}
+
+/*
+Add a static DHCP host in a running network
+  - @param name Name of the network
+  - @param h Host to add
+  - @returns Nothing or an error if the host is not known by the network in time
+*/
+func (l *Libvirt) AddNetworkHost(name string, h network.Host) error {
+	xml, err := network.HostXML(h)
+	if err != nil {
+		return err
+	}
+
+	if _, err := virsh("net-update", name, "add", "ip-dhcp-host", "--live", "--xml", xml); err != nil {
+		return err
+	}
+
+	// Check that the host is really known by the running network
+	return poll(l.NetworkTimeout, l.PollInterval, func() error {
+		n, err := l.Network(name)
+		if err != nil {
+			return err
+		}
+		if _, ok := n.Host(h.Name); !ok {
+			return fmt.Errorf("host %s not found in network %s", h.Name, name)
+		}
+
+		return nil
+	})
+}
+
+/*
+Remove a static DHCP host from a running network
+  - @param name Name of the network
+  - @param host Hostname of the host to remove
+  - @returns Nothing or an error if the host is still known by the network in time
+*/
+func (l *Libvirt) RemoveNetworkHost(name, host string) error {
+	n, err := l.Network(name)
+	if err != nil {
+		return err
+	}
+
+	h, ok := n.Host(host)
+	if !ok {
+		return fmt.Errorf("host %s not found in network %s", host, name)
+	}
+
+	xml, err := network.HostXML(h)
+	if err != nil {
+		return err
+	}
+
+	if _, err := virsh("net-update", name, "delete", "ip-dhcp-host", "--live", "--xml", xml); err != nil {
+		return err
+	}
+
+	// Check that the host is really removed from the running network
+	return poll(l.NetworkTimeout, l.PollInterval, func() error {
+		n, err := l.Network(name)
+		if err != nil {
+			return err
+		}
+		if _, ok := n.Host(host); ok {
+			return fmt.Errorf("host %s still found in network %s", host, name)
+		}
+
+		return nil
+	})
+}
+
+/*
+Get the current definition of a network
+  - @param name Name of the network
+  - @returns Pointer to the network or an error
+*/
+func (l *Libvirt) Network(name string) (*network.Network, error) {
+	out, err := virsh("net-dumpxml", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return network.Parse(out)
+}
@@ -0,0 +1,389 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hypervisor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+// In-memory hypervisor, to test the orchestration without any VM
+type Memory struct {
+	mu       sync.Mutex
+	domains  map[string]*memDomain
+	networks map[string]*network.Network
+	calls    []string
+
+	// State of a domain after Define, StateRunning if empty
+	DefinedState State
+
+	// Interval between two state checks
+	PollInterval time.Duration
+}
+
+type memDomain struct {
+	def   Domain
+	state State
+}
+
+/*
+Create an in-memory hypervisor
+  - @returns Pointer to the hypervisor
+*/
+func NewMemory() *Memory {
+	return &Memory{
+		domains:      map[string]*memDomain{},
+		networks:     map[string]*network.Network{},
+		PollInterval: 10 * time.Millisecond,
+	}
+}
+
+/*
+Get the calls done on the hypervisor
+  - @returns List of the calls, as "Action name"
+*/
+func (m *Memory) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.calls...)
+}
+
+/*
+Force the state of a domain, as if the guest changed it
+  - @param name Name of the domain
+  - @param state New state
+  - @returns Nothing or an error
+*/
+func (m *Memory) SetState(name string, state State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.domains[name]
+	if !ok {
+		return fmt.Errorf("domain %s not found", name)
+	}
+	d.state = state
+
+	return nil
+}
+
+/*
+Get a defined domain
+  - @param name Name of the domain
+  - @returns The definition of the domain and true if found
+*/
+func (m *Memory) Domain(name string) (Domain, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.domains[name]
+	if !ok {
+		return Domain{}, false
+	}
+
+	return d.def, true
+}
+
+/*
+Change the state of a domain
+  - @param action Name of the action, recorded in the calls
+  - @param name Name of the domain
+  - @param from Allowed current states, any state if empty
+  - @param to New state
+  - @returns Nothing or an error
+*/
+func (m *Memory) transition(action, name string, from []State, to State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, action+" "+name)
+
+	d, ok := m.domains[name]
+	if !ok {
+		return fmt.Errorf("%s: domain %s not found", action, name)
+	}
+
+	if len(from) > 0 {
+		allowed := false
+		for _, s := range from {
+			if d.state == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s: domain %s is %q", action, name, d.state)
+		}
+	}
+	d.state = to
+
+	return nil
+}
+
+/*
+Define a domain
+  - @remarks Its state is DefinedState, nothing is installed
+  - @param d Definition of the domain
+  - @returns Nothing or an error if the domain already exists or one of its networks does not
+*/
+func (m *Memory) Define(d Domain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "Define "+d.Name)
+
+	if _, ok := m.domains[d.Name]; ok {
+		return fmt.Errorf("domain %s already exists", d.Name)
+	}
+	for _, n := range d.Networks {
+		if _, ok := m.networks[n]; !ok {
+			return fmt.Errorf("network %s of domain %s not found", n, d.Name)
+		}
+	}
+
+	state := m.DefinedState
+	if state == "" {
+		state = StateRunning
+	}
+	m.domains[d.Name] = &memDomain{def: d, state: state}
+
+	return nil
+}
+
+/*
+Clone a shut off domain
+  - @param src Name of the domain to copy
+  - @param d Name and MAC address of the new domain
+  - @returns Nothing or an error
+*/
+func (m *Memory) Clone(src string, d Domain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "Clone "+src+" "+d.Name)
+
+	orig, ok := m.domains[src]
+	if !ok {
+		return fmt.Errorf("domain %s not found", src)
+	}
+	if orig.state != StateShutOff {
+		return fmt.Errorf("domain %s is %q", src, orig.state)
+	}
+	if _, ok := m.domains[d.Name]; ok {
+		return fmt.Errorf("domain %s already exists", d.Name)
+	}
+
+	def := orig.def
+	def.Name, def.MAC = d.Name, d.MAC
+	m.domains[d.Name] = &memDomain{def: def, state: StateShutOff}
+
+	return nil
+}
+
+/*
+Remove a shut off domain
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (m *Memory) Undefine(name string) error {
+	if err := m.transition("Undefine", name, []State{StateShutOff, StateCrashed}, StateUndefined); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.domains, name)
+
+	return nil
+}
+
+/*
+Start a shut off domain
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (m *Memory) Start(name string) error {
+	return m.transition("Start", name, []State{StateShutOff, StateCrashed}, StateRunning)
+}
+
+/*
+Shut down a running domain
+  - @remarks The domain is shut off at once
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (m *Memory) Shutdown(name string) error {
+	return m.transition("Shutdown", name, []State{StateRunning}, StateShutOff)
+}
+
+/*
+Force off a domain
+  - @param name Name of the domain
+  - @returns Nothing or an error
+*/
+func (m *Memory) Destroy(name string) error {
+	return m.transition("Destroy", name, []State{StateRunning, StatePaused, StateShutdown, StateCrashed}, StateShutOff)
+}
+
+/*
+Get the state of a domain
+  - @param name Name of the domain
+  - @returns The state, StateUndefined with an error if not found
+*/
+func (m *Memory) State(name string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.domains[name]
+	if !ok {
+		return StateUndefined, fmt.Errorf("domain %s not found", name)
+	}
+
+	return d.state, nil
+}
+
+/*
+Wait for a domain to reach a state
+  - @param ctx Context used to stop waiting
+  - @param name Name of the domain
+  - @param state Expected state
+  - @returns Nothing or an error
+*/
+func (m *Memory) WaitState(ctx context.Context, name string, state State) error {
+	return waitState(ctx, m, name, state, m.PollInterval)
+}
+
+// No console to log without a real domain
+func (m *Memory) ConsoleLog(name string) string {
+	return ""
+}
+
+/*
+Create a network
+  - @param n Definition of the network
+  - @returns Nothing or an error if the network already exists
+*/
+func (m *Memory) CreateNetwork(n *network.Network) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "CreateNetwork "+n.Name())
+	if _, ok := m.networks[n.Name()]; ok {
+		return fmt.Errorf("network %s already exists", n.Name())
+	}
+
+	// Keep a copy, as the running network is not changed by later edits of the definition
+	cp, err := copyNetwork(n)
+	if err != nil {
+		return err
+	}
+	m.networks[n.Name()] = cp
+
+	return nil
+}
+
+/*
+Remove a network
+  - @param name Name of the network, nothing is done if it does not exist
+  - @returns Nothing
+*/
+func (m *Memory) DestroyNetwork(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "DestroyNetwork "+name)
+	delete(m.networks, name)
+
+	return nil
+}
+
+/*
+Add a static DHCP host in a network
+  - @param name Name of the network
+  - @param h Host to add
+  - @returns Nothing or an error
+*/
+func (m *Memory) AddNetworkHost(name string, h network.Host) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "AddNetworkHost "+name+" "+h.Name)
+	n, ok := m.networks[name]
+	if !ok {
+		return fmt.Errorf("network %s not found", name)
+	}
+
+	return n.AddHost(h)
+}
+
+/*
+Remove a static DHCP host from a network
+  - @param name Name of the network
+  - @param host Hostname of the host to remove
+  - @returns Nothing or an error
+*/
+func (m *Memory) RemoveNetworkHost(name, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, "RemoveNetworkHost "+name+" "+host)
+	n, ok := m.networks[name]
+	if !ok {
+		return fmt.Errorf("network %s not found", name)
+	}
+
+	return n.RemoveHost(host)
+}
+
+/*
+Get a network
+  - @param name Name of the network
+  - @returns Pointer to a copy of the network or an error
+*/
+func (m *Memory) Network(name string) (*network.Network, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.networks[name]
+	if !ok {
+		return nil, fmt.Errorf("network %s not found", name)
+	}
+
+	// As with libvirt, changing the returned network does not change the running one
+	return copyNetwork(n)
+}
+
+/*
+Copy a network
+  - @param n Network to copy
+  - @returns Pointer to the copy or an error
+*/
+func copyNetwork(n *network.Network) (*network.Network, error) {
+	data, err := n.XML()
+	if err != nil {
+		return nil, err
+	}
+	cp, err := network.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	cp.MACPrefix = n.MACPrefix
+
+	return cp, nil
+}
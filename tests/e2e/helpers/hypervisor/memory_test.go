@@ -0,0 +1,174 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hypervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+)
+
+func TestMemoryLifecycle(t *testing.T) {
+	var h Hypervisor = NewMemory()
+
+	if err := h.Define(Domain{Name: "node-001", MAC: "52:54:00:00:00:01"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Start("node-001"); err == nil {
+		t.Error("starting a running domain should fail")
+	}
+	if err := h.Destroy("node-001"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.WaitState(ctx, "node-001", StateShutOff); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Start("node-001"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := h.State("node-001"); s != StateRunning {
+		t.Errorf("State() = %q, want %q", s, StateRunning)
+	}
+	if _, err := h.State("node-002"); err == nil {
+		t.Error("unknown domain should return an error")
+	}
+}
+
+func TestMemoryClone(t *testing.T) {
+	m := NewMemory()
+
+	if err := m.Define(Domain{Name: "node-001", MAC: "52:54:00:00:00:01", MemoryMiB: 4096}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Clone("node-001", Domain{Name: "node-clone", MAC: "52:54:00:00:00:c8"}); err == nil {
+		t.Error("cloning a running domain should fail")
+	}
+
+	if err := m.Shutdown("node-001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Clone("node-001", Domain{Name: "node-clone", MAC: "52:54:00:00:00:c8"}); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := m.Domain("node-clone"); !ok || d.MAC != "52:54:00:00:00:c8" || d.MemoryMiB != 4096 {
+		t.Errorf("clone = %+v", d)
+	}
+
+	if err := m.Undefine("node-clone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Domain("node-clone"); ok {
+		t.Error("clone still defined")
+	}
+}
+
+func TestMemoryWaitStateTimeout(t *testing.T) {
+	m := NewMemory()
+	_ = m.Define(Domain{Name: "node-001"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.WaitState(ctx, "node-001", StateShutOff); err == nil {
+		t.Error("WaitState should time out")
+	}
+
+	// Guest powering off by itself
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = m.SetState("node-001", StateShutOff)
+	}()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if err := m.WaitState(ctx2, "node-001", StateShutOff); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Define node-001"}
+	if calls := m.Calls(); len(calls) != len(want) || calls[0] != want[0] {
+		t.Errorf("Calls() = %v, want %v", calls, want)
+	}
+}
+
+func TestMemoryNetwork(t *testing.T) {
+	m := NewMemory()
+
+	n, err := network.Load("../../../assets/net-default.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateNetwork(n); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := m.Network("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := live.NewHost("node-001", 1)
+	if host.MAC != "52:54:00:00:00:01" || host.IP != "192.168.122.2" {
+		t.Errorf("NewHost() = %+v", host)
+	}
+	if err := m.AddNetworkHost("default", host); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddNetworkHost("default", live.NewHost("node-002", 1)); err == nil {
+		t.Error("adding a host with the same addresses should fail")
+	}
+
+	// Neither the initial definition nor the returned copy are changed by the live update
+	if _, found := n.Host("node-001"); found {
+		t.Error("definition should not be changed")
+	}
+	if _, found := live.Host("node-001"); found {
+		t.Error("returned network should not be changed")
+	}
+	live, err = m.Network("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, found := live.Host("node-001"); !found || h != host {
+		t.Errorf("Host() = %+v, %v", h, found)
+	}
+	if live.BootFile() != "http://192.168.122.1:8000/install.ipxe" || len(live.Options()) != 3 {
+		t.Errorf("boot configuration lost: %q %v", live.BootFile(), live.Options())
+	}
+
+	if err := m.RemoveNetworkHost("default", "node-001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveNetworkHost("default", "node-001"); err == nil {
+		t.Error("removing an unknown host should fail")
+	}
+	live, err = m.Network("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := live.Host("node-001"); found {
+		t.Error("host should be removed")
+	}
+
+	if err := m.DestroyNetwork("default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Network("default"); err == nil {
+		t.Error("network should be removed")
+	}
+}
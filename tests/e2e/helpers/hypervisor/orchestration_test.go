@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hypervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/fleet"
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/scheduler"
+)
+
+/*
+Add a node in the default network and install it, as done by the suite
+  - @param h Hypervisor to use
+  - @param s Scheduler giving the slots
+  - @param n Node to install
+  - @returns Nothing or an error
+*/
+func bootNode(h Hypervisor, s *scheduler.Scheduler, n fleet.Node) error {
+	release, err := s.Acquire(context.Background(), n.Hostname, n.Index)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	def, err := h.Network("default")
+	if err != nil {
+		return err
+	}
+	host := def.NewHost(n.Hostname, n.Index)
+	if err := h.AddNetworkHost("default", host); err != nil {
+		return err
+	}
+
+	if err := h.Define(Domain{Name: n.Hostname, MAC: host.MAC, Networks: []string{"isolated-1"}}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	return h.WaitState(ctx, n.Hostname, StateRunning)
+}
+
+func TestBootFleet(t *testing.T) {
+	m := NewMemory()
+	m.PollInterval = time.Millisecond
+
+	def, err := network.Load("../../../assets/net-default.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*network.Network{def, network.NewIsolated("isolated-1", "virbr-iso1", 131)} {
+		if err := m.CreateNetwork(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An existing domain makes the installation of node-003 fail
+	if err := m.Define(Domain{Name: "node-003"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := scheduler.New(2, 1)
+	s.Probe = func() (scheduler.Load, error) { return scheduler.Load{}, nil }
+	s.MaxJitter, s.Spacing = 0, 0
+
+	nodes := fleet.New()
+	for i := 1; i <= 4; i++ {
+		nodes.Nodes = append(nodes.Nodes, fleet.Node{Hostname: fmt.Sprintf("node-%03d", i), Index: i})
+	}
+
+	// Errors are returned as panics, as Gomega assertions do in the suite
+	err = nodes.Run(0, func(n fleet.Node) {
+		if err := bootNode(m, s, n); err != nil {
+			panic(err)
+		}
+	})
+
+	var nodeErr *fleet.NodeError
+	if !errors.As(err, &nodeErr) || nodeErr.Hostname != "node-003" {
+		t.Fatalf("Run() = %v, want an error of node-003 only", err)
+	}
+	if len(s.Waits()) != 4 {
+		t.Errorf("%d node(s) got a slot, want 4", len(s.Waits()))
+	}
+
+	live, err := m.Network("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes.Nodes {
+		host, found := live.Host(n.Hostname)
+		if !found {
+			t.Errorf("%s not found in the default network", n.Hostname)
+			continue
+		}
+		if n.Hostname == "node-003" {
+			continue
+		}
+
+		d, found := m.Domain(n.Hostname)
+		if !found || d.MAC != host.MAC || !slices.Equal(d.Networks, []string{"isolated-1"}) {
+			t.Errorf("Domain(%s) = %+v, %v", n.Hostname, d, found)
+		}
+		if state, _ := m.State(n.Hostname); state != StateRunning {
+			t.Errorf("%s is %q, want %q", n.Hostname, state, StateRunning)
+		}
+	}
+
+	// A node cannot be attached to a network that does not exist
+	if err := m.Define(Domain{Name: "node-005", Networks: []string{"isolated-2"}}); err == nil {
+		t.Error("defining a domain on an unknown network should fail")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+	"golang.org/x/crypto/ssh"
+)
+
+// Default time between two attempts to reach a node, typically while it reboots
+const DefaultRetry = 10 * time.Second
+
+// Error printed by journalctl when the cursor does not exist in the journal
+const seekError = "Failed to seek to cursor"
+
+// Streamer runs long commands on a node, usually a *sshpool.Client
+type Streamer interface {
+	ID() string
+	Stream(ctx context.Context, cmd string, stdout io.Writer) error
+}
+
+// Journal of a node being followed
+type follower struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	writer *Writer
+}
+
+// Collector follows the journal of the nodes in the background
+type Collector struct {
+	// Base directory, a sub-directory is used for each node
+	Dir string
+
+	// Units to follow, DefaultUnits if empty
+	Units []string
+
+	Retry time.Duration
+
+	mu        sync.Mutex
+	followers map[string]*follower
+}
+
+/*
+Create a collector
+  - @param dir Base directory of the logs
+  - @returns Pointer to the collector
+*/
+func NewCollector(dir string) *Collector {
+	return &Collector{
+		Dir:       dir,
+		Retry:     DefaultRetry,
+		followers: map[string]*follower{},
+	}
+}
+
+/*
+Get the journalctl command to execute
+  - @param units Units to follow
+  - @param cursor Position to resume from, from the beginning if empty
+  - @returns The command
+*/
+func command(units []string, cursor string) string {
+	args := []string{"journalctl", "--follow", "--no-tail", "--output=json"}
+	for _, u := range units {
+		args = append(args, "--unit", sshpool.Quote(u))
+	}
+	if cursor != "" {
+		args = append(args, "--after-cursor", sshpool.Quote(cursor))
+	}
+
+	return strings.Join(args, " ")
+}
+
+/*
+Sleep or stop earlier if the context is done
+  - @param ctx Context to check
+  - @param d Time to sleep
+  - @returns Nothing
+*/
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+/*
+Check if journalctl failed because of an unknown cursor
+  - @remarks journalctl also exits when killed by a reboot, the cursor is still valid then
+  - @param err Error of the stream
+  - @returns True if the cursor cannot be used
+*/
+func isSeekError(err error) bool {
+	var exitErr *ssh.ExitError
+	return errors.As(err, &exitErr) && strings.Contains(err.Error(), seekError)
+}
+
+/*
+Follow the journal of a node until the context is done
+  - @remarks The stream is restarted from the last cursor each time the connection is lost
+  - @param ctx Context used to stop following
+  - @param s Streamer of the node
+  - @param f Follower of the node
+  - @returns Nothing
+*/
+func (c *Collector) follow(ctx context.Context, s Streamer, f *follower) {
+	defer close(f.done)
+
+	units := c.Units
+	if len(units) == 0 {
+		units = DefaultUnits
+	}
+
+	for {
+		pr, pw := io.Pipe()
+		consumed := make(chan struct{})
+		go func() {
+			defer close(consumed)
+			pr.CloseWithError(f.writer.Consume(pr))
+		}()
+
+		cursor := f.writer.Cursor
+		err := s.Stream(ctx, command(units, cursor), pw)
+		_ = pw.Close()
+		<-consumed
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// journalctl refuses a cursor from another journal, as after a reprovisioning
+		if cursor != "" && isSeekError(err) {
+			f.writer.Cursor = ""
+			continue
+		}
+
+		// Connection lost, the node is probably rebooting
+		sleep(ctx, c.Retry)
+	}
+}
+
+/*
+Start to follow the journal of a node
+  - @remarks Nothing is done if the node is already followed
+  - @param s Streamer of the node
+  - @returns Nothing or an error if the logs cannot be written
+*/
+func (c *Collector) Follow(s Streamer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := s.ID()
+	if _, found := c.followers[id]; found {
+		return nil
+	}
+
+	w, err := NewWriter(filepath.Join(c.Dir, id))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &follower{cancel: cancel, done: make(chan struct{}), writer: w}
+	c.followers[id] = f
+	go c.follow(ctx, s, f)
+
+	return nil
+}
+
+/*
+Get the followed nodes
+  - @returns Identifiers of the nodes, sorted
+*/
+func (c *Collector) Following() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]string, 0, len(c.followers))
+	for id := range c.followers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+/*
+Stop following a node
+  - @remarks The cursor is saved, so the next collector resumes where this one stopped
+  - @param id Identifier of the node
+  - @returns Nothing or an error
+*/
+func (c *Collector) stop(id string) error {
+	c.mu.Lock()
+	f, found := c.followers[id]
+	delete(c.followers, id)
+	c.mu.Unlock()
+
+	if !found {
+		return nil
+	}
+	f.cancel()
+	<-f.done
+
+	return f.writer.Close()
+}
+
+/*
+Stop following all the nodes
+  - @returns Nothing or an error
+*/
+func (c *Collector) Stop() error {
+	var errs []error
+	for _, id := range c.Following() {
+		errs = append(errs, c.stop(id))
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Forget the position in the journal of a reprovisioned node
+  - @remarks The node stops being followed, its existing logs are kept
+  - @param id Identifier of the node
+  - @returns Nothing or an error
+*/
+func (c *Collector) Forget(id string) error {
+	if err := c.stop(id); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(c.Dir, id, CursorFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
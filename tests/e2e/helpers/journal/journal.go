@@ -0,0 +1,225 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units followed by default, as journalctl patterns
+var DefaultUnits = []string{
+	"elemental-register*.service",
+	"elemental-system-agent.service",
+	"rancher-system-agent.service",
+	"k3s*.service",
+	"rke2*.service",
+}
+
+// Name of the file keeping the position in the journal of a node
+const CursorFileName = "journal.cursor"
+
+// Entry of the journal, as given by journalctl --output=json
+type Entry struct {
+	Cursor    string          `json:"__CURSOR"`
+	Realtime  string          `json:"__REALTIME_TIMESTAMP"`
+	BootID    string          `json:"_BOOT_ID"`
+	Unit      string          `json:"UNIT"`
+	OwnerUnit string          `json:"_SYSTEMD_UNIT"`
+	Message   json.RawMessage `json:"MESSAGE"`
+}
+
+/*
+Get the unit of the entry
+  - @remarks Messages about a unit are logged by systemd itself, with UNIT set
+  - @returns Name of the unit
+*/
+func (e *Entry) UnitName() string {
+	if e.Unit != "" {
+		return e.Unit
+	}
+
+	return e.OwnerUnit
+}
+
+/*
+Get the time of the entry
+  - @returns The time, zero if unknown
+*/
+func (e *Entry) Time() time.Time {
+	us, err := strconv.ParseInt(e.Realtime, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMicro(us)
+}
+
+/*
+Get the message of the entry
+  - @remarks journalctl gives an array of bytes for messages that are not valid UTF-8
+  - @returns The message
+*/
+func (e *Entry) Text() string {
+	var s string
+	if err := json.Unmarshal(e.Message, &s); err == nil {
+		return s
+	}
+
+	var b []int
+	if err := json.Unmarshal(e.Message, &b); err == nil {
+		raw := make([]byte, len(b))
+		for i, c := range b {
+			raw[i] = byte(c)
+		}
+		return string(raw)
+	}
+
+	return string(e.Message)
+}
+
+// Writer splits the journal of a node into one file per unit
+type Writer struct {
+	Dir string
+
+	// Last entry written, to resume after a reboot
+	Cursor string
+
+	files map[string]*os.File
+	boots map[string]string
+}
+
+/*
+Create a writer
+  - @remarks The cursor saved by a previous writer is loaded, if any
+  - @param dir Directory of the node
+  - @returns Pointer to the writer or an error
+*/
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &Writer{Dir: dir, files: map[string]*os.File{}, boots: map[string]string{}}
+	data, err := os.ReadFile(filepath.Join(dir, CursorFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	w.Cursor = strings.TrimSpace(string(data))
+
+	return w, nil
+}
+
+/*
+Get the log file of a unit
+  - @param unit Name of the unit
+  - @returns The file or an error
+*/
+func (w *Writer) file(unit string) (*os.File, error) {
+	if f, found := w.files[unit]; found {
+		return f, nil
+	}
+
+	name := strings.TrimSuffix(unit, ".service") + ".log"
+	f, err := os.OpenFile(filepath.Join(w.Dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w.files[unit] = f
+
+	return f, nil
+}
+
+/*
+Write an entry into the file of its unit
+  - @remarks A line is added each time the node has rebooted
+  - @param e Entry to write
+  - @returns Nothing or an error
+*/
+func (w *Writer) Write(e *Entry) error {
+	unit := e.UnitName()
+	if unit == "" {
+		return nil
+	}
+
+	f, err := w.file(unit)
+	if err != nil {
+		return err
+	}
+
+	if e.BootID != "" && w.boots[unit] != e.BootID {
+		if _, err := fmt.Fprintf(f, "-- Boot %s --\n", e.BootID); err != nil {
+			return err
+		}
+		w.boots[unit] = e.BootID
+	}
+
+	ts := e.Time().UTC().Format("2006-01-02T15:04:05.000000Z")
+	if _, err := fmt.Fprintf(f, "%s %s\n", ts, strings.TrimRight(e.Text(), "\n")); err != nil {
+		return err
+	}
+	w.Cursor = e.Cursor
+
+	return nil
+}
+
+/*
+Write all the entries of a journalctl JSON output
+  - @remarks Lines that are not valid entries are ignored
+  - @param r Output of journalctl
+  - @returns Nothing or an error, io.EOF is not an error
+*/
+func (w *Writer) Consume(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		if err := w.Write(&e); err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
+
+/*
+Save the cursor and close the files
+  - @returns Nothing or an error
+*/
+func (w *Writer) Close() error {
+	var errs []error
+	for unit, f := range w.files {
+		errs = append(errs, f.Close())
+		delete(w.files, unit)
+	}
+
+	if w.Cursor != "" {
+		errs = append(errs, os.WriteFile(filepath.Join(w.Dir, CursorFileName), []byte(w.Cursor+"\n"), 0644))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func entry(cursor, boot, unit, owner, msg string) string {
+	return fmt.Sprintf(`{"__CURSOR":%q,"__REALTIME_TIMESTAMP":"1700000000000000","_BOOT_ID":%q,"UNIT":%q,"_SYSTEMD_UNIT":%q,"MESSAGE":%s}`,
+		cursor, boot, unit, owner, msg)
+}
+
+// Node rebooting after each stream
+type fakeNode struct {
+	mu       sync.Mutex
+	commands []string
+	streams  [][]string
+	// Error ending each stream, the connection is lost if not set
+	errs []error
+}
+
+func (n *fakeNode) ID() string {
+	return "node-1"
+}
+
+func (n *fakeNode) Stream(ctx context.Context, cmd string, stdout io.Writer) error {
+	n.mu.Lock()
+	n.commands = append(n.commands, cmd)
+	var lines []string
+	if len(n.streams) > 0 {
+		lines, n.streams = n.streams[0], n.streams[1:]
+	}
+	err := errors.New("connection lost")
+	if len(n.errs) > 0 {
+		err, n.errs = n.errs[0], n.errs[1:]
+	}
+	n.mu.Unlock()
+
+	if lines == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for _, l := range lines {
+		_, _ = io.WriteString(stdout, l+"\n")
+	}
+
+	return err
+}
+
+// Wait until the collector started a number of streams
+func waitStreams(t *testing.T, n *fakeNode, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		started := len(n.commands)
+		n.mu.Unlock()
+		if started == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d stream(s) started, want %d", started, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCollectorResumesAfterReboot(t *testing.T) {
+	dir := t.TempDir()
+	node := &fakeNode{streams: [][]string{
+		{
+			entry("c1", "boot1", "", "elemental-register.service", `"registering"`),
+			entry("c2", "boot1", "elemental-register.service", "init.scope", `"Finished Elemental Register"`),
+			"not json",
+		},
+		{
+			entry("c3", "boot2", "", "rancher-system-agent.service", `[104,105]`),
+		},
+	}}
+
+	c := NewCollector(dir)
+	c.Retry = time.Millisecond
+	if err := c.Follow(node); err != nil {
+		t.Fatal(err)
+	}
+	// Already followed, nothing to do
+	if err := c.Follow(node); err != nil {
+		t.Fatal(err)
+	}
+
+	waitStreams(t, node, 3)
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(node.commands[0], "--after-cursor") {
+		t.Errorf("first command resumes: %s", node.commands[0])
+	}
+	if !strings.Contains(node.commands[1], "--after-cursor 'c2'") || !strings.Contains(node.commands[2], "--after-cursor 'c3'") {
+		t.Errorf("commands do not resume from the last cursor:\n%s", strings.Join(node.commands, "\n"))
+	}
+
+	register, err := os.ReadFile(filepath.Join(dir, "node-1", "elemental-register.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(register); strings.Count(got, "-- Boot boot1 --") != 1 || !strings.Contains(got, "Z registering\n") || !strings.Contains(got, "Finished Elemental Register") {
+		t.Errorf("elemental-register.log:\n%s", got)
+	}
+
+	agent, err := os.ReadFile(filepath.Join(dir, "node-1", "rancher-system-agent.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(agent), " hi\n") {
+		t.Errorf("rancher-system-agent.log:\n%s", agent)
+	}
+
+	// The next collector resumes where this one stopped
+	w, err := NewWriter(filepath.Join(dir, "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Cursor != "c3" {
+		t.Errorf("saved cursor = %q, want c3", w.Cursor)
+	}
+
+	if err := c.Forget("node-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node-1", CursorFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cursor still there after Forget: %v", err)
+	}
+}
+
+func TestCollectorKeepsCursorOnReboot(t *testing.T) {
+	node := &fakeNode{
+		streams: [][]string{
+			{entry("c1", "boot1", "", "elemental-register.service", `"registering"`)},
+			{},
+			{},
+		},
+		errs: []error{
+			errors.New("connection lost"),
+			// journalctl is killed by the reboot, nothing is printed
+			fmt.Errorf(": %w", &ssh.ExitError{}),
+			// The node was reprovisioned, its journal is new
+			fmt.Errorf("Failed to seek to cursor: Invalid argument: %w", &ssh.ExitError{}),
+		},
+	}
+
+	c := NewCollector(t.TempDir())
+	c.Retry = time.Millisecond
+	if err := c.Follow(node); err != nil {
+		t.Fatal(err)
+	}
+	waitStreams(t, node, 4)
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "--after-cursor 'c1'", "--after-cursor 'c1'", ""}
+	for i, w := range want {
+		resumed := strings.Contains(node.commands[i], "--after-cursor")
+		if w == "" && resumed || w != "" && !strings.Contains(node.commands[i], w) {
+			t.Errorf("command %d = %q, want cursor %q", i, node.commands[i], w)
+		}
+	}
+}
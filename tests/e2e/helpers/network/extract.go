@@ -0,0 +1,177 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/artifact"
+)
+
+// Names of the boot files in the ISO, in order of preference
+var (
+	kernelNames = []string{"linux", "kernel", "vmlinuz"}
+	initrdNames = []string{"initrd"}
+	rootfsNames = []string{"rootfs.squashfs"}
+)
+
+/*
+Extract the boot artifacts of an ISO
+  - @remarks Artifacts already extracted from the same ISO are kept
+  - @param iso Path of the ISO
+  - @param dir Directory where the artifacts are written
+  - @returns The artifacts, named after the ISO, or an error
+*/
+func ExtractBootArtifacts(iso, dir string) (BootArtifacts, error) {
+	f, err := os.Open(iso)
+	if err != nil {
+		return BootArtifacts{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return BootArtifacts{}, err
+	}
+
+	fsys, err := artifact.OpenISO(f)
+	if err != nil {
+		return BootArtifacts{}, fmt.Errorf("%s: %w", iso, err)
+	}
+
+	a := ArtifactsOf(iso)
+	if err := extractBootArtifacts(fsys, info.ModTime(), a, dir); err != nil {
+		return BootArtifacts{}, fmt.Errorf("%s: %w", iso, err)
+	}
+
+	return a, nil
+}
+
+/*
+Extract the boot artifacts of a filesystem
+  - @param fsys Filesystem of the ISO
+  - @param modTime Modification time of the ISO, older artifacts are extracted again
+  - @param a Names of the artifacts to write
+  - @param dir Directory where the artifacts are written
+  - @returns Nothing or an error
+*/
+func extractBootArtifacts(fsys fs.FS, modTime time.Time, a BootArtifacts, dir string) error {
+	files := []struct {
+		names []string
+		dest  string
+	}{
+		{kernelNames, a.Kernel},
+		{initrdNames, a.Initrd},
+		{rootfsNames, a.Rootfs},
+	}
+
+	for _, f := range files {
+		src, size, err := findBootFile(fsys, f.names)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(dir, f.dest)
+		if info, err := os.Stat(dest); err == nil && info.Size() == size && !info.ModTime().Before(modTime) {
+			continue
+		}
+		if err := copyFile(fsys, src, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Find a boot file
+  - @remarks Empty files are skipped, symbolic links are not followed by the ISO reader
+  - @param fsys Filesystem of the ISO
+  - @param names Possible names of the file, in order of preference
+  - @returns Path and size of the file, or an error if none is found
+*/
+func findBootFile(fsys fs.FS, names []string) (string, int64, error) {
+	found := make([]string, len(names))
+	sizes := make([]int64, len(names))
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		i := slices.Index(names, d.Name())
+		if i < 0 || found[i] != "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > 0 {
+			found[i], sizes[i] = p, info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	for i, p := range found {
+		if p != "" {
+			return p, sizes[i], nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("no boot file named %v", names)
+}
+
+/*
+Copy a file out of a filesystem
+  - @remarks The file is written under a temporary name first, an interrupted copy is never used
+  - @param fsys Filesystem of the file
+  - @param src Path of the file in the filesystem
+  - @param dest Path of the copy
+  - @returns Nothing or an error
+*/
+func copyFile(fsys fs.FS, src, dest string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dest + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("cannot extract %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
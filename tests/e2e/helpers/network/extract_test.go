@@ -0,0 +1,63 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestExtractBootArtifacts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"boot/kernel":     {Data: []byte("kernel")},
+		"boot/x86/linux":  {Data: []byte("linux")},
+		"boot/initrd":     {Data: []byte("initrd")},
+		"empty/initrd":    {},
+		"rootfs.squashfs": {Data: []byte("hsqs")},
+	}
+	dir := t.TempDir()
+	a := ArtifactsOf("/tmp/elemental-master.iso")
+
+	if err := extractBootArtifacts(fsys, time.Now(), a, dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"elemental-master-linux":    "linux",
+		"elemental-master-initrd":   "initrd",
+		"elemental-master-squashfs": "hsqs",
+	} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != content {
+			t.Fatalf("unexpected %s %q, %v", name, data, err)
+		}
+	}
+
+	// Already extracted from the same ISO
+	fsys["rootfs.squashfs"] = &fstest.MapFile{Data: []byte("next")}
+	if err := extractBootArtifacts(fsys, time.Now().Add(-time.Hour), a, dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, a.Rootfs)); string(data) != "hsqs" {
+		t.Fatalf("artifact extracted again: %q", data)
+	}
+
+	delete(fsys, "boot/initrd")
+	if err := extractBootArtifacts(fsys, time.Now(), a, dir); err == nil || !strings.Contains(err.Error(), "initrd") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+const (
+	// Script fetched first by all the nodes, given by DHCP
+	EntryScript = "install.ipxe"
+
+	// iPXE binary loaded by UEFI HTTP boot, it then fetches the entry script
+	EFIBinary = "ipxe.efi"
+
+	// Directory of the scripts of the nodes
+	ScriptDir = "ipxe"
+
+	// Script of the nodes without their own script
+	DefaultScript = ScriptDir + "/default.ipxe"
+)
+
+// Boot artifacts of an ISO, relative to the base URL
+type BootArtifacts struct {
+	Kernel string
+	Initrd string
+	Rootfs string
+}
+
+/*
+Get the names of the boot artifacts extracted from an ISO
+  - @param iso Path of the ISO
+  - @returns The artifacts, named after the ISO
+*/
+func ArtifactsOf(iso string) BootArtifacts {
+	name := strings.TrimSuffix(filepath.Base(iso), ".iso")
+
+	return BootArtifacts{
+		Kernel: name + "-linux",
+		Initrd: name + "-initrd",
+		Rootfs: name + "-squashfs",
+	}
+}
+
+/*
+Get the kernel command line of the network installations
+  - @param enforcing True to enforce SELinux, it is permissive otherwise
+  - @returns The command line
+*/
+func KernelCmdline(enforcing bool) string {
+	mode := "0"
+	if enforcing {
+		mode = "1"
+	}
+
+	return "ip=dhcp rd.cos.disable security=selinux enforcing=" + mode + " console=tty1 console=ttyS0"
+}
+
+// Node with its own iPXE script
+type IPXENode struct {
+	Name string
+	MAC  string
+
+	// Appended to the kernel command line
+	Cmdline string
+
+	// Replaces the registration config URL, if set
+	ConfigURL string
+}
+
+// Configuration of the iPXE scripts
+type IPXEConfig struct {
+	// URL where the scripts and the artifacts are served
+	BaseURL   string
+	Artifacts BootArtifacts
+	Cmdline   string
+
+	// URL of the registration config, copied where the live system expects its cloud-config
+	ConfigURL string
+}
+
+/*
+Check the configuration
+  - @remarks Values are written as is in the scripts, a line break would create a new command
+  - @returns Nothing, or an error if a value is missing or invalid
+*/
+func (c IPXEConfig) Validate() error {
+	values := []struct{ name, value string }{
+		{"base URL", c.BaseURL},
+		{"kernel", c.Artifacts.Kernel},
+		{"initrd", c.Artifacts.Initrd},
+		{"rootfs", c.Artifacts.Rootfs},
+		{"config URL", c.ConfigURL},
+		{"cmdline", c.Cmdline},
+	}
+	for _, v := range values {
+		if v.value == "" && v.name != "cmdline" {
+			return fmt.Errorf("iPXE %s is not set", v.name)
+		}
+		if strings.ContainsAny(v.value, "\r\n") {
+			return fmt.Errorf("iPXE %s contains a line break", v.name)
+		}
+	}
+
+	return nil
+}
+
+/*
+Get the name of the script of a node
+  - @param mac MAC address of the node
+  - @returns Path of the script, relative to the base URL
+*/
+func ScriptName(mac string) string {
+	// Same format as ${mac:hexhyp} in iPXE
+	return ScriptDir + "/" + strings.ReplaceAll(strings.ToLower(mac), ":", "-") + ".ipxe"
+}
+
+/*
+Get a URL from the base URL
+  - @param name Path relative to the base URL
+  - @returns The URL
+*/
+func (c IPXEConfig) URL(name string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + name
+}
+
+var entryTemplate = template.Must(template.New("entry").Parse(`#!ipxe
+# Generated by the e2e tests, do not edit
+# UEFI HTTP boot loads {{ .EFI }} first, PXE ROMs chainload this script directly
+chain --autofree --replace {{ .Dir }}/${mac:hexhyp}.ipxe || chain --autofree --replace {{ .Default }}
+`))
+
+var scriptTemplate = template.Must(template.New("script").Parse(`#!ipxe
+# Generated by the e2e tests, do not edit
+# Node: {{ .Node }}
+set arch amd64
+set url {{ .URL }}
+set kernel {{ .Kernel }}
+set initrd {{ .Initrd }}
+set rootfs {{ .Rootfs }}
+set config {{ .Config }}
+set cmdline {{ .Cmdline }}
+set live root=live:${url}/${rootfs} stages.initramfs[0].commands[0]="curl -k ${config} > /run/initramfs/live/livecd-cloud-config.yaml"
+iseq ${platform} efi && goto uefi || goto legacy
+
+:uefi
+# The EFI stub finds the initrd by its name
+kernel ${url}/${kernel} initrd=initrd ${live} ${cmdline}
+initrd --name initrd ${url}/${initrd}
+boot
+
+:legacy
+initrd ${url}/${initrd}
+chain --autofree --replace ${url}/${kernel} initrd=${initrd} ${live} ${cmdline}
+`))
+
+/*
+Render a template
+  - @param t Template to render
+  - @param data Values of the template
+  - @returns The rendered script
+*/
+func execute(t *template.Template, data any) string {
+	var b strings.Builder
+	// Templates only use fields known to exist, execution cannot fail
+	_ = t.Execute(&b, data)
+
+	return b.String()
+}
+
+/*
+Render the script of a node
+  - @param n Node to boot, nil for the default script
+  - @returns The script
+*/
+func (c IPXEConfig) Script(n *IPXENode) string {
+	data := struct {
+		Node, URL, Kernel, Initrd, Rootfs, Config, Cmdline string
+	}{
+		Node:    "default",
+		URL:     strings.TrimSuffix(c.BaseURL, "/"),
+		Kernel:  c.Artifacts.Kernel,
+		Initrd:  c.Artifacts.Initrd,
+		Rootfs:  c.Artifacts.Rootfs,
+		Config:  c.ConfigURL,
+		Cmdline: c.Cmdline,
+	}
+	if n != nil {
+		data.Node = n.Name + " " + strings.ToLower(n.MAC)
+		if n.ConfigURL != "" {
+			data.Config = n.ConfigURL
+		}
+		data.Cmdline = strings.TrimSpace(data.Cmdline + " " + n.Cmdline)
+	}
+
+	return execute(scriptTemplate, data)
+}
+
+/*
+Render all the scripts
+  - @param nodes Nodes with their own script
+  - @returns Scripts by path relative to the base URL, or an error
+*/
+func (c IPXEConfig) Render(nodes []IPXENode) (map[string]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	scripts := map[string]string{
+		EntryScript: execute(entryTemplate, map[string]string{
+			"EFI":     EFIBinary,
+			"Dir":     c.URL(ScriptDir),
+			"Default": c.URL(DefaultScript),
+		}),
+		DefaultScript: c.Script(nil),
+	}
+	for i := range nodes {
+		n := &nodes[i]
+		if _, err := net.ParseMAC(n.MAC); err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		if strings.ContainsAny(n.Name+n.Cmdline+n.ConfigURL, "\r\n") {
+			return nil, fmt.Errorf("node %s: value with a line break", n.Name)
+		}
+
+		name := ScriptName(n.MAC)
+		if _, found := scripts[name]; found {
+			return nil, fmt.Errorf("node %s: MAC %s already used", n.Name, n.MAC)
+		}
+		scripts[name] = c.Script(n)
+	}
+
+	return scripts, nil
+}
+
+/*
+Write the scripts
+  - @param dir Directory served at the base URL
+  - @param scripts Scripts by relative path, as given by Render
+  - @returns Nothing or an error
+*/
+func WriteScripts(dir string, scripts map[string]string) error {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(scripts[name]), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Configure the network boot
+  - @remarks iPXE clients get the entry script, UEFI HTTP clients get the iPXE binary first
+  - @param baseURL URL where the scripts and the iPXE binary are served
+  - @returns Nothing
+*/
+func (n *Network) SetIPXEBoot(baseURL string) {
+	base := strings.TrimSuffix(baseURL, "/")
+	n.SetBootFile(base + "/" + EntryScript)
+
+	// Previous UEFI HTTP boot options are replaced
+	opts := []string{}
+	for _, o := range n.Options() {
+		if !strings.Contains(o, "efi-http") {
+			opts = append(opts, o)
+		}
+	}
+	opts = append(opts,
+		"dhcp-match=set:efi-http,option:client-arch,16",
+		"dhcp-boot=tag:efi-http,"+base+"/"+EFIBinary,
+		"dhcp-option-force=tag:efi-http,60,HTTPClient",
+	)
+
+	n.def.DnsmasqOptions = nil
+	for _, o := range opts {
+		n.AddOption(o)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func config() IPXEConfig {
+	return IPXEConfig{
+		BaseURL:   "http://192.168.122.1:8000/",
+		Artifacts: ArtifactsOf("../../elemental-master.iso"),
+		Cmdline:   KernelCmdline(false),
+		ConfigURL: "http://192.168.122.1:8000/install-config.yaml",
+	}
+}
+
+func TestRender(t *testing.T) {
+	nodes := []IPXENode{
+		{Name: "node-001", MAC: "52:54:00:00:00:02"},
+		{Name: "node-002", MAC: "52:54:00:00:00:03", Cmdline: "rd.debug", ConfigURL: "http://example.com/other.yaml"},
+	}
+
+	scripts, err := config().Render(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := config().Render(nodes)
+	for name, s := range scripts {
+		if again[name] != s {
+			t.Fatalf("%s rendered differently", name)
+		}
+	}
+	if len(scripts) != 4 {
+		t.Fatalf("unexpected scripts %v", scripts)
+	}
+
+	entry := scripts[EntryScript]
+	if !strings.Contains(entry, "chain --autofree --replace http://192.168.122.1:8000/ipxe/${mac:hexhyp}.ipxe || chain --autofree --replace http://192.168.122.1:8000/ipxe/default.ipxe\n") {
+		t.Fatalf("unexpected entry script:\n%s", entry)
+	}
+
+	first := scripts["ipxe/52-54-00-00-00-02.ipxe"]
+	for _, line := range []string{
+		"set url http://192.168.122.1:8000\n",
+		"set kernel elemental-master-linux\n",
+		"set initrd elemental-master-initrd\n",
+		"set rootfs elemental-master-squashfs\n",
+		"set config http://192.168.122.1:8000/install-config.yaml\n",
+		"set cmdline ip=dhcp rd.cos.disable security=selinux enforcing=0 console=tty1 console=ttyS0\n",
+		"initrd --name initrd ${url}/${initrd}\n",
+		"chain --autofree --replace ${url}/${kernel} initrd=${initrd} ${live} ${cmdline}\n",
+	} {
+		if !strings.Contains(first, line) {
+			t.Fatalf("%q not found in:\n%s", line, first)
+		}
+	}
+
+	second := scripts["ipxe/52-54-00-00-00-03.ipxe"]
+	if !strings.Contains(second, "set config http://example.com/other.yaml\n") || !strings.Contains(second, "console=ttyS0 rd.debug\n") {
+		t.Fatalf("node values not used:\n%s", second)
+	}
+	if strings.Contains(scripts[DefaultScript], "rd.debug") {
+		t.Fatal("node values used in the default script")
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	c := config()
+	if _, err := c.Render([]IPXENode{{Name: "a", MAC: "52:54:00:00:00:02"}, {Name: "b", MAC: "52:54:00:00:00:02"}}); err == nil {
+		t.Fatal("duplicate MAC accepted")
+	}
+	if _, err := c.Render([]IPXENode{{Name: "a", MAC: "invalid"}}); err == nil {
+		t.Fatal("invalid MAC accepted")
+	}
+
+	c.Cmdline += "\nshell"
+	if _, err := c.Render(nil); err == nil {
+		t.Fatal("line break accepted")
+	}
+	c = config()
+	c.ConfigURL = ""
+	if _, err := c.Render(nil); err == nil {
+		t.Fatal("missing config URL accepted")
+	}
+}
+
+func TestWriteScripts(t *testing.T) {
+	dir := t.TempDir()
+	scripts, err := config().Render([]IPXENode{{Name: "node-001", MAC: "52:54:00:00:00:02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteScripts(dir, scripts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "ipxe", "52-54-00-00-00-02.ipxe"))
+	if err != nil || !strings.HasPrefix(string(data), "#!ipxe\n") {
+		t.Fatalf("unexpected script %q, %v", data, err)
+	}
+}
+
+func TestSetIPXEBoot(t *testing.T) {
+	n := NewIsolated("isolated", "virbr1", 100)
+	n.AddOption("dhcp-boot=tag:efi-http,http://old/ipxe.efi")
+	n.AddOption("log-dhcp")
+
+	n.SetIPXEBoot("http://192.168.100.1:8000")
+	if n.BootFile() != "http://192.168.100.1:8000/install.ipxe" {
+		t.Fatalf("unexpected boot file %s", n.BootFile())
+	}
+	opts := n.Options()
+	if len(opts) != 4 || opts[0] != "log-dhcp" || opts[2] != "dhcp-boot=tag:efi-http,http://192.168.100.1:8000/ipxe.efi" {
+		t.Fatalf("unexpected options %q", opts)
+	}
+}
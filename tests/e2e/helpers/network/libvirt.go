@@ -0,0 +1,299 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	libvirtxml "libvirt.org/libvirt-go-xml"
+)
+
+// MAC prefix of the nodes on the default network
+const DefaultMACPrefix = "52:54:00:00:00"
+
+// Static DHCP host of a network
+type Host struct {
+	Name string
+	MAC  string
+	IP   string
+}
+
+// Libvirt network definition
+type Network struct {
+	def *libvirtxml.Network
+
+	// Prefix used to generate the MAC address of the nodes
+	MACPrefix string
+}
+
+/*
+Parse a network definition
+  - @param data XML definition, as given by 'virsh net-dumpxml'
+  - @returns Pointer to the network or an error
+*/
+func Parse(data string) (*Network, error) {
+	def := &libvirtxml.Network{}
+	if err := def.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	if len(def.IPs) == 0 {
+		return nil, fmt.Errorf("network %s has no IP configuration", def.Name)
+	}
+
+	return &Network{def: def, MACPrefix: DefaultMACPrefix}, nil
+}
+
+/*
+Load a network definition from a file
+  - @param file XML definition file
+  - @returns Pointer to the network or an error
+*/
+func Load(file string) (*Network, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(string(data))
+}
+
+/*
+Create an isolated network, without any forwarding to the outside
+  - @remarks Several isolated networks can be used in the same run, as long as the subnets differ
+  - @param name Name of the network
+  - @param bridge Name of the bridge interface
+  - @param subnet Third byte of the 192.168.x.0/24 subnet, also used in the MAC addresses
+  - @returns Pointer to the network
+*/
+func NewIsolated(name, bridge string, subnet int) *Network {
+	prefix := fmt.Sprintf("192.168.%d.", subnet)
+
+	return &Network{
+		def: &libvirtxml.Network{
+			Name:   name,
+			Bridge: &libvirtxml.NetworkBridge{Name: bridge, STP: "on", Delay: "0"},
+			IPs: []libvirtxml.NetworkIP{{
+				Address: prefix + "1",
+				Netmask: "255.255.255.0",
+				DHCP: &libvirtxml.NetworkDHCP{
+					Ranges: []libvirtxml.NetworkDHCPRange{{Start: prefix + "2", End: prefix + "191"}},
+				},
+			}},
+		},
+		MACPrefix: fmt.Sprintf("52:54:00:00:%02x", subnet),
+	}
+}
+
+// Name of the network
+func (n *Network) Name() string {
+	return n.def.Name
+}
+
+// Name of the bridge interface, empty if not set
+func (n *Network) Bridge() string {
+	if n.def.Bridge == nil {
+		return ""
+	}
+
+	return n.def.Bridge.Name
+}
+
+// IP address of the host on the network
+func (n *Network) Gateway() string {
+	return n.def.IPs[0].Address
+}
+
+/*
+Get the DHCP configuration, created if needed
+  - @remarks Only the first IP configuration is used
+  - @returns Pointer to the DHCP configuration
+*/
+func (n *Network) dhcp() *libvirtxml.NetworkDHCP {
+	ip := &n.def.IPs[0]
+	if ip.DHCP == nil {
+		ip.DHCP = &libvirtxml.NetworkDHCP{}
+	}
+
+	return ip.DHCP
+}
+
+/*
+Get the DHCP range
+  - @returns First and last IP of the range, empty if not set
+*/
+func (n *Network) DHCPRange() (string, string) {
+	if r := n.dhcp().Ranges; len(r) > 0 {
+		return r[0].Start, r[0].End
+	}
+
+	return "", ""
+}
+
+/*
+Set the DHCP range
+  - @param start First IP of the range
+  - @param end Last IP of the range
+  - @returns Nothing
+*/
+func (n *Network) SetDHCPRange(start, end string) {
+	n.dhcp().Ranges = []libvirtxml.NetworkDHCPRange{{Start: start, End: end}}
+}
+
+// List of the static DHCP hosts
+func (n *Network) Hosts() []Host {
+	var hosts []Host
+	for _, h := range n.dhcp().Hosts {
+		hosts = append(hosts, Host{Name: h.Name, MAC: h.MAC, IP: h.IP})
+	}
+
+	return hosts
+}
+
+/*
+Get a static DHCP host
+  - @param name Hostname to look for
+  - @returns The host and true if found
+*/
+func (n *Network) Host(name string) (Host, bool) {
+	for _, h := range n.Hosts() {
+		if h.Name == name {
+			return h, true
+		}
+	}
+
+	return Host{}, false
+}
+
+/*
+Generate the addresses of a node
+  - @param name Hostname of the node
+  - @param index Index of the node, used for the MAC and IP addresses
+  - @returns The host, not added to the network
+*/
+func (n *Network) NewHost(name string, index int) Host {
+	gw := net.ParseIP(n.Gateway()).To4()
+
+	return Host{
+		Name: name,
+		MAC:  fmt.Sprintf("%s:%02x", n.MACPrefix, index),
+		IP:   net.IPv4(gw[0], gw[1], gw[2], byte(index+1)).String(),
+	}
+}
+
+/*
+Add a static DHCP host
+  - @param h Host to add
+  - @returns Nothing or an error if the name, MAC or IP is already used
+*/
+func (n *Network) AddHost(h Host) error {
+	for _, e := range n.Hosts() {
+		if e.Name == h.Name || strings.EqualFold(e.MAC, h.MAC) || e.IP == h.IP {
+			return fmt.Errorf("host %s (%s/%s) conflicts with %s (%s/%s)", h.Name, h.MAC, h.IP, e.Name, e.MAC, e.IP)
+		}
+	}
+
+	n.dhcp().Hosts = append(n.dhcp().Hosts, libvirtxml.NetworkDHCPHost{Name: h.Name, MAC: h.MAC, IP: h.IP})
+
+	return nil
+}
+
+/*
+Remove a static DHCP host
+  - @param name Hostname of the host to remove
+  - @returns Nothing or an error if the host is not found
+*/
+func (n *Network) RemoveHost(name string) error {
+	d := n.dhcp()
+	for i, h := range d.Hosts {
+		if h.Name == name {
+			d.Hosts = append(d.Hosts[:i], d.Hosts[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host %s not found in network %s", name, n.Name())
+}
+
+/*
+Get the XML definition of a static DHCP host
+  - @remarks Format expected by 'virsh net-update ... ip-dhcp-host'
+  - @param h Host to convert
+  - @returns The XML definition or an error
+*/
+func HostXML(h Host) (string, error) {
+	host := libvirtxml.NetworkDHCPHost{Name: h.Name, MAC: h.MAC, IP: h.IP}
+
+	return host.Marshal()
+}
+
+// File given by DHCP for network boot, empty if not set
+func (n *Network) BootFile() string {
+	if b := n.dhcp().Bootp; len(b) > 0 {
+		return b[0].File
+	}
+
+	return ""
+}
+
+/*
+Set the file given by DHCP for network boot
+  - @param file URL or path of the file, bootp is disabled if empty
+  - @returns Nothing
+*/
+func (n *Network) SetBootFile(file string) {
+	if file == "" {
+		n.dhcp().Bootp = nil
+		return
+	}
+
+	n.dhcp().Bootp = []libvirtxml.NetworkBootp{{File: file}}
+}
+
+// List of the dnsmasq options
+func (n *Network) Options() []string {
+	var opts []string
+	if n.def.DnsmasqOptions != nil {
+		for _, o := range n.def.DnsmasqOptions.Option {
+			opts = append(opts, o.Value)
+		}
+	}
+
+	return opts
+}
+
+/*
+Add a dnsmasq option
+  - @param value Option to add, as in dnsmasq configuration file
+  - @returns Nothing
+*/
+func (n *Network) AddOption(value string) {
+	if n.def.DnsmasqOptions == nil {
+		n.def.DnsmasqOptions = &libvirtxml.NetworkDnsmasqOptions{}
+	}
+
+	n.def.DnsmasqOptions.Option = append(n.def.DnsmasqOptions.Option, libvirtxml.NetworkDnsmasqOption{Value: value})
+}
+
+/*
+Get the XML definition of the network
+  - @returns The XML definition or an error
+*/
+func (n *Network) XML() (string, error) {
+	return n.def.Marshal()
+}
@@ -1,47 +0,0 @@
-/*
-Copyright © 2022 - 2026 SUSE LLC
-
-Licensed under the Apache License, Version 2.0 (the "License");
-you may not use this file except in compliance with the License.
-You may obtain a copy of the License at
-    http://www.apache.org/licenses/LICENSE-2.0
-Unless required by applicable law or agreed to in writing, software
-distributed under the License is distributed on an "AS IS" BASIS,
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-See the License for the specific language governing permissions and
-limitations under the License.
-*/
-
-package network
-
-import (
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
-)
-
-/*
-Configure iPXE server for OS provisioning
-  - @param httpSrv IP address:port where the files are shared
-  - @returns The number of .ipxe files found or an error
-*/
-func ConfigureiPXE(httpSrv string) (int, error) {
-	ipxeScript, err := tools.GetFilesList("../..", "install.ipxe")
-	if err != nil {
-		return 0, err
-	}
-
-	// NOTE: always use the first ipxe file found!
-	if len(ipxeScript) >= 1 {
-		err = tools.Sed("set url.*", "set url "+httpSrv, ipxeScript[0])
-		if err != nil {
-			return 0, err
-		}
-
-		err = tools.Sed(".*set config.*", "set config $${url}/install-config.yaml", ipxeScript[0])
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	// Returns the number of ipxe files found
-	return len(ipxeScript), nil
-}
@@ -0,0 +1,238 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+// Mode the node booted in
+type BootMode string
+
+const (
+	BootActive   BootMode = "active"
+	BootPassive  BootMode = "passive"
+	BootRecovery BootMode = "recovery"
+	BootUnknown  BootMode = ""
+)
+
+// Snapshotters that can be used by Elemental
+const (
+	SnapshotterBtrfs      = "btrfs"
+	SnapshotterLoopDevice = "loopdevice"
+)
+
+// Runner executes commands on a node, usually a *sshpool.Client
+type Runner interface {
+	Run(ctx context.Context, cmd string) (*sshpool.Result, error)
+}
+
+// OS state of a node
+type State struct {
+	// All the fields of /etc/os-release, and the ones set by Elemental
+	OSRelease map[string]string
+	Image     string
+	ImageTag  string
+	ImageRepo string
+
+	BootMode BootMode
+
+	// Changes at each boot
+	BootID string
+
+	// Variables of /oem/grubenv
+	GrubEnv map[string]string
+
+	Cmdline []string
+
+	// Enforcing, Permissive or Disabled
+	SELinux string
+
+	TPM bool
+
+	// Labels of all the partitions, sorted
+	PartitionLabels []string
+
+	// Snapshotter used by the booted system, empty if unknown
+	Snapshotter string
+
+	// Image mounted as root: file behind the loop device, or btrfs subvolume
+	RootImage string
+}
+
+// Marker of the beginning of a section in the probe output
+const sectionMarker = "### "
+
+// Commands executed on the node, by section
+// NOTE: errors are ignored on purpose, a missing information just leaves the field empty
+var sections = []struct{ name, cmd string }{
+	{"os-release", "cat /etc/os-release"},
+	{"boot-mode", "for m in active passive recovery; do [ -e /run/elemental/${m}_mode ] && echo ${m}; done"},
+	{"boot-id", "cat /proc/sys/kernel/random/boot_id"},
+	{"grubenv", "grub2-editenv /oem/grubenv list"},
+	{"cmdline", "cat /proc/cmdline"},
+	{"selinux", "getenforce || echo Disabled"},
+	{"tpm", "[ -e /dev/tpm0 ] && echo present"},
+	{"labels", "lsblk -rno LABEL"},
+	{"root", "findmnt -no SOURCE,FSTYPE /"},
+	{"root-image", "losetup -nO BACK-FILE \"$(findmnt -no SOURCE /)\" || findmnt -no SOURCE /"},
+}
+
+/*
+Get the script collecting the state
+  - @returns Script to execute on the node
+*/
+func script() string {
+	var b strings.Builder
+	for _, s := range sections {
+		fmt.Fprintf(&b, "echo '%s%s'; %s 2>/dev/null; ", sectionMarker, s.name, s.cmd)
+	}
+	b.WriteString("true")
+
+	return b.String()
+}
+
+/*
+Get the OS state of a node
+  - @param ctx Context used to stop the probe
+  - @param r Runner of the node
+  - @returns The state or an error if the node cannot be reached
+*/
+func Get(ctx context.Context, r Runner) (*State, error) {
+	res, err := r.Run(ctx, script())
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	return Parse(res.Stdout), nil
+}
+
+/*
+Parse KEY=value lines
+  - @remarks Comments and quotes around the values are removed
+  - @param data Lines to parse
+  - @returns Map of the values
+*/
+func parseVars(data string) map[string]string {
+	vars := map[string]string{}
+	for line := range strings.Lines(data) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+
+	return vars
+}
+
+/*
+Parse the output of the probe
+  - @param out Output of the probe script
+  - @returns The state
+*/
+func Parse(out string) *State {
+	// Split the output by section
+	content := map[string]string{}
+	var current string
+	for line := range strings.Lines(out) {
+		if name, found := strings.CutPrefix(strings.TrimSpace(line), sectionMarker); found {
+			current = name
+			continue
+		}
+		content[current] += line
+	}
+
+	s := &State{
+		OSRelease: parseVars(content["os-release"]),
+		GrubEnv:   parseVars(content["grubenv"]),
+		Cmdline:   strings.Fields(content["cmdline"]),
+		SELinux:   strings.TrimSpace(content["selinux"]),
+		TPM:       strings.TrimSpace(content["tpm"]) == "present",
+		BootID:    strings.TrimSpace(content["boot-id"]),
+	}
+	s.Image = s.OSRelease["IMAGE"]
+	s.ImageTag = s.OSRelease["IMAGE_TAG"]
+	s.ImageRepo = s.OSRelease["IMAGE_REPO"]
+
+	// Only one mode file is expected
+	if modes := strings.Fields(content["boot-mode"]); len(modes) > 0 {
+		s.BootMode = BootMode(modes[0])
+	}
+
+	for _, label := range strings.Fields(content["labels"]) {
+		if !slices.Contains(s.PartitionLabels, label) {
+			s.PartitionLabels = append(s.PartitionLabels, label)
+		}
+	}
+	slices.Sort(s.PartitionLabels)
+
+	s.RootImage = strings.TrimSpace(content["root-image"])
+
+	// Root is a btrfs snapshot or a loop device containing the image
+	if root := strings.Fields(content["root"]); len(root) == 2 {
+		switch {
+		case root[1] == "btrfs":
+			s.Snapshotter = SnapshotterBtrfs
+		case strings.HasPrefix(root[0], "/dev/loop"):
+			s.Snapshotter = SnapshotterLoopDevice
+		}
+	}
+
+	return s
+}
+
+/*
+Check if a kernel argument has been used
+  - @param arg Argument, as "name" or "name=value"
+  - @returns True if the argument is in the kernel command line
+*/
+func (s *State) CmdlineHas(arg string) bool {
+	return slices.Contains(s.Cmdline, arg)
+}
+
+/*
+Format the main fields of the state
+  - @returns One field per line
+*/
+func (s *State) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "OS: %s\n", s.OSRelease["PRETTY_NAME"])
+	fmt.Fprintf(&b, "Image: %s\n", s.Image)
+	fmt.Fprintf(&b, "Boot mode: %s\n", s.BootMode)
+	fmt.Fprintf(&b, "Snapshotter: %s\n", s.Snapshotter)
+	fmt.Fprintf(&b, "Root image: %s\n", s.RootImage)
+	fmt.Fprintf(&b, "SELinux: %s\n", s.SELinux)
+	fmt.Fprintf(&b, "TPM: %t\n", s.TPM)
+	fmt.Fprintf(&b, "Partitions: %s\n", strings.Join(s.PartitionLabels, ", "))
+	fmt.Fprintf(&b, "Cmdline: %s\n", strings.Join(s.Cmdline, " "))
+
+	return b.String()
+}
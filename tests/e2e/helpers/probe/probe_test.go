@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+)
+
+const sample = `### os-release
+NAME="SL-Micro"
+# Elemental fields
+IMAGE="registry.suse.com/suse/sl-micro/6.1/baremetal-os-container:2.2.0-4.5"
+IMAGE_TAG="2.2.0-4.5"
+IMAGE_REPO='registry.suse.com/suse/sl-micro/6.1/baremetal-os-container'
+PRETTY_NAME="SUSE Linux Micro 6.1"
+### boot-mode
+recovery
+### boot-id
+0b1c3e1e-5f4d-4b9b-8d0a-1c2f0e8a7d6c
+### grubenv
+next_entry=recovery
+extra_cmdline=ipv6.disable=1 console=ttyS0
+### cmdline
+BOOT_IMAGE=(loop0)/boot/vmlinuz root=LABEL=COS_RECOVERY ipv6.disable=1 elemental.mode=recovery
+### selinux
+Enforcing
+### tpm
+### labels
+
+COS_OEM
+COS_RECOVERY
+COS_STATE
+COS_PERSISTENT
+COS_OEM
+### root
+/dev/loop0 ext2
+### root-image
+/run/initramfs/live/cOS/recovery.img
+`
+
+func TestParse(t *testing.T) {
+	s := Parse(sample)
+
+	if s.ImageRepo != "registry.suse.com/suse/sl-micro/6.1/baremetal-os-container" || s.ImageTag != "2.2.0-4.5" {
+		t.Errorf("image = %q:%q", s.ImageRepo, s.ImageTag)
+	}
+	if !strings.HasSuffix(s.Image, ":"+s.ImageTag) {
+		t.Errorf("Image = %q", s.Image)
+	}
+	if s.BootMode != BootRecovery || s.BootID != "0b1c3e1e-5f4d-4b9b-8d0a-1c2f0e8a7d6c" {
+		t.Errorf("BootMode = %q, BootID = %q", s.BootMode, s.BootID)
+	}
+	if s.GrubEnv["next_entry"] != "recovery" || s.GrubEnv["extra_cmdline"] != "ipv6.disable=1 console=ttyS0" {
+		t.Errorf("GrubEnv = %v", s.GrubEnv)
+	}
+	if !s.CmdlineHas("ipv6.disable=1") || s.CmdlineHas("ipv6.disable") {
+		t.Errorf("Cmdline = %v", s.Cmdline)
+	}
+	if s.SELinux != "Enforcing" || s.TPM {
+		t.Errorf("SELinux = %q, TPM = %t", s.SELinux, s.TPM)
+	}
+	if want := []string{"COS_OEM", "COS_PERSISTENT", "COS_RECOVERY", "COS_STATE"}; !slices.Equal(s.PartitionLabels, want) {
+		t.Errorf("PartitionLabels = %v, want %v", s.PartitionLabels, want)
+	}
+	if s.Snapshotter != SnapshotterLoopDevice || s.RootImage != "/run/initramfs/live/cOS/recovery.img" {
+		t.Errorf("Snapshotter = %q, RootImage = %q", s.Snapshotter, s.RootImage)
+	}
+
+	if s := Parse("### root\n/dev/vda3[/@/.snapshots/1/snapshot] btrfs\n### tpm\npresent\n"); s.Snapshotter != SnapshotterBtrfs || !s.TPM {
+		t.Errorf("Snapshotter = %q, TPM = %t", s.Snapshotter, s.TPM)
+	}
+}
+
+// Runner returning the same output for all the commands
+type fakeRunner string
+
+func (f fakeRunner) Run(_ context.Context, cmd string) (*sshpool.Result, error) {
+	return &sshpool.Result{Command: cmd, Stdout: string(f)}, nil
+}
+
+func TestGet(t *testing.T) {
+	s, err := Get(context.Background(), fakeRunner(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OSRelease["NAME"] != "SL-Micro" {
+		t.Errorf("OSRelease = %v", s.OSRelease)
+	}
+}
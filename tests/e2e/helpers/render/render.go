@@ -0,0 +1,162 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+// Old-style placeholders, they should not be found in a rendered manifest
+var legacyPlaceholder = regexp.MustCompile(`%[A-Z0-9_]+%`)
+
+// Values used to render a template
+type Values map[string]string
+
+// Renderer writes rendered assets into its own output directory
+type Renderer struct {
+	OutputDir string
+}
+
+/*
+Merge values
+  - @param other Values to add, they override the existing ones
+  - @returns A new set of values
+*/
+func (v Values) With(other Values) Values {
+	merged := make(Values, len(v)+len(other))
+	for key, value := range v {
+		merged[key] = value
+	}
+	for key, value := range other {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+/*
+Create a new renderer
+  - @param baseDir Directory where the per-run output directory is created
+  - @returns Pointer to the renderer or an error
+*/
+func New(baseDir string) (*Renderer, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(baseDir, "manifests-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Renderer{OutputDir: dir}, nil
+}
+
+/*
+Render a template into the output directory
+  - @remarks The source file is never modified
+  - @param src Path of the template to render
+  - @param name Name of the rendered file, without extension
+  - @param values Values to use in the template
+  - @returns Path of the rendered file or an error
+*/
+func (r *Renderer) Render(src, name string, values Values) (string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := Bytes(filepath.Base(src), data, values)
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(r.OutputDir, name+filepath.Ext(src))
+	if err := os.WriteFile(file, out, 0644); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
+
+/*
+Render a template from memory
+  - @param name Name of the template, used in error messages
+  - @param data Template content
+  - @param values Values to use in the template
+  - @returns The rendered content or an error
+*/
+func Bytes(name string, data []byte, values Values) ([]byte, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"lower": strings.ToLower}).
+		Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return nil, fmt.Errorf("unresolved placeholder: %w", err)
+	}
+
+	if found := legacyPlaceholder.FindAll(out.Bytes(), -1); len(found) > 0 {
+		return nil, fmt.Errorf("unresolved placeholder(s) in %s: %s", name, bytes.Join(found, []byte(", ")))
+	}
+
+	return out.Bytes(), nil
+}
+
+/*
+Validate a manifest against the schema known by the cluster
+  - @remarks Server-side dry-run, unknown or invalid fields are rejected
+  - @param ns Namespace where the manifest will be applied
+  - @param file Manifest to check
+  - @returns Nothing or an error
+*/
+func Validate(ns, file string) error {
+	_, err := kubectl.RunWithoutErr("apply",
+		"--namespace", ns,
+		"--dry-run=server",
+		"--validate=strict",
+		"--filename", file)
+	if err != nil {
+		return fmt.Errorf("%s does not match the schema: %w", file, err)
+	}
+
+	return nil
+}
+
+/*
+Validate and apply a manifest
+  - @param ns Namespace where to apply the manifest
+  - @param file Manifest to apply
+  - @returns Nothing or an error
+*/
+func Apply(ns, file string) error {
+	if err := Validate(ns, file); err != nil {
+		return err
+	}
+
+	return kubectl.Apply(ns, file)
+}
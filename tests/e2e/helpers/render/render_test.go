@@ -0,0 +1,83 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run the tests with -update to write the rendered files as the new golden files
+var update = flag.Bool("update", false, "update the golden files")
+
+// Values of the MachineRegistration, as set by the configure spec
+var registrationValues = Values{
+	"CLUSTER_NAME":       "cluster",
+	"PASSWORD":           "password",
+	"POOL_TYPE":          "master",
+	"SSH_AUTHORIZED_KEY": "ssh-ed25519 AAAA e2e",
+	"SSHD_CONFIG_FILE":   "/etc/ssh/sshd_config",
+	"USER":               "root",
+	"VM_NAME":            "node",
+}
+
+func TestRegistrationGolden(t *testing.T) {
+	for name, snapType := range map[string]string{
+		"btrfs":          "btrfs",
+		"no-snapshotter": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := &Renderer{OutputDir: t.TempDir()}
+			file, err := r.Render("../../../assets/machineRegistration.yaml", "registration",
+				registrationValues.With(Values{"SNAP_TYPE": snapType}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "machineRegistration-"+name+".yaml")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rendered registration differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestBytesErrors(t *testing.T) {
+	if _, err := Bytes("missing", []byte("name: {{ .NAME }}"), Values{}); err == nil {
+		t.Error("missing value not reported")
+	}
+
+	_, err := Bytes("legacy", []byte("name: %NAME%\nuser: {{ .USER }}"), Values{"USER": "root"})
+	if err == nil || !strings.Contains(err.Error(), "%NAME%") {
+		t.Errorf("Bytes() = %v, want the legacy placeholder reported", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+)
+
+// Retry and timeout policy of a kind of operation
+type Policy struct {
+	Name string
+
+	// Timeout before scaling, PerNode is added for each node when needed
+	Timeout time.Duration
+	PerNode time.Duration
+
+	// Time between two attempts, increased up to MaxInterval if set
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Factor      float64
+}
+
+// Policies used in the tests, timeouts are scaled with TIMEOUT_SCALE
+var (
+	// Read of a resource through the Kubernetes API
+	APIRead = Policy{Name: "api-read", Timeout: 3 * time.Minute, Interval: 5 * time.Second}
+
+	// Installation or upgrade of a Helm chart, including Rancher Manager
+	HelmInstall = Policy{Name: "helm-install", Timeout: 2 * time.Minute, Interval: 20 * time.Second}
+
+	// Pods or deployments becoming ready
+	WorkloadReady = Policy{Name: "workload-ready", Timeout: 4 * time.Minute, Interval: 30 * time.Second}
+
+	// Download of a file from a remote server
+	Download = Policy{Name: "download", Timeout: 2 * time.Minute, Interval: 10 * time.Second}
+
+	// Node reachable through SSH
+	SSHReachability = Policy{Name: "ssh-reachability", Timeout: 10 * time.Minute, Interval: 5 * time.Second}
+
+	// Command executed on a reachable node
+	SSHCommand = Policy{Name: "ssh-command", Timeout: 2 * time.Minute, Interval: 20 * time.Second}
+
+	// Node installation, registration or reboot
+	NodeBoot = Policy{Name: "node-boot", Timeout: 8 * time.Minute, Interval: 5 * time.Second, MaxInterval: 30 * time.Second, Factor: 2}
+
+	// Cluster reaching a stable state
+	ClusterConverge = Policy{Name: "cluster-converge", Timeout: 5 * time.Minute, PerNode: 3 * time.Minute, Interval: 10 * time.Second}
+
+	// OS upgrade of the nodes
+	OSUpgrade = Policy{Name: "os-upgrade", Timeout: 10 * time.Minute, Interval: 30 * time.Second}
+
+	// Backup or restore with rancher-backup
+	BackupRestore = Policy{Name: "backup-restore", Timeout: 5 * time.Minute, Interval: 10 * time.Second}
+)
+
+/*
+Adapt the policy to a number of nodes
+  - @param nodes Number of nodes, at least 1 is used
+  - @returns The policy with PerNode added for each node
+*/
+func (p Policy) For(nodes int) Policy {
+	if nodes < 1 {
+		nodes = 1
+	}
+	p.Timeout += time.Duration(nodes) * p.PerNode
+
+	return p
+}
+
+/*
+Change the timeout of the policy
+  - @remarks To use only for operations known to be slower or faster than usual
+  - @param d New timeout, before scaling
+  - @returns The modified policy
+*/
+func (p Policy) WithTimeout(d time.Duration) Policy {
+	p.Timeout = d
+
+	return p
+}
+
+/*
+Change the interval of the policy
+  - @param d New interval, backoff is kept if MaxInterval is higher
+  - @returns The modified policy
+*/
+func (p Policy) WithInterval(d time.Duration) Policy {
+	p.Interval = d
+
+	return p
+}
+
+// Timeout scaled for the current environment
+func (p Policy) Scaled() time.Duration {
+	return tools.SetTimeout(p.Timeout)
+}
+
+/*
+Get the time to wait before an attempt
+  - @param attempt Attempt number, starting at 1
+  - @returns The delay, 0 for the first attempt
+*/
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+
+	d := p.Interval
+	if p.MaxInterval <= p.Interval || p.Factor <= 1 {
+		return d
+	}
+
+	for i := 2; i < attempt && d < p.MaxInterval; i++ {
+		d = time.Duration(float64(d) * p.Factor)
+	}
+
+	return min(d, p.MaxInterval)
+}
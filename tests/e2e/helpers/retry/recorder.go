@@ -0,0 +1,265 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum length of the last value kept in a record
+const maxValueLength = 200
+
+// Retries of an operation
+type Record struct {
+	Operation string
+	Policy    string
+	Attempts  int
+
+	// Last error returned, and last value returned if no error
+	LastError string
+	LastValue string
+
+	Start time.Time
+	End   time.Time
+}
+
+// Time between the first and the last attempt
+func (r Record) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Recorder keeps the retries done by the operations
+type Recorder struct {
+	mu      sync.Mutex
+	records []*Record
+}
+
+/*
+Create an empty recorder
+  - @returns Pointer to the recorder
+*/
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) start(op string, p Policy) *Record {
+	rec := &Record{Operation: op, Policy: p.Name}
+
+	r.mu.Lock()
+	r.records = append(r.records, rec)
+	r.mu.Unlock()
+
+	return rec
+}
+
+/*
+Update a record with the result of an attempt
+  - @param rec Record to update
+  - @param err Error returned by the attempt, can be nil
+  - @param value Value returned by the attempt, used if there is no error
+  - @returns Nothing
+*/
+func (r *Recorder) attempt(rec *Record, err error, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if rec.Attempts == 0 {
+		rec.Start = now
+	}
+	rec.Attempts++
+	rec.End = now
+
+	if err != nil {
+		rec.LastError = err.Error()
+		return
+	}
+	if len(value) > maxValueLength {
+		value = value[:maxValueLength] + "..."
+	}
+	rec.LastValue = value
+}
+
+/*
+Wait before an attempt, without going after the end of the policy
+  - @param ctx Context used to stop waiting
+  - @param d Time to wait
+  - @param deadline End of the policy
+  - @returns Nothing or the context error
+*/
+func wait(ctx context.Context, d time.Duration, deadline time.Time) error {
+	d = min(d, time.Until(deadline))
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+/*
+Execute a function until it succeeds
+  - @param ctx Context used to stop retrying
+  - @param op Name of the operation, used in the report
+  - @param p Policy to apply
+  - @param fn Function to execute
+  - @returns Nothing or the last error
+*/
+func (r *Recorder) Do(ctx context.Context, op string, p Policy, fn func() error) error {
+	rec := r.start(op, p)
+	deadline := time.Now().Add(p.Scaled())
+
+	for attempt := 1; ; attempt++ {
+		if err := wait(ctx, p.Delay(attempt), deadline); err != nil {
+			return err
+		}
+
+		err := fn()
+		r.attempt(rec, err, "")
+		if err == nil {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%s: still failing after %d attempt(s): %w", op, attempt, err)
+		}
+	}
+}
+
+/*
+Record the calls of a function polled by Gomega
+  - @remarks Gomega already waits p.Interval between calls, only the backoff is added
+  - @param op Name of the operation, used in the report
+  - @param p Policy to apply
+  - @param fn Function to record, any signature accepted by Eventually
+  - @returns Function with the same signature, or fn itself if it is not a function
+*/
+func (r *Recorder) Wrap(op string, p Policy, fn any) any {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fn
+	}
+
+	rec := r.start(op, p)
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+
+	var (
+		attempt  int
+		deadline time.Time
+	)
+	wrapped := reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+		attempt++
+		if attempt == 1 {
+			deadline = time.Now().Add(p.Scaled())
+		} else {
+			_ = wait(context.Background(), p.Delay(attempt)-p.Interval, deadline)
+		}
+
+		out := v.Call(args)
+
+		var (
+			err    error
+			values []string
+		)
+		for _, o := range out {
+			if o.Type().Implements(errType) {
+				if !o.IsNil() {
+					err = o.Interface().(error)
+				}
+				continue
+			}
+			values = append(values, fmt.Sprintf("%v", o.Interface()))
+		}
+		r.attempt(rec, err, strings.Join(values, ", "))
+
+		return out
+	})
+
+	return wrapped.Interface()
+}
+
+/*
+Get the records
+  - @returns Copy of the records, in creation order
+*/
+func (r *Recorder) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := make([]Record, 0, len(r.records))
+	for _, rec := range r.records {
+		records = append(records, *rec)
+	}
+
+	return records
+}
+
+/*
+Get the records and clear the recorder
+  - @returns Copy of the records, in creation order
+*/
+func (r *Recorder) Flush() []Record {
+	records := r.Records()
+
+	r.mu.Lock()
+	r.records = nil
+	r.mu.Unlock()
+
+	return records
+}
+
+/*
+Format the operations that needed more than one attempt
+  - @param records Records to format
+  - @returns One line per operation, the slowest first, empty if none was retried
+*/
+func Report(records []Record) string {
+	var retried []Record
+	for _, rec := range records {
+		if rec.Attempts > 1 {
+			retried = append(retried, rec)
+		}
+	}
+	sort.SliceStable(retried, func(i, j int) bool {
+		return retried[i].Duration() > retried[j].Duration()
+	})
+
+	var b strings.Builder
+	for _, rec := range retried {
+		fmt.Fprintf(&b, "%s [%s]: %d attempts in %s", rec.Operation, rec.Policy, rec.Attempts, rec.Duration().Round(time.Second))
+		switch {
+		case rec.LastError != "":
+			fmt.Fprintf(&b, ", last error: %s", rec.LastError)
+		case rec.LastValue != "":
+			fmt.Fprintf(&b, ", last value: %s", rec.LastValue)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,99 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := Policy{Interval: time.Second, MaxInterval: 5 * time.Second, Factor: 2}
+
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if d := p.Delay(i + 1); d != w {
+			t.Errorf("Delay(%d) = %s, want %s", i+1, d, w)
+		}
+	}
+
+	if d := APIRead.Delay(5); d != APIRead.Interval {
+		t.Errorf("Delay(5) = %s, want constant %s", d, APIRead.Interval)
+	}
+}
+
+func TestFor(t *testing.T) {
+	if d := ClusterConverge.For(3).Timeout; d != 14*time.Minute {
+		t.Errorf("For(3) timeout = %s, want 14m", d)
+	}
+}
+
+func TestDo(t *testing.T) {
+	r := NewRecorder()
+	p := Policy{Name: "test", Timeout: time.Second, Interval: time.Millisecond}
+
+	calls := 0
+	err := r.Do(context.Background(), "flaky", p, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := r.Records()
+	if len(records) != 1 || records[0].Attempts != 3 || records[0].LastError != "not yet" {
+		t.Errorf("records = %+v", records)
+	}
+
+	err = r.Do(context.Background(), "broken", p.WithTimeout(10*time.Millisecond), func() error {
+		return errors.New("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Do() = %v, want an error naming the operation", err)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	r := NewRecorder()
+	p := Policy{Name: "test", Timeout: time.Second, Interval: time.Millisecond}
+
+	calls := 0
+	fn := r.Wrap("read", p, func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("not found")
+		}
+		return "value", nil
+	}).(func() (string, error))
+
+	for i := 0; i < 2; i++ {
+		_, _ = fn()
+	}
+
+	report := Report(r.Flush())
+	if !strings.Contains(report, "read [test]: 2 attempts") || !strings.Contains(report, "not found") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+	if len(r.Records()) != 0 {
+		t.Error("Flush() should clear the records")
+	}
+}
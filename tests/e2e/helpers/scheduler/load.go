@@ -0,0 +1,173 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time between the two CPU samples used to compute the host load
+const SampleInterval = time.Second
+
+// Load of the host
+type Load struct {
+	// Percentage of CPU time spent working (IO wait excluded) and waiting for IO
+	CPU    float64
+	IOWait float64
+
+	// Hugepages configured on the host, 0 if not used
+	HugePagesTotal int
+	FreeHugeMiB    int
+}
+
+// Thresholds above which no new node is started, 0 disables a check
+type Limits struct {
+	MaxCPU    float64
+	MaxIOWait float64
+
+	// Only checked if hugepages are configured on the host
+	MinFreeHugeMiB int
+}
+
+/*
+Check the load against the limits
+  - @param l Limits to check
+  - @returns List of the exceeded limits, empty if none
+*/
+func (load Load) Exceeds(l Limits) []string {
+	var reasons []string
+
+	if l.MaxCPU > 0 && load.CPU > l.MaxCPU {
+		reasons = append(reasons, fmt.Sprintf("CPU %.0f%% > %.0f%%", load.CPU, l.MaxCPU))
+	}
+	if l.MaxIOWait > 0 && load.IOWait > l.MaxIOWait {
+		reasons = append(reasons, fmt.Sprintf("IO wait %.0f%% > %.0f%%", load.IOWait, l.MaxIOWait))
+	}
+	if l.MinFreeHugeMiB > 0 && load.HugePagesTotal > 0 && load.FreeHugeMiB < l.MinFreeHugeMiB {
+		reasons = append(reasons, fmt.Sprintf("free hugepages %dMiB < %dMiB", load.FreeHugeMiB, l.MinFreeHugeMiB))
+	}
+
+	return reasons
+}
+
+// CPU counters from /proc/stat
+type cpuTimes struct {
+	total  uint64
+	idle   uint64
+	iowait uint64
+}
+
+/*
+Read the aggregated CPU counters
+  - @returns The counters or an error
+*/
+func readCPUTimes() (cpuTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, err
+	}
+
+	return parseCPUTimes(string(data))
+}
+
+func parseCPUTimes(data string) (cpuTimes, error) {
+	line, _, _ := strings.Cut(data, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 6 || fields[0] != "cpu" {
+		return cpuTimes{}, fmt.Errorf("unexpected /proc/stat format: %q", line)
+	}
+
+	// guest and guest_nice are already counted in user and nice
+	var t cpuTimes
+	for i, f := range fields[1:min(len(fields), 9)] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		t.total += v
+
+		switch i {
+		case 3:
+			t.idle = v
+		case 4:
+			t.iowait = v
+		}
+	}
+
+	return t, nil
+}
+
+/*
+Read the hugepages information
+  - @returns Number of hugepages and free hugepages in MiB, or an error
+*/
+func readHugePages() (int, int, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return parseHugePages(string(data))
+}
+
+func parseHugePages(data string) (int, int, error) {
+	values := map[string]int{}
+
+	s := bufio.NewScanner(strings.NewReader(data))
+	for s.Scan() {
+		key, value, found := strings.Cut(s.Text(), ":")
+		if !found {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB")); err == nil {
+			values[key] = n
+		}
+	}
+
+	// Hugepagesize is in kB
+	return values["HugePages_Total"], values["HugePages_Free"] * values["Hugepagesize"] / 1024, s.Err()
+}
+
+/*
+Get the current load of the host
+  - @remarks The CPU usage is sampled over SampleInterval
+  - @returns The load or an error
+*/
+func HostLoad() (Load, error) {
+	before, err := readCPUTimes()
+	if err != nil {
+		return Load{}, err
+	}
+	time.Sleep(SampleInterval)
+	after, err := readCPUTimes()
+	if err != nil {
+		return Load{}, err
+	}
+
+	var load Load
+	if total := float64(after.total - before.total); total > 0 {
+		load.IOWait = 100 * float64(after.iowait-before.iowait) / total
+		load.CPU = 100*(1-float64(after.idle-before.idle)/total) - load.IOWait
+	}
+
+	load.HugePagesTotal, load.FreeHugeMiB, err = readHugePages()
+
+	return load, err
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Default maximum random delay before asking for a slot
+	DefaultMaxJitter = 30 * time.Second
+
+	// Default minimum time between two node starts, to let the load show up
+	DefaultSpacing = 5 * time.Second
+
+	// Default interval between two load checks
+	DefaultPoll = 10 * time.Second
+
+	// Default time after which a node is started even if the host is still loaded
+	DefaultMaxLoadWait = 5 * time.Minute
+)
+
+// Time spent by a node before being allowed to start
+type Wait struct {
+	Node   string
+	Jitter time.Duration
+
+	// Time spent waiting for a free slot, then for the host load to decrease
+	Slot time.Duration
+	Load time.Duration
+
+	// Limits still exceeded when MaxLoadWait has been reached, empty if none
+	Forced []string
+}
+
+// Total waiting time
+func (w Wait) Total() time.Duration {
+	return w.Jitter + w.Slot + w.Load
+}
+
+// Scheduler limits the number of nodes installed or booted at the same time
+type Scheduler struct {
+	Limits Limits
+
+	// Function used to get the host load, HostLoad by default
+	Probe func() (Load, error)
+
+	// Seed of the jitter, the same seed gives the same delays
+	Seed      int64
+	MaxJitter time.Duration
+
+	Spacing     time.Duration
+	Poll        time.Duration
+	MaxLoadWait time.Duration
+
+	slots chan struct{}
+
+	// Only one node at a time can check the load and start
+	gate      sync.Mutex
+	lastStart time.Time
+
+	mu    sync.Mutex
+	waits []Wait
+}
+
+/*
+Create a scheduler
+  - @param slots Maximum number of nodes handled at the same time, 1 if lower
+  - @param seed Seed of the jitter
+  - @returns Pointer to the scheduler
+*/
+func New(slots int, seed int64) *Scheduler {
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &Scheduler{
+		Probe:       HostLoad,
+		Seed:        seed,
+		MaxJitter:   DefaultMaxJitter,
+		Spacing:     DefaultSpacing,
+		Poll:        DefaultPoll,
+		MaxLoadWait: DefaultMaxLoadWait,
+		slots:       make(chan struct{}, slots),
+	}
+}
+
+/*
+Get the jitter of a node
+  - @remarks Only depends on the seed and the index, whatever the order of the calls
+  - @param index Index of the node
+  - @returns The delay to wait before asking for a slot
+*/
+func (s *Scheduler) Jitter(index int) time.Duration {
+	if s.MaxJitter <= 0 {
+		return 0
+	}
+
+	r := rand.New(rand.NewSource(s.Seed + int64(index)))
+
+	return time.Duration(r.Int63n(int64(s.MaxJitter)))
+}
+
+/*
+Sleep or stop earlier if the context is done
+  - @param ctx Context to check
+  - @param d Time to sleep
+  - @returns Nothing or the context error
+*/
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+/*
+Wait until a node is allowed to start
+  - @remarks The slot must be released once the node is installed or booted
+  - @param ctx Context used to stop waiting
+  - @param node Name of the node
+  - @param index Index of the node, used for the jitter
+  - @returns Function releasing the slot or an error
+*/
+func (s *Scheduler) Acquire(ctx context.Context, node string, index int) (func(), error) {
+	w := Wait{Node: node, Jitter: s.Jitter(index)}
+	if err := sleep(ctx, w.Jitter); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case s.slots <- struct{}{}:
+	}
+	w.Slot = time.Since(start)
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { <-s.slots })
+	}
+
+	start = time.Now()
+	forced, err := s.waitLoad(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	w.Load = time.Since(start)
+	w.Forced = forced
+
+	s.mu.Lock()
+	s.waits = append(s.waits, w)
+	s.mu.Unlock()
+
+	return release, nil
+}
+
+/*
+Wait for the host load to be under the limits
+  - @param ctx Context used to stop waiting
+  - @returns Limits still exceeded if MaxLoadWait is reached, or an error
+*/
+func (s *Scheduler) waitLoad(ctx context.Context) ([]string, error) {
+	s.gate.Lock()
+	defer s.gate.Unlock()
+
+	if err := sleep(ctx, time.Until(s.lastStart.Add(s.Spacing))); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(s.MaxLoadWait)
+	for {
+		var reasons []string
+		if load, err := s.Probe(); err != nil {
+			reasons = []string{"cannot get host load: " + err.Error()}
+		} else {
+			reasons = load.Exceeds(s.Limits)
+		}
+
+		if len(reasons) == 0 || !time.Now().Before(deadline) {
+			s.lastStart = time.Now()
+			return reasons, nil
+		}
+
+		if err := sleep(ctx, s.Poll); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+Get the waiting time of the nodes
+  - @returns List of the waits, sorted by node name
+*/
+func (s *Scheduler) Waits() []Wait {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waits := append([]Wait(nil), s.waits...)
+	sort.Slice(waits, func(i, j int) bool {
+		return waits[i].Node < waits[j].Node
+	})
+
+	return waits
+}
+
+/*
+Format the waiting time of the nodes
+  - @returns One line per node
+*/
+func (s *Scheduler) Report() string {
+	var b strings.Builder
+	for _, w := range s.Waits() {
+		fmt.Fprintf(&b, "%s: waited %s (jitter %s, slot %s, load %s)",
+			w.Node, w.Total().Round(time.Second), w.Jitter.Round(time.Second),
+			w.Slot.Round(time.Second), w.Load.Round(time.Second))
+		if len(w.Forced) > 0 {
+			fmt.Fprintf(&b, ", started anyway: %s", strings.Join(w.Forced, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,155 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(slots int, probe func() (Load, error)) *Scheduler {
+	s := New(slots, 42)
+	s.Probe = probe
+	s.MaxJitter = 0
+	s.Spacing = 0
+	s.Poll = time.Millisecond
+	s.MaxLoadWait = time.Second
+
+	return s
+}
+
+func TestJitterIsDeterministic(t *testing.T) {
+	a, b := New(1, 42), New(1, 42)
+	for index := 0; index < 10; index++ {
+		if a.Jitter(index) != b.Jitter(index) {
+			t.Fatalf("Jitter(%d) differs with the same seed", index)
+		}
+		if j := a.Jitter(index); j < 0 || j >= a.MaxJitter {
+			t.Errorf("Jitter(%d) = %s, out of range", index, j)
+		}
+	}
+	if New(1, 43).Jitter(1) == a.Jitter(1) {
+		t.Error("Jitter should depend on the seed")
+	}
+}
+
+func TestAcquireWaitsForLoad(t *testing.T) {
+	var calls int
+	s := newTestScheduler(1, func() (Load, error) {
+		calls++
+		if calls < 3 {
+			return Load{CPU: 95}, nil
+		}
+		return Load{CPU: 10}, nil
+	})
+	s.Limits = Limits{MaxCPU: 80}
+
+	release, err := s.Acquire(context.Background(), "node-001", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	waits := s.Waits()
+	if calls != 3 || len(waits) != 1 || len(waits[0].Forced) != 0 {
+		t.Errorf("calls = %d, waits = %+v", calls, waits)
+	}
+}
+
+func TestAcquireForcedAfterMaxLoadWait(t *testing.T) {
+	s := newTestScheduler(1, func() (Load, error) {
+		return Load{}, errors.New("no /proc")
+	})
+	s.MaxLoadWait = 5 * time.Millisecond
+
+	release, err := s.Acquire(context.Background(), "node-001", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if w := s.Waits(); len(w) != 1 || len(w[0].Forced) != 1 {
+		t.Errorf("waits = %+v, want one forced start", w)
+	}
+}
+
+func TestAcquireLimitsSlots(t *testing.T) {
+	s := newTestScheduler(2, func() (Load, error) { return Load{}, nil })
+
+	var (
+		mu            sync.Mutex
+		running, peak int
+		wg            sync.WaitGroup
+	)
+	for index := 1; index <= 6; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), "node", index)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}(index)
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("%d nodes started at the same time, want at most 2", peak)
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s := newTestScheduler(1, func() (Load, error) { return Load{}, nil })
+	release, _ := s.Acquire(context.Background(), "node-001", 1)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "node-002", 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cpu, err := parseCPUTimes("cpu  100 0 50 800 40 5 5 0 30 0\ncpu0 1 2 3 4 5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu.total != 1000 || cpu.idle != 800 || cpu.iowait != 40 {
+		t.Errorf("parseCPUTimes() = %+v", cpu)
+	}
+
+	total, free, err := parseHugePages("MemTotal:       32657928 kB\nHugePages_Total:    1024\nHugePages_Free:      512\nHugepagesize:       2048 kB\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1024 || free != 1024 {
+		t.Errorf("parseHugePages() = %d, %d, want 1024, 1024", total, free)
+	}
+}
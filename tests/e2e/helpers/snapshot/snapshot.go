@@ -0,0 +1,282 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"gopkg.in/yaml.v3"
+)
+
+// Files where Elemental describes the installed system, the first one found is used
+var StateFiles = []string{
+	"/run/initramfs/elemental-state/state.yaml",
+	"/run/initramfs/cos-state/state.yaml",
+}
+
+// Directories where the snapshots are stored, depending on the snapshotter
+var SnapshotDirs = map[string]string{
+	probe.SnapshotterLoopDevice: "/run/initramfs/elemental-state/.snapshots",
+	probe.SnapshotterBtrfs:      "/.snapshots",
+}
+
+// Number of snapshots kept by Elemental when the MachineRegistration does not set maxSnaps
+var DefaultMaxSnaps = map[string]int{
+	probe.SnapshotterLoopDevice: 2,
+	probe.SnapshotterBtrfs:      8,
+}
+
+// Identifier of a snapshot in the path of the mounted image
+var snapshotPath = regexp.MustCompile(`\.snapshots/(\d+)/`)
+
+// Marker of the list of the snapshots found on the disk
+const diskMarker = "### on-disk"
+
+// Snapshot of the system, as described in the state file
+type Snapshot struct {
+	ID         int    `yaml:"-"`
+	Active     bool   `yaml:"active"`
+	Source     string `yaml:"source"`
+	Digest     string `yaml:"digest"`
+	Date       string `yaml:"date"`
+	FromAction string `yaml:"fromAction"`
+}
+
+/*
+Get the image the snapshot was created from
+  - @returns The image, without the source type prefix
+*/
+func (s Snapshot) Image() string {
+	for _, prefix := range []string{"oci://", "docker://", "oci:", "docker:"} {
+		if image, found := strings.CutPrefix(s.Source, prefix); found {
+			return image
+		}
+	}
+
+	return s.Source
+}
+
+// Snapshots of a node
+type Inventory struct {
+	Snapshotter string
+
+	// Sorted by identifier
+	Snapshots []Snapshot
+
+	// Identifiers of the snapshots stored on the disk, sorted
+	OnDisk []int
+}
+
+// Part of the state file describing the snapshots
+type stateFile struct {
+	State struct {
+		Snapshots map[int]Snapshot `yaml:"snapshots"`
+	} `yaml:"state"`
+}
+
+/*
+Get the script listing the snapshots
+  - @param snapshotter Snapshotter used by the node
+  - @returns Script to execute on the node
+*/
+func script(snapshotter string) string {
+	files := strings.Join(StateFiles, " ")
+	return fmt.Sprintf("for f in %s; do [ -f $f ] && cat $f && break; done; echo '%s'; ls -1 %s 2>/dev/null; true",
+		files, diskMarker, SnapshotDirs[snapshotter])
+}
+
+/*
+Get the snapshots of a node
+  - @param ctx Context used to stop the command
+  - @param r Runner of the node
+  - @param snapshotter Snapshotter used by the node
+  - @returns The inventory or an error
+*/
+func Get(ctx context.Context, r probe.Runner, snapshotter string) (*Inventory, error) {
+	if _, found := SnapshotDirs[snapshotter]; !found {
+		return nil, fmt.Errorf("unknown snapshotter %q", snapshotter)
+	}
+
+	res, err := r.Run(ctx, script(snapshotter))
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	return Parse(snapshotter, res.Stdout)
+}
+
+/*
+Parse the output of the listing script
+  - @param snapshotter Snapshotter used by the node
+  - @param out Output of the script: the state file, then the snapshot directories
+  - @returns The inventory or an error if the state file is missing or invalid
+*/
+func Parse(snapshotter, out string) (*Inventory, error) {
+	state, disk, _ := strings.Cut(out, diskMarker)
+	if strings.TrimSpace(state) == "" {
+		return nil, errors.New("state file not found")
+	}
+
+	var f stateFile
+	if err := yaml.Unmarshal([]byte(state), &f); err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+
+	inv := &Inventory{Snapshotter: snapshotter}
+	for id, s := range f.State.Snapshots {
+		s.ID = id
+		inv.Snapshots = append(inv.Snapshots, s)
+	}
+	slices.SortFunc(inv.Snapshots, func(a, b Snapshot) int {
+		return a.ID - b.ID
+	})
+
+	// Other entries, like the 'active' link of the loop device snapshotter, are ignored
+	for _, name := range strings.Fields(disk) {
+		if id, err := strconv.Atoi(name); err == nil {
+			inv.OnDisk = append(inv.OnDisk, id)
+		}
+	}
+	slices.Sort(inv.OnDisk)
+
+	return inv, nil
+}
+
+/*
+Get a snapshot
+  - @param id Identifier of the snapshot
+  - @returns The snapshot and true if found
+*/
+func (i *Inventory) Get(id int) (Snapshot, bool) {
+	for _, s := range i.Snapshots {
+		if s.ID == id {
+			return s, true
+		}
+	}
+
+	return Snapshot{}, false
+}
+
+/*
+Get the active snapshot, the one booted by default
+  - @returns The snapshot and true if found
+*/
+func (i *Inventory) Active() (Snapshot, bool) {
+	for _, s := range i.Snapshots {
+		if s.Active {
+			return s, true
+		}
+	}
+
+	return Snapshot{}, false
+}
+
+/*
+Get the snapshot preceding the active one, used as fallback
+  - @returns The snapshot and true if found
+*/
+func (i *Inventory) Previous() (Snapshot, bool) {
+	active, found := i.Active()
+	if !found {
+		return Snapshot{}, false
+	}
+
+	for _, s := range slices.Backward(i.Snapshots) {
+		if s.ID < active.ID {
+			return s, true
+		}
+	}
+
+	return Snapshot{}, false
+}
+
+/*
+Check the consistency of the snapshots
+  - @param minSnaps Minimum number of snapshots expected
+  - @param maxSnaps Maximum number of snapshots kept
+  - @returns Nothing or an error listing all the issues found
+*/
+func (i *Inventory) Check(minSnaps, maxSnaps int) error {
+	var errs []error
+
+	if n := len(i.Snapshots); n < minSnaps || n > maxSnaps {
+		errs = append(errs, fmt.Errorf("%d snapshots, expected between %d and %d", n, minSnaps, maxSnaps))
+	}
+
+	active := 0
+	for _, s := range i.Snapshots {
+		if s.Active {
+			active++
+		}
+		if s.Source == "" {
+			errs = append(errs, fmt.Errorf("snapshot %d has no source", s.ID))
+		}
+	}
+	if active != 1 {
+		errs = append(errs, fmt.Errorf("%d active snapshots, expected 1", active))
+	}
+
+	ids := make([]int, 0, len(i.Snapshots))
+	for _, s := range i.Snapshots {
+		ids = append(ids, s.ID)
+	}
+	if !slices.Equal(ids, i.OnDisk) {
+		errs = append(errs, fmt.Errorf("snapshots %v are described, but %v are stored", ids, i.OnDisk))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s snapshots: %w", i.Snapshotter, err)
+	}
+
+	return nil
+}
+
+func (i *Inventory) String() string {
+	var b strings.Builder
+	for _, s := range i.Snapshots {
+		active := ""
+		if s.Active {
+			active = " (active)"
+		}
+		fmt.Fprintf(&b, "%d%s: %s, %s on %s\n", s.ID, active, s.Source, s.FromAction, s.Date)
+	}
+
+	return b.String()
+}
+
+/*
+Get the snapshot booted by a node
+  - @param s State of the node
+  - @returns Identifier of the snapshot and true if the node booted a snapshot
+*/
+func Booted(s *probe.State) (int, bool) {
+	m := snapshotPath.FindStringSubmatch(s.RootImage)
+	if m == nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(m[1])
+
+	return id, err == nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+)
+
+const sample = `date: "2025-01-10T10:12:45Z"
+state:
+    label: COS_STATE
+    snapshots:
+        1:
+            active: false
+            source: oci://registry.suse.com/suse/sl-micro/6.1/baremetal-os-container:2.2.0-4.4
+            digest: sha256:aaa
+            date: "2025-01-10T10:12:45Z"
+            fromAction: install
+        2:
+            active: true
+            source: oci://registry.suse.com/suse/sl-micro/6.1/baremetal-os-container:2.2.0-4.5
+            digest: sha256:bbb
+            date: "2025-01-10T11:02:13Z"
+            fromAction: upgrade
+### on-disk
+1
+2
+active
+`
+
+func TestParse(t *testing.T) {
+	inv, err := Parse(probe.SnapshotterLoopDevice, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Check(2, DefaultMaxSnaps[inv.Snapshotter]); err != nil {
+		t.Error(err)
+	}
+
+	active, _ := inv.Active()
+	prev, found := inv.Previous()
+	if active.ID != 2 || !found || prev.ID != 1 {
+		t.Errorf("active = %d, previous = %d\n%s", active.ID, prev.ID, inv)
+	}
+	if prev.Image() != "registry.suse.com/suse/sl-micro/6.1/baremetal-os-container:2.2.0-4.4" {
+		t.Errorf("Image() = %q", prev.Image())
+	}
+
+	// One snapshot removed from the disk, but still described
+	inv.OnDisk = inv.OnDisk[1:]
+	if err := inv.Check(1, 1); err == nil || !strings.Contains(err.Error(), "are stored") || !strings.Contains(err.Error(), "expected between 1 and 1") {
+		t.Errorf("Check() = %v", err)
+	}
+
+	if _, err := Parse(probe.SnapshotterBtrfs, "### on-disk\n1\n"); err == nil {
+		t.Error("missing state file not detected")
+	}
+}
+
+func TestBooted(t *testing.T) {
+	for root, want := range map[string]int{
+		"/run/initramfs/elemental-state/.snapshots/2/snapshot.img": 2,
+		"/dev/vda3[/@/.snapshots/13/snapshot]":                     13,
+		"/run/initramfs/live/cOS/recovery.img":                     0,
+	} {
+		if id, _ := Booted(&probe.State{RootImage: root}); id != want {
+			t.Errorf("Booted(%s) = %d, want %d", root, id, want)
+		}
+	}
+}
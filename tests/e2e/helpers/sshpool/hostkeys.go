@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshpool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Error returned when a VM presents another host key than the recorded one
+type HostKeyChangedError struct {
+	Name string
+	Want string
+	Got  string
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf("host key of %s changed from %s to %s, forget the node if it has been reprovisioned", e.Name, e.Want, e.Got)
+}
+
+// Host key recorded for a VM
+type hostKey struct {
+	addr string
+	key  ssh.PublicKey
+}
+
+// HostKeys records the host key of each VM on first connection
+type HostKeys struct {
+	// File where the keys are kept between runs of the suite, memory only if empty
+	file string
+
+	mu   sync.Mutex
+	keys map[string]hostKey
+}
+
+/*
+Open a host keys file
+  - @remarks A missing file is not an error, it is created on first record
+  - @param file Path of the file, memory only if empty
+  - @returns Pointer to the host keys or an error
+*/
+func OpenHostKeys(file string) (*HostKeys, error) {
+	h := &HostKeys{file: file, keys: map[string]hostKey{}}
+	if file == "" {
+		return h, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Format is "<name> <address> <key type> <key>"
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(s.Text()), " ", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key for %s in %s: %w", fields[0], file, err)
+		}
+		h.keys[fields[0]] = hostKey{addr: fields[1], key: key}
+	}
+
+	return h, s.Err()
+}
+
+/*
+Save the host keys into the file
+  - @remarks Must be called with the lock held
+  - @returns Nothing or an error
+*/
+func (h *HostKeys) save() error {
+	if h.file == "" {
+		return nil
+	}
+
+	names := make([]string, 0, len(h.keys))
+	for name := range h.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		k := h.keys[name]
+		fmt.Fprintf(&b, "%s %s %s", name, k.addr, ssh.MarshalAuthorizedKey(k.key))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.file), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(h.file, []byte(b.String()), 0600)
+}
+
+/*
+Get the name of the VM recorded for an address
+  - @param addr Address of the VM, with the port
+  - @returns Name of the VM, empty if unknown
+*/
+func (h *HostKeys) Name(addr string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, k := range h.keys {
+		if k.addr == addr {
+			return name
+		}
+	}
+
+	return ""
+}
+
+/*
+Check the host key of a VM, recording it on first connection
+  - @remarks Keys of unnamed VMs are checked if the address is known, but never recorded
+  - @param name Name of the VM, can be empty
+  - @returns Callback to use in the SSH client configuration
+*/
+func (h *HostKeys) Callback(name string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		id := name
+		if id == "" {
+			for n, k := range h.keys {
+				if k.addr == hostname {
+					id = n
+					break
+				}
+			}
+			if id == "" {
+				return nil
+			}
+		}
+
+		known, found := h.keys[id]
+		if !found {
+			h.keys[id] = hostKey{addr: hostname, key: key}
+			return h.save()
+		}
+
+		if !bytes.Equal(known.key.Marshal(), key.Marshal()) {
+			return &HostKeyChangedError{
+				Name: id,
+				Want: ssh.FingerprintSHA256(known.key),
+				Got:  ssh.FingerprintSHA256(key),
+			}
+		}
+
+		// The address can change if the VM is recreated with the same name
+		if known.addr != hostname {
+			known.addr = hostname
+			h.keys[id] = known
+			return h.save()
+		}
+
+		return nil
+	}
+}
+
+/*
+Forget the host key of a VM
+  - @remarks To be used when the VM is reprovisioned, the next key is then accepted
+  - @param name Name of the VM
+  - @returns Nothing or an error
+*/
+func (h *HostKeys) Forget(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, found := h.keys[name]; !found {
+		return nil
+	}
+	delete(h.keys, name)
+
+	return h.save()
+}
+
+/*
+Forget the host keys of all the VMs
+  - @returns Nothing or an error
+*/
+func (h *HostKeys) Reset() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.keys = map[string]hostKey{}
+
+	return h.save()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshpool
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Names of the files kept in the SSH directory of a run
+	KeyFileName      = "id_ed25519"
+	HostKeysFileName = "known_hosts"
+
+	// Comment added to the generated public keys
+	keyComment = "elemental-e2e"
+)
+
+/*
+Generate a new key, replacing any existing one
+  - @remarks The public key is written next to the private key, with a .pub extension
+  - @param file Path of the private key
+  - @returns The signer to use for authentication or an error
+*/
+func NewKey(file string) (ssh.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, keyComment)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file+".pub", []byte(AuthorizedKey(signer)+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+/*
+Load a key generated by NewKey
+  - @param file Path of the private key
+  - @returns The signer to use for authentication or an error
+*/
+func LoadKey(file string) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+/*
+Format the public part of a key for authorized_keys
+  - @param signer Key to format
+  - @returns The public key on one line
+*/
+func AuthorizedKey(signer ssh.Signer) string {
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	return key + " " + keyComment
+}
@@ -0,0 +1,338 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshpool
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Default timeout of the TCP connection and SSH handshake
+	DefaultDialTimeout = 30 * time.Second
+
+	// Default time after which a connection not answering a keepalive is reopened
+	DefaultKeepAliveTimeout = 10 * time.Second
+)
+
+// Connection shared by all the commands sent to a node
+type conn struct {
+	name string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// Pool keeps one SSH connection per node, reopened when the node reboots
+type Pool struct {
+	Username string
+	Password string
+
+	// Host keys of the nodes, checked on each new connection
+	HostKeys *HostKeys
+
+	DialTimeout      time.Duration
+	KeepAliveTimeout time.Duration
+
+	// Directory where the commands and their output are logged, one sub-directory per node
+	// NOTE: nothing is logged if empty
+	LogDir string
+
+	mu     sync.Mutex
+	signer ssh.Signer
+	conns  map[string]*conn
+	logs   map[string]*nodeLog
+	dials  int
+}
+
+// Client runs commands on one node through the pool
+type Client struct {
+	// Name of the VM, used to track its host key
+	Name string
+
+	// Address of the node, with the port
+	Host string
+
+	pool *Pool
+}
+
+/*
+Create a pool
+  - @remarks Host keys are only kept in memory, set HostKeys to keep them in a file
+  - @param username User used to log in
+  - @param password Password used if key authentication fails, can be empty
+  - @returns Pointer to the pool
+*/
+func New(username, password string) *Pool {
+	hostKeys, _ := OpenHostKeys("")
+
+	return &Pool{
+		Username:         username,
+		Password:         password,
+		HostKeys:         hostKeys,
+		DialTimeout:      DefaultDialTimeout,
+		KeepAliveTimeout: DefaultKeepAliveTimeout,
+		conns:            map[string]*conn{},
+		logs:             map[string]*nodeLog{},
+	}
+}
+
+/*
+Set the key used to log in
+  - @remarks Only used for the next connections, the password is still tried if the key is refused
+  - @param signer Key to use, nil to only use the password
+  - @returns Nothing
+*/
+func (p *Pool) SetSigner(signer ssh.Signer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.signer = signer
+}
+
+/*
+Get a client for a node
+  - @param name Name of the VM, empty if unknown
+  - @param addr Address of the node, with the port
+  - @returns Pointer to the client
+*/
+func (p *Pool) Client(name, addr string) *Client {
+	return &Client{Name: name, Host: addr, pool: p}
+}
+
+/*
+Get the shared connection of a node
+  - @param c Client of the node
+  - @returns Pointer to the connection, created if needed
+*/
+func (p *Pool) conn(c *Client) *conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cn, found := p.conns[c.Host]
+	if !found {
+		cn = &conn{}
+		p.conns[c.Host] = cn
+	}
+	if c.Name != "" {
+		cn.name = c.Name
+	}
+
+	return cn
+}
+
+/*
+Open a new SSH connection to a node
+  - @param c Client of the node
+  - @returns Pointer to the SSH client or an error
+*/
+func (p *Pool) dial(c *Client) (*ssh.Client, error) {
+	p.mu.Lock()
+	signer := p.signer
+	p.mu.Unlock()
+
+	var auth []ssh.AuthMethod
+	if signer != nil {
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if p.Password != "" {
+		auth = append(auth, ssh.Password(p.Password))
+	}
+
+	client, err := ssh.Dial("tcp", c.Host, &ssh.ClientConfig{
+		User:            p.Username,
+		Auth:            auth,
+		Timeout:         p.DialTimeout,
+		HostKeyCallback: p.HostKeys.Callback(c.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.dials++
+	p.mu.Unlock()
+
+	return client, nil
+}
+
+/*
+Check that a connection is still usable
+  - @remarks A rebooted node does not always close the connection, so a keepalive is sent
+  - @param client SSH client to check
+  - @returns True if the node answered in time
+*/
+func (p *Pool) alive(client *ssh.Client) bool {
+	done := make(chan error, 1)
+	go func() {
+		// A refused request is still an answer
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	t := time.NewTimer(p.KeepAliveTimeout)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		return err == nil
+	case <-t.C:
+		return false
+	}
+}
+
+/*
+Open a session on the shared connection of a node
+  - @remarks The connection is reopened once if it is broken
+  - @param c Client of the node
+  - @returns Pointer to the session or an error
+*/
+func (p *Pool) session(c *Client) (*ssh.Session, error) {
+	cn := p.conn(c)
+
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	var err error
+	for range 2 {
+		if cn.client != nil && !p.alive(cn.client) {
+			_ = cn.client.Close()
+			cn.client = nil
+		}
+
+		if cn.client == nil {
+			if cn.client, err = p.dial(c); err != nil {
+				return nil, err
+			}
+		}
+
+		var s *ssh.Session
+		if s, err = cn.client.NewSession(); err == nil {
+			return s, nil
+		}
+		_ = cn.client.Close()
+		cn.client = nil
+	}
+
+	return nil, err
+}
+
+/*
+Close the shared connection of a node
+  - @param addr Address of the node, with the port
+  - @returns Nothing
+*/
+func (p *Pool) drop(addr string) {
+	p.mu.Lock()
+	cn, found := p.conns[addr]
+	p.mu.Unlock()
+	if !found {
+		return
+	}
+
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	if cn.client != nil {
+		_ = cn.client.Close()
+		cn.client = nil
+	}
+}
+
+/*
+Forget a reprovisioned node
+  - @remarks Its connection is closed and its next host key accepted
+  - @param name Name of the VM
+  - @returns Nothing or an error
+*/
+func (p *Pool) Forget(name string) error {
+	p.mu.Lock()
+	var addrs []string
+	for addr, cn := range p.conns {
+		if cn.name == name {
+			addrs = append(addrs, addr)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, addr := range addrs {
+		p.drop(addr)
+	}
+
+	return p.HostKeys.Forget(name)
+}
+
+/*
+Forget a reprovisioned node known only by its address
+  - @param addr Address of the node, with the port
+  - @returns Nothing or an error
+*/
+func (p *Pool) ForgetAddr(addr string) error {
+	p.drop(addr)
+
+	if name := p.HostKeys.Name(addr); name != "" {
+		return p.HostKeys.Forget(name)
+	}
+
+	return nil
+}
+
+/*
+Get the number of connections opened since the creation of the pool
+  - @returns Number of successful dials
+*/
+func (p *Pool) Dials() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.dials
+}
+
+/*
+Close all the connections and log files
+  - @returns Nothing
+*/
+func (p *Pool) Close() {
+	p.mu.Lock()
+	addrs := make([]string, 0, len(p.conns))
+	for addr := range p.conns {
+		addrs = append(addrs, addr)
+	}
+	logs := p.logs
+	p.logs = map[string]*nodeLog{}
+	p.mu.Unlock()
+
+	for _, addr := range addrs {
+		p.drop(addr)
+	}
+	for _, l := range logs {
+		l.close()
+	}
+}
+
+/*
+Forget the node
+  - @remarks To be used when the node is reprovisioned
+  - @returns Nothing or an error
+*/
+func (c *Client) Forget() error {
+	if c.Name == "" {
+		return c.pool.ForgetAddr(c.Host)
+	}
+
+	return c.pool.Forget(c.Name)
+}
@@ -0,0 +1,342 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshpool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Name of the file where the commands of a node are logged
+const CommandsLogName = "commands.log"
+
+// Result of a command executed on a node
+type Result struct {
+	Command  string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+}
+
+// True if the command exited with 0
+func (r *Result) Success() bool {
+	return r.ExitCode == 0
+}
+
+/*
+Convert a failed command into an error
+  - @returns Nothing if the command succeeded, or an error including the standard error
+*/
+func (r *Result) Err() error {
+	if r.Success() {
+		return nil
+	}
+
+	return fmt.Errorf("%q exited with %d: %s", r.Command, r.ExitCode, strings.TrimSpace(r.Stderr))
+}
+
+// Log file of a node, shared by all the commands executed on it
+type nodeLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (l *nodeLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Write(p)
+}
+
+func (l *nodeLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_ = l.f.Close()
+}
+
+/*
+Get the identifier of the node
+  - @returns Name of the VM, or IP address if the name is unknown
+*/
+func (c *Client) ID() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	host, _, err := net.SplitHostPort(c.Host)
+	if err != nil {
+		return c.Host
+	}
+
+	return host
+}
+
+/*
+Get the log file of a node
+  - @param c Client of the node
+  - @returns Writer of the log, io.Discard if logging is disabled or not possible
+*/
+func (p *Pool) log(c *Client) io.Writer {
+	if p.LogDir == "" {
+		return io.Discard
+	}
+	name := c.ID()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if l, found := p.logs[name]; found {
+		return l
+	}
+
+	dir := filepath.Join(p.LogDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return io.Discard
+	}
+	f, err := os.OpenFile(filepath.Join(dir, CommandsLogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return io.Discard
+	}
+	l := &nodeLog{f: f}
+	p.logs[name] = l
+
+	return l
+}
+
+/*
+Execute a command on the node until it ends or the context is done
+  - @param ctx Context used to stop the command
+  - @param cmd Command to execute
+  - @param stdin Reader of the standard input, nil for none
+  - @param stdout Writer of the standard output
+  - @param stderr Writer of the standard error
+  - @returns Nothing, an *ssh.ExitError if the command failed, or another error if it cannot be completed
+*/
+func (c *Client) exec(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := c.pool.session(c)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		return fmt.Errorf("%q: %w", cmd, ctx.Err())
+	case err = <-done:
+	}
+
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		// Connection lost during the command, typically because the command rebooted the node
+		c.pool.drop(c.Host)
+		return fmt.Errorf("%q: %w", cmd, err)
+	}
+
+	return err
+}
+
+/*
+Execute a command on the node
+  - @remarks The output is also streamed into the log of the node, if enabled
+  - @param ctx Context used to stop the command
+  - @param cmd Command to execute
+  - @returns The result, or an error if the command cannot be executed or completed
+*/
+func (c *Client) Run(ctx context.Context, cmd string) (*Result, error) {
+	log := c.pool.log(c)
+	fmt.Fprintf(log, "=== %s $ %s\n", time.Now().Format(time.RFC3339), cmd)
+
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	err := c.exec(ctx, cmd, nil, io.MultiWriter(&stdout, log), io.MultiWriter(&stderr, log))
+
+	r := &Result{
+		Command:  cmd,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		r.ExitCode = exitErr.ExitStatus()
+	case ctx.Err() != nil:
+		fmt.Fprintf(log, "=== stopped after %s: %v\n", r.Duration.Round(time.Millisecond), ctx.Err())
+		return nil, err
+	default:
+		fmt.Fprintf(log, "=== connection lost after %s: %v\n", r.Duration.Round(time.Millisecond), err)
+		return nil, err
+	}
+	fmt.Fprintf(log, "=== exit %d in %s\n", r.ExitCode, r.Duration.Round(time.Millisecond))
+
+	return r, nil
+}
+
+/*
+Execute a long running command, streaming its output
+  - @remarks Only the command is logged, not its output
+  - @param ctx Context used to stop the command
+  - @param cmd Command to execute
+  - @param stdout Writer of the standard output
+  - @returns Nothing, an *ssh.ExitError if the command failed, or another error if it cannot be completed
+*/
+func (c *Client) Stream(ctx context.Context, cmd string, stdout io.Writer) error {
+	fmt.Fprintf(c.pool.log(c), "=== %s $ %s (streamed)\n", time.Now().Format(time.RFC3339), cmd)
+
+	var stderr bytes.Buffer
+	err := c.exec(ctx, cmd, nil, stdout, &stderr)
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return err
+}
+
+/*
+Execute a command reading its standard input from a local stream
+  - @remarks Only the command is logged, not its input
+  - @param ctx Context used to stop the command
+  - @param cmd Command to execute
+  - @param stdin Reader of the standard input, closed on the node once read entirely
+  - @returns Nothing, or an error including the standard error
+*/
+func (c *Client) Write(ctx context.Context, cmd string, stdin io.Reader) error {
+	fmt.Fprintf(c.pool.log(c), "=== %s $ %s (stdin)\n", time.Now().Format(time.RFC3339), cmd)
+
+	var stderr bytes.Buffer
+	err := c.exec(ctx, cmd, stdin, io.Discard, &stderr)
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return err
+}
+
+/*
+Run a command on the node
+  - @remarks Same behaviour as tools.Client.RunSSH, but the connection is kept open
+  - @param cmd Command to execute
+  - @returns Standard output of the command or an error including the standard error
+*/
+func (c *Client) RunSSH(cmd string) (string, error) {
+	r, err := c.Run(context.Background(), cmd)
+	if err != nil {
+		return "", err
+	}
+
+	return r.Stdout, r.Err()
+}
+
+/*
+Quote a value for the remote shell
+  - @param s Value to quote
+  - @returns The value in single quotes
+*/
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+/*
+Check if a systemd unit is active
+  - @param ctx Context used to stop the command
+  - @param unit Name of the unit
+  - @returns True if the unit is active, or an error if the node cannot be reached
+*/
+func (c *Client) UnitActive(ctx context.Context, unit string) (bool, error) {
+	r, err := c.Run(ctx, "systemctl is-active --quiet "+Quote(unit))
+	if err != nil {
+		return false, err
+	}
+
+	return r.Success(), nil
+}
+
+/*
+Check if a file exists
+  - @param ctx Context used to stop the command
+  - @param path Path of the file, any type of file is accepted
+  - @returns True if the file exists, or an error if the node cannot be reached
+*/
+func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
+	r, err := c.Run(ctx, "test -e "+Quote(path))
+	if err != nil {
+		return false, err
+	}
+
+	return r.Success(), nil
+}
+
+/*
+Check if the journal of a unit contains a line
+  - @param ctx Context used to stop the command
+  - @param unit Name of the unit
+  - @param re Regular expression to search, matched against each message
+  - @param since Time of the oldest message to check, the whole journal if zero
+  - @returns True if a message matches, or an error if the journal cannot be read
+*/
+func (c *Client) JournalContains(ctx context.Context, unit string, re *regexp.Regexp, since time.Time) (bool, error) {
+	cmd := "journalctl --no-pager --output=cat --unit " + Quote(unit)
+	if !since.IsZero() {
+		cmd += fmt.Sprintf(" --since @%d", since.Unix())
+	}
+
+	r, err := c.Run(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+	if err := r.Err(); err != nil {
+		return false, err
+	}
+
+	for line := range strings.Lines(r.Stdout) {
+		if re.MatchString(line) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,359 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshpool
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Minimal SSH server echoing the executed commands
+type testServer struct {
+	t        *testing.T
+	listener net.Listener
+	key      ssh.Signer
+
+	// Public key accepted for authentication, password is always "pwd"
+	authorized ssh.PublicKey
+	usedKey    bool
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func newTestServer(t *testing.T) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{t: t, listener: l, key: newSigner(t)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// Simulate a reboot by closing all the connections
+func (s *testServer) reboot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) serve(c net.Conn) {
+	s.mu.Lock()
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pwd []byte) (*ssh.Permissions, error) {
+			if string(pwd) == "pwd" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.authorized != nil && bytes.Equal(key.Marshal(), s.authorized.Marshal()) {
+				s.usedKey = true
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	cfg.AddHostKey(s.key)
+	s.mu.Unlock()
+
+	_, chans, reqs, err := ssh.NewServerConn(c, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				switch req.Type {
+				case "exec":
+					_ = req.Reply(true, nil)
+				case "signal":
+					// Only sent to stop a blocked command
+					return
+				default:
+					_ = req.Reply(false, nil)
+					continue
+				}
+
+				// Payload is the length of the command followed by the command
+				cmd := string(req.Payload[4:])
+				var code uint32
+				switch {
+				case cmd == "block":
+					continue
+				case strings.HasPrefix(cmd, "exit "):
+					n, _ := strconv.Atoi(strings.TrimPrefix(cmd, "exit "))
+					code = uint32(n)
+					_, _ = ch.Stderr().Write([]byte("failed\n"))
+				default:
+					_, _ = ch.Write([]byte(cmd))
+				}
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, code)
+				_, _ = ch.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func TestRunSSHReusesAndReconnects(t *testing.T) {
+	s := newTestServer(t)
+	p := New("root", "pwd")
+	defer p.Close()
+	c := p.Client("node-1", s.addr())
+
+	for range 3 {
+		out, err := c.RunSSH("echo SSH_OK")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "echo SSH_OK" {
+			t.Fatalf("RunSSH() = %q", out)
+		}
+	}
+	if p.Dials() != 1 {
+		t.Fatalf("Dials() = %d, want 1 connection for all commands", p.Dials())
+	}
+
+	s.reboot()
+	if _, err := c.RunSSH("hostname"); err != nil {
+		t.Fatalf("RunSSH() after reboot: %v", err)
+	}
+	if p.Dials() != 2 {
+		t.Fatalf("Dials() = %d, want 2 after reboot", p.Dials())
+	}
+}
+
+func TestKeyAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	if _, err := NewKey(file); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authorized = signer.PublicKey()
+
+	// Wrong password, only the key can work
+	p := New("root", "wrong")
+	defer p.Close()
+	p.SetSigner(signer)
+
+	if _, err := p.Client("node-1", s.addr()).RunSSH("true"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.usedKey {
+		t.Fatal("key has not been used")
+	}
+}
+
+func TestHostKeyTracking(t *testing.T) {
+	s := newTestServer(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	hostKeys, err := OpenHostKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New("root", "pwd")
+	defer p.Close()
+	p.HostKeys = hostKeys
+	c := p.Client("node-1", s.addr())
+
+	if _, err := c.RunSSH("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys must survive a new run of the suite
+	reloaded, err := OpenHostKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := reloaded.Name(s.addr()); name != "node-1" {
+		t.Fatalf("Name() = %q after reload, want node-1", name)
+	}
+
+	// Reprovisioned node without Forget
+	s.mu.Lock()
+	s.key = newSigner(t)
+	s.mu.Unlock()
+	s.reboot()
+
+	_, err = c.RunSSH("true")
+	var changed *HostKeyChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("RunSSH() error = %v, want HostKeyChangedError", err)
+	}
+
+	// Unnamed clients are checked against the key recorded for the address
+	if _, err := p.Client("", s.addr()).RunSSH("true"); !errors.As(err, &changed) {
+		t.Fatalf("RunSSH() unnamed error = %v, want HostKeyChangedError", err)
+	}
+
+	if err := c.Forget(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RunSSH("true"); err != nil {
+		t.Fatalf("RunSSH() after Forget: %v", err)
+	}
+}
+
+func TestForgetLiveSystem(t *testing.T) {
+	s := newTestServer(t)
+	p := New("root", "pwd")
+	defer p.Close()
+	c := p.Client("node-1", s.addr())
+
+	// Key of the live system pinned, connection still open
+	if _, err := c.RunSSH("true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Forget("node-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installed system, with its own key
+	s.mu.Lock()
+	s.key = newSigner(t)
+	s.mu.Unlock()
+	s.reboot()
+
+	if _, err := c.RunSSH("true"); err != nil {
+		t.Fatalf("RunSSH() after Forget: %v", err)
+	}
+	if p.Dials() != 2 {
+		t.Fatalf("Dials() = %d, want 2 after Forget", p.Dials())
+	}
+
+	// The new key is pinned in turn
+	s.mu.Lock()
+	s.key = newSigner(t)
+	s.mu.Unlock()
+	s.reboot()
+
+	var changed *HostKeyChangedError
+	if _, err := c.RunSSH("true"); !errors.As(err, &changed) {
+		t.Fatalf("RunSSH() error = %v, want HostKeyChangedError", err)
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	s := newTestServer(t)
+	p := New("root", "pwd")
+	defer p.Close()
+	p.LogDir = t.TempDir()
+	c := p.Client("node-1", s.addr())
+
+	r, err := c.Run(context.Background(), "exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ExitCode != 3 || r.Stderr != "failed\n" || r.Success() || r.Err() == nil {
+		t.Fatalf("Run() = %+v, want exit code 3 and stderr", r)
+	}
+
+	// A failed command is an error for RunSSH only
+	if _, err := c.RunSSH("exit 1"); err == nil {
+		t.Fatal("RunSSH() succeeded on a failed command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Run(ctx, "block"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want deadline exceeded", err)
+	}
+
+	// The connection is still usable after a stopped command
+	found, err := c.JournalContains(context.Background(), "elemental-register.service", regexp.MustCompile(`--unit 'elemental-register\.service'`), time.Time{})
+	if err != nil || !found {
+		t.Fatalf("JournalContains() = %t, %v", found, err)
+	}
+	if p.Dials() != 1 {
+		t.Fatalf("Dials() = %d, want 1", p.Dials())
+	}
+
+	p.Close()
+	data, err := os.ReadFile(filepath.Join(p.LogDir, "node-1", CommandsLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"$ exit 3", "=== exit 3 in", "stopped after", "journalctl --no-pager"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log does not contain %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Phase of the provisioning of a node
+type Phase string
+
+const (
+	PhaseBoot         Phase = "pxe/iso boot"
+	PhaseLive         Phase = "live system"
+	PhaseRegistration Phase = "registration"
+	PhaseInstalled    Phase = "install done"
+	PhasePoweredOff   Phase = "power-off"
+	PhaseActiveBoot   Phase = "first active boot"
+	PhaseJoined       Phase = "joined cluster"
+)
+
+// Usual order of the phases
+var Phases = []Phase{
+	PhaseBoot,
+	PhaseLive,
+	PhaseRegistration,
+	PhaseInstalled,
+	PhasePoweredOff,
+	PhaseActiveBoot,
+	PhaseJoined,
+}
+
+// Sources of the events
+const (
+	SourceConsole    = "console"
+	SourceHTTP       = "http"
+	SourceHypervisor = "hypervisor"
+	SourceSSH        = "ssh"
+	SourceCluster    = "cluster"
+)
+
+// Event marking the start of a phase
+type Event struct {
+	Phase  Phase     `json:"phase"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Timeline of a node, with the first event of each phase
+type Timeline struct {
+	Node string
+
+	// Sorted by time
+	Events []Event
+}
+
+/*
+Get the event of a phase
+  - @param p Phase to look for
+  - @returns The event and true if the phase was reached
+*/
+func (t Timeline) Get(p Phase) (Event, bool) {
+	for _, e := range t.Events {
+		if e.Phase == p {
+			return e, true
+		}
+	}
+
+	return Event{}, false
+}
+
+/*
+Check that phases were reached in order
+  - @param phases Phases expected, in this order
+  - @returns Nothing or an error describing the first missing or misplaced phase
+*/
+func (t Timeline) CheckOrder(phases ...Phase) error {
+	var prev Event
+	for i, p := range phases {
+		e, found := t.Get(p)
+		if !found {
+			return fmt.Errorf("%s: phase %q not reached:\n%s", t.Node, p, t)
+		}
+		if i > 0 && e.Time.Before(prev.Time) {
+			return fmt.Errorf("%s: phase %q reached before %q:\n%s", t.Node, p, prev.Phase, t)
+		}
+		prev = e
+	}
+
+	return nil
+}
+
+func (t Timeline) String() string {
+	if len(t.Events) == 0 {
+		return t.Node + ": no phase reached"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, started at %s:\n", t.Node, t.Events[0].Time.Format(time.RFC3339))
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, e := range t.Events {
+		fmt.Fprintf(w, "  +%s\t%s\t%s\t%s\n", e.Time.Sub(t.Events[0].Time).Round(time.Second), e.Phase, e.Source, e.Detail)
+	}
+	_ = w.Flush()
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+/*
+Sort the events by time, then by usual order of the phases
+  - @param events Events to sort
+  - @returns Nothing
+*/
+func sortEvents(events []Event) {
+	slices.SortStableFunc(events, func(a, b Event) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return slices.Index(Phases, a.Phase) - slices.Index(Phases, b.Phase)
+	})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	dir := t.TempDir()
+	tr := NewTracker(dir)
+	start := time.Now()
+
+	// Served files are only recorded for known nodes
+	h := tr.Handler(http.NotFoundHandler(), func(ip string) string {
+		if ip == "192.168.122.2" {
+			return "node-1"
+		}
+		return ""
+	})
+	for _, addr := range []string{"192.168.122.2:4242", "192.168.122.99:4242"} {
+		r := httptest.NewRequest(http.MethodGet, "/ipxe/boot.ipxe", nil)
+		r.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	tr.ConsoleLine("node-1", "[    0.000000] Kernel command line: BOOT_IMAGE=/boot/kernel root=live:CDLABEL=COS_LIVE", start.Add(time.Minute))
+	tr.ConsoleLine("node-1", "[  120.000000] reboot: Power down", start.Add(5*time.Minute))
+	// Already reached, ignored
+	tr.ConsoleLine("node-1", "[  120.000000] reboot: Power down", start.Add(20*time.Minute))
+	if err := tr.Mark("node-1", Event{Phase: PhaseActiveBoot, Time: start.Add(10 * time.Minute), Source: SourceSSH}); err != nil {
+		t.Fatal(err)
+	}
+
+	report := tr.Report()
+	if !strings.Contains(report, "GET /ipxe/boot.ipxe") || strings.Contains(report, "192.168.122.99") {
+		t.Errorf("report:\n%s", report)
+	}
+	if tr.Report() != "" {
+		t.Error("nothing changed since the last report")
+	}
+
+	// Timeline is loaded from the files by another tracker
+	tl := NewTracker(dir).Timeline("node-1")
+	if len(tl.Events) != 4 {
+		t.Fatalf("timeline:\n%s", tl)
+	}
+	if err := tl.CheckOrder(PhaseBoot, PhaseLive, PhasePoweredOff, PhaseActiveBoot); err != nil {
+		t.Error(err)
+	}
+	if err := tl.CheckOrder(PhaseActiveBoot, PhasePoweredOff); err == nil {
+		t.Error("misplaced phase not detected")
+	}
+	if err := tl.CheckOrder(PhaseLive, PhaseJoined); err == nil || !strings.Contains(err.Error(), "not reached") {
+		t.Errorf("missing phase not detected: %v", err)
+	}
+
+	if err := tr.Reset("node-1"); err != nil {
+		t.Fatal(err)
+	}
+	if tl := NewTracker(dir).Timeline("node-1"); len(tl.Events) != 0 {
+		t.Errorf("timeline after Reset:\n%s", tl)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the file keeping the timeline of a node
+const FileName = "timeline.json"
+
+// Line of the console marking a phase
+type Marker struct {
+	Phase   Phase
+	Pattern *regexp.Regexp
+}
+
+// Console lines marking the phases
+var ConsoleMarkers = []Marker{
+	{PhaseBoot, regexp.MustCompile(`iPXE initialising devices|UEFI PXEv4|UEFI HTTPv4|QEMU DVD-ROM|QEMU CD-ROM`)},
+	{PhaseLive, regexp.MustCompile(`Kernel command line:.*(root=live:|rd\.live\.image)`)},
+	{PhaseRegistration, regexp.MustCompile(`(?i)Start(ing|ed) .*elemental[ -]regist`)},
+	{PhaseInstalled, regexp.MustCompile(`(?i)elemental install.* completed`)},
+	{PhasePoweredOff, regexp.MustCompile(`reboot: Power down`)},
+	{PhaseActiveBoot, regexp.MustCompile(`Kernel command line:.*(elemental\.mode=active|LABEL=COS_ACTIVE)`)},
+}
+
+// Tracker builds the timeline of the nodes from the events of all the sources
+type Tracker struct {
+	// Base directory, a sub-directory is used for each node
+	Dir string
+
+	mu        sync.Mutex
+	timelines map[string][]Event
+	changed   map[string]bool
+}
+
+/*
+Create a tracker
+  - @remarks Timelines saved by a previous tracker are loaded when needed
+  - @param dir Base directory of the timelines
+  - @returns Pointer to the tracker
+*/
+func NewTracker(dir string) *Tracker {
+	return &Tracker{
+		Dir:       dir,
+		timelines: map[string][]Event{},
+		changed:   map[string]bool{},
+	}
+}
+
+/*
+Get the events of a node, loading them if needed
+  - @remarks Must be called with the lock held
+  - @param node Name of the node
+  - @returns The events
+*/
+func (t *Tracker) events(node string) []Event {
+	if events, found := t.timelines[node]; found {
+		return events
+	}
+
+	var events []Event
+	if data, err := os.ReadFile(filepath.Join(t.Dir, node, FileName)); err == nil {
+		_ = json.Unmarshal(data, &events)
+	}
+	t.timelines[node] = events
+
+	return events
+}
+
+/*
+Save the events of a node
+  - @remarks Must be called with the lock held
+  - @param node Name of the node
+  - @returns Nothing or an error
+*/
+func (t *Tracker) save(node string) error {
+	if t.Dir == "" {
+		return nil
+	}
+
+	dir := filepath.Join(t.Dir, node)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t.timelines[node], "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, FileName), data, 0644)
+}
+
+/*
+Record that a node reached a phase
+  - @remarks Only the first event of a phase is kept, the next ones are ignored
+  - @param node Name of the node
+  - @param e Event to record
+  - @returns Nothing or an error if the timeline cannot be saved
+*/
+func (t *Tracker) Mark(node string, e Event) error {
+	if node == "" {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := t.events(node)
+	for _, known := range events {
+		if known.Phase == e.Phase {
+			return nil
+		}
+	}
+	events = append(events, e)
+	sortEvents(events)
+	t.timelines[node] = events
+	t.changed[node] = true
+
+	return t.save(node)
+}
+
+/*
+Record the phase marked by a console line, if any
+  - @remarks Can be used as console.Monitor.Observer
+  - @param node Name of the node
+  - @param line Line of the console
+  - @param at Time the line was seen
+  - @returns Nothing
+*/
+func (t *Tracker) ConsoleLine(node, line string, at time.Time) {
+	for _, m := range ConsoleMarkers {
+		if m.Pattern.MatchString(line) {
+			_ = t.Mark(node, Event{Phase: m.Phase, Time: at, Source: SourceConsole, Detail: strings.TrimSpace(line)})
+		}
+	}
+}
+
+/*
+Record the network boot of the nodes downloading files
+  - @param next Handler serving the files
+  - @param resolve Function giving the name of a node from its IP address, empty if unknown
+  - @returns The handler to use instead of next
+*/
+func (t *Tracker) Handler(next http.Handler, resolve func(ip string) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if node := resolve(ip); node != "" {
+			_ = t.Mark(node, Event{Phase: PhaseBoot, Source: SourceHTTP, Detail: r.Method + " " + r.URL.Path})
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+Get the timeline of a node
+  - @param node Name of the node
+  - @returns A copy of the timeline
+*/
+func (t *Tracker) Timeline(node string) Timeline {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Timeline{Node: node, Events: append([]Event(nil), t.events(node)...)}
+}
+
+/*
+Forget the timeline of a node
+  - @remarks Used before reprovisioning a node, to start a new timeline
+  - @param node Name of the node
+  - @returns Nothing or an error
+*/
+func (t *Tracker) Reset(node string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timelines[node] = nil
+	delete(t.changed, node)
+	if t.Dir == "" {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(t.Dir, node, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+/*
+Get the timelines changed since the last report
+  - @returns The timelines, one after the other, empty if nothing changed
+*/
+func (t *Tracker) Report() string {
+	t.mu.Lock()
+	nodes := make([]string, 0, len(t.changed))
+	for node := range t.changed {
+		nodes = append(nodes, node)
+	}
+	t.changed = map[string]bool{}
+	t.mu.Unlock()
+
+	sort.Strings(nodes)
+	reports := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		reports = append(reports, t.Timeline(node).String())
+	}
+
+	return strings.Join(reports, "\n\n")
+}
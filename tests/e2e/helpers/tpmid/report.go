@@ -0,0 +1,83 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tpmid
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Result of a scenario
+type Result struct {
+	Mode     Mode
+	Node     string
+	Scenario string
+	Err      error
+}
+
+// Report keeps the results of the scenarios, by TPM mode
+type Report struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+/*
+Add the result of a scenario
+  - @param mode TPM mode tested
+  - @param node Name of the node, or a description of the nodes
+  - @param scenario Name of the scenario
+  - @param err Nothing if the scenario succeeded, the failure otherwise
+  - @returns The error, to be checked by the caller
+*/
+func (r *Report) Add(mode Mode, node, scenario string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, Result{Mode: mode, Node: node, Scenario: scenario, Err: err})
+
+	return err
+}
+
+func (r *Report) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var modes []Mode
+	for _, res := range r.results {
+		if !slices.Contains(modes, res.Mode) {
+			modes = append(modes, res.Mode)
+		}
+	}
+	slices.Sort(modes)
+
+	var b strings.Builder
+	for _, mode := range modes {
+		fmt.Fprintf(&b, "%s TPM:\n", mode)
+		for _, res := range r.results {
+			if res.Mode != mode {
+				continue
+			}
+			status := "ok"
+			if res.Err != nil {
+				status = "FAILED: " + res.Err.Error()
+			}
+			fmt.Fprintf(&b, "  %s, %s: %s\n", res.Node, res.Scenario, status)
+		}
+	}
+
+	return b.String()
+}
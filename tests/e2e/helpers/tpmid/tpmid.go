@@ -0,0 +1,266 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tpmid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+// TPM used by a node to register
+type Mode string
+
+const (
+	// TPM emulated by elemental-register
+	ModeEmulated Mode = "emulated"
+	// Software TPM of the VM
+	ModeSWTPM Mode = "swtpm"
+)
+
+// Annotation set by the operator with the IP used to register
+const RegistrationIPAnnotation = "elemental.cattle.io/registration-ip"
+
+// Name of the file keeping the identities of the nodes, across the runs
+const FileName = "tpm-identities.json"
+
+/*
+Get the TPM mode of a node
+  - @param emulated True if the TPM is emulated
+  - @returns The mode
+*/
+func ModeOf(emulated bool) Mode {
+	if emulated {
+		return ModeEmulated
+	}
+
+	return ModeSWTPM
+}
+
+// Identity given by the operator to a node
+type Identity struct {
+	Node string `json:"node"`
+	Mode Mode   `json:"mode"`
+
+	// MachineInventory created at registration
+	Inventory      string `json:"inventory"`
+	UID            string `json:"uid"`
+	TPMHash        string `json:"tpmHash"`
+	RegistrationIP string `json:"registrationIP"`
+}
+
+/*
+Get the identity of a node from its MachineInventory
+  - @param node Name of the node
+  - @param mode TPM mode of the node
+  - @param m MachineInventory of the node
+  - @returns The identity
+*/
+func FromInventory(node string, mode Mode, m *elemental.MachineInventory) Identity {
+	return Identity{
+		Node:           node,
+		Mode:           mode,
+		Inventory:      m.Name,
+		UID:            string(m.UID),
+		TPMHash:        m.Spec.TPMHash,
+		RegistrationIP: m.Annotations[RegistrationIPAnnotation],
+	}
+}
+
+/*
+Find the identity of a node in a list of MachineInventories
+  - @param node Name of the node
+  - @param mode TPM mode of the node
+  - @param ip IP used by the node to register
+  - @param machines MachineInventories to look into
+  - @returns The identity and true if found
+*/
+func Find(node string, mode Mode, ip string, machines []elemental.MachineInventory) (Identity, bool) {
+	for i := range machines {
+		if machines[i].Annotations[RegistrationIPAnnotation] == ip {
+			return FromInventory(node, mode, &machines[i]), true
+		}
+	}
+
+	return Identity{}, false
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("%s (%s TPM): %s, TPM hash %s", i.Node, i.Mode, i.Inventory, i.TPMHash)
+}
+
+/*
+Check that the identity is complete
+  - @returns Nothing or an error
+*/
+func (i Identity) Check() error {
+	if i.Inventory == "" || i.UID == "" {
+		return fmt.Errorf("%s: no MachineInventory", i.Node)
+	}
+	if i.TPMHash == "" {
+		return fmt.Errorf("%s: MachineInventory %s has no TPM hash", i.Node, i.Inventory)
+	}
+
+	return nil
+}
+
+/*
+Check that a node kept its identity when registered again
+  - @param before Identity before the registration
+  - @param after Identity after the registration
+  - @returns Nothing or an error listing the changes
+*/
+func Stable(before, after Identity) error {
+	var errs []error
+	if after.Inventory != before.Inventory || after.UID != before.UID {
+		errs = append(errs, fmt.Errorf("MachineInventory changed from %s (%s) to %s (%s)", before.Inventory, before.UID, after.Inventory, after.UID))
+	}
+	if after.TPMHash != before.TPMHash {
+		errs = append(errs, fmt.Errorf("TPM hash changed from %s to %s", before.TPMHash, after.TPMHash))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", before.Node, err)
+	}
+
+	return nil
+}
+
+/*
+Check that no identity is shared
+  - @remarks The same node registered with another TPM mode must get another identity too
+  - @param ids Identities to compare
+  - @returns Nothing or an error listing the shared identities
+*/
+func Distinct(ids []Identity) error {
+	var errs []error
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			if a.TPMHash == b.TPMHash {
+				errs = append(errs, fmt.Errorf("%s and %s share TPM hash %s", a, b, a.TPMHash))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Check that a clone of a node has been rejected
+  - @param src Identity of the cloned node, after the registration of the clone
+  - @param before Identity of the cloned node, before the registration of the clone
+  - @param clone Identity given to the clone, if any
+  - @param registered True if the registration of the clone succeeded
+  - @returns Nothing or an error
+*/
+func Rejected(before, src Identity, clone *Identity, registered bool) error {
+	var errs []error
+	if registered {
+		errs = append(errs, errors.New("registration of the clone succeeded"))
+	}
+	if clone != nil {
+		errs = append(errs, fmt.Errorf("clone got an identity: %s", clone))
+	}
+	if err := Stable(before, src); err != nil {
+		errs = append(errs, err)
+	}
+	if src.RegistrationIP != before.RegistrationIP {
+		errs = append(errs, fmt.Errorf("clone took over the identity of %s, registered from %s instead of %s", before.Node, src.RegistrationIP, before.RegistrationIP))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("clone of %s not rejected: %w", before.Node, err)
+	}
+
+	return nil
+}
+
+/*
+Load the identities recorded by the previous runs
+  - @param file File of the identities
+  - @returns The identities, empty if the file does not exist, or an error
+*/
+func Load(file string) ([]Identity, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []Identity
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return ids, nil
+}
+
+/*
+Merge identities into the ones recorded by the previous runs
+  - @remarks A node keeps one identity per TPM mode, the newest one
+  - @param file File of the identities
+  - @param ids Identities to add
+  - @returns All the identities, sorted by node and mode, or an error
+*/
+func Save(file string, ids []Identity) ([]Identity, error) {
+	all, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		all = slices.DeleteFunc(all, func(known Identity) bool {
+			return known.Node == id.Node && known.Mode == id.Mode
+		})
+		all = append(all, id)
+	}
+	slices.SortFunc(all, func(a, b Identity) int {
+		if c := strings.Compare(a.Node, b.Node); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.Mode), string(b.Mode))
+	})
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return all, os.WriteFile(file, data, 0644)
+}
+
+/*
+Get the TPM modes of identities
+  - @param ids Identities
+  - @returns The modes found, sorted
+*/
+func Modes(ids []Identity) []Mode {
+	var modes []Mode
+	for _, id := range ids {
+		if !slices.Contains(modes, id.Mode) {
+			modes = append(modes, id.Mode)
+		}
+	}
+	slices.Sort(modes)
+
+	return modes
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tpmid
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func identity(node string, mode Mode, hash, ip string) Identity {
+	m := elemental.MachineInventory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "m-" + hash,
+			UID:         types.UID("uid-" + hash),
+			Annotations: map[string]string{RegistrationIPAnnotation: ip},
+		},
+		Spec: elemental.MachineInventorySpec{TPMHash: hash},
+	}
+
+	return FromInventory(node, mode, &m)
+}
+
+func TestFind(t *testing.T) {
+	machines := []elemental.MachineInventory{{}, {}}
+	machines[1].Name = "m-2"
+	machines[1].Annotations = map[string]string{RegistrationIPAnnotation: "192.168.122.3"}
+
+	id, found := Find("node-2", ModeSWTPM, "192.168.122.3", machines)
+	if !found || id.Inventory != "m-2" || id.Node != "node-2" {
+		t.Fatalf("unexpected identity %+v, found %v", id, found)
+	}
+	if _, found := Find("node-3", ModeSWTPM, "192.168.122.4", machines); found {
+		t.Fatal("identity found for an unknown IP")
+	}
+}
+
+func TestChecks(t *testing.T) {
+	a := identity("node-1", ModeEmulated, "aaa", "192.168.122.2")
+	b := identity("node-2", ModeEmulated, "bbb", "192.168.122.3")
+
+	if err := a.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Identity{Node: "node-1", Inventory: "m", UID: "u"}).Check(); err == nil {
+		t.Fatal("identity without TPM hash accepted")
+	}
+
+	if err := Stable(a, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := Stable(a, identity("node-1", ModeEmulated, "ccc", "192.168.122.2")); err == nil {
+		t.Fatal("changed identity reported as stable")
+	}
+
+	if err := Distinct([]Identity{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	swtpm := identity("node-1", ModeSWTPM, "aaa", "192.168.122.2")
+	if err := Distinct([]Identity{a, b, swtpm}); err == nil {
+		t.Fatal("shared TPM hash not reported")
+	}
+
+	if err := Rejected(a, a, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	moved := a
+	moved.RegistrationIP = "192.168.122.200"
+	if err := Rejected(a, moved, nil, false); err == nil {
+		t.Fatal("identity taken over by the clone not reported")
+	}
+	if err := Rejected(a, a, &b, true); err == nil {
+		t.Fatal("registered clone not reported")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), FileName)
+
+	ids, err := Load(file)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("unexpected identities %v, error %v", ids, err)
+	}
+
+	if _, err := Save(file, []Identity{identity("node-2", ModeSWTPM, "old", ""), identity("node-1", ModeSWTPM, "aaa", "")}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := Save(file, []Identity{identity("node-2", ModeSWTPM, "bbb", ""), identity("node-1", ModeEmulated, "ccc", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err = Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || len(all) != 3 {
+		t.Fatalf("expected 3 identities, got %v", ids)
+	}
+	if ids[0].Mode != ModeEmulated || ids[1].TPMHash != "aaa" || ids[2].TPMHash != "bbb" {
+		t.Fatalf("unexpected identities %v", ids)
+	}
+	if modes := Modes(ids); len(modes) != 2 {
+		t.Fatalf("unexpected modes %v", modes)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var r Report
+	_ = r.Add(ModeSWTPM, "node-1", "re-registration", nil)
+	_ = r.Add(ModeEmulated, "node-1", "clone", Rejected(Identity{Node: "node-1"}, Identity{Node: "node-1"}, nil, true))
+
+	s := r.String()
+	if strings.Index(s, "emulated TPM:") > strings.Index(s, "swtpm TPM:") {
+		t.Fatalf("modes not sorted:\n%s", s)
+	}
+	if !strings.Contains(s, "node-1, re-registration: ok") || !strings.Contains(s, "clone: FAILED") {
+		t.Fatalf("unexpected report:\n%s", s)
+	}
+}
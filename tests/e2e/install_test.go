@@ -24,22 +24,24 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 func rolloutDeployment(ns, d string) {
 	// NOTE: 1st or 2nd rollout command can sporadically fail, so better to use Eventually here
-	Eventually(func() string {
+	EventuallyWith(retry.WorkloadReady, "restart of "+d, func() string {
 		status, _ := kubectl.RunWithoutErr("rollout", "restart", "deployment/"+d,
 			"--namespace", ns)
 		return status
-	}, tools.SetTimeout(1*time.Minute), 20*time.Second).Should(ContainSubstring("restarted"))
+	}).Should(ContainSubstring("restarted"))
 
 	// Wait for deployment to be restarted
-	Eventually(func() string {
+	EventuallyWith(retry.WorkloadReady, "rollout of "+d, func() string {
 		status, _ := kubectl.RunWithoutErr("rollout", "status", "deployment/"+d,
 			"--namespace", ns)
 		return status
-	}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(ContainSubstring("successfully rolled out"))
+	}).Should(ContainSubstring("successfully rolled out"))
 }
 
 var _ = Describe("E2E - Install Rancher Manager", Label("install"), func() {
@@ -160,14 +162,14 @@ var _ = Describe("E2E - Install Rancher Manager", Label("install"), func() {
 
 		// Check issuer for Private CA
 		if caType == "private" {
-			Eventually(func() error {
+			EventuallyWith(retry.Download, "Rancher Manager page", func() error {
 				out, err := exec.Command("curl", "-vk", "https://"+rancherHostname).CombinedOutput()
 				if err != nil {
 					// Show only if there's no error
 					GinkgoWriter.Printf("%s\n", out)
 				}
 				return err
-			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+			}).Should(Not(HaveOccurred()))
 		}
 
 		By("Configuring kubectl to use Rancher admin user", func() {
@@ -179,31 +181,30 @@ var _ = Describe("E2E - Install Rancher Manager", Label("install"), func() {
 			Expect(internalUsername).To(Not(BeEmpty()))
 
 			// Add token in Rancher Manager
-			err = tools.Sed("%ADMIN_USER%", internalUsername, ciTokenYaml)
-			Expect(err).To(Not(HaveOccurred()))
-			err = kubectl.Apply("default", ciTokenYaml)
+			tokenFile := RenderManifest(ciTokenYaml, "ci-access-token", render.Values{"ADMIN_USER": internalUsername})
+			err = render.Apply("default", tokenFile)
 			Expect(err).To(Not(HaveOccurred()))
 
 			// Getting Rancher Manager local cluster CA
 			// NOTE: loop until the cmd return something, it could take some time
 			var rancherCA string
-			Eventually(func() error {
+			EventuallyWith(retry.APIRead, "Rancher Manager CA", func() error {
 				rancherCA, err = kubectl.RunWithoutErr("get", "secret",
 					"--namespace", "cattle-system",
 					"tls-rancher-ingress",
 					"-o", "jsonpath={.data.tls\\.crt}",
 				)
 				return err
-			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
-
-			// Copy skel file for ~/.kube/config
-			err = tools.CopyFile(localKubeconfigYaml, localKubeconfig)
-			Expect(err).To(Not(HaveOccurred()))
+			}).Should(Not(HaveOccurred()))
 
 			// Create kubeconfig for local cluster
-			err = tools.Sed("%RANCHER_URL%", rancherHostname, localKubeconfig)
-			Expect(err).To(Not(HaveOccurred()))
-			err = tools.Sed("%RANCHER_CA%", rancherCA, localKubeconfig)
+			kubeconfigFile := RenderManifest(localKubeconfigYaml, "local-kubeconfig", render.Values{
+				"RANCHER_CA":  rancherCA,
+				"RANCHER_URL": rancherHostname,
+			})
+
+			// Use it as ~/.kube/config
+			err = tools.CopyFile(kubeconfigFile, localKubeconfig)
 			Expect(err).To(Not(HaveOccurred()))
 
 			// Set correct file permissions
@@ -17,12 +17,11 @@ package e2e_test
 import (
 	"os"
 	"os/exec"
-	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 func checkRC(err error) {
@@ -62,9 +61,9 @@ var _ = Describe("E2E - Getting logs node", Label("logs"), func() {
 			myDir, _ := os.Getwd()
 
 			for _, b := range []binary{elemental, logCollector} {
-				Eventually(func() error {
+				EventuallyWith(retry.Download, "download of "+b.Name, func() error {
 					return exec.Command("curl", "-L", b.Url, "-o", b.Name).Run()
-				}, tools.SetTimeout(1*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 
 				err := exec.Command("chmod", "+x", b.Name).Run()
 				checkRC(err)
@@ -15,18 +15,18 @@ limitations under the License.
 package e2e_test
 
 import (
-	"os"
 	"os/exec"
 	"strconv"
 	"sync"
-	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
 	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
 )
 
 var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
@@ -35,34 +35,19 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 	const machineRegName = "machine-registration-multi"
 
 	var (
-		basePatterns []YamlPattern
+		baseValues   render.Values
 		globalNodeID int
 		wg           sync.WaitGroup
 	)
 
 	BeforeEach(func() {
-		// Patterns to replace
-		basePatterns = []YamlPattern{
-			{
-				key:   "%SNAP_TYPE%",
-				value: snapType,
-			},
-			{
-				key:   "%SSHD_CONFIG_FILE%",
-				value: sshdConfigFile,
-			},
-			{
-				key:   "%PASSWORD%",
-				value: userPassword,
-			},
-			{
-				key:   "%USER%",
-				value: userName,
-			},
-			{
-				key:   "%VM_NAME%",
-				value: vmNameRoot,
-			},
+		// Values used in all templates
+		baseValues = render.Values{
+			"PASSWORD":         userPassword,
+			"SNAP_TYPE":        snapType,
+			"SSHD_CONFIG_FILE": sshdConfigFile,
+			"USER":             userName,
+			"VM_NAME":          vmNameRoot,
 		}
 	})
 
@@ -71,15 +56,11 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 		testCaseID = 68
 
 		By("Starting default network", func() {
-			// Don't check return code, as the default network could be already removed
-			for _, c := range []string{"net-destroy", "net-undefine"} {
-				_ = exec.Command("sudo", "virsh", c, "default").Run()
-			}
+			StartDefaultNetwork()
+		})
 
-			// Wait a bit between virsh commands
-			time.Sleep(1 * time.Minute)
-			err := exec.Command("sudo", "virsh", "net-create", netDefaultFileName).Run()
-			Expect(err).To(Not(HaveOccurred()))
+		By("Starting isolated networks", func() {
+			StartIsolatedNetworks()
 		})
 	})
 
@@ -88,25 +69,14 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 		testCaseID = 38
 
 		By("Adding MachineRegistration", func() {
-			// Set temporary file
-			registrationTmp, err := tools.CreateTemp("machineRegistration")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(registrationTmp)
-
-			// Save original file as it may have to be modified twice
-			err = tools.CopyFile(registrationYaml, registrationTmp)
-			Expect(err).To(Not(HaveOccurred()))
-
-			// Create Yaml file
-			for _, p := range basePatterns {
-				err := tools.Sed(p.key, p.value, registrationTmp)
-				Expect(err).To(Not(HaveOccurred()))
-			}
+			// Create Yaml file, with the SSH key of the run
+			values := baseValues.With(render.Values{"SSH_AUTHORIZED_KEY": NewRunKey()})
+			registrationFile := RenderManifest(registrationYaml, machineRegName, values)
 
 			// Apply to k8s
-			Eventually(func() error {
-				return kubectl.Apply(clusterNS, registrationTmp)
-			}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+			EventuallyWith(retry.APIRead, "creation of "+registrationFile, func() error {
+				return render.Apply(clusterNS, registrationFile)
+			}).ShouldNot(HaveOccurred())
 
 			// Check that the machine registration is correctly created
 			CheckCreatedRegistration(clusterNS, "machine-registration-multi")
@@ -114,14 +84,13 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 
 		By("Downloading MachineRegistration file", func() {
 			// Download the new YAML installation config file
-			tokenURL, err := kubectl.RunWithoutErr("get", "MachineRegistration",
-				"--namespace", clusterNS, machineRegName,
-				"-o", "jsonpath={.status.registrationURL}")
+			registration, err := Elemental().MachineRegistrations(clusterNS).Get(machineRegName)
 			Expect(err).To(Not(HaveOccurred()))
+			tokenURL := registration.Status.RegistrationURL
 
-			Eventually(func() error {
+			EventuallyWith(retry.Download, "download of registration config", func() error {
 				return tools.GetFileFromURL(tokenURL, installConfigYaml, false)
-			}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+			}).ShouldNot(HaveOccurred())
 		})
 
 		By("Creating ISO from SeedImage", func() {
@@ -134,35 +103,15 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 			Expect(OSVersion).To(Not(BeEmpty()))
 
 			// Extract container image URL
-			baseImageURL, err := elemental.GetImageURI(clusterNS, string(OSVersion))
+			baseImageURL, err := Elemental().GetImageURI(clusterNS, string(OSVersion))
 			Expect(err).To(Not(HaveOccurred()))
 			Expect(baseImageURL).To(Not(BeEmpty()))
 
-			// Set temporary file
-			seedImageTmp, err := tools.CreateTemp("seedimage")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(seedImageTmp)
-
-			// Save original file as it may have to be modified twice
-			err = tools.CopyFile(seedImageYaml, seedImageTmp)
-			Expect(err).To(Not(HaveOccurred()))
-
-			seedImagePatterns := []YamlPattern{
-				{
-					key:   "%BASE_IMAGE%",
-					value: baseImageURL,
-				},
-			}
-			patterns := append(basePatterns, seedImagePatterns...)
-
 			// Create Yaml file
-			for _, p := range patterns {
-				err := tools.Sed(p.key, p.value, seedImageTmp)
-				Expect(err).To(Not(HaveOccurred()))
-			}
+			seedImageFile := RenderManifest(seedImageYaml, seedImageName, baseValues.With(render.Values{"BASE_IMAGE": baseImageURL}))
 
 			// Apply to k8s
-			err = kubectl.Apply(clusterNS, seedImageTmp)
+			err = render.Apply(clusterNS, seedImageFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 	})
@@ -182,37 +131,12 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 		for clusterIndex := 1; clusterIndex <= numberOfClusters; clusterIndex++ {
 			createdClusterName := clusterName + "-" + strconv.Itoa(clusterIndex)
 
-			// Patterns to replace
-			addPatterns := []YamlPattern{
-				{
-					key:   "%CLUSTER_NAME%",
-					value: createdClusterName,
-				},
-				{
-					key:   "%K8S_VERSION%",
-					value: k8sDownstreamVersion,
-				},
-			}
-			patterns := append(basePatterns, addPatterns...)
-
 			By("Creating cluster "+createdClusterName, func() {
-				// Set temporary file
-				clusterTmp, err := tools.CreateTemp(createdClusterName)
-				Expect(err).To(Not(HaveOccurred()))
-				defer os.Remove(clusterTmp)
-
-				// Save original file as it may have to be modified twice
-				err = tools.CopyFile(clusterYaml, clusterTmp)
-				Expect(err).To(Not(HaveOccurred()))
-
 				// Create Yaml file
-				for _, p := range patterns {
-					err := tools.Sed(p.key, p.value, clusterTmp)
-					Expect(err).To(Not(HaveOccurred()))
-				}
+				clusterFile := RenderCluster(createdClusterName)
 
 				// Apply to k8s
-				err = kubectl.Apply(clusterNS, clusterTmp)
+				err := render.Apply(clusterNS, clusterFile)
 				Expect(err).To(Not(HaveOccurred()))
 
 				// Check that the cluster is correctly created
@@ -220,23 +144,11 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 			})
 
 			By("Creating cluster selector for cluster "+createdClusterName, func() {
-				// Set temporary file
-				selectorTmp, err := tools.CreateTemp("selector")
-				Expect(err).To(Not(HaveOccurred()))
-				defer os.Remove(selectorTmp)
-
-				// Save original file as it may have to be modified twice
-				err = tools.CopyFile(selectorYaml, selectorTmp)
-				Expect(err).To(Not(HaveOccurred()))
-
 				// Create Yaml file
-				for _, p := range patterns {
-					err := tools.Sed(p.key, p.value, selectorTmp)
-					Expect(err).To(Not(HaveOccurred()))
-				}
+				selectorFile := RenderManifest(selectorYaml, "selector-"+createdClusterName, render.Values{"CLUSTER_NAME": createdClusterName})
 
 				// Apply to k8s
-				err = kubectl.Apply(clusterNS, selectorTmp)
+				err := render.Apply(clusterNS, selectorFile)
 				Expect(err).To(Not(HaveOccurred()))
 
 				// Check that the selector template is correctly created
@@ -253,24 +165,23 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 				Expect(hostName).To(Not(BeEmpty()))
 
 				// Add node in network configuration
-				err := rancher.AddNode(netDefaultFileName, hostName, globalNodeID)
-				Expect(err).To(Not(HaveOccurred()))
+				AddNode(hostName, globalNodeID)
 
 				// Get generated MAC address
 				_, macAdrs := GetNodeInfo(hostName)
 				Expect(macAdrs).To(Not(BeEmpty()))
 
 				wg.Add(1)
-				go func(s, h, m string) {
+				go func(h, m string) {
 					defer wg.Done()
 					defer GinkgoRecover()
 
 					By("Installing node "+h+" on cluster "+createdClusterName, func() {
 						// Execute node deployment in parallel
-						err := exec.Command(s, h, m).Run()
+						err := hv.Define(hypervisor.Domain{Name: h, MAC: m, Networks: IsolatedNetworkNames()})
 						Expect(err).To(Not(HaveOccurred()))
 					})
-				}(installVMScript, hostName, macAdrs)
+				}(hostName, macAdrs)
 			}
 
 			// Wait for all parallel jobs
@@ -286,25 +197,24 @@ var _ = Describe("E2E - Bootstrapping nodes", Label("multi-cluster"), func() {
 				ip := GetNodeIP(hostName)
 
 				// Get MachineInventory name
-				nodeName, err := kubectl.RunWithoutErr("get", "MachineInventory",
-					"--namespace", clusterNS,
-					"-o", "jsonpath={.items[?(@.metadata.annotations.elemental\\.cattle\\.io/registration-ip==\""+ip+"\")].metadata.name}")
+				nodeName, err := Elemental().GetMachineInventoryByIP(clusterNS, ip)
 				Expect(err).To(Not(HaveOccurred()))
 
 				// Add label
-				elemental.SetMachineInventoryLabel(clusterNS, nodeName, "clusterName", createdClusterName)
+				err = Elemental().SetMachineInventoryLabel(clusterNS, nodeName, "clusterName", createdClusterName)
+				Expect(err).To(Not(HaveOccurred()))
 
 				// Get node information
 				client, _ := GetNodeInfo(hostName)
 
 				// Restart node(s)
 				wg.Add(1)
-				go func(h string, cl *tools.Client) {
+				go func(h string, cl *sshpool.Client) {
 					defer wg.Done()
 					defer GinkgoRecover()
 
 					By("Restarting "+h+" to add it in cluster "+createdClusterName, func() {
-						err := exec.Command("sudo", "virsh", "start", h).Run()
+						err := hv.Start(h)
 						Expect(err).To(Not(HaveOccurred()))
 					})
 
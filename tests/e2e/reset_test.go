@@ -15,14 +15,13 @@ limitations under the License.
 package e2e_test
 
 import (
-	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootentry"
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 var _ = Describe("E2E - Test the reset feature", Label("reset"), func() {
@@ -39,48 +38,68 @@ var _ = Describe("E2E - Test the reset feature", Label("reset"), func() {
 		})
 
 		// Get the machine inventory name list
-		machineInventory, err := kubectl.RunWithoutErr("get", "MachineInventory",
-			"--namespace", clusterNS,
-			"-o", "jsonpath='{.items[*].metadata.name}'")
+		machineInventories, err := Elemental().MachineInventories(clusterNS).Names("")
 		Expect(err).To(Not(HaveOccurred()))
-		firstMachineInventory := strings.Split(machineInventory, " ")[1]
+		Expect(len(machineInventories)).To(BeNumerically(">", 1))
+		firstMachineInventory := machineInventories[1]
 
 		By("Configuring reset at MachineInventory level", func() {
 			// Patch the first machine inventory to enable reset
-			_, err = kubectl.RunWithoutErr("patch", "MachineInventory", firstMachineInventory,
-				"--namespace", clusterNS, "--type", "merge",
-				"--patch-file", resetMachineInv)
+			_, err = Elemental().MachineInventories(clusterNS).PatchFile(firstMachineInventory, resetMachineInv)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
+		var ip string
 		By("Deleting and removing the node from the cluster", func() {
-			machineToRemove, err := elemental.GetInternalMachine(clusterNS, firstMachineInventory)
+			// The node is reinstalled, so its SSH host keys will change
+			m, err := Elemental().MachineInventories(clusterNS).Get(firstMachineInventory)
 			Expect(err).To(Not(HaveOccurred()))
-			_, err = kubectl.RunWithoutErr("delete", "machines", machineToRemove,
-				"--namespace", clusterNS)
+			ip = m.Annotations["elemental.cattle.io/registration-ip"]
+			err = sshPool.ForgetAddr(ip + ":22")
+			Expect(err).To(Not(HaveOccurred()))
+
+			machineToRemove, err := Elemental().GetInternalMachine(clusterNS, firstMachineInventory)
+			Expect(err).To(Not(HaveOccurred()))
+			err = Elemental().Machines(clusterNS).Delete(machineToRemove)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Checking that MachineInventory is deleted", func() {
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "MachineInventory",
-					"--namespace", clusterNS,
-					"-o", "jsonpath={.items[*].metadata.name}")
-				return out
-			}, tools.SetTimeout(10*time.Minute), 5*time.Second).ShouldNot(ContainSubstring(firstMachineInventory))
+			EventuallyWith(retry.NodeBoot.WithTimeout(10*time.Minute), "removal of "+firstMachineInventory, func() []string {
+				names, _ := Elemental().MachineInventories(clusterNS).Names("")
+				return names
+			}).ShouldNot(ContainElement(firstMachineInventory))
 		})
 
 		By("Checking that MachineInventory is back after the reset", func() {
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "MachineInventory",
-					"--namespace", clusterNS,
-					"-o", "jsonpath={.items[*].metadata.name}")
-				return out
-			}, tools.SetTimeout(8*time.Minute), 5*time.Second).Should(ContainSubstring(firstMachineInventory))
+			EventuallyWith(retry.NodeBoot, "registration of "+firstMachineInventory, func() []string {
+				names, _ := Elemental().MachineInventories(clusterNS).Names("")
+				return names
+			}).Should(ContainElement(firstMachineInventory))
 		})
 
 		By("Checking cluster state", func() {
 			WaitCluster(clusterNS, clusterName)
 		})
+
+		By("Testing Grub entries on the reset node", func() {
+			h, found := hostByIP(ip)
+			Expect(found).To(BeTrue(), "no node with IP "+ip)
+
+			cl := sshPool.Client(h.Name, ip+":22")
+			CheckSSH(cl)
+
+			// The recovery partition is reinstalled with the node
+			active := ProbeNode(cl)
+			Expect(active.BootMode).To(Equal(probe.BootActive))
+			for _, e := range []bootentry.Entry{bootentry.Recovery, bootentry.Active} {
+				state := BootEntry(cl, e, active)
+				GinkgoWriter.Printf("OS state of %s after %s boot:\n%s\n", h.Name, e, state)
+			}
+		})
+
+		By("Checking cluster state after the reboots", func() {
+			WaitCluster(clusterNS, clusterName)
+		})
 	})
 })
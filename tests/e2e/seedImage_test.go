@@ -15,7 +15,6 @@ limitations under the License.
 package e2e_test
 
 import (
-	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -23,9 +22,8 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
 var _ = Describe("E2E - Creating ISO image", Label("iso-image"), func() {
@@ -46,52 +44,35 @@ var _ = Describe("E2E - Creating ISO image", Label("iso-image"), func() {
 		// If registry keyword is found this means that we have to test a specific OS channel
 		if strings.Contains(os2Test, "registry") {
 			// Get default channel image
-			defChannel, err := kubectl.RunWithoutErr("get", "managedOSVersionChannel",
-				"--namespace", clusterNS,
-				"-o", "jsonpath={.items[0].spec.options.image}")
+			channels, err := Elemental().ManagedOSVersionChannels(clusterNS).List("")
 			Expect(err).To(Not(HaveOccurred()))
+			Expect(channels).To(Not(BeEmpty()))
+			defChannel := channels[0].Spec.Options.Image
 			Expect(defChannel).To(Not(BeEmpty()))
 
 			// Add channel to test if needed
 			if !strings.Contains(defChannel, os2Test) {
 				By("Adding OSChannel to test", func() {
 					// Get channel name (to be able to remove it later)
-					channelName, err := kubectl.RunWithoutErr("get", "managedOSVersionChannel",
-						"--namespace", clusterNS,
-						"-o", "jsonpath={.items[0].metadata.name}")
-					Expect(err).To(Not(HaveOccurred()))
+					channelName := channels[0].Name
 					Expect(channelName).To(Not(BeEmpty()))
 
-					// Set temporary file
-					osChannelTmp, err := tools.CreateTemp("osChannel")
-					Expect(err).To(Not(HaveOccurred()))
-					defer os.Remove(osChannelTmp)
-
-					// Save original file as it can be modified multiple time
-					err = tools.CopyFile(osChannelYaml, osChannelTmp)
-					Expect(err).To(Not(HaveOccurred()))
-
-					// Set the OS channel to test
-					err = tools.Sed("%OS_CHANNEL%", os2Test, osChannelTmp)
-					Expect(err).To(Not(HaveOccurred()))
+					// Create Yaml file
+					osChannelFile := RenderManifest(osChannelYaml, "os-channel-to-test", render.Values{"OS_CHANNEL": os2Test})
 
 					// Apply to k8s
-					err = kubectl.Apply(clusterNS, osChannelTmp)
+					err := render.Apply(clusterNS, osChannelFile)
 					Expect(err).To(Not(HaveOccurred()))
 
 					// Check that the OS channel to test has been added
 					const channel = "os-channel-to-test"
-					newChannel, err := kubectl.RunWithoutErr("get", "managedOSVersionChannel",
-						"--namespace", clusterNS, channel,
-						"-o", "jsonpath={.spec.options.image}")
+					newChannel, err := Elemental().ManagedOSVersionChannels(clusterNS).Get(channel)
 					Expect(err).To(Not(HaveOccurred()))
-					Expect(newChannel).To(Equal(os2Test))
+					Expect(newChannel.Spec.Options.Image).To(Equal(os2Test))
 
 					// Delete the default channel (to be sure that it can't be used)
-					out, err := kubectl.RunWithoutErr("delete", "managedOSVersionChannel",
-						"--namespace", clusterNS, channelName)
+					err = Elemental().ManagedOSVersionChannels(clusterNS).Delete(channelName)
 					Expect(err).To(Not(HaveOccurred()))
-					Expect(out).To(ContainSubstring("deleted"))
 				})
 			}
 
@@ -114,13 +95,13 @@ var _ = Describe("E2E - Creating ISO image", Label("iso-image"), func() {
 				WaitForOSVersion(clusterNS)
 
 				// Get OSVersion name
-				Eventually(func() string {
+				EventuallyWith(retry.APIRead.WithInterval(30*time.Second), "OS version of "+os2Test, func() string {
 					OSVersion, _ = exec.Command(getOSScript, os2Test, "true").Output()
 					return string(OSVersion)
-				}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(Not(BeEmpty()))
+				}).Should(Not(BeEmpty()))
 
 				// Extract container image URL
-				baseImageURL, err = elemental.GetImageURI(clusterNS, string(OSVersion))
+				baseImageURL, err = Elemental().GetImageURI(clusterNS, string(OSVersion))
 				Expect(err).To(Not(HaveOccurred()))
 			}
 
@@ -129,72 +110,30 @@ var _ = Describe("E2E - Creating ISO image", Label("iso-image"), func() {
 
 			// Set poweroff to false for master pool to have time to check SeedImage cloud-config
 			if poolType == "master" && isoBoot {
-				_, err := kubectl.RunWithoutErr("patch", "MachineRegistration",
-					"--namespace", clusterNS, machineRegName,
-					"--type", "merge", "--patch",
-					"{\"spec\":{\"config\":{\"elemental\":{\"install\":{\"poweroff\":false}}}}}")
+				_, err := Elemental().MachineRegistrations(clusterNS).Patch(machineRegName,
+					[]byte(`{"spec":{"config":{"elemental":{"install":{"poweroff":false}}}}}`))
 				Expect(err).To(Not(HaveOccurred()))
 			}
 
 			By("Setting emulated TPM to "+strconv.FormatBool(emulateTPM), func() {
-				// Set temporary file
-				emulatedTmp, err := tools.CreateTemp("emulatedTPM")
-				Expect(err).To(Not(HaveOccurred()))
-				defer os.Remove(emulatedTmp)
-
-				// Save original file as it can be modified multiple time
-				err = tools.CopyFile(emulateTPMYaml, emulatedTmp)
-				Expect(err).To(Not(HaveOccurred()))
-
-				// Patch the yaml file
-				err = tools.Sed("%EMULATE_TPM%", strconv.FormatBool(emulateTPM), emulatedTmp)
-				Expect(err).To(Not(HaveOccurred()))
+				// Create the patch file
+				emulatedFile := RenderManifest(emulateTPMYaml, "emulated-tpm-"+poolType, render.Values{"EMULATE_TPM": strconv.FormatBool(emulateTPM)})
 
 				// And apply it
-				_, err = kubectl.RunWithoutErr("patch", "MachineRegistration",
-					"--namespace", clusterNS, machineRegName,
-					"--type", "merge", "--patch-file", emulatedTmp,
-				)
+				_, err = Elemental().MachineRegistrations(clusterNS).PatchFile(machineRegName, emulatedFile)
 				Expect(err).To(Not(HaveOccurred()))
 			})
 
-			// Patterns to replace
-			patterns := []YamlPattern{
-				{
-					key:   "%BASE_IMAGE%",
-					value: baseImageURL,
-				},
-				{
-					key:   "%CLUSTER_NAME%",
-					value: clusterName,
-				},
-				{
-					key:   "%POOL_TYPE%",
-					value: poolType,
-				},
-				{
-					key:   "%SSHD_CONFIG_FILE%",
-					value: sshdConfigFile,
-				},
-			}
-
-			// Set temporary file
-			seedImageTmp, err := tools.CreateTemp("seedImage")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(seedImageTmp)
-
-			// Save original file as it will have to be modified twice
-			err = tools.CopyFile(seedImageYaml, seedImageTmp)
-			Expect(err).To(Not(HaveOccurred()))
-
 			// Create Yaml file
-			for _, p := range patterns {
-				err := tools.Sed(p.key, p.value, seedImageTmp)
-				Expect(err).To(Not(HaveOccurred()))
-			}
+			seedImageFile := RenderManifest(seedImageYaml, seedImageName, render.Values{
+				"BASE_IMAGE":       baseImageURL,
+				"CLUSTER_NAME":     clusterName,
+				"POOL_TYPE":        poolType,
+				"SSHD_CONFIG_FILE": sshdConfigFile,
+			})
 
 			// Apply to k8s
-			err = kubectl.Apply(clusterNS, seedImageTmp)
+			err = render.Apply(clusterNS, seedImageFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 	})
@@ -15,8 +15,14 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -28,7 +34,31 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
 	. "github.com/rancher-sandbox/qase-ginkgo"
+	"github.com/rancher/elemental/tests/e2e/helpers/artifact"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootentry"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootserver"
+	"github.com/rancher/elemental/tests/e2e/helpers/cluster"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/console"
+	"github.com/rancher/elemental/tests/e2e/helpers/diag"
+	"github.com/rancher/elemental/tests/e2e/helpers/disklayout"
+	"github.com/rancher/elemental/tests/e2e/helpers/download"
 	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/fleet"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/journal"
+	"github.com/rancher/elemental/tests/e2e/helpers/kube"
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/scheduler"
+	"github.com/rancher/elemental/tests/e2e/helpers/snapshot"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
+	"github.com/rancher/elemental/tests/e2e/helpers/timeline"
+	"github.com/rancher/elemental/tests/e2e/helpers/tpmid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/dynamic"
 )
 
 const (
@@ -45,10 +75,10 @@ const (
 	installConfigYaml     = "../../install-config.yaml"
 	installHardenedScript = "../scripts/config-hardened"
 	installVMScript       = "../scripts/install-vm"
+	isolatedSubnet        = 130
 	localKubeconfigYaml   = "../assets/local-kubeconfig-skel.yaml"
 	localStorageYaml      = "../assets/local-storage.yaml"
 	metallbRscYaml        = "../assets/metallb_rsc.yaml"
-	numberOfNodesMax      = 30
 	osChannelYaml         = "../assets/osChannel.yaml"
 	resetMachineInv       = "../assets/reset_machine_inventory.yaml"
 	restoreYaml           = "../assets/restore.yaml"
@@ -60,19 +90,29 @@ const (
 )
 
 var (
+	backupResourceSet         string
 	backupRestoreVersion      string
+	bootServer                *bootserver.Server
+	bootServerErr             error
+	bootServerStopped         = make(chan struct{})
 	caType                    string
 	certManagerVersion        string
 	clusterName               string
 	clusterNS                 string
 	clusterType               string
 	clusterYaml               string
+	consoles                  *console.Monitor
+	elementalClient           *elemental.Client
 	elementalSupport          string
 	emulateTPM                bool
 	forceDowngrade            bool
+	hv                        hypervisor.Hypervisor
 	isoBoot                   bool
+	journals                  *journal.Collector
 	k8sUpstreamVersion        string
+	kubeClient                dynamic.Interface
 	k8sDownstreamVersion      string
+	manifests                 *render.Renderer
 	netDefaultFileName        string
 	numberOfClusters          int
 	numberOfVMs               int
@@ -87,7 +127,6 @@ var (
 	rancherHostname           string
 	rancherLogCollector       string
 	rancherVersion            string
-	rancherUpgrade            string
 	rancherUpgradeChannel     string
 	rancherUpgradeHeadVersion string
 	rancherUpgradeVersion     string
@@ -96,11 +135,15 @@ var (
 	seedImageYaml             string
 	selectorYaml              string
 	selinux                   bool
+	retries                   = retry.NewRecorder()
 	sequential                bool
 	snapType                  string
 	sshdConfigFile            string
+	sshPool                   *sshpool.Pool
+	suiteConfig               *config.SuiteConfig
 	testCaseID                int64
 	testType                  string
+	timelines                 *timeline.Tracker
 	upgradeImage              string
 	upgradeOSChannel          string
 	upgradeType               string
@@ -110,12 +153,12 @@ var (
 )
 
 func CheckBackupRestore(v string) {
-	Eventually(func() string {
+	EventuallyWith(retry.BackupRestore, "rancher-backup logs", func() string {
 		out, _ := kubectl.RunWithoutErr("logs", "-l app.kubernetes.io/name=rancher-backup",
 			"--tail=-1", "--since=5m",
 			"--namespace", "cattle-resources-system")
 		return out
-	}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring(v))
+	}).Should(ContainSubstring(v))
 }
 
 /*
@@ -126,12 +169,12 @@ Check that Cluster resource has been correctly created
 */
 func CheckCreatedCluster(ns, cn string) {
 	// Check that the cluster is correctly created
-	Eventually(func() string {
+	EventuallyWith(retry.APIRead, "cluster "+cn, func() string {
 		out, _ := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io",
 			"--namespace", ns,
 			cn, "-o", "jsonpath={.metadata.name}")
 		return out
-	}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(Equal(cn))
+	}).Should(Equal(cn))
 }
 
 /*
@@ -141,12 +184,10 @@ Check that Registration resource has been correctly created
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func CheckCreatedRegistration(ns, rn string) {
-	Eventually(func() string {
-		out, _ := kubectl.RunWithoutErr("get", "MachineRegistration",
-			"--namespace", ns,
-			"-o", "jsonpath={.items[*].metadata.name}")
-		return out
-	}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(ContainSubstring(rn))
+	EventuallyWith(retry.APIRead, "MachineRegistration "+rn, func() []string {
+		names, _ := Elemental().MachineRegistrations(ns).Names("")
+		return names
+	}).Should(ContainElement(rn))
 }
 
 /*
@@ -156,28 +197,52 @@ Check that a SelectorTemplate resource has been correctly created
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func CheckCreatedSelectorTemplate(ns, sn string) {
-	Eventually(func() string {
-		out, _ := kubectl.RunWithoutErr("get", "MachineInventorySelectorTemplate",
-			"--namespace", ns,
-			"-o", "jsonpath={.items[*].metadata.name}")
-		return out
-	}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(ContainSubstring(sn))
+	EventuallyWith(retry.APIRead, "selector template "+sn, func() []string {
+		names, _ := Elemental().MachineInventorySelectorTemplates(ns).Names("")
+		return names
+	}).Should(ContainElement(sn))
+}
+
+/*
+Watch the serial console of a node for boot failures
+  - @remarks Nothing is done if the node is already watched
+  - @param hn Node hostname
+  - @returns Nothing
+*/
+func WatchConsole(hn string) {
+	if hn != "" {
+		consoles.Watch(hn, hv.ConsoleLog(hn))
+	}
 }
 
 /*
 Check SSH connection
+  - @remarks The journal of the node is followed until the end of the spec
+  - @remarks Fails without waiting more if the console of the node shows a boot failure
   - @param cl Client (node) informations
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func CheckSSH(cl *tools.Client) {
-	Eventually(func() string {
+func CheckSSH(cl *sshpool.Client) {
+	WatchConsole(cl.Name)
+
+	EventuallyWith(retry.SSHReachability, "SSH on "+cl.Host, func() string {
+		if f := consoles.Failure(cl.Name); f != nil {
+			StopTrying("Node " + cl.ID() + " cannot boot").Wrap(f).Now()
+		}
+
 		out, _ := cl.RunSSH("echo SSH_OK")
 		return strings.Trim(out, "\n")
-	}, tools.SetTimeout(10*time.Minute), 5*time.Second).Should(Equal("SSH_OK"))
+	}).Should(Equal("SSH_OK"))
+
+	// Keep the journal of the node from now on, it could be useful if something fails later
+	if err := journals.Follow(cl); err != nil {
+		GinkgoWriter.Printf("Cannot follow the journal of %s: %v\n", cl.ID(), err)
+	}
 }
 
 /*
 Download ISO built with SeedImage
+  - @remarks The content of the ISO is checked against the SeedImage and its MachineRegistration
   - @param ns Namespace where the cluster is deployed
   - @param seedName Name of the used SeedImage resource
   - @param filename Path and name of the file where to store the ISO
@@ -189,53 +254,67 @@ func DownloadBuiltISO(ns, seedName, filename string) {
 
 	By("Waiting for image to be generated", func() {
 		// Check that the seed image is correctly created
-		Eventually(func() string {
-			out, _ := kubectl.RunWithoutErr("get", "SeedImage",
-				"--namespace", ns,
-				seedName,
-				"-o", "jsonpath={.status}")
-			return out
-		}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(ContainSubstring("downloadURL"))
+		EventuallyWith(retry.APIRead, "SeedImage "+seedName, func() string {
+			seedImage, err := Elemental().SeedImages(ns).Get(seedName)
+			if err != nil {
+				return ""
+			}
+			return seedImage.Status.DownloadURL
+		}).Should(Not(BeEmpty()))
 	})
 
 	By("Downloading image", func() {
-		// Get URL
-		seedImageURL, err := kubectl.RunWithoutErr("get", "SeedImage",
-			"--namespace", ns,
-			seedName,
-			"-o", "jsonpath={.status.downloadURL}")
+		seedImage, err := Elemental().SeedImages(ns).Get(seedName)
 		Expect(err).To(Not(HaveOccurred()))
 
-		// ISO file size should be greater than 500MB
-		Eventually(func() int64 {
-			// No need to check download status, file size at the end is enough
-			_ = tools.GetFileFromURL(seedImageURL, filename, false)
-			file, _ := os.Stat(filename)
-			return file.Size()
-		}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(BeNumerically(">", minimalISOSize))
+		// Only supported in Dev version for now, not Stable (1.5.x) and Staging (1.6.4)
+		var sum *download.Checksum
+		if strings.Contains(os2Test, "dev") {
+			sum, err = download.FetchChecksum(context.Background(), seedImage.Status.ChecksumURL, filename)
+			Expect(err).To(Not(HaveOccurred()))
+		}
+
+		// Each attempt resumes where the previous one stopped
+		d := download.New(seedImage.Status.DownloadURL, filename, sum)
+		EventuallyWith(retry.Download, "download of "+filename, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), retry.Download.Scaled())
+			defer cancel()
+
+			stats, err := d.Run(ctx)
+			if err != nil {
+				return err
+			}
+			GinkgoWriter.Printf("Downloaded %s: %s\n", filename, stats)
+			return nil
+		}).Should(Succeed())
+
+		// ISO file size should be greater than 250MB
+		file, err := os.Stat(filename)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(file.Size()).To(BeNumerically(">", minimalISOSize))
 	})
 
-	// Only supported in Dev version for now, not Stable (1.5.x) and Staging (1.6.4)
-	if strings.Contains(os2Test, "dev") {
-		By("Checking checksum", func() {
-			// Get checksum URL
-			checksumURL, err := kubectl.RunWithoutErr("get", "SeedImage",
-				"--namespace", ns,
-				seedName,
-				"-o", "jsonpath={.status.checksumURL}")
-			Expect(err).To(Not(HaveOccurred()))
+	By("Inspecting image", func() {
+		seedImage, err := Elemental().SeedImages(ns).Get(seedName)
+		Expect(err).To(Not(HaveOccurred()))
+		ref := seedImage.Spec.MachineRegistrationRef
+		Expect(ref).To(Not(BeNil()))
+		refNS := ref.Namespace
+		if refNS == "" {
+			refNS = ns
+		}
+		registration, err := Elemental().MachineRegistrations(refNS).Get(ref.Name)
+		Expect(err).To(Not(HaveOccurred()))
 
-			// Download checksum file
-			checksumFile := filename + ".sha256"
-			_ = tools.GetFileFromURL(checksumURL, checksumFile, false)
+		// Checked without booting, a broken image fails here instead of on the nodes
+		report, err := artifact.Inspect(filename)
+		Expect(err).To(Not(HaveOccurred()))
+		GinkgoWriter.Printf("Content of the image:\n%s", report)
 
-			// Check the checksum of downloaded image
-			err = exec.Command("bash", "-c", "sed -i 's; .*\\.iso; "+filename+";' "+checksumFile).Run()
-			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("sha256sum", "--check", checksumFile).Run()
-			Expect(err).To(Not(HaveOccurred()))
-		})
-	}
+		expect, err := artifact.ExpectFrom(registration, seedImage)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(report.Check(expect)).To(Succeed())
+	})
 }
 
 /*
@@ -259,21 +338,88 @@ func GetBackupDir() string {
 /*
 Get Elemental node information
   - @param hn Node hostname
-  - @returns Client structure and MAC address
+  - @returns SSH client and MAC address
 */
-func GetNodeInfo(hn string) (*tools.Client, string) {
+func GetNodeInfo(hn string) (*sshpool.Client, string) {
 	// Get network data
-	data, err := rancher.GetHostNetConfig(".*name=\""+hn+"\".*", netDefaultFileName)
+	data := getNodeHost(hn)
+
+	return sshPool.Client(hn, data.IP+":22"), data.MAC
+}
+
+/*
+Get the nodes used by the current run
+  - @remarks Addresses are generated if a node is not in the default network yet
+  - @returns Pointer to the fleet, the function will fail through Ginkgo in case of issue
+*/
+func GetFleet() *fleet.Fleet {
+	n, err := hv.Network("default")
 	Expect(err).To(Not(HaveOccurred()))
 
-	// Set 'client' to be able to access the node through SSH
-	c := &tools.Client{
-		Host:     string(data.IP) + ":22",
-		Username: userName,
-		Password: userPassword,
+	// MachineInventories only exist once the nodes are registered
+	inventories := map[string]string{}
+	if machines, err := Elemental().MachineInventories(clusterNS).List(""); err == nil {
+		for _, m := range machines {
+			inventories[m.Annotations["elemental.cattle.io/registration-ip"]] = m.Name
+		}
 	}
 
-	return c, data.Mac
+	f := fleet.New()
+	for index := vmIndex; index <= numberOfVMs; index++ {
+		hostName := elemental.SetHostname(vmNameRoot, index)
+		host, found := n.Host(hostName)
+		if !found {
+			host = n.NewHost(hostName, index)
+		}
+
+		f.Nodes = append(f.Nodes, fleet.Node{
+			Hostname:         hostName,
+			Index:            index,
+			MAC:              host.MAC,
+			IP:               host.IP,
+			Pool:             poolType,
+			Cluster:          clusterName,
+			Namespace:        clusterNS,
+			Client:           sshPool.Client(hostName, host.IP+":22"),
+			MachineInventory: inventories[host.IP],
+		})
+	}
+
+	return f
+}
+
+/*
+Install or boot nodes in parallel, without overloading the host
+  - @remarks The waiting time of each node is added to the report
+  - @param nodes Nodes to handle
+  - @param fn Function installing or booting a node, the slot is held until it returns
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func BootNodes(nodes *fleet.Fleet, fn func(fleet.Node)) {
+	s := scheduler.New(suiteConfig.BootSlots, int64(suiteConfig.BootSeed))
+	s.Limits = scheduler.Limits{
+		MaxCPU:         float64(suiteConfig.BootMaxCPU),
+		MaxIOWait:      float64(suiteConfig.BootMaxIOWait),
+		MinFreeHugeMiB: suiteConfig.BootMinFreeHugeMiB,
+	}
+
+	// Jitter is only useful in parallel mode
+	if sequential {
+		s.MaxJitter = 0
+	}
+
+	defer func() {
+		AddReportEntry("Boot waits", s.Report())
+	}()
+
+	nodes.ForEach(0, func(n fleet.Node) {
+		release, err := s.Acquire(context.Background(), n.Hostname, n.Index)
+		Expect(err).To(Not(HaveOccurred()))
+		defer release()
+
+		WatchConsole(n.Hostname)
+		fn(n)
+	})
 }
 
 /*
@@ -282,59 +428,287 @@ Get Elemental node IP address
   - @returns IP address
 */
 func GetNodeIP(hn string) string {
-	// Get network data
-	data, err := rancher.GetHostNetConfig(".*name=\""+hn+"\".*", netDefaultFileName)
+	return getNodeHost(hn).IP
+}
+
+/*
+Get the network configuration of a node
+  - @param hn Node hostname
+  - @returns The node entry of the default network, the function will fail through Ginkgo in case of issue
+*/
+func getNodeHost(hn string) network.Host {
+	n, err := hv.Network("default")
 	Expect(err).To(Not(HaveOccurred()))
 
-	return data.IP
+	host, found := n.Host(hn)
+	Expect(found).To(BeTrue(), "node "+hn+" not found in default network")
+
+	return host
 }
 
 /*
-Install rancher-backup operator
-  - @param k kubectl structure
+Get the disk layout of a node
+  - @remarks Layouts set in DISK_LAYOUTS are given in turn to the nodes
+  - @param index Index of the node
+  - @returns The layout, the default one with HDD_SIZE disks if none is set
+*/
+func NodeLayout(index int) disklayout.Layout {
+	if len(suiteConfig.DiskLayouts) == 0 {
+		return disklayout.Default.WithSize(suiteConfig.HDDSize)
+	}
+
+	// Names are checked when the configuration is loaded
+	l, _ := disklayout.Get(suiteConfig.DiskLayouts[index%len(suiteConfig.DiskLayouts)])
+	return l
+}
+
+/*
+Add a node in the default network
+  - @remarks The running network is updated, there is no need to restart it
+  - @param hn Node hostname
+  - @param index Index of the node, used to set the MAC and IP addresses
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func InstallBackupOperator(k *kubectl.Kubectl) {
-	chartRepo := "rancher-chart"           // Default chart
-	backupRscSet := "rancher-resource-set" // Default resource set
+func AddNode(hn string, index int) {
+	n, err := hv.Network("default")
+	Expect(err).To(Not(HaveOccurred()))
 
-	// Use specific operator version if defined
-	if backupRestoreVersion == "" {
-		// Autodetect operator version based on Rancher Manager version
-		rancherVersion, err := kubectl.RunWithoutErr("get", "deploy", "rancher",
-			"--namespace", "cattle-system",
-			"-o", "jsonpath={.spec.template.spec.containers[0].image}")
+	err = hv.AddNetworkHost("default", n.NewHost(hn, index))
+	Expect(err).To(Not(HaveOccurred()))
+
+	// The node will be (re)provisioned with new host keys, a new journal and a new console
+	err = sshPool.Forget(hn)
+	Expect(err).To(Not(HaveOccurred()))
+	err = journals.Forget(hn)
+	Expect(err).To(Not(HaveOccurred()))
+	consoles.Forget(hn)
+	err = timelines.Reset(hn)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+/*
+Delete a MachineInventory of the cluster namespace
+  - @param name Name of the MachineInventory, nothing is done if it does not exist
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func DeleteMachineInventory(name string) {
+	err := Elemental().MachineInventories(clusterNS).Delete(name)
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+/*
+Create the SSH key of the run
+  - @remarks Host keys recorded by a previous run are forgotten, as the nodes will be provisioned again
+  - @returns Public key to add in the MachineRegistration, the function will fail through Ginkgo in case of issue
+*/
+func NewRunKey() string {
+	signer, err := sshpool.NewKey(filepath.Join(suiteConfig.SSHDir, sshpool.KeyFileName))
+	Expect(err).To(Not(HaveOccurred()))
+
+	err = sshPool.HostKeys.Reset()
+	Expect(err).To(Not(HaveOccurred()))
+
+	sshPool.SetSigner(signer)
+
+	return sshpool.AuthorizedKey(signer)
+}
+
+/*
+(Re)start the default network with its initial configuration
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func StartDefaultNetwork() {
+	n, err := network.Load(netDefaultFileName)
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Only the PXE definition boots nodes from the network, not the airgap one
+	if n.BootFile() != "" {
+		n.SetIPXEBoot(httpSrv)
+	}
+
+	// Both calls wait for the real state of the network, no need to sleep
+	err = hv.DestroyNetwork(n.Name())
+	Expect(err).To(Not(HaveOccurred()))
+
+	err = hv.CreateNetwork(n)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+/*
+Get the isolated networks of the run
+  - @remarks Set by ISOLATED_NETWORKS, their subnets follow the one of the default network
+  - @returns The networks, not created
+*/
+func isolatedNetworks() []*network.Network {
+	var nets []*network.Network
+	for i := 1; i <= suiteConfig.IsolatedNetworks; i++ {
+		nets = append(nets, network.NewIsolated(fmt.Sprintf("isolated-%d", i), fmt.Sprintf("virbr-iso%d", i), isolatedSubnet+i))
+	}
+
+	return nets
+}
+
+/*
+Get the names of the isolated networks of the run
+  - @remarks The nodes are attached to all of them, in addition to the default network
+  - @returns The names, empty if ISOLATED_NETWORKS is not set
+*/
+func IsolatedNetworkNames() []string {
+	var names []string
+	for _, n := range isolatedNetworks() {
+		names = append(names, n.Name())
+	}
+
+	return names
+}
+
+/*
+(Re)start the isolated networks of the run
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func StartIsolatedNetworks() {
+	for _, n := range isolatedNetworks() {
+		err := hv.DestroyNetwork(n.Name())
 		Expect(err).To(Not(HaveOccurred()))
 
-		// backupRscSet should be used for newer versions
-		switch {
-		case strings.Contains(rancherVersion, ":v2.14"):
-			backupRestoreVersion = "v10.0.0-rc.1"
-			backupRscSet = "rancher-resource-set-full"
-		case strings.Contains(rancherVersion, ":v2.13"):
-			backupRestoreVersion = "v9.0.1"
-			backupRscSet = "rancher-resource-set-full"
-		case strings.Contains(rancherVersion, ":v2.12"):
-			backupRestoreVersion = "v8.1.1"
-			backupRscSet = "rancher-resource-set-full"
-		case strings.Contains(rancherVersion, ":v2.11"):
-			backupRestoreVersion = "v7.0.4"
-		case strings.Contains(rancherVersion, ":v2.10"):
-			backupRestoreVersion = "v6.0.2"
-		case strings.Contains(rancherVersion, ":v2.9"):
-			backupRestoreVersion = "v5.0.4"
-		case strings.Contains(rancherVersion, ":v2.8"):
-			backupRestoreVersion = "v4.0.4"
-		}
+		err = hv.CreateNetwork(n)
+		Expect(err).To(Not(HaveOccurred()))
 	}
-	chartRepo = "https://github.com/rancher/backup-restore-operator/releases/download/" + backupRestoreVersion
-	err := tools.Sed("%RSC_SET%", backupRscSet, backupYaml)
+}
+
+/*
+Check that the local HTTP server still runs
+  - @remarks It runs in the background, so its failure is reported to the next spec needing it
+  - @returns Nothing, the function will fail through Ginkgo if the server stopped
+*/
+func CheckBootServer() {
+	select {
+	case <-bootServerStopped:
+		Fail(fmt.Sprintf("Boot server on %s stopped: %v", httpSrv, bootServerErr))
+	default:
+	}
+}
+
+/*
+Generate the iPXE scripts of the nodes and serve them with the boot artifacts
+  - @remarks Boot artifacts are extracted from the ISO, as for install-vm only one is expected
+  - @param nodes Nodes booting from the network, each one gets its own script
+  - @returns The configuration of the scripts, the function will fail through Ginkgo in case of issue
+*/
+func ConfigureiPXE(nodes *fleet.Fleet) network.IPXEConfig {
+	CheckBootServer()
+
+	isos, err := filepath.Glob("../../elemental-*.iso")
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(isos).To(HaveLen(1))
+
+	artifacts, err := network.ExtractBootArtifacts(isos[0], "../..")
+	Expect(err).To(Not(HaveOccurred()))
+
+	cfg := network.IPXEConfig{
+		BaseURL:   httpSrv,
+		Artifacts: artifacts,
+		Cmdline:   network.KernelCmdline(selinux),
+		ConfigURL: httpSrv + "/" + filepath.Base(installConfigYaml),
+	}
+	for _, name := range []string{artifacts.Kernel, artifacts.Initrd, artifacts.Rootfs} {
+		bootServer.Register(name, "../../"+name)
+	}
+	// Link created by install-vm, to the binary of the architecture
+	bootServer.Register(network.EFIBinary, "../../"+network.EFIBinary)
+	bootServer.Register(filepath.Base(installConfigYaml), installConfigYaml)
+	// NOTE: no channel JSON is registered, the OS channel of the specs is a custom one pulled from an image
+
+	var list []network.IPXENode
+	for _, n := range nodes.Nodes {
+		list = append(list, network.IPXENode{Name: n.Hostname, MAC: n.MAC})
+	}
+	scripts, err := cfg.Render(list)
+	Expect(err).To(Not(HaveOccurred()))
+	for name, script := range scripts {
+		bootServer.RegisterData(name, []byte(script))
+	}
+
+	// Kept for debugging, the served scripts are in memory
+	err = network.WriteScripts(filepath.Join(suiteConfig.ArtifactsDir, "ipxe"), scripts)
 	Expect(err).To(Not(HaveOccurred()))
 
+	return cfg
+}
+
+/*
+Get rancher-backup operator version and resource set to use
+  - @remarks The pinned version is read from the configuration, not from the version resolved by a previous install
+  - @returns Operator version and resource set name
+*/
+func GetBackupConfig() (string, string) {
+	version := suiteConfig.BackupRestoreVersion
+	rscSet := "rancher-resource-set" // Default resource set
+
+	// Use specific operator version if defined
+	if version != "" {
+		return version, rscSet
+	}
+
+	// Autodetect operator version based on Rancher Manager version
+	rancherVersion, err := kubectl.RunWithoutErr("get", "deploy", "rancher",
+		"--namespace", "cattle-system",
+		"-o", "jsonpath={.spec.template.spec.containers[0].image}")
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Full resource set should be used for newer versions
+	switch {
+	case strings.Contains(rancherVersion, ":v2.14"):
+		version = "v10.0.0-rc.1"
+		rscSet = "rancher-resource-set-full"
+	case strings.Contains(rancherVersion, ":v2.13"):
+		version = "v9.0.1"
+		rscSet = "rancher-resource-set-full"
+	case strings.Contains(rancherVersion, ":v2.12"):
+		version = "v8.1.1"
+		rscSet = "rancher-resource-set-full"
+	case strings.Contains(rancherVersion, ":v2.11"):
+		version = "v7.0.4"
+	case strings.Contains(rancherVersion, ":v2.10"):
+		version = "v6.0.2"
+	case strings.Contains(rancherVersion, ":v2.9"):
+		version = "v5.0.4"
+	case strings.Contains(rancherVersion, ":v2.8"):
+		version = "v4.0.4"
+	}
+
+	return version, rscSet
+}
+
+/*
+Render the backup resource
+  - @remarks The resource set is the one resolved when the operator was installed
+  - @returns Path of the rendered manifest, the function will fail through Ginkgo in case of issue
+*/
+func RenderBackup() string {
+	if backupResourceSet == "" {
+		_, backupResourceSet = GetBackupConfig()
+	}
+
+	return RenderManifest(backupYaml, "backup", render.Values{"RSC_SET": backupResourceSet})
+}
+
+/*
+Install rancher-backup operator
+  - @param k kubectl structure
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func InstallBackupOperator(k *kubectl.Kubectl) {
+	backupRestoreVersion, backupResourceSet = GetBackupConfig()
+	chartRepo := "https://github.com/rancher/backup-restore-operator/releases/download/" + backupRestoreVersion
+
 	// Log some debugging informations
 	GinkgoWriter.Printf("Install Backup/Restore operator version %s\n", backupRestoreVersion)
 	GinkgoWriter.Printf("Using chart repository %s\n", chartRepo)
-	GinkgoWriter.Printf("Using Resource Set %s\n", backupRscSet)
+	GinkgoWriter.Printf("Using Resource Set %s\n", backupResourceSet)
 
 	for _, chart := range []string{"rancher-backup-crd", "rancher-backup"} {
 		// Set the filename in chart if a custom version is defined
@@ -361,9 +735,9 @@ func InstallBackupOperator(k *kubectl.Kubectl) {
 
 		RunHelmCmdWithRetry(flags...)
 
-		Eventually(func() error {
+		EventuallyWith(retry.WorkloadReady, "rancher-backup pods", func() error {
 			return rancher.CheckPod(k, [][]string{{"cattle-resources-system", "app.kubernetes.io/name=rancher-backup"}})
-		}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+		}).Should(Not(HaveOccurred()))
 	}
 }
 
@@ -396,9 +770,9 @@ func InstallCertManager(k *kubectl.Kubectl) {
 		{"cert-manager", "app.kubernetes.io/component=webhook"},
 		{"cert-manager", "app.kubernetes.io/component=cainjector"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "cert-manager pods", func() error {
 		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -427,9 +801,9 @@ func InstallElementalOperator(k *kubectl.Kubectl, order []string, repo string) {
 	}
 
 	// Wait for pod to be started
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "elemental-operator pods", func() error {
 		return rancher.CheckPod(k, [][]string{{"cattle-elemental-system", "app=elemental-operator"}})
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -445,9 +819,9 @@ func InstallLocalStorage(k *kubectl.Kubectl) {
 	checkList := [][]string{
 		{localPathNS, "app=local-path-provisioner"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady.WithTimeout(2*time.Minute), "local-path-provisioner pods", func() error {
 		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(2*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -457,9 +831,9 @@ Install K3s
 func InstallK3s() {
 	// Get K3s installation script
 	fileName := "k3s-install.sh"
-	Eventually(func() error {
+	EventuallyWith(retry.Download, "download of K3s script", func() error {
 		return tools.GetFileFromURL("https://get.k3s.io", fileName, true)
-	}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+	}).ShouldNot(HaveOccurred())
 
 	// Set command and arguments
 	installCmd := exec.Command("sh", fileName)
@@ -467,13 +841,13 @@ func InstallK3s() {
 
 	// Retry in case of (sporadic) failure...
 	count := 1
-	Eventually(func() error {
+	EventuallyWith(retry.HelmInstall.WithInterval(5*time.Second), "K3s installation", func() error {
 		// Execute K3s installation
 		out, err := installCmd.CombinedOutput()
 		GinkgoWriter.Printf("K3s installation loop %d:\n%s\n", count, out)
 		count++
 		return err
-	}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -482,9 +856,9 @@ Install Rancher Manager
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func InstallRancher(k *kubectl.Kubectl) {
-	Eventually(func() error {
+	EventuallyWith(retry.HelmInstall.WithTimeout(5*time.Minute).WithInterval(time.Minute), "Rancher Manager deployment", func() error {
 		return rancher.DeployRancherManager(rancherHostname, rancherChannel, rancherVersion, rancherHeadVersion, caType, proxy)
-	}, tools.SetTimeout(5*time.Minute), 1*time.Minute).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 
 	checkList := [][]string{
 		{"cattle-system", "app=rancher"},
@@ -492,9 +866,9 @@ func InstallRancher(k *kubectl.Kubectl) {
 		{"cattle-fleet-local-system", "app=fleet-agent"},
 		{"cattle-provisioning-capi-system", "control-plane=controller-manager"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady.WithTimeout(10*time.Minute), "Rancher Manager pods", func() error {
 		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(10*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -504,19 +878,58 @@ Install RKE2
 func InstallRKE2() {
 	// Get RKE2 installation script
 	fileName := "rke2-install.sh"
-	Eventually(func() error {
+	EventuallyWith(retry.Download, "download of RKE2 script", func() error {
 		return tools.GetFileFromURL("https://get.rke2.io", fileName, true)
-	}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+	}).ShouldNot(HaveOccurred())
 
 	// Retry in case of (sporadic) failure...
 	count := 1
-	Eventually(func() error {
+	EventuallyWith(retry.HelmInstall.WithInterval(5*time.Second), "RKE2 installation", func() error {
 		// Execute RKE2 installation
 		out, err := exec.Command("sudo", "--preserve-env=INSTALL_RKE2_VERSION", "sh", fileName).CombinedOutput()
 		GinkgoWriter.Printf("RKE2 installation loop %d:\n%s\n", count, out)
 		count++
 		return err
-	}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
+}
+
+/*
+Render the Cluster resource
+  - @param cn Cluster resource name
+  - @returns Path of the rendered manifest, the function will fail through Ginkgo in case of issue
+*/
+func RenderCluster(cn string) string {
+	return RenderManifest(clusterYaml, "cluster-"+cn, render.Values{
+		"CLUSTER_NAME": cn,
+		"K8S_VERSION":  k8sDownstreamVersion,
+		"SELINUX":      strconv.FormatBool(selinux),
+	})
+}
+
+/*
+Render a manifest from the assets
+  - @param src Template to render
+  - @param name Name of the rendered file, without extension
+  - @param values Values to use in the template
+  - @returns Path of the rendered file, the function will fail through Ginkgo in case of issue
+*/
+func RenderManifest(src, name string, values render.Values) string {
+	file, err := manifests.Render(src, name, values)
+	Expect(err).To(Not(HaveOccurred()))
+
+	return file
+}
+
+/*
+Poll a function with a retry policy
+  - @remarks Attempts are recorded and the retried operations added to the spec report
+  - @param p Policy to apply
+  - @param op Name of the operation, used in the report
+  - @param fn Function to poll, any signature accepted by Eventually
+  - @returns The assertion, to be used as with Eventually
+*/
+func EventuallyWith(p retry.Policy, op string, fn any) AsyncAssertion {
+	return Eventually(retries.Wrap(op, p, fn), p.Scaled(), p.Interval)
 }
 
 /*
@@ -525,9 +938,9 @@ Execute RunHelmBinaryWithCustomErr within a loop with timeout
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func RunHelmCmdWithRetry(s ...string) {
-	Eventually(func() error {
+	EventuallyWith(retry.HelmInstall, "helm "+strings.Join(s[:min(len(s), 3)], " "), func() error {
 		return kubectl.RunHelmBinaryWithCustomErr(s...)
-	}, tools.SetTimeout(2*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -536,18 +949,185 @@ Execute SSH command with retry
   - @param cmd Command to execute
   - @returns result of the executed command
 */
-func RunSSHWithRetry(cl *tools.Client, cmd string) string {
+func RunSSHWithRetry(cl *sshpool.Client, cmd string) string {
 	var err error
 	var out string
 
-	Eventually(func() error {
+	EventuallyWith(retry.SSHCommand, "SSH command on "+cl.Host, func() error {
 		out, err = cl.RunSSH(cmd)
 		return err
-	}, tools.SetTimeout(2*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 
 	return out
 }
 
+/*
+Record that a node reached a phase of its provisioning
+  - @remarks Only the first time is kept, so this can be called each time the phase is seen
+  - @param hn Node hostname
+  - @param p Phase reached
+  - @param source Source of the information
+  - @param detail What was seen, can be empty
+  - @returns Nothing, an error is only logged as the timeline is informative
+*/
+func MarkPhase(hn string, p timeline.Phase, source, detail string) {
+	if err := timelines.Mark(hn, timeline.Event{Phase: p, Source: source, Detail: detail}); err != nil {
+		GinkgoWriter.Printf("Cannot save the timeline of %s: %v\n", hn, err)
+	}
+}
+
+/*
+Get the network configuration of a node from its IP address
+  - @param ip IP address of the node
+  - @returns The node entry of the default network and true if found
+*/
+func hostByIP(ip string) (network.Host, bool) {
+	n, err := hv.Network("default")
+	if err != nil {
+		return network.Host{}, false
+	}
+	for _, h := range n.Hosts() {
+		if h.IP == ip {
+			return h, true
+		}
+	}
+
+	return network.Host{}, false
+}
+
+/*
+Get the name of a node from its IP address
+  - @param ip IP address of the node
+  - @returns Hostname of the node, empty if unknown
+*/
+func nodeByIP(ip string) string {
+	h, _ := hostByIP(ip)
+
+	return h.Name
+}
+
+/*
+Get the OS state of a node
+  - @param cl Client of the node
+  - @returns The state, the function will fail through Ginkgo in case of issue
+*/
+func ProbeNode(cl *sshpool.Client) *probe.State {
+	var state *probe.State
+
+	EventuallyWith(retry.SSHCommand, "probe of "+cl.Host, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+		defer cancel()
+
+		var err error
+		state, err = probe.Get(ctx, cl)
+		return err
+	}).Should(Not(HaveOccurred()))
+
+	if state.BootMode == probe.BootActive {
+		MarkPhase(cl.Name, timeline.PhaseActiveBoot, timeline.SourceSSH, "probe")
+	}
+
+	return state
+}
+
+/*
+Get the snapshots of a node
+  - @param cl Client of the node
+  - @param snapshotter Snapshotter used by the node
+  - @returns The snapshots, the function will fail through Ginkgo in case of issue
+*/
+func GetSnapshots(cl *sshpool.Client, snapshotter string) *snapshot.Inventory {
+	var inv *snapshot.Inventory
+
+	EventuallyWith(retry.SSHCommand, "snapshots of "+cl.Host, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+		defer cancel()
+
+		var err error
+		inv, err = snapshot.Get(ctx, cl, snapshotter)
+		return err
+	}).Should(Not(HaveOccurred()))
+
+	return inv
+}
+
+/*
+Boot a node with a Grub entry and check it
+  - @remarks The entry is only used for this boot, the node boots the default entry after
+  - @param cl Client of the node
+  - @param e Entry to boot
+  - @param active State of the node booted with the active entry, used to check the mounted image
+  - @returns The state of the node once booted, the function will fail through Ginkgo in case of issue
+*/
+func BootEntry(cl *sshpool.Client, e bootentry.Entry, active *probe.State) *probe.State {
+	before := ProbeNode(cl)
+
+	EventuallyWith(retry.SSHCommand, "selection of "+string(e)+" entry on "+cl.Host, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+		defer cancel()
+
+		return bootentry.SetNext(ctx, cl, e)
+	}).Should(Not(HaveOccurred()))
+
+	// Execute 'reboot' in background, to avoid SSH locking
+	_ = RunSSHWithRetry(cl, "setsid -f reboot")
+
+	// The node can still be reached for a short time before rebooting, so wait for a new boot
+	var state *probe.State
+	EventuallyWith(retry.NodeBoot, string(e)+" boot of "+cl.Host, func() (probe.BootMode, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+		defer cancel()
+
+		var err error
+		if state, err = probe.Get(ctx, cl); err != nil {
+			return probe.BootUnknown, err
+		}
+		if state.BootID == before.BootID {
+			return probe.BootUnknown, errors.New("not rebooted yet")
+		}
+		return state.BootMode, nil
+	}).Should(Equal(e.Mode()))
+
+	Expect(bootentry.Verify(e, active, state)).To(Succeed())
+
+	return state
+}
+
+/*
+Get the identity given by the operator to a node
+  - @param hn Node hostname
+  - @param ip IP used by the node to register
+  - @returns The identity and true if the node is registered, the function will fail through Ginkgo in case of issue
+*/
+func GetIdentity(hn, ip string) (tpmid.Identity, bool) {
+	var machines []elemental.MachineInventory
+
+	EventuallyWith(retry.APIRead, "MachineInventories in "+clusterNS, func() error {
+		var err error
+		machines, err = Elemental().MachineInventories(clusterNS).List("")
+		return err
+	}).Should(Not(HaveOccurred()))
+
+	return tpmid.Find(hn, tpmid.ModeOf(emulateTPM), ip, machines)
+}
+
+/*
+Register a node again
+  - @remarks elemental-register is run with the configuration kept by the node at installation
+  - @param cl Client of the node
+  - @returns Nothing or an error with the end of the registration log
+*/
+func ReRegister(cl *sshpool.Client) error {
+	// The unit remains active after a run, so a restart is needed to run it again
+	out, err := cl.RunSSH("systemctl restart elemental-register.service")
+	if err != nil {
+		log, _ := cl.RunSSH("journalctl --no-pager -n 30 -u elemental-register.service")
+		return fmt.Errorf("registration of %s failed: %w: %s%s", cl.ID(), err, out, log)
+	}
+
+	return nil
+}
+
 /*
 Start K3s
   - @returns Nothing, the function will fail through Ginkgo in case of issue
@@ -582,126 +1162,91 @@ func StartRKE2() {
 	Expect(err).To(Not(HaveOccurred()))
 }
 
+/*
+Restart rancher-system-agent on nodes where the plan failed
+  - @remarks Sometimes it can fail just because of a sporadic/timeout issue and a restart can fix it!
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name, the nodes of the other clusters are not touched
+  - @returns Nothing
+*/
+func restartFailedAgents(ns, cn string) {
+	// Extract the list of failed nodes
+	machines, _ := diag.ListMachines(Elemental(), ns, cn)
+
+	for _, m := range machines {
+		if m.HasMessage(diag.PlanErrorMessage) && tools.IsIPv4(m.InternalIP) {
+			// Only the IP is known, the host key is checked if already recorded
+			cl := sshPool.Client("", m.InternalIP+":22")
+
+			// Log the workaround, could be useful
+			GinkgoWriter.Printf("!! rancher-system-agent issue !! Service has been restarted on node with IP %s\n", m.InternalIP)
+
+			// Restart rancher-system-agent service on the node
+			// NOTE: wait a little to be sure that all is restarted before continuing
+			RunSSHWithRetry(cl, "systemctl restart rancher-system-agent.service")
+			time.Sleep(tools.SetTimeout(15 * time.Second))
+		}
+	}
+}
+
 /*
 Wait for cluster to be in a stable state
+  - @remarks All the expected conditions are watched together, the timeline of the transitions is added to the report
   - @param ns Namespace where the cluster is deployed
   - @param cn Cluster resource name
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func WaitCluster(ns, cn string) {
-	type state struct {
-		conditionStatus string
-		conditionType   string
-	}
+	waiter := &cluster.Waiter{
+		Client:    Kube(),
+		Namespace: ns,
+		Name:      cn,
+		Expected:  cluster.DefaultExpectations,
+		Timeout:   retry.ClusterConverge.For(usedNodes).Scaled(),
+		OnResync: func(c *cluster.Cluster, unmet []cluster.Expectation) {
+			// Called from the goroutine of the waiter
+			defer GinkgoRecover()
+
+			restart := false
+			for _, e := range unmet {
+				// Show the status in case of issue, easier to debug
+				GinkgoWriter.Printf("!! Cluster status issue !! %s is not %s\n", e.Type, e.Status)
 
-	// List of conditions to check
-	states := []state{
-		{
-			conditionStatus: "True",
-			conditionType:   "Connected",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Created",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "NoDiskPressure",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "NoMemoryPressure",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Provisioned",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Ready",
-		},
-		{
-			conditionStatus: "False",
-			conditionType:   "Reconciling",
-		},
-		{
-			conditionStatus: "False",
-			conditionType:   "Stalled",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Updated",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Waiting",
+				// Check if rancher-system-agent.service has some issue
+				if e.Type == "Provisioned" || e.Type == "Ready" || e.Type == "Updated" {
+					restart = true
+				}
+			}
+
+			if restart {
+				restartFailedAgents(ns, cn)
+			}
 		},
 	}
 
-	// Check that the cluster is in Ready state (this means that it has been created)
-	Eventually(func() string {
-		status, _ := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io",
-			"--namespace", ns, cn,
-			"-o", "jsonpath={.status.ready}")
-		return status
-	}, tools.SetTimeout(2*time.Duration(usedNodes)*time.Minute), 10*time.Second).Should(Equal("true"))
-
-	// Check that all needed conditions are in the good state
-	for _, s := range states {
-		counter := 0
-
-		Eventually(func() string {
-			status, _ := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io",
-				"--namespace", ns, cn,
-				"-o", "jsonpath={.status.conditions[?(@.type==\""+s.conditionType+"\")].status}")
-
-			if status != s.conditionStatus {
-				// Show the status in case of issue, easier to debug (but log after 10 different issues)
-				// NOTE: it's not perfect but it's mainly a way to inform that the cluster took time to came up
-				counter++
-				if counter > 10 {
-					GinkgoWriter.Printf("!! Cluster status issue !! %s is %s instead of %s\n",
-						s.conditionType, status, s.conditionStatus)
-
-					// Reset counter
-					counter = 0
-				}
+	timeline, err := waiter.Wait(context.Background())
 
-				// Check if rancher-system-agent.service has some issue
-				if s.conditionType == "Provisioned" || s.conditionType == "Ready" || s.conditionType == "Updated" {
-					msg := "error applying plan -- check rancher-system-agent.service logs on node for more information"
-
-					// Extract the list of failed nodes
-					listIP, _ := kubectl.RunWithoutErr("get", "machine",
-						"--namespace", ns,
-						"-o", "jsonpath={.items[?(@.status.conditions[*].message==\""+msg+"\")].status.addresses[?(@.type==\"InternalIP\")].address}")
-
-					// We can try to restart the rancher-system-agent service on the failing node
-					// because sometimes it can fail just because of a sporadic/timeout issue and a restart can fix it!
-					for _, ip := range strings.Fields(listIP) {
-						if tools.IsIPv4(ip) {
-							// Set 'client' to be able to access the node through SSH
-							cl := &tools.Client{
-								Host:     ip + ":22",
-								Username: userName,
-								Password: userPassword,
-							}
-
-							// Log the workaround, could be useful
-							GinkgoWriter.Printf("!! rancher-system-agent issue !! Service has been restarted on node with IP %s\n", ip)
-
-							// Restart rancher-system-agent service on the node
-							// NOTE: wait a little to be sure that all is restarted before continuing
-							RunSSHWithRetry(cl, "systemctl restart rancher-system-agent.service")
-							time.Sleep(tools.SetTimeout(15 * time.Second))
-						}
-					}
-				}
-			}
+	// Keep the timeline, even (and mostly!) in case of failure
+	AddReportEntry("Cluster "+ns+"/"+cn+" timeline", timeline.String())
+	if _, werr := timeline.WriteFile(suiteConfig.ArtifactsDir, "cluster-"+cn+"-timeline.log"); werr != nil {
+		GinkgoWriter.Printf("Cannot write cluster timeline: %v\n", werr)
+	}
 
-			return status
-		}, tools.SetTimeout(2*time.Duration(usedNodes)*time.Minute), 10*time.Second).Should(Equal(s.conditionStatus))
+	// Gather as much information as possible before failing
+	if err != nil {
+		collector := &diag.Collector{
+			Dir:  suiteConfig.ArtifactsDir,
+			Kube: Kube(),
+			SSH:  sshPool,
+		}
+		dir, derr := collector.Collect(ns, cn, err)
+		GinkgoWriter.Printf("Diagnostics bundle available in %s\n", dir)
+		if derr != nil {
+			GinkgoWriter.Printf("Diagnostics bundle may be incomplete: %v\n", derr)
+		}
 	}
+
+	Expect(err).To(Not(HaveOccurred()))
 }
 
 /*
@@ -711,7 +1256,7 @@ Wait for all pods to be Running/Succeeded in the current K8s cluster
 func WaitForAllPods() {
 	// Log pods list, useful for debugging
 	// wait for some pod to be listed
-	Eventually(func() string {
+	EventuallyWith(retry.WorkloadReady.WithTimeout(20*time.Minute), "pods creation", func() string {
 		podDetails, err := kubectl.RunWithoutErr("get", "pod", "--all-namespaces")
 		pd := strings.TrimSpace(podDetails)
 
@@ -722,7 +1267,7 @@ func WaitForAllPods() {
 		}
 
 		return pd
-	}, tools.SetTimeout(20*time.Minute), 30*time.Second).ShouldNot(BeEmpty())
+	}).ShouldNot(BeEmpty())
 
 	// NOTE: pods from cattle-system NS are removed because, at this stage,
 	// they can contains helm ones which can be seen as Failed when they
@@ -730,7 +1275,7 @@ func WaitForAllPods() {
 	// If this exclusion is not enough, next time we can try something like:
 	// kubectl get pod -A -o json | jq -r '.items[] | select(.metadata.name | test("helm-") | not).status.phase'
 	okStatus := strings.NewReplacer("Running", "", "Succeeded", "", "Completed", "")
-	Eventually(func() string {
+	EventuallyWith(retry.WorkloadReady, "pods running", func() string {
 		podStatus, _ := kubectl.RunWithoutErr("get", "pod", "--all-namespaces",
 			"-o", "jsonpath={.items[?(@.metadata.namespace!=\"cattle-system\")].status.phase}")
 		s := strings.TrimSpace(okStatus.Replace(podStatus))
@@ -739,7 +1284,7 @@ func WaitForAllPods() {
 		GinkgoWriter.Printf("Pods Status: %s\n", s)
 
 		return s
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(BeEmpty())
+	}).Should(BeEmpty())
 }
 
 /*
@@ -755,17 +1300,17 @@ func WaitForK3s(k *kubectl.Kubectl) {
 		{"kube-system", "app.kubernetes.io/name=traefik"},
 		{"kube-system", "svccontroller.k3s.cattle.io/svcname=traefik"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "K3s pods", func() error {
 		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 
 	// Check DaemonSet(s)
 	checkList = [][]string{
 		{"kube-system", "svccontroller.k3s.cattle.io/svcname=traefik"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "K3s daemonsets", func() error {
 		return rancher.CheckDaemonSet(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -782,18 +1327,18 @@ func WaitForRKE2(k *kubectl.Kubectl) {
 		{"kube-system", "k8s-app=kube-dns"},
 		{"kube-system", "app.kubernetes.io/name=rke2-ingress-nginx"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "RKE2 pods", func() error {
 		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 
 	// Check DaemonSet(s)
 	checkList = [][]string{
 		{"kube-system", "k8s-app=canal"},
 		{"kube-system", "app.kubernetes.io/instance=rke2-ingress-nginx"},
 	}
-	Eventually(func() error {
+	EventuallyWith(retry.WorkloadReady, "RKE2 daemonsets", func() error {
 		return rancher.CheckDaemonSet(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	}).Should(Not(HaveOccurred()))
 }
 
 /*
@@ -802,12 +1347,38 @@ Wait for OSVersion to be populated
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func WaitForOSVersion(ns string) {
-	Eventually(func() string {
-		out, _ := kubectl.RunWithoutErr("get", "ManagedOSVersion",
-			"--namespace", ns,
-			"-o", "jsonpath={.items[*].metadata.name}")
-		return out
-	}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(BeEmpty()))
+	EventuallyWith(retry.APIRead.WithTimeout(2*time.Minute), "ManagedOSVersions", func() []string {
+		names, _ := Elemental().ManagedOSVersions(ns).Names("")
+		return names
+	}).Should(Not(BeEmpty()))
+}
+
+/*
+Get the Kubernetes client
+  - @remarks The client is created on first use, as the cluster may not exist when the suite starts
+  - @returns The client, the function will fail through Ginkgo in case of issue
+*/
+func Kube() dynamic.Interface {
+	if kubeClient == nil {
+		c, err := kube.NewDynamicClient()
+		Expect(err).To(Not(HaveOccurred()))
+		kubeClient = c
+	}
+
+	return kubeClient
+}
+
+/*
+Get the client for the Elemental resources
+  - @remarks The client is created on first use, as the cluster may not exist when the suite starts
+  - @returns Pointer to the client, the function will fail through Ginkgo in case of issue
+*/
+func Elemental() *elemental.Client {
+	if elementalClient == nil {
+		elementalClient = elemental.NewClient(Kube())
+	}
+
+	return elementalClient
 }
 
 func FailWithReport(message string, callerSkip ...int) {
@@ -820,138 +1391,70 @@ func TestE2E(t *testing.T) {
 	RunSpecs(t, "Elemental End-To-End Test Suite")
 }
 
-// Use to modify yaml templates
-type YamlPattern struct {
-	key   string
-	value string
-}
-
 var _ = BeforeSuite(func() {
-	backupRestoreVersion = os.Getenv("BACKUP_RESTORE_VERSION")
-	bootTypeString := os.Getenv("BOOT_TYPE")
-	caType = os.Getenv("CA_TYPE")
-	certManagerVersion = os.Getenv("CERT_MANAGER_VERSION")
-	clusterName = os.Getenv("CLUSTER_NAME")
-	clusterNS = os.Getenv("CLUSTER_NS")
-	clusterType = os.Getenv("CLUSTER_TYPE")
-	elementalSupport = os.Getenv("ELEMENTAL_SUPPORT")
-	eTPM := os.Getenv("EMULATE_TPM")
-	forceDowngradeString := os.Getenv("FORCE_DOWNGRADE")
-	index := os.Getenv("VM_INDEX")
-	k8sDownstreamVersion = os.Getenv("K8S_DOWNSTREAM_VERSION")
-	k8sUpstreamVersion = os.Getenv("K8S_UPSTREAM_VERSION")
-	number := os.Getenv("VM_NUMBERS")
-	clusterNumber := os.Getenv("CLUSTER_NUMBER")
-	operatorInstallType = os.Getenv("OPERATOR_INSTALL_TYPE")
-	operatorRepo = os.Getenv("OPERATOR_REPO")
-	operatorUpgrade = os.Getenv("OPERATOR_UPGRADE")
-	os2Test = os.Getenv("OS_TO_TEST")
-	poolType = os.Getenv("POOL")
-	proxy = os.Getenv("PROXY")
-	rancherHostname = os.Getenv("PUBLIC_FQDN")
-	rancherLogCollector = os.Getenv("RANCHER_LOG_COLLECTOR")
-	rancherVersion = os.Getenv("RANCHER_VERSION")
-	rancherUpgrade = os.Getenv("RANCHER_UPGRADE")
-	selinuxString := os.Getenv("SELINUX")
-	seqString := os.Getenv("SEQUENTIAL")
-	snapType = os.Getenv("SNAP_TYPE")
-	testType = os.Getenv("TEST_TYPE")
-	upgradeImage = os.Getenv("UPGRADE_IMAGE")
-	upgradeOSChannel = os.Getenv("UPGRADE_OS_CHANNEL")
-	upgradeType = os.Getenv("UPGRADE_TYPE")
+	var err error
+
+	// Load and validate the configuration before doing anything else
+	suiteConfig, err = config.Load()
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Keep the effective configuration, useful to reproduce a failed run
+	dumpFile, err := suiteConfig.Dump(suiteConfig.ArtifactsDir)
+	Expect(err).To(Not(HaveOccurred()))
+	GinkgoWriter.Printf("Effective configuration saved in %s\n", dumpFile)
+
+	backupRestoreVersion = suiteConfig.BackupRestoreVersion
+	caType = suiteConfig.CAType
+	certManagerVersion = suiteConfig.CertManagerVersion
+	clusterName = suiteConfig.ClusterName
+	clusterNS = suiteConfig.ClusterNS
+	clusterType = suiteConfig.ClusterType
+	elementalSupport = suiteConfig.ElementalSupport
+	emulateTPM = suiteConfig.EmulateTPM
+	forceDowngrade = suiteConfig.ForceDowngrade
+	k8sDownstreamVersion = suiteConfig.K8sDownstreamVersion
+	k8sUpstreamVersion = suiteConfig.K8sUpstreamVersion
+	numberOfClusters = suiteConfig.NumberOfClusters
+	numberOfVMs = suiteConfig.NumberOfVMs
+	operatorInstallType = suiteConfig.OperatorInstallType
+	operatorRepo = suiteConfig.OperatorRepo
+	operatorUpgrade = suiteConfig.OperatorUpgrade
+	os2Test = suiteConfig.OSToTest
+	poolType = suiteConfig.PoolType
+	proxy = suiteConfig.Proxy
+	rancherChannel = suiteConfig.Rancher.Channel
+	rancherHeadVersion = suiteConfig.Rancher.HeadVersion
+	rancherHostname = suiteConfig.RancherHostname
+	rancherLogCollector = suiteConfig.RancherLogCollector
+	rancherUpgradeChannel = suiteConfig.RancherUpgrade.Channel
+	rancherUpgradeHeadVersion = suiteConfig.RancherUpgrade.HeadVersion
+	rancherUpgradeVersion = suiteConfig.RancherUpgrade.Version
+	rancherVersion = suiteConfig.Rancher.Version
+	selinux = suiteConfig.SELinux
+	sequential = suiteConfig.Sequential
+	snapType = suiteConfig.SnapType
+	testType = suiteConfig.TestType
+	upgradeImage = suiteConfig.UpgradeImage
+	upgradeOSChannel = suiteConfig.UpgradeOSChannel
+	upgradeType = suiteConfig.UpgradeType
+	vmIndex = suiteConfig.Index()
 
 	// Define boot type
-	switch bootTypeString {
+	switch suiteConfig.BootType {
 	case "iso":
 		isoBoot = true
 	case "raw":
 		rawBoot = true
 	}
 
-	// Force correct value for emulateTPM
-	switch eTPM {
-	case "true":
-		emulateTPM = true
-	default:
-		emulateTPM = false
-	}
+	// Nodes are libvirt VMs, their serial console is logged with the artifacts
+	libvirt := hypervisor.NewLibvirt(installVMScript)
+	libvirt.ConsoleDir = suiteConfig.ArtifactsDir
+	hv = libvirt
 
-	// Force correct value for forceDowngrade
-	switch forceDowngradeString {
-	case "true":
-		forceDowngrade = true
-	default:
-		forceDowngrade = false
-	}
-
-	// Only if VM_INDEX is set
-	if index != "" {
-		var err error
-		vmIndex, err = strconv.Atoi(index)
-		Expect(err).To(Not(HaveOccurred()))
-
-		// Set default hostname
+	// Set default hostname, only if VM_INDEX is set
+	if suiteConfig.VMIndex != nil {
 		vmName = elemental.SetHostname(vmNameRoot, vmIndex)
-	} else {
-		// Default value for vmIndex
-		vmIndex = 0
-	}
-
-	// Only if VM_NUMBER is set
-	if number != "" {
-		var err error
-		numberOfVMs, err = strconv.Atoi(number)
-		Expect(err).To(Not(HaveOccurred()))
-	} else {
-		// By default set to vmIndex
-		numberOfVMs = vmIndex
-	}
-
-	// Extract Rancher Manager channel/version to upgrade
-	if rancherUpgrade != "" {
-		// Split rancherUpgrade and reset it
-		s := strings.Split(rancherUpgrade, "/")
-
-		// Get needed informations
-		rancherUpgradeChannel = s[0]
-		if len(s) > 1 {
-			rancherUpgradeVersion = s[1]
-		}
-		if len(s) > 2 {
-			rancherUpgradeHeadVersion = s[2]
-		}
-	}
-
-	// Extract Rancher Manager channel/version to install
-	if rancherVersion != "" {
-		// Split rancherVersion and reset it
-		s := strings.Split(rancherVersion, "/")
-		rancherVersion = ""
-
-		// Get needed informations
-		rancherChannel = s[0]
-		if len(s) > 1 {
-			rancherVersion = s[1]
-		}
-		if len(s) > 2 {
-			rancherHeadVersion = s[2]
-		}
-	}
-
-	// Force correct value for selinux
-	switch selinuxString {
-	case "true":
-		selinux = true
-	default:
-		selinux = false
-	}
-
-	// Force correct value for sequential
-	switch seqString {
-	case "true":
-		sequential = true
-	default:
-		sequential = false
 	}
 
 	// Depending of the OS version, the SSH config file could be at different places
@@ -973,12 +1476,6 @@ var _ = BeforeSuite(func() {
 		selectorYaml = "../assets/selector.yaml"
 	case "multi":
 		// Enable multi-cluster support
-		if clusterNumber != "" {
-			var err error
-			numberOfClusters, err = strconv.Atoi(clusterNumber)
-			Expect(err).To(Not(HaveOccurred()))
-		}
-
 		clusterYaml = "../assets/cluster-multi.yaml"
 		netDefaultFileName = "../assets/net-default.xml"
 		registrationYaml = "../assets/machineRegistration-multi.yaml"
@@ -993,12 +1490,61 @@ var _ = BeforeSuite(func() {
 		selectorYaml = "../assets/selector.yaml"
 	}
 
+	// Rendered manifests are stored with the other run artifacts
+	manifests, err = render.New(suiteConfig.ArtifactsDir)
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Nodes are accessed through one SSH connection each, with the key of the run once created
+	sshPool = sshpool.New(userName, userPassword)
+	// Commands and their output are logged with the artifacts, one directory per node
+	sshPool.LogDir = suiteConfig.ArtifactsDir
+	sshPool.HostKeys, err = sshpool.OpenHostKeys(filepath.Join(suiteConfig.SSHDir, sshpool.HostKeysFileName))
+	Expect(err).To(Not(HaveOccurred()))
+	if signer, err := sshpool.LoadKey(filepath.Join(suiteConfig.SSHDir, sshpool.KeyFileName)); err == nil {
+		sshPool.SetSigner(signer)
+	}
+
+	// Journals of the nodes are kept with the artifacts, one directory per node
+	journals = journal.NewCollector(suiteConfig.ArtifactsDir)
+
+	// Provisioning phases of the nodes are kept with the artifacts, one directory per node
+	timelines = timeline.NewTracker(suiteConfig.ArtifactsDir)
+
+	// Consoles are watched to stop waiting for a node that cannot boot, and to follow its boot phases
+	consoles = console.NewMonitor()
+	consoles.Observer = timelines.ConsoleLine
+
 	// Set number of "used" nodes
 	// NOTE: could be the number of added nodes or the number of nodes to use/upgrade
 	usedNodes = (numberOfVMs - vmIndex) + 1
 
-	// Final step: start local HTTP server
-	tools.HTTPShare("../..", ":8000")
+	// Only the files registered by the specs are served, requests are logged with the artifacts
+	bootServer = bootserver.New(hostByIP)
+	if err := os.MkdirAll(suiteConfig.ArtifactsDir, 0755); err == nil {
+		if f, err := os.OpenFile(filepath.Join(suiteConfig.ArtifactsDir, bootserver.LogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			bootServer.Log = f
+		}
+	}
+
+	// Final step: start local HTTP server, recording the nodes booting from it
+	// NOTE: the port is bound here so the suite stops at once if it is not available
+	l, err := net.Listen("tcp", ":8000")
+	Expect(err).To(Not(HaveOccurred()))
+	go func() {
+		defer close(bootServerStopped)
+
+		bootServerErr = http.Serve(l, timelines.Handler(bootServer, nodeByIP))
+		GinkgoWriter.Printf("Boot server stopped: %v\n", bootServerErr)
+	}()
+})
+
+var _ = AfterSuite(func() {
+	if sshPool != nil {
+		sshPool.Close()
+	}
+	if consoles != nil {
+		consoles.Stop()
+	}
 })
 
 var _ = ReportBeforeEach(func(report SpecReport) {
@@ -1006,6 +1552,23 @@ var _ = ReportBeforeEach(func(report SpecReport) {
 	testCaseID = -1
 })
 
+var _ = AfterEach(func() {
+	// The next spec starts following the journals again from where this one stopped
+	if err := journals.Stop(); err != nil {
+		GinkgoWriter.Printf("Cannot save the journals of the nodes: %v\n", err)
+	}
+
+	// Show how the nodes were provisioned
+	if report := timelines.Report(); report != "" {
+		AddReportEntry("Boot timeline", report)
+	}
+
+	// Show which operations were slow or flaky
+	if report := retry.Report(retries.Flush()); report != "" {
+		AddReportEntry("Retried operations", report)
+	}
+})
+
 var _ = ReportAfterEach(func(report SpecReport) {
 	// Add result in Qase if asked
 	Qase(testCaseID, report)
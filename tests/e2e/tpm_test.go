@@ -0,0 +1,198 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootentry"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/tpmid"
+)
+
+// Ordered, as the identities compared across the TPM modes are saved by the first spec
+var _ = Describe("E2E - Checking TPM identities", Label("tpm-identity"), Ordered, func() {
+	// Index of the cloned node, far from the ones of the fleet
+	const cloneIndex = 200
+
+	It("Keep a stable and unique TPM identity for each node", func() {
+		mode := tpmid.ModeOf(emulateTPM)
+		report := &tpmid.Report{}
+		DeferCleanup(func() {
+			AddReportEntry("TPM identities", report.String())
+		})
+
+		nodes := GetFleet()
+		Expect(nodes.Len()).To(BeNumerically(">", 0))
+		ids := make([]tpmid.Identity, nodes.Len())
+
+		By("Checking the TPM hash of each node", func() {
+			for i, n := range nodes.Nodes {
+				id, found := GetIdentity(n.Hostname, n.IP)
+				Expect(found).To(BeTrue(), "no MachineInventory for "+n.Hostname)
+				Expect(report.Add(mode, n.Hostname, "TPM hash", id.Check())).To(Succeed())
+				ids[i] = id
+			}
+		})
+
+		// Done one node at a time, the registrations should not interfere
+		By("Registering each node again", func() {
+			for i, n := range nodes.Nodes {
+				CheckSSH(n.Client)
+				Expect(report.Add(mode, n.Hostname, "registration", ReRegister(n.Client))).To(Succeed())
+
+				id, found := GetIdentity(n.Hostname, n.IP)
+				Expect(found).To(BeTrue(), "no MachineInventory for "+n.Hostname)
+				Expect(report.Add(mode, n.Hostname, "stable identity", tpmid.Stable(ids[i], id))).To(Succeed())
+			}
+		})
+
+		By("Checking that no identity is shared", func() {
+			Expect(report.Add(mode, "all nodes", "unique identities", tpmid.Distinct(ids))).To(Succeed())
+
+			// Kept in the artifacts to be compared with the ones of a run with the other TPM mode
+			_, err := tpmid.Save(filepath.Join(suiteConfig.ArtifactsDir, tpmid.FileName), ids)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		src := nodes.Nodes[0]
+		cloneName := elemental.SetHostname(vmNameRoot, cloneIndex)
+
+		// Kept to check the source once back in its active system
+		active := ProbeNode(src.Client)
+
+		// Set once the clone is registered with its own MachineInventory
+		var cloneInventory string
+
+		By("Cloning "+src.Hostname+" into "+cloneName, func() {
+			AddNode(cloneName, cloneIndex)
+			DeferCleanup(func() {
+				// Not to be adopted by a MachineInventorySelector of the cluster
+				if cloneInventory != "" {
+					DeleteMachineInventory(cloneInventory)
+				}
+				err := hv.RemoveNetworkHost("default", cloneName)
+				Expect(err).To(Not(HaveOccurred()))
+			})
+
+			// The copied disk boots in recovery, where k3s/rke2 and rancher-system-agent never start,
+			// so the clone cannot join the cluster as the original node
+			EventuallyWith(retry.SSHCommand, "selection of recovery entry on "+src.Hostname, func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+				defer cancel()
+
+				return bootentry.SetNext(ctx, src.Client, bootentry.Recovery)
+			}).Should(Not(HaveOccurred()))
+
+			// Disks can only be copied from a shut off node
+			err := hv.Shutdown(src.Hostname)
+			Expect(err).To(Not(HaveOccurred()))
+			ctx, cancel := context.WithTimeout(context.Background(), retry.NodeBoot.Timeout)
+			defer cancel()
+			err = hv.WaitState(ctx, src.Hostname, hypervisor.StateShutOff)
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = hv.Clone(src.Hostname, hypervisor.Domain{Name: cloneName, MAC: getNodeHost(cloneName).MAC})
+			Expect(err).To(Not(HaveOccurred()))
+			DeferCleanup(func() {
+				// The clone may already be stopped
+				_ = hv.Destroy(cloneName)
+				err := hv.Undefine(cloneName)
+				Expect(err).To(Not(HaveOccurred()))
+			})
+
+			for _, hn := range []string{src.Hostname, cloneName} {
+				err = hv.Start(hn)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+
+		clone, _ := GetNodeInfo(cloneName)
+
+		By("Checking that "+cloneName+" is kept out of the cluster", func() {
+			CheckSSH(clone)
+			Expect(ProbeNode(clone).BootMode).To(Equal(bootentry.Recovery.Mode()))
+		})
+
+		By("Booting "+src.Hostname+" back in its active system", func() {
+			// The recovery entry was selected before the copy, the source booted it too
+			CheckSSH(src.Client)
+			_ = BootEntry(src.Client, bootentry.Active, active)
+		})
+
+		By("Checking the registration of "+cloneName, func() {
+			regErr := ReRegister(clone)
+			srcID, found := GetIdentity(src.Hostname, src.IP)
+			Expect(found).To(BeTrue(), "no MachineInventory for "+src.Hostname)
+			cloneID, registered := GetIdentity(cloneName, getNodeHost(cloneName).IP)
+
+			// A rejected clone may have taken over the MachineInventory of the source
+			if registered && cloneID.Inventory != ids[0].Inventory {
+				cloneInventory = cloneID.Inventory
+			}
+
+			var err error
+			if emulateTPM {
+				// The emulated TPM is copied with the disk, the operator must reject it
+				var got *tpmid.Identity
+				if registered {
+					got = &cloneID
+				}
+				err = tpmid.Rejected(ids[0], srcID, got, regErr == nil)
+			} else {
+				// The clone gets its own software TPM, so it is a new machine
+				err = errors.Join(regErr, tpmid.Stable(ids[0], srcID))
+				if !registered {
+					err = errors.Join(err, fmt.Errorf("no MachineInventory for %s", cloneName))
+				} else {
+					err = errors.Join(err, cloneID.Check(), tpmid.Distinct([]tpmid.Identity{ids[0], cloneID}))
+				}
+			}
+			Expect(report.Add(mode, cloneName, "clone of "+src.Hostname, err)).To(Succeed())
+		})
+
+		By("Removing "+cloneName, func() {
+			err := hv.Destroy(cloneName)
+			Expect(err).To(Not(HaveOccurred()))
+
+			if cloneInventory != "" {
+				DeleteMachineInventory(cloneInventory)
+			}
+		})
+
+		By("Checking cluster state", func() {
+			WaitCluster(clusterNS, clusterName)
+		})
+	})
+
+	It("Give different identities to the emulated and software TPMs", func() {
+		all, err := tpmid.Load(filepath.Join(suiteConfig.ArtifactsDir, tpmid.FileName))
+		Expect(err).To(Not(HaveOccurred()))
+
+		// Each run registers the nodes with one TPM mode only
+		if modes := tpmid.Modes(all); len(modes) < 2 {
+			Skip(fmt.Sprintf("only %v TPM identities known, run again with EMULATE_TPM=%t to compare both modes", modes, !emulateTPM))
+		}
+
+		Expect(tpmid.Distinct(all)).To(Succeed())
+	})
+})
@@ -15,128 +15,99 @@ limitations under the License.
 package e2e_test
 
 import (
-	"os/exec"
-	"strings"
-	"sync"
+	"context"
+	"regexp"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
-	"github.com/rancher/elemental/tests/e2e/helpers/misc"
-	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/fleet"
+	"github.com/rancher/elemental/tests/e2e/helpers/hypervisor"
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
 )
 
-var _ = Describe("E2E - Bootstrap node for UI", Label("ui"), func() {
-	var (
-		bootstrappedNodes int
-		wg                sync.WaitGroup
-	)
+// Message logged by systemd at the end of the registration
+var registerFinished = regexp.MustCompile(`(?i)Finished Elemental Register`)
 
+var _ = Describe("E2E - Bootstrap node for UI", Label("ui"), func() {
 	It("Configure libvirt and bootstrap a node", func() {
 		By("Downloading MachineRegistration", func() {
-			tokenURL, err := kubectl.RunWithoutErr("get", "MachineRegistration",
-				"--namespace", clusterNS,
-				"machine-registration", "-o", "jsonpath={.status.registrationURL}")
+			registration, err := Elemental().MachineRegistrations(clusterNS).Get("machine-registration")
 			Expect(err).To(Not(HaveOccurred()))
+			tokenURL := registration.Status.RegistrationURL
 
 			// Get the YAML config file
-			Eventually(func() error {
+			EventuallyWith(retry.Download, "download of registration config", func() error {
 				return tools.GetFileFromURL(tokenURL, installConfigYaml, false)
-			}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+			}).ShouldNot(HaveOccurred())
 		})
 
 		By("Starting default network", func() {
-			// Don't check return code, as the default network could be already removed
-			cmds := []string{"net-destroy", "net-undefine"}
-			for _, c := range cmds {
-				_ = exec.Command("sudo", "virsh", c, "default").Run()
-			}
-
-			err := exec.Command("sudo", "virsh", "net-create", netDefaultFileName).Run()
-			Expect(err).To(Not(HaveOccurred()))
+			StartDefaultNetwork()
 		})
 
-		if !isoBoot && !rawBoot {
-			By("Configuring iPXE boot script for network installation", func() {
-				numberOfFile, err := network.ConfigureiPXE(httpSrv)
-				Expect(err).To(Not(HaveOccurred()))
-				Expect(numberOfFile).To(BeNumerically(">=", 1))
-			})
-		}
+		By("Starting isolated networks", func() {
+			StartIsolatedNetworks()
+		})
 
 		// Loop on node provisionning
 		// NOTE: if numberOfVMs == vmIndex then only one node will be provisionned
-		bootstrappedNodes = 0
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
+		nodes := GetFleet()
+		for _, n := range nodes.Nodes {
 			// Add node in network configuration
-			err := rancher.AddNode(netDefaultFileName, hostName, index)
-			Expect(err).To(Not(HaveOccurred()))
+			AddNode(n.Hostname, n.Index)
+		}
 
-			// Get generated MAC address
-			client, macAdrs := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
-			Expect(macAdrs).To(Not(BeEmpty()))
+		if !isoBoot && !rawBoot {
+			By("Configuring iPXE boot scripts for network installation", func() {
+				ConfigureiPXE(nodes)
+			})
+		}
 
-			wg.Add(1)
-			go func(s, h, m string, i int, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
+		BootNodes(nodes, func(n fleet.Node) {
+			By("Installing node "+n.Hostname, func() {
+				// Execute node deployment in parallel
+				err := hv.Define(hypervisor.Domain{Name: n.Hostname, MAC: n.MAC, Networks: IsolatedNetworkNames()})
+				Expect(err).To(Not(HaveOccurred()))
 
-				By("Installing node "+h, func() {
-					// Execute node deployment in parallel
-					err := exec.Command(s, h, m).Run()
+				if rawBoot {
+					// Report to Qase that we boot from raw image
+					testCaseID = 75
+
+					// The VM will boot first on the recovery partition to create the normal partition
+					// No need to check the recovery process
+					// Only make sure the VM is up and running on the normal partition
+					GinkgoWriter.Printf("Checking ssh on VM %s\n", n.Hostname)
+					CheckSSH(n.Client)
+					GinkgoWriter.Printf("Checking ssh OK on VM %s\n", n.Hostname)
+
+					// Wait for the end of the elemental-register process
+					EventuallyWith(retry.NodeBoot.WithTimeout(4*time.Minute), "registration of "+n.Hostname, func() (bool, error) {
+						ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+						defer cancel()
+						return n.Client.JournalContains(ctx, "elemental-register.service", registerFinished, time.Time{})
+					}).Should(BeTrue())
+
+					// Wait a bit more to be sure the VM is ready and halt it
+					time.Sleep(1 * time.Minute)
+					GinkgoWriter.Printf("Stopping VM %s\n", n.Hostname)
+					err := hv.Destroy(n.Hostname)
 					Expect(err).To(Not(HaveOccurred()))
 
-					if rawBoot {
-						// Report to Qase that we boot from raw image
-						testCaseID = 75
-
-						// The VM will boot first on the recovery partition to create the normal partition
-						// No need to check the recovery process
-						// Only make sure the VM is up and running on the normal partition
-						GinkgoWriter.Printf("Checking ssh on VM %s\n", h)
-						CheckSSH(cl)
-						GinkgoWriter.Printf("Checking ssh OK on VM %s\n", h)
-
-						// Wait for the end of the elemental-register process
-						Eventually(func() error {
-							_, err := cl.RunSSH("(journalctl --no-pager -u elemental-register.service) | grep -Eiq 'Finished Elemental Register'")
-							return err
-						}, tools.SetTimeout(4*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
-
-						// Wait a bit more to be sure the VM is ready and halt it
-						time.Sleep(1 * time.Minute)
-						GinkgoWriter.Printf("Stopping VM %s\n", h)
-						err := exec.Command("sudo", "virsh", "destroy", h).Run()
-						Expect(err).To(Not(HaveOccurred()))
-
-						// Make sure VM status is equal to shut-off
-						Eventually(func() string {
-							out, _ := exec.Command("sudo", "virsh", "domstate", h).Output()
-							return strings.Trim(string(out), "\n\n")
-						}, tools.SetTimeout(5*time.Minute), 5*time.Second).Should(Equal("shut off"))
-					} else {
-						// Report to Qase that we boot from ISO
-						testCaseID = 9
-					}
-
-				})
-			}(installVMScript, hostName, macAdrs, index, client)
-
-			// Wait a bit before starting more nodes to reduce CPU and I/O load
-			bootstrappedNodes = misc.WaitNodesBoot(index, vmIndex, bootstrappedNodes, numberOfNodesMax)
-		}
+					// Make sure VM status is equal to shut-off
+					ctx, cancel := context.WithTimeout(context.Background(), tools.SetTimeout(5*time.Minute))
+					defer cancel()
+					err = hv.WaitState(ctx, n.Hostname, hypervisor.StateShutOff)
+					Expect(err).To(Not(HaveOccurred()))
+				} else {
+					// Report to Qase that we boot from ISO
+					testCaseID = 9
+				}
 
-		// Wait for all parallel jobs
-		wg.Wait()
+			})
+		})
 	})
 
 	It("Add the nodes in Rancher Manager", func() {
@@ -144,54 +115,30 @@ var _ = Describe("E2E - Bootstrap node for UI", Label("ui"), func() {
 		// TODO: Find a better way to check this
 		time.Sleep(5 * time.Minute)
 
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
-			// Get node information
-			client, _ := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
+		nodes := GetFleet()
+		BootNodes(nodes, func(n fleet.Node) {
+			// Restart the node(s)
+			By("Restarting "+n.Hostname+" to add it in the cluster", func() {
+				err := hv.Start(n.Hostname)
+				GinkgoWriter.Printf("Starting VM %s\n", n.Hostname)
+				Expect(err).To(Not(HaveOccurred()))
+			})
 
-			// Execute in parallel
-			wg.Add(1)
-			go func(c, h string, i int, t bool, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
+			By("Checking "+n.Hostname+" SSH connection", func() {
+				CheckSSH(n.Client)
+			})
 
-				// Restart the node(s)
-				By("Restarting "+h+" to add it in the cluster", func() {
-					// Wait a little bit to avoid starting all VMs at the same time
-					misc.RandomSleep(sequential, i)
+			state := ProbeNode(n.Client)
 
-					err := exec.Command("sudo", "virsh", "start", h).Run()
-					GinkgoWriter.Printf("Starting VM %s\n", h)
-					Expect(err).To(Not(HaveOccurred()))
-				})
-
-				By("Checking "+h+" SSH connection", func() {
-					CheckSSH(cl)
-				})
-
-				By("Checking that TPM is correctly configured on "+h, func() {
-					testValue := "-c"
-					if t == true {
-						testValue = "! -e"
-					}
-					_ = RunSSHWithRetry(cl, "[[ "+testValue+" /dev/tpm0 ]]")
-				})
-
-				By("Checking OS version on "+h, func() {
-					out := RunSSHWithRetry(cl, "cat /etc/os-release")
-					GinkgoWriter.Printf("OS Version on %s:\n%s\n", h, out)
-				})
-			}(clusterNS, hostName, index, emulateTPM, client)
-
-			// Wait a bit before starting more nodes to reduce CPU and I/O load
-			bootstrappedNodes = misc.WaitNodesBoot(index, vmIndex, bootstrappedNodes, numberOfNodesMax)
-		}
+			By("Checking that TPM is correctly configured on "+n.Hostname, func() {
+				// There is no TPM device if the TPM is emulated
+				Expect(state.TPM).To(Equal(!emulateTPM))
+			})
 
-		// Wait for all parallel jobs
-		wg.Wait()
+			By("Checking OS version on "+n.Hostname, func() {
+				GinkgoWriter.Printf("OS state on %s:\n%s\n", n.Hostname, state)
+				Expect(state.BootMode).To(Equal(probe.BootActive))
+			})
+		})
 	})
 })
@@ -24,7 +24,9 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 func deleteFinalizers(ns, object, value string) {
@@ -36,12 +38,12 @@ func deleteFinalizers(ns, object, value string) {
 }
 
 func testClusterAvailability(ns, cluster string) {
-	Eventually(func() string {
+	EventuallyWith(retry.APIRead, "cluster "+cluster, func() string {
 		out, _ := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io",
 			"--namespace", ns, cluster,
 			"-o", "jsonpath={.metadata.name}")
 		return out
-	}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(Equal(clusterName))
+	}).Should(Equal(clusterName))
 }
 
 var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator"), func() {
@@ -75,12 +77,11 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 		})
 
 		By("Checking that Elemental resources are gone", func() {
-			Eventually(func() string {
-				out, _ := kubectl.Run("get", "MachineInventorySelectorTemplate",
-					"--namespace", clusterNS,
-					"-o", "jsonpath={.items[*].metadata.name}")
-				return out
-			}, tools.SetTimeout(3*time.Minute), 5*time.Second).Should(ContainSubstring("NotFound"))
+			// The CRD itself is removed, so the kind is not found anymore
+			EventuallyWith(retry.APIRead, "deletion of selector templates", func() bool {
+				_, err := Elemental().MachineInventorySelectorTemplates(clusterNS).Names("")
+				return apierrors.IsNotFound(err)
+			}).Should(BeTrue())
 		})
 
 		// NOTE: the operator cannot be reinstall now because there are still CRDs pending to be removed
@@ -112,11 +113,11 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 			defer GinkgoRecover()
 
 			By("Deleting cluster resource", func() {
-				Eventually(func() error {
+				EventuallyWith(retry.APIRead, "deletion of cluster "+name, func() error {
 					_, err := kubectl.RunWithoutErr("delete", "cluster.v1.provisioning.cattle.io",
 						"--namespace", ns, name)
 					return err
-				}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 			})
 		}(clusterNS, clusterName)
 
@@ -125,19 +126,18 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 			// NOTE: wait a bit for the cluster deletion to be started (it's running in background)
 			time.Sleep(1 * time.Minute)
 
-			machineList, err := kubectl.RunWithoutErr("get", "MachineInventory",
-				"--namespace", clusterNS, "-o", "jsonpath={.items[*].metadata.name}")
+			machineList, err := Elemental().MachineInventories(clusterNS).Names("")
 			Expect(err).To(Not(HaveOccurred()))
 
-			for _, machine := range strings.Fields(machineList) {
+			for _, machine := range machineList {
 				var internalMachine string
 
 				// Sporadic timeouts can occur sometimes
-				Eventually(func() error {
+				EventuallyWith(retry.APIRead, "internal machine of "+machine, func() error {
 					var err error
-					internalMachine, err = elemental.GetInternalMachine(clusterNS, machine)
+					internalMachine, err = Elemental().GetInternalMachine(clusterNS, machine)
 					return err
-				}, tools.SetTimeout(1*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+				}).Should(Not(HaveOccurred()))
 
 				// Delete blocking Finalizers
 				GinkgoWriter.Printf("Deleting Finalizers for MachineInventory '%s'...\n", machine)
@@ -152,15 +152,14 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 
 			// On older versions managedOSVersions CRD might be already gone at this stage
 			// ignore error if the managedOSVersion type is unknown
-			mOSList, err := kubectl.RunWithoutErr("get", "ManagedOSVersion",
-				"--namespace", clusterNS, "-o", "jsonpath={.items[*].metadata.name}")
-			if err != nil && strings.Contains(err.Error(), "doesn't have a resource type") {
-				mOSList = ""
+			mOSList, err := Elemental().ManagedOSVersions(clusterNS).Names("")
+			if apierrors.IsNotFound(err) {
+				mOSList = nil
 			} else {
 				Expect(err).ToNot((HaveOccurred()))
 			}
 
-			for _, mOS := range strings.Fields(mOSList) {
+			for _, mOS := range mOSList {
 				// Delete blocking Finalizers
 				GinkgoWriter.Printf("Deleting Finalizers for ManagedOSVersion '%s'...\n", mOS)
 				deleteFinalizers(clusterNS, "ManagedOSVersion", mOS)
@@ -202,9 +201,9 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 			}
 
 			// Wait for pod to be started
-			Eventually(func() error {
+			EventuallyWith(retry.WorkloadReady, "elemental-operator pods", func() error {
 				return rancher.CheckPod(k, [][]string{{"cattle-elemental-system", "app=elemental-operator"}})
-			}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+			}).Should(Not(HaveOccurred()))
 		})
 
 		By("Creating a dumb MachineRegistration", func() {
@@ -213,8 +212,8 @@ var _ = Describe("E2E - Uninstall Elemental Operator", Label("uninstall-operator
 		})
 
 		By("Creating cluster", func() {
-			// NOTE: we can re-use clusterYaml as it has already been configured correctly
-			err := kubectl.Apply(clusterNS, clusterYaml)
+			// NOTE: rendered with the same values as in the configure test
+			err := render.Apply(clusterNS, RenderCluster(clusterName))
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
@@ -15,8 +15,8 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
 	"maps"
-	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -28,21 +28,26 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
-	"gopkg.in/yaml.v3"
+	"github.com/rancher/elemental/tests/e2e/helpers/bootentry"
+	"github.com/rancher/elemental/tests/e2e/helpers/fleet"
+	"github.com/rancher/elemental/tests/e2e/helpers/probe"
+	"github.com/rancher/elemental/tests/e2e/helpers/render"
+	"github.com/rancher/elemental/tests/e2e/helpers/retry"
+	"github.com/rancher/elemental/tests/e2e/helpers/snapshot"
+	"github.com/rancher/elemental/tests/e2e/helpers/sshpool"
 )
 
-func getAnnotations(cl *tools.Client) map[string]string {
-	annotationsStr, err := kubectl.RunWithoutErr(
-		"get", "machineinventory",
-		"--namespace", clusterNS,
-		"-o", "jsonpath={.items[?(@.metadata.annotations.elemental\\.cattle\\.io/registration-ip==\""+strings.Replace(cl.Host, ":22", "", -1)+"\")].metadata.annotations}",
-	)
+func getAnnotations(cl *sshpool.Client) map[string]string {
+	machines, err := Elemental().MachineInventories(clusterNS).List("")
 	Expect(err).To(Not(HaveOccurred()))
 
 	annotations := make(map[string]string)
-	err = yaml.Unmarshal([]byte(annotationsStr), &annotations)
-	Expect(err).To(Not(HaveOccurred()))
+	ip := strings.TrimSuffix(cl.Host, ":22")
+	for _, m := range machines {
+		if m.Annotations["elemental.cattle.io/registration-ip"] == ip {
+			annotations = m.Annotations
+		}
+	}
 
 	// For debugging purposes
 	for a, b := range annotations {
@@ -122,30 +127,30 @@ var _ = Describe("E2E - Upgrading Rancher Manager", Label("upgrade-rancher-manag
 
 		// Wait for Rancher Manager to be restarted
 		// NOTE: 1st or 2nd rollout command can sporadically fail, so better to use Eventually here
-		Eventually(func() string {
+		EventuallyWith(retry.WorkloadReady, "rollout of Rancher Manager", func() string {
 			status, _ := kubectl.RunWithoutErr(
 				"rollout",
 				"--namespace", "cattle-system",
 				"status", "deployment/rancher",
 			)
 			return status
-		}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(ContainSubstring("successfully rolled out"))
+		}).Should(ContainSubstring("successfully rolled out"))
 
 		// Check that all Rancher Manager pods are running
-		Eventually(func() error {
+		EventuallyWith(retry.WorkloadReady, "Rancher Manager pods", func() error {
 			checkList := [][]string{
 				{"cattle-system", "app=rancher"},
 				{"cattle-fleet-local-system", "app=fleet-agent"},
 				{"cattle-system", "app=rancher-webhook"},
 			}
 			return rancher.CheckPod(k, checkList)
-		}, tools.SetTimeout(3*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+		}).Should(Not(HaveOccurred()))
 
 		// Check that all pods are using the same version
-		Eventually(func() int {
+		EventuallyWith(retry.WorkloadReady, "Rancher Manager image", func() int {
 			out, _ := kubectl.RunWithoutErr(getImageVersion...)
 			return len(strings.Fields(out))
-		}, tools.SetTimeout(3*time.Minute), 10*time.Second).Should(Equal(1))
+		}).Should(Equal(1))
 
 		// Get after-upgrade Rancher Manager version
 		// and check that it's different to the before-upgrade version
@@ -164,7 +169,12 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 		annotationsBefore map[string]string
 		value             string
 		valueToCheck      string
-		wg                sync.WaitGroup
+	)
+
+	// Image of each node before the upgrade, expected back after a rollback
+	var (
+		imagesBefore   = map[string]string{}
+		imagesBeforeMu sync.Mutex
 	)
 
 	It("Upgrade node", func() {
@@ -175,36 +185,19 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 			Expect(upgradeType).To(Not(BeEmpty()))
 		})
 
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
-
-			// Get node information
-			client, _ := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
-
-			// Execute checking in parallel
-			wg.Add(1)
-			go func(h string, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
-
-				By("Getting annotations for "+h+" before upgrade", func() {
-					annotationsBefore = getAnnotations(cl)
-				})
-			}(hostName, client)
-		}
+		nodes := GetFleet()
+		nodes.ForEach(0, func(n fleet.Node) {
+			By("Getting annotations for "+n.Hostname+" before upgrade", func() {
+				annotationsBefore = getAnnotations(n.Client)
+			})
 
-		// Wait for all parallel jobs
-		wg.Wait()
+			image := ProbeNode(n.Client).Image
+			imagesBeforeMu.Lock()
+			imagesBefore[n.Hostname] = image
+			imagesBeforeMu.Unlock()
+		})
 
 		By("Triggering Upgrade in Rancher with "+upgradeType, func() {
-			// Set temporary file
-			upgradeTmp, err := tools.CreateTemp("upgrade")
-			Expect(err).To(Not(HaveOccurred()))
-			defer os.Remove(upgradeTmp)
-
 			if upgradeType == "managedOSVersionName" {
 				// Get OSVersion name
 				OSVersion, err := exec.Command(getOSScript, upgradeOSChannel).Output()
@@ -219,25 +212,22 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 					GinkgoWriter.Printf("!! ManagedOSVersionChannel not synced !! Triggering a re-sync!\n")
 
 					// Get current syncInterval
-					syncValue, err := kubectl.RunWithoutErr("get", "managedOSVersionChannel",
-						"--namespace", clusterNS, channel,
-						"-o", "jsonpath={.spec.syncInterval}")
+					osChannel, err := Elemental().ManagedOSVersionChannels(clusterNS).Get(channel)
 					Expect(err).To(Not(HaveOccurred()))
+					syncValue := osChannel.Spec.SyncInterval
 					Expect(syncValue).To(Not(BeEmpty()))
 
 					// Reduce syncInterval to force an update
-					_, err = kubectl.RunWithoutErr("patch", "managedOSVersionChannel",
-						"--namespace", clusterNS, channel,
-						"--type", "merge",
-						"--patch", "{\"spec\":{\"syncInterval\":\"1m\"}}")
+					_, err = Elemental().ManagedOSVersionChannels(clusterNS).Patch(channel,
+						[]byte(`{"spec":{"syncInterval":"1m"}}`))
 					Expect(err).To(Not(HaveOccurred()))
 
 					// Loop until sync is done
-					Eventually(func() string {
+					EventuallyWith(retry.APIRead.WithInterval(30*time.Second), "OS version in "+upgradeOSChannel, func() string {
 						value, _ := exec.Command(getOSScript, upgradeOSChannel).Output()
 
 						return string(value)
-					}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(BeEmpty()))
+					}).Should(Not(BeEmpty()))
 
 					// We should now have an OS version!
 					OSVersion, err = exec.Command(getOSScript, upgradeOSChannel).Output()
@@ -245,10 +235,8 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 					Expect(OSVersion).To(Not(BeEmpty()))
 
 					// Re-patch syncInterval to the initial value
-					_, err = kubectl.RunWithoutErr("patch", "managedOSVersionChannel",
-						"--namespace", clusterNS, channel,
-						"--type", "merge",
-						"--patch", "{\"spec\":{\"syncInterval\":\""+syncValue+"\"}}")
+					_, err = Elemental().ManagedOSVersionChannels(clusterNS).Patch(channel,
+						[]byte(`{"spec":{"syncInterval":"`+syncValue+`"}}`))
 					Expect(err).To(Not(HaveOccurred()))
 				}
 
@@ -256,11 +244,9 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 				value = string(OSVersion)
 
 				// Extract the value to check after the upgrade
-				out, err := kubectl.RunWithoutErr("get", "ManagedOSVersion",
-					"--namespace", clusterNS, value,
-					"-o", "jsonpath={.spec.metadata.upgradeImage}")
+				osVersion, err := Elemental().ManagedOSVersions(clusterNS).Get(value)
 				Expect(err).To(Not(HaveOccurred()))
-				valueToCheck = tools.TrimStringFromChar(strings.Trim(out, "\n"), ":")
+				valueToCheck = tools.TrimStringFromChar(osVersion.Spec.Metadata.UpgradeImage, ":")
 			} else if upgradeType == "osImage" {
 				// Set OS image to use for upgrade
 				value = upgradeImage
@@ -270,132 +256,109 @@ var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
 			}
 
 			// Add a nodeSelector if needed
+			nodeHostname := ""
 			if usedNodes == 1 {
-				// Set node hostname
-				hostName := elemental.SetHostname(vmNameRoot, vmIndex)
-				Expect(hostName).To(Not(BeEmpty()))
-
-				// Get node information
-				client, _ := GetNodeInfo(hostName)
-				Expect(client).To(Not(BeNil()))
-
 				// Get *REAL* hostname
-				hostname := RunSSHWithRetry(client, "hostname")
-				hostname = strings.Trim(hostname, "\n")
-
-				label := "kubernetes.io/hostname"
-				selector, err := elemental.AddSelector(label, hostname)
-				Expect(err).To(Not(HaveOccurred()), selector)
-
-				// Create new file for this specific upgrade
-				err = tools.AddDataToFile(upgradeSkelYaml, upgradeTmp, selector)
-				Expect(err).To(Not(HaveOccurred()))
-			} else {
-				// Use original file as-is
-				err := tools.CopyFile(upgradeSkelYaml, upgradeTmp)
-				Expect(err).To(Not(HaveOccurred()))
-			}
-
-			// Patterns to replace
-			patterns := []YamlPattern{
-				{
-					key:   "with-%UPGRADE_TYPE%",
-					value: strings.ToLower(upgradeType),
-				},
-				{
-					key:   "%UPGRADE_TYPE%",
-					value: upgradeType + ": " + value,
-				},
-				{
-					key:   "%CLUSTER_NAME%",
-					value: clusterName,
-				},
-				{
-					key:   "%FORCE_DOWNGRADE%",
-					value: strconv.FormatBool(forceDowngrade),
-				},
+				hostname := RunSSHWithRetry(nodes.Nodes[0].Client, "hostname")
+				nodeHostname = strings.Trim(hostname, "\n")
 			}
 
 			// Create Yaml file
-			for _, p := range patterns {
-				err := tools.Sed(p.key, p.value, upgradeTmp)
-				Expect(err).To(Not(HaveOccurred()))
-			}
+			upgradeFile := RenderManifest(upgradeSkelYaml, "upgrade-"+strings.ToLower(upgradeType), render.Values{
+				"CLUSTER_NAME":    clusterName,
+				"FORCE_DOWNGRADE": strconv.FormatBool(forceDowngrade),
+				"NODE_HOSTNAME":   nodeHostname,
+				"UPGRADE_TYPE":    upgradeType,
+				"UPGRADE_VALUE":   value,
+			})
 
 			// Apply the generated file
-			err = kubectl.Apply(clusterNS, upgradeTmp)
+			err := render.Apply(clusterNS, upgradeFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		for index := vmIndex; index <= numberOfVMs; index++ {
-			// Set node hostname
-			hostName := elemental.SetHostname(vmNameRoot, index)
-			Expect(hostName).To(Not(BeEmpty()))
+		nodes.ForEach(0, func(n fleet.Node) {
+			By("Checking VM upgrade on "+n.Hostname, func() {
+				EventuallyWith(retry.OSUpgrade, "upgrade of "+n.Hostname, func() string {
+					ctx, cancel := context.WithTimeout(context.Background(), retry.SSHCommand.Interval)
+					defer cancel()
+
+					state, err := probe.Get(ctx, n.Client)
+					if err != nil {
+						return ""
+					}
+
+					// This remove the version and keep only the repo, as in the file
+					// we have the exact version and we don't know it before the upgrade
+					return tools.TrimStringFromChar(state.Image, ":")
+				}).Should(Equal(valueToCheck))
+			})
+
+			By("Checking that annotations have been updated after upgrade", func() {
+				EventuallyWith(retry.OSUpgrade.WithTimeout(5*time.Minute), "annotations of "+n.Hostname, func() bool {
+					annotationsAfter = getAnnotations(n.Client)
+
+					// Maps should not be equal after an upgrade
+					return maps.Equal(annotationsBefore, annotationsAfter)
+				}).Should(BeFalse())
+			})
+		})
 
-			// Get node information
-			client, _ := GetNodeInfo(hostName)
-			Expect(client).To(Not(BeNil()))
+		// Rebooting takes time, so the boot entries can be tested on the first nodes only
+		sample := nodes
+		if suiteConfig.BootEntryNodes > 0 {
+			sample = nodes.First(suiteConfig.BootEntryNodes)
+		}
 
-			// Toggle Grub recovery entry test if only one node is upgraded
-			grubRecovery := false
-			if usedNodes == 1 {
-				grubRecovery = true
-			}
+		// One node at a time, to keep the cluster available
+		nodes.ForEach(1, func(n fleet.Node) {
+			active := ProbeNode(n.Client)
+			Expect(active.BootMode).To(Equal(probe.BootActive))
 
-			// Execute node deployment in parallel
-			wg.Add(1)
-			go func(h string, cl *tools.Client) {
-				defer wg.Done()
-				defer GinkgoRecover()
-
-				By("Checking VM upgrade on "+h, func() {
-					Eventually(func() string {
-						// Use grep here in case of comment in the file!
-						out, _ := cl.RunSSH("eval $(grep -v ^# /etc/os-release) && echo ${IMAGE}")
-
-						// This remove the version and keep only the repo, as in the file
-						// we have the exact version and we don't know it before the upgrade
-						return tools.TrimStringFromChar(strings.Trim(out, "\n"), ":")
-					}, tools.SetTimeout(10*time.Minute), 30*time.Second).Should(Equal(valueToCheck))
-				})
-
-				By("Checking that annotations have been updated after upgrade", func() {
-					Eventually(func() bool {
-						annotationsAfter = getAnnotations(cl)
-
-						// Maps should not be equal after an upgrade
-						return maps.Equal(annotationsBefore, annotationsAfter)
-					}, tools.SetTimeout(5*time.Minute), 30*time.Second).Should(BeFalse())
-				})
-
-				if grubRecovery {
-					By("Testing Grub Recovery entry on "+h+" after upgrade", func() {
-						_ = RunSSHWithRetry(cl, "grub2-editenv /oem/grubenv set next_entry=recovery")
-
-						// Check that the recovery entry is selected
-						out := RunSSHWithRetry(cl, "grub2-editenv /oem/grubenv list | grep next_entry")
-						Expect(out).To(ContainSubstring("recovery"))
-
-						// Reboot in recovery, execute 'reboot' in background, to avoid SSH locking
-						_ = RunSSHWithRetry(cl, "setsid -f reboot")
-
-						// Check the mode after reboot
-						out = RunSSHWithRetry(cl, "cat /run/elemental/recovery_mode")
-						Expect(out).To(Not(BeEmpty()))
-
-						// Final reboot in active (normal) mode
-						_ = RunSSHWithRetry(cl, "setsid -f reboot")
-
-						// Check the mode after final reboot
-						out = RunSSHWithRetry(cl, "cat /run/elemental/active_mode")
-						Expect(out).To(Not(BeEmpty()))
-					})
+			var previous snapshot.Snapshot
+			By("Checking snapshots on "+n.Hostname+" after upgrade", func() {
+				if snapType != "" {
+					Expect(active.Snapshotter).To(Equal(snapType))
 				}
-			}(hostName, client)
-		}
 
-		// Wait for all parallel jobs
-		wg.Wait()
+				inv := GetSnapshots(n.Client, active.Snapshotter)
+				GinkgoWriter.Printf("Snapshots of %s:\n%s", n.Hostname, inv)
+
+				// The snapshot used before the upgrade is kept
+				maxSnaps := suiteConfig.SnapMax
+				if maxSnaps == 0 {
+					maxSnaps = snapshot.DefaultMaxSnaps[active.Snapshotter]
+				}
+				Expect(inv.Check(2, maxSnaps)).To(Succeed())
+
+				current, _ := inv.Active()
+				booted, found := snapshot.Booted(active)
+				Expect(found).To(BeTrue())
+				Expect(booted).To(Equal(current.ID))
+
+				previous, found = inv.Previous()
+				Expect(found).To(BeTrue())
+			})
+
+			By("Rolling back "+n.Hostname+" to the previous snapshot", func() {
+				// The fallback entry boots the previous snapshot, the upgraded one stays the default
+				state := BootEntry(n.Client, bootentry.Passive, active)
+				booted, _ := snapshot.Booted(state)
+				Expect(booted).To(Equal(previous.ID))
+				Expect(state.Image).To(Equal(imagesBefore[n.Hostname]))
+			})
+
+			if _, found := sample.Node(n.Hostname); !found {
+				return
+			}
+
+			By("Testing Grub entries on "+n.Hostname+" after upgrade", func() {
+				for _, e := range []bootentry.Entry{bootentry.Recovery, bootentry.Active} {
+					state := BootEntry(n.Client, e, active)
+					GinkgoWriter.Printf("OS state of %s after %s boot:\n%s\n", n.Hostname, e, state)
+				}
+			})
+		})
 
 		By("Checking cluster state after upgrade", func() {
 			WaitCluster(clusterNS, clusterName)